@@ -0,0 +1,46 @@
+// Hot-key read throughput of a shard with and without READ_CACHE_SIZE
+// Run with: bun bench/read-cache.ts
+
+import { Shard } from '../src/shard.ts'
+import * as fs from 'fs/promises'
+import * as os from 'os'
+import * as path from 'path'
+
+const ITEMS = 10_000
+const HOT_KEYS = 100
+const READS = 200_000
+
+async function run(readCacheSize: number): Promise<number> {
+  const dir = await fs.mkdtemp(path.join(os.tmpdir(), 'dynado-bench-'))
+  const shard = new Shard(
+    path.join(dir, 'shard.db'),
+    0,
+    { mode: 'never' },
+    'serializable',
+    readCacheSize
+  )
+  try {
+    for (let i = 0; i < ITEMS; i++) {
+      await shard.putItem('Bench', `user-${i}`, '', {
+        id: { S: `user-${i}` },
+        name: { S: `User ${i}` },
+        visits: { N: String(i) },
+      })
+    }
+
+    const start = performance.now()
+    for (let i = 0; i < READS; i++) {
+      await shard.getItem('Bench', `user-${i % HOT_KEYS}`, '')
+    }
+    return READS / ((performance.now() - start) / 1000)
+  } finally {
+    shard.close()
+    await fs.rm(dir, { recursive: true })
+  }
+}
+
+const uncached = await run(0)
+const cached = await run(HOT_KEYS)
+console.log(`uncached: ${Math.round(uncached)} reads/s`)
+console.log(`cached:   ${Math.round(cached)} reads/s`)
+console.log(`speedup:  ${(cached / uncached).toFixed(2)}x`)
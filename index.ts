@@ -4,10 +4,15 @@ export { DB } from "./src";
 // Start server if run directly
 if (import.meta.main) {
   const db = new DB();
+  // A bad SEED_FILE fails startup instead of serving a partial baseline
+  await db.ready.catch((error) => {
+    console.error(error);
+    process.exit(1);
+  });
   console.log(
     `DynamoDB-compatible server running at http://localhost:${db.config.port}`
   );
   console.log(
-    `Using sharded SQLite storage with ${db.config.shardCount} shards`
+    `Using sharded SQLite storage with ${db.shardCount} shards`
   );
 }
@@ -0,0 +1,145 @@
+// BackupStore: on-demand backups of a table's schema and items, kept in the
+// data directory until DeleteBackup
+
+import { Database } from 'bun:sqlite'
+import type { DynamoDBItem, TableSchema } from './types.ts'
+import * as fs from 'fs'
+
+export interface BackupInfo {
+  backupArn: string
+  backupName: string
+  tableName: string
+  // The table's schema when the backup was taken
+  schema: TableSchema
+  itemCount: number
+  sizeBytes: number
+  createdAt: number // Milliseconds since epoch
+}
+
+interface BackupRow {
+  backup_arn: string
+  backup_name: string
+  table_name: string
+  table_schema: string
+  item_count: number
+  size_bytes: number
+  created_at: number
+}
+
+export class BackupStore {
+  private db: Database
+
+  constructor(dataDir: string) {
+    if (!fs.existsSync(dataDir)) {
+      fs.mkdirSync(dataDir, { recursive: true })
+    }
+    this.db = new Database(`${dataDir}/backups.db`)
+
+    this.db.run(`
+      CREATE TABLE IF NOT EXISTS backups (
+        backup_arn TEXT PRIMARY KEY,
+        backup_name TEXT NOT NULL,
+        table_name TEXT NOT NULL,
+        table_schema TEXT NOT NULL,
+        item_count INTEGER NOT NULL,
+        size_bytes INTEGER NOT NULL,
+        created_at INTEGER NOT NULL
+      )
+    `)
+    this.db.run(`
+      CREATE TABLE IF NOT EXISTS backup_items (
+        backup_arn TEXT NOT NULL,
+        item_data TEXT NOT NULL
+      )
+    `)
+    this.db.run(`
+      CREATE INDEX IF NOT EXISTS idx_backup_items_arn
+      ON backup_items(backup_arn)
+    `)
+  }
+
+  // Stores the backup and its items in one SQLite transaction, so a crash
+  // never leaves a backup with only some of its items
+  createBackup(backup: BackupInfo, items: DynamoDBItem[]): void {
+    const insertItem = this.db.prepare(
+      'INSERT INTO backup_items (backup_arn, item_data) VALUES (?, ?)'
+    )
+    this.db.transaction(() => {
+      this.db.run(
+        `INSERT INTO backups
+         (backup_arn, backup_name, table_name, table_schema, item_count,
+          size_bytes, created_at)
+         VALUES (?, ?, ?, ?, ?, ?, ?)`,
+        [
+          backup.backupArn,
+          backup.backupName,
+          backup.tableName,
+          JSON.stringify(backup.schema),
+          backup.itemCount,
+          backup.sizeBytes,
+          backup.createdAt,
+        ]
+      )
+      for (const item of items) {
+        insertItem.run(backup.backupArn, JSON.stringify(item))
+      }
+    })()
+  }
+
+  getBackup(backupArn: string): BackupInfo | null {
+    const row = this.db
+      .query<BackupRow, [string]>('SELECT * FROM backups WHERE backup_arn = ?')
+      .get(backupArn)
+    return row ? toBackupInfo(row) : null
+  }
+
+  // Oldest first, as ListBackups returns them; rowid orders backups taken
+  // in the same millisecond
+  listBackups(tableName?: string): BackupInfo[] {
+    const rows = tableName
+      ? this.db
+          .query<BackupRow, [string]>(
+            `SELECT * FROM backups WHERE table_name = ?
+             ORDER BY created_at, rowid`
+          )
+          .all(tableName)
+      : this.db
+          .query<BackupRow, []>(
+            'SELECT * FROM backups ORDER BY created_at, rowid'
+          )
+          .all()
+    return rows.map(toBackupInfo)
+  }
+
+  readItems(backupArn: string): DynamoDBItem[] {
+    return this.db
+      .query<{ item_data: string }, [string]>(
+        'SELECT item_data FROM backup_items WHERE backup_arn = ?'
+      )
+      .all(backupArn)
+      .map((row) => JSON.parse(row.item_data))
+  }
+
+  deleteBackup(backupArn: string): void {
+    this.db.transaction(() => {
+      this.db.run('DELETE FROM backup_items WHERE backup_arn = ?', [backupArn])
+      this.db.run('DELETE FROM backups WHERE backup_arn = ?', [backupArn])
+    })()
+  }
+
+  close() {
+    this.db.close()
+  }
+}
+
+function toBackupInfo(row: BackupRow): BackupInfo {
+  return {
+    backupArn: row.backup_arn,
+    backupName: row.backup_name,
+    tableName: row.table_name,
+    schema: JSON.parse(row.table_schema),
+    itemCount: row.item_count,
+    sizeBytes: row.size_bytes,
+    createdAt: row.created_at,
+  }
+}
@@ -0,0 +1,154 @@
+// ConsumedCapacity reporting for ReturnConsumedCapacity
+
+import type {
+  ConsumedCapacity,
+  ReturnConsumedCapacity,
+} from '@aws-sdk/client-dynamodb'
+import type { TableSchema } from './types.ts'
+import { isGlobalIndex } from './indexes.ts'
+
+const READ_UNIT_BYTES = 4 * 1024
+const WRITE_UNIT_BYTES = 1024
+// Transactions read and write each item twice, to prepare and to commit
+const TRANSACTION_FACTOR = 2
+
+// Capacity units a request spent on one table, and on each of its indexes
+// by index name
+export interface CapacityUsage {
+  table: number
+  indexes: Record<string, number>
+}
+
+/**
+ * Read capacity for reading `bytes` of items: one unit per 4KB, rounded up
+ * over the whole read and never less than one, halved for eventually
+ * consistent reads. A page that continues a paginated read passes the
+ * bytes of the pages before it, and is charged only the units its bytes
+ * add to the running total, so the pages sum to the cost of one read.
+ */
+export function readCapacityUnits(
+  bytes: number,
+  consistentRead: boolean | undefined,
+  bytesBefore: number = 0
+): number {
+  const units =
+    bytesBefore === 0
+      ? Math.max(1, Math.ceil(bytes / READ_UNIT_BYTES))
+      : Math.ceil((bytesBefore + bytes) / READ_UNIT_BYTES) -
+        Math.ceil(bytesBefore / READ_UNIT_BYTES)
+  return consistentRead ? units : units / 2
+}
+
+/**
+ * Write capacity for writing an item of `bytes`: one unit per 1KB, rounded
+ * up and never less than one. A write that replaces an item passes the
+ * larger of the old and new sizes.
+ */
+export function writeCapacityUnits(bytes: number): number {
+  return Math.max(1, Math.ceil(bytes / WRITE_UNIT_BYTES))
+}
+
+// Transactional reads are always consistent, and cost twice that
+export function transactionReadUnits(bytes: number): number {
+  return TRANSACTION_FACTOR * readCapacityUnits(bytes, true)
+}
+
+export function transactionUsage(usage: CapacityUsage): CapacityUsage {
+  return {
+    table: TRANSACTION_FACTOR * usage.table,
+    indexes: Object.fromEntries(
+      Object.entries(usage.indexes).map(([name, units]) => [
+        name,
+        TRANSACTION_FACTOR * units,
+      ])
+    ),
+  }
+}
+
+/**
+ * The ConsumedCapacity for a request that spent `units` on one table, or
+ * on one of its indexes when indexName is set, as a Query or Scan does
+ */
+export function consumedCapacity(
+  mode: ReturnConsumedCapacity | undefined,
+  schema: TableSchema,
+  units: number,
+  indexName?: string
+): ConsumedCapacity | undefined {
+  return reportCapacity(
+    mode,
+    schema,
+    indexName
+      ? { table: 0, indexes: { [indexName]: units } }
+      : { table: units, indexes: {} }
+  )
+}
+
+/**
+ * The ConsumedCapacity for a request's usage of one table. TOTAL reports
+ * only the sum; INDEXES also breaks it down by table and by each index
+ * the request read or wrote, so callers can see where the units went.
+ */
+export function reportCapacity(
+  mode: ReturnConsumedCapacity | undefined,
+  schema: TableSchema,
+  usage: CapacityUsage
+): ConsumedCapacity | undefined {
+  if (mode !== 'TOTAL' && mode !== 'INDEXES') return undefined
+
+  const indexUnits = Object.values(usage.indexes)
+  const capacity: ConsumedCapacity = {
+    TableName: schema.tableName,
+    CapacityUnits: indexUnits.reduce((sum, units) => sum + units, usage.table),
+  }
+  if (mode === 'INDEXES') {
+    capacity.Table = { CapacityUnits: usage.table }
+    for (const [indexName, units] of Object.entries(usage.indexes)) {
+      const key = isGlobalIndex(schema, indexName)
+        ? 'GlobalSecondaryIndexes'
+        : 'LocalSecondaryIndexes'
+      capacity[key] = {
+        ...capacity[key],
+        [indexName]: { CapacityUnits: units },
+      }
+    }
+  }
+  return capacity
+}
+
+/**
+ * Sums the usage of a request that touches several tables, as the batch
+ * and transaction operations do, reporting one ConsumedCapacity per table
+ * in the order the tables were first used
+ */
+export class CapacityTally {
+  private tables = new Map<
+    string,
+    { schema: TableSchema; usage: CapacityUsage }
+  >()
+
+  add(schema: TableSchema, usage: CapacityUsage): void {
+    const tally = this.tables.get(schema.tableName)
+    if (!tally) {
+      this.tables.set(schema.tableName, {
+        schema,
+        usage: { table: usage.table, indexes: { ...usage.indexes } },
+      })
+      return
+    }
+    tally.usage.table += usage.table
+    for (const [indexName, units] of Object.entries(usage.indexes)) {
+      tally.usage.indexes[indexName] =
+        (tally.usage.indexes[indexName] ?? 0) + units
+    }
+  }
+
+  report(
+    mode: ReturnConsumedCapacity | undefined
+  ): ConsumedCapacity[] | undefined {
+    if (mode !== 'TOTAL' && mode !== 'INDEXES') return undefined
+    return [...this.tables.values()].map(
+      ({ schema, usage }) => reportCapacity(mode, schema, usage)!
+    )
+  }
+}
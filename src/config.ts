@@ -1,34 +1,254 @@
 // Configuration for storage backend
 
+// How often shard writes are flushed to disk
+export type FsyncPolicy =
+  | { mode: 'always' }
+  | { mode: 'interval'; intervalMs: number }
+  | { mode: 'never' }
+
+// How transactions interleave. serializable is DynamoDB's documented
+// behaviour: ConditionCheck items are locked like written items, so a
+// transaction conflicts with any other that writes what it read. snapshot
+// only detects write-write conflicts, which allows write skew.
+export type IsolationLevel = 'serializable' | 'snapshot'
+
+// Where StatsD metrics are sent
+export interface StatsdAddr {
+  host: string
+  port: number
+}
+
 export interface Config {
-  shardCount: number
+  // Unset: the count DATA_DIR was written with, or 4 for a new directory
+  shardCount?: number
+  // Rehash stored items when shardCount differs from the on-disk layout
+  reshard: boolean
   dataDir: string
   port: number
+  fsyncPolicy: FsyncPolicy
+  requestTimeoutMs: number
+  maxTables: number
+  maxRequestBodyBytes: number
+  isolationLevel: IsolationLevel
+  // Items each shard keeps in its LRU read cache; 0 disables the cache
+  readCacheSize: number
+  // Items one Query or Scan page may examine; 0 leaves only the 1MB cap
+  maxPageItems: number
+  // How long a GSI added by UpdateTable reports CREATING before it is
+  // readable; 0 makes new indexes ACTIVE immediately
+  indexBackfillMs: number
+  // How often expired TTL items are deleted; 0 disables the sweeper
+  ttlSweepIntervalMs: number
+  // How far back RestoreTableToPointInTime can restore a table with
+  // point-in-time recovery enabled
+  pitrRetentionMs: number
+  // Directory ExportTableToPointInTime writes buckets under and ImportTable
+  // reads them from; unset: <dataDir>/exports
+  exportDir?: string
+  // S3-compatible endpoint exports and imports use instead of exportDir
+  exportS3Endpoint?: string
+  // Regions whose requests are served from their own tables, so global
+  // tables can replicate between them; requests signed for any other region
+  // share the main tables
+  replicaRegions: string[]
+  // How long a write to a global table takes to reach its other replicas
+  replicationLagMs: number
+  // Kinesis-compatible endpoint that tables' Kinesis streaming destinations
+  // are sent to; unset: destinations are tracked but nothing is sent
+  kinesisEndpoint?: string
+  // URL every stream record is POSTed to; unset disables the sink
+  streamWebhookUrl?: string
+  // Attempts to deliver each record to streamWebhookUrl before dropping it
+  streamWebhookMaxAttempts: number
+  // How far behind the latest writes eventually consistent reads are; 0
+  // makes every read see the latest write
+  staleReadMs: number
+  // Serialize response object keys in sorted order (for golden tests)
+  sortedKeys: boolean
+  // JSON file of tables and items to create at startup
+  seedFile?: string
+  // Send request metrics to this StatsD server when set
+  statsdAddr?: StatsdAddr
 }
 
 export function createConfig(params?: {
   shardCount?: number
+  reshard?: boolean
   dataDir?: string
   port?: number
+  fsyncPolicy?: FsyncPolicy
+  requestTimeoutMs?: number
+  maxTables?: number
+  maxRequestBodyBytes?: number
+  isolationLevel?: IsolationLevel
+  readCacheSize?: number
+  maxPageItems?: number
+  indexBackfillMs?: number
+  ttlSweepIntervalMs?: number
+  pitrRetentionMs?: number
+  exportDir?: string
+  exportS3Endpoint?: string
+  replicaRegions?: string[]
+  replicationLagMs?: number
+  kinesisEndpoint?: string
+  streamWebhookUrl?: string
+  streamWebhookMaxAttempts?: number
+  staleReadMs?: number
+  sortedKeys?: boolean
+  seedFile?: string
+  statsdAddr?: StatsdAddr
 }): Config {
   return {
-    shardCount: params?.shardCount ?? 4,
+    shardCount: params?.shardCount,
+    reshard: params?.reshard ?? false,
     dataDir: params?.dataDir ?? './data',
     port: params?.port ?? 8000,
+    fsyncPolicy: params?.fsyncPolicy ?? { mode: 'always' },
+    requestTimeoutMs: params?.requestTimeoutMs ?? 60000,
+    maxTables: params?.maxTables ?? 2500,
+    maxRequestBodyBytes: params?.maxRequestBodyBytes ?? 16 * 1024 * 1024,
+    isolationLevel: params?.isolationLevel ?? 'serializable',
+    readCacheSize: params?.readCacheSize ?? 0,
+    maxPageItems: params?.maxPageItems ?? 0,
+    indexBackfillMs: params?.indexBackfillMs ?? 0,
+    ttlSweepIntervalMs: params?.ttlSweepIntervalMs ?? 60000,
+    pitrRetentionMs: params?.pitrRetentionMs ?? 35 * 24 * 60 * 60 * 1000,
+    exportDir: params?.exportDir,
+    exportS3Endpoint: params?.exportS3Endpoint,
+    replicaRegions: params?.replicaRegions ?? [],
+    replicationLagMs: params?.replicationLagMs ?? 1000,
+    kinesisEndpoint: params?.kinesisEndpoint,
+    streamWebhookUrl: params?.streamWebhookUrl,
+    streamWebhookMaxAttempts: params?.streamWebhookMaxAttempts ?? 5,
+    staleReadMs: params?.staleReadMs ?? 0,
+    sortedKeys: params?.sortedKeys ?? false,
+    seedFile: params?.seedFile,
+    statsdAddr: params?.statsdAddr,
+  }
+}
+
+// Parses FSYNC_POLICY values: "always", "never", or "interval:<ms>"
+export function parseFsyncPolicy(value: string): FsyncPolicy {
+  if (value === 'always' || value === 'never') {
+    return { mode: value }
+  }
+  if (value.startsWith('interval:')) {
+    const intervalMs = parseInt(value.slice('interval:'.length))
+    if (!Number.isFinite(intervalMs) || intervalMs <= 0) {
+      throw new Error(`Invalid FSYNC_POLICY interval: ${value}`)
+    }
+    return { mode: 'interval', intervalMs }
+  }
+  throw new Error(
+    `Invalid FSYNC_POLICY: ${value} (expected always, never, or interval:<ms>)`
+  )
+}
+
+// Parses ISOLATION_LEVEL values: "serializable" or "snapshot"
+export function parseIsolationLevel(value: string): IsolationLevel {
+  if (value === 'serializable' || value === 'snapshot') {
+    return value
+  }
+  throw new Error(
+    `Invalid ISOLATION_LEVEL: ${value} (expected serializable or snapshot)`
+  )
+}
+
+// Parses STATSD_ADDR values of the form "host:port"
+export function parseStatsdAddr(value: string): StatsdAddr {
+  const separator = value.lastIndexOf(':')
+  const port = parseInt(value.slice(separator + 1))
+  if (separator <= 0 || !Number.isInteger(port) || port <= 0) {
+    throw new Error(`Invalid STATSD_ADDR: ${value} (expected host:port)`)
   }
+  return { host: value.slice(0, separator), port }
 }
 
 // Helper for reading from environment variables (used in Bun/Node.js)
 export function getConfigFromEnv(): Config {
   const shardCount = process.env.SHARD_COUNT
     ? parseInt(process.env.SHARD_COUNT)
-    : 4
+    : undefined
+  const reshard = process.env.RESHARD === '1'
   const dataDir = process.env.DATA_DIR || './data'
   const port = process.env.PORT ? parseInt(process.env.PORT) : 8000
+  const fsyncPolicy = process.env.FSYNC_POLICY
+    ? parseFsyncPolicy(process.env.FSYNC_POLICY)
+    : undefined
+  const requestTimeoutMs = process.env.REQUEST_TIMEOUT_MS
+    ? parseInt(process.env.REQUEST_TIMEOUT_MS)
+    : undefined
+  const maxTables = process.env.MAX_TABLES
+    ? parseInt(process.env.MAX_TABLES)
+    : undefined
+  const maxRequestBodyBytes = process.env.MAX_REQUEST_BODY_BYTES
+    ? parseInt(process.env.MAX_REQUEST_BODY_BYTES)
+    : undefined
+  const isolationLevel = process.env.ISOLATION_LEVEL
+    ? parseIsolationLevel(process.env.ISOLATION_LEVEL)
+    : undefined
+  const readCacheSize = process.env.READ_CACHE_SIZE
+    ? parseInt(process.env.READ_CACHE_SIZE)
+    : undefined
+  const maxPageItems = process.env.MAX_PAGE_ITEMS
+    ? parseInt(process.env.MAX_PAGE_ITEMS)
+    : undefined
+  const indexBackfillMs = process.env.INDEX_BACKFILL_MS
+    ? parseInt(process.env.INDEX_BACKFILL_MS)
+    : undefined
+  const ttlSweepIntervalMs = process.env.TTL_SWEEP_INTERVAL_MS
+    ? parseInt(process.env.TTL_SWEEP_INTERVAL_MS)
+    : undefined
+  const pitrRetentionMs = process.env.PITR_RETENTION_MS
+    ? parseInt(process.env.PITR_RETENTION_MS)
+    : undefined
+  const exportDir = process.env.EXPORT_DIR || undefined
+  const exportS3Endpoint = process.env.EXPORT_S3_ENDPOINT || undefined
+  const replicaRegions = process.env.REPLICA_REGIONS
+    ? process.env.REPLICA_REGIONS.split(',').map((region) => region.trim())
+    : undefined
+  const replicationLagMs = process.env.REPLICATION_LAG_MS
+    ? parseInt(process.env.REPLICATION_LAG_MS)
+    : undefined
+  const kinesisEndpoint = process.env.KINESIS_ENDPOINT || undefined
+  const streamWebhookUrl = process.env.STREAM_WEBHOOK_URL || undefined
+  const streamWebhookMaxAttempts = process.env.STREAM_WEBHOOK_MAX_ATTEMPTS
+    ? parseInt(process.env.STREAM_WEBHOOK_MAX_ATTEMPTS)
+    : undefined
+  const staleReadMs = process.env.STALE_READ_MS
+    ? parseInt(process.env.STALE_READ_MS)
+    : undefined
+  const sortedKeys = process.env.SORTED_KEYS === '1'
+  const seedFile = process.env.SEED_FILE || undefined
+  const statsdAddr = process.env.STATSD_ADDR
+    ? parseStatsdAddr(process.env.STATSD_ADDR)
+    : undefined
 
   return createConfig({
     shardCount,
+    reshard,
     dataDir,
     port,
+    fsyncPolicy,
+    requestTimeoutMs,
+    maxTables,
+    maxRequestBodyBytes,
+    isolationLevel,
+    readCacheSize,
+    maxPageItems,
+    indexBackfillMs,
+    ttlSweepIntervalMs,
+    pitrRetentionMs,
+    exportDir,
+    exportS3Endpoint,
+    replicaRegions,
+    replicationLagMs,
+    kinesisEndpoint,
+    streamWebhookUrl,
+    streamWebhookMaxAttempts,
+    staleReadMs,
+    sortedKeys,
+    seedFile,
+    statsdAddr,
   })
 }
@@ -0,0 +1,114 @@
+// Contributor Insights: while enabled for a table or index, counts how often
+// each partition key and each item is accessed, keeping the most accessed
+// in memory
+
+// Keys counted per rule; once this many are held, new keys evict the least
+// counted
+const TRACKED_KEYS = 1000
+// Contributors reported per rule, as many as CloudWatch graphs
+export const TOP_CONTRIBUTORS = 10
+
+export interface Contributor {
+  // The partition key value, then the sort key value for item rules
+  Keys: string[]
+  // Overcounts a key by at most the count of the key it evicted
+  ApproximateAggregateValue: number
+}
+
+/**
+ * Counts the most frequent keys with the Space-Saving algorithm: once
+ * TRACKED_KEYS are held, a new key replaces the least counted one and
+ * takes over its count, so a key accessed more often than any evicted key
+ * is never lost.
+ */
+class KeyCounter {
+  private counts = new Map<string, number>()
+
+  add(keys: string[]): void {
+    const id = JSON.stringify(keys)
+    const count = this.counts.get(id)
+    if (count !== undefined) {
+      this.counts.set(id, count + 1)
+      return
+    }
+    if (this.counts.size < TRACKED_KEYS) {
+      this.counts.set(id, 1)
+      return
+    }
+    let leastId = ''
+    let least = Infinity
+    for (const [other, otherCount] of this.counts) {
+      if (otherCount < least) {
+        leastId = other
+        least = otherCount
+      }
+    }
+    this.counts.delete(leastId)
+    this.counts.set(id, least + 1)
+  }
+
+  // Most counted first; ties keep the order keys were first seen in
+  top(): Contributor[] {
+    return [...this.counts]
+      .sort(([, a], [, b]) => b - a)
+      .slice(0, TOP_CONTRIBUTORS)
+      .map(([id, count]) => ({
+        Keys: JSON.parse(id),
+        ApproximateAggregateValue: count,
+      }))
+  }
+}
+
+export interface TopContributors {
+  // Most accessed partition keys
+  partitions: Contributor[]
+  // Most accessed items, for tables and indexes with a sort key
+  items: Contributor[]
+}
+
+export class ContributorInsightsTracker {
+  // By table name, then index name, '' for the table itself
+  private counters = new Map<
+    string,
+    Map<string, { partitions: KeyCounter; items: KeyCounter }>
+  >()
+
+  // Counts one access to the item with these key values
+  record(
+    tableName: string,
+    indexName: string | undefined,
+    partitionKey: string,
+    sortKey: string | undefined
+  ): void {
+    let table = this.counters.get(tableName)
+    if (!table) {
+      table = new Map()
+      this.counters.set(tableName, table)
+    }
+    let counters = table.get(indexName ?? '')
+    if (!counters) {
+      counters = { partitions: new KeyCounter(), items: new KeyCounter() }
+      table.set(indexName ?? '', counters)
+    }
+    counters.partitions.add([partitionKey])
+    if (sortKey !== undefined) counters.items.add([partitionKey, sortKey])
+  }
+
+  top(tableName: string, indexName: string | undefined): TopContributors {
+    const counters = this.counters.get(tableName)?.get(indexName ?? '')
+    return {
+      partitions: counters?.partitions.top() ?? [],
+      items: counters?.items.top() ?? [],
+    }
+  }
+
+  // Forgets the counts of a table or index whose insights are disabled
+  reset(tableName: string, indexName: string | undefined): void {
+    this.counters.get(tableName)?.delete(indexName ?? '')
+  }
+
+  // Forgets every count of a deleted table
+  drop(tableName: string): void {
+    this.counters.delete(tableName)
+  }
+}
@@ -13,7 +13,9 @@ import type {
   DynamoDBItem,
   TransactionRecord,
   PrepareRequest,
+  PrepareResponse,
   CommitRequest,
+  ItemChange,
   ReleaseRequest,
 } from './types.ts'
 import type { Shard } from './shard.ts'
@@ -21,6 +23,7 @@ import type { MetadataStore } from './metadata-store.ts'
 import { getShardIndex } from './hash-utils.ts'
 import * as fs from 'fs'
 import { MAX_ITEMS_PER_TRANSACTION } from './index.ts'
+import { applyProjection } from './expression-parser/index.ts'
 
 interface IdempotencyCacheEntry {
   timestamp: number
@@ -46,21 +49,25 @@ export function generateTransactionTimestamp(): number {
   return now
 }
 
-// Build cancellation reasons array for transaction failure
+// Build cancellation reasons array for transaction failure, one slot per
+// item. Every rejected item reports its own reason, with the blocking item
+// when it asked for ReturnValuesOnConditionCheckFailure.
 export function buildCancellationReasons(
-  total: number,
-  failedIndex: number,
-  failedReason: CancellationReason
+  responses: PrepareResponse[]
 ): CancellationReason[] {
-  const reasons: CancellationReason[] = []
-  for (let i = 0; i < total; i++) {
-    if (i === failedIndex) {
-      reasons.push(failedReason)
-    } else {
-      reasons.push({ Code: 'None' })
+  return responses.map((response) => {
+    if (response.accepted) {
+      return { Code: 'None' }
     }
-  }
-  return reasons
+    const reason: CancellationReason = {
+      Code: response.reason || 'Unknown',
+      Message: response.message || 'The conditional request failed',
+    }
+    if (response.item) {
+      reason.Item = response.item
+    }
+    return reason
+  })
 }
 
 export class TransactionCoordinator {
@@ -106,7 +113,7 @@ export class TransactionCoordinator {
     shards: Shard[],
     metadataStore: MetadataStore,
     clientRequestToken?: string
-  ): Promise<void> {
+  ): Promise<ItemChange[]> {
     // Validate
     if (!items || items.length === 0) {
       throw new Error('TransactItems cannot be empty')
@@ -120,7 +127,8 @@ export class TransactionCoordinator {
       this.cleanIdempotencyCache()
       const cached = this.idempotencyCache.get(clientRequestToken)
       if (cached) {
-        return cached.result
+        // A replayed request changes nothing
+        return []
       }
     }
 
@@ -163,29 +171,9 @@ export class TransactionCoordinator {
       const allAccepted = prepareResponses.every((r) => r.accepted)
 
       if (!allAccepted) {
-        // Find first failure
-        const failureIndex = prepareResponses.findIndex((r) => !r.accepted)
-        const failedResponse = prepareResponses[failureIndex]
-
-        if (!failedResponse) {
-          throw new Error('Failed to find failure response')
-        }
-
-        // Build cancellation reason
-        const reason: CancellationReason = {
-          Code: failedResponse.reason || 'Unknown',
-          Message: failedResponse.message || 'The conditional request failed',
-        }
-
-        if (failedResponse.item) {
-          reason.Item = failedResponse.item
-        }
-
-        const cancellationReasons = buildCancellationReasons(
-          items.length,
-          failureIndex,
-          reason
-        )
+        // Prepare requests are built in item order, so each response lines
+        // up with its slot in CancellationReasons
+        const cancellationReasons = buildCancellationReasons(prepareResponses)
 
         // Update ledger
         this.updateTransactionState(
@@ -210,7 +198,7 @@ export class TransactionCoordinator {
 
       // PHASE 2: COMMIT
       // This phase MUST complete - retry indefinitely on failure
-      await this.commitAllShards(
+      const changes = await this.commitAllShards(
         shardOperations,
         shards,
         transactionId,
@@ -227,6 +215,7 @@ export class TransactionCoordinator {
           result: undefined,
         })
       }
+      return changes
     } catch (error: unknown) {
       // If error is TransactionCanceledException, it's already handled
       if (error instanceof TransactionCanceledException) {
@@ -305,7 +294,7 @@ export class TransactionCoordinator {
         // Apply projection expression if provided
         let resultItem = dbItem
         if (item.Get.ProjectionExpression !== undefined) {
-          resultItem = this.applyProjection(
+          resultItem = applyProjection(
             dbItem,
             item.Get.ProjectionExpression,
             item.Get.ExpressionAttributeNames
@@ -453,10 +442,11 @@ export class TransactionCoordinator {
     shards: Shard[],
     transactionId: string,
     timestamp: number
-  ): Promise<void> {
+  ): Promise<ItemChange[]> {
     // Commit operations must succeed - retry with exponential backoff
     const MAX_RETRIES = 10
     const INITIAL_DELAY = 100
+    const changes: ItemChange[] = []
 
     for (const op of operations) {
       const shard = shards[op.shardIndex]
@@ -470,7 +460,8 @@ export class TransactionCoordinator {
 
       while (retries < MAX_RETRIES) {
         try {
-          await shard.commit(op.commitRequest)
+          const change = await shard.commit(op.commitRequest)
+          if (change) changes.push(change)
           break // Success
         } catch (error: unknown) {
           lastErrorMessage =
@@ -499,6 +490,7 @@ export class TransactionCoordinator {
         }
       }
     }
+    return changes
   }
 
   // Record failed commits for recovery (in production, would use separate recovery table)
@@ -650,31 +642,6 @@ export class TransactionCoordinator {
 
   // Helper methods
 
-  private applyProjection(
-    item: DynamoDBItem,
-    projectionExpression: string,
-    expressionAttributeNames?: Record<string, string>
-  ): DynamoDBItem {
-    const attrs = projectionExpression.split(',').map((a) => a.trim())
-    const projected: DynamoDBItem = {} as DynamoDBItem
-
-    for (const attr of attrs) {
-      let attrName = attr
-      if (expressionAttributeNames && attr.startsWith('#')) {
-        const resolved = expressionAttributeNames[attr]
-        if (resolved) attrName = resolved
-      }
-      if (attrName) {
-        const value = item[attrName]
-        if (value !== undefined) {
-          projected[attrName] = value
-        }
-      }
-    }
-
-    return projected
-  }
-
   private cleanIdempotencyCache(): void {
     const cutoff = Date.now() - this.CACHE_TTL_MS
     for (const [token, entry] of this.idempotencyCache.entries()) {
@@ -0,0 +1,25 @@
+// Stable codes for the causes of a ValidationException
+
+/**
+ * DynamoDB reports most bad requests as a ValidationException and only the
+ * message says why. Dynado also sets DynadoErrorCode on the error payload
+ * so callers can assert on the cause without matching the full message.
+ */
+export type ValidationErrorCode =
+  | 'SCHEMA_MISMATCH'
+  | 'RESERVED_WORD'
+  | 'EXPRESSION_SYNTAX'
+  | 'SIZE_LIMIT'
+  | 'TYPE_MISMATCH'
+
+export function validationError(code: ValidationErrorCode, message: string) {
+  return { name: 'ValidationException', message, DynadoErrorCode: code }
+}
+
+// Lexer and parser failures are reported like DynamoDB's syntax errors
+export function syntaxError(expressionKind: string, detail: string) {
+  return validationError(
+    'EXPRESSION_SYNTAX',
+    `Invalid ${expressionKind}: Syntax error; ${detail}`
+  )
+}
@@ -0,0 +1,243 @@
+// Table exports in the layout ExportTableToPointInTime writes to S3: a
+// gzipped DynamoDB JSON data file and manifests under
+// <prefix>/AWSDynamoDB/<exportId>/, written to a local directory or an
+// S3-compatible endpoint
+
+import { Database } from 'bun:sqlite'
+import { createHash } from 'crypto'
+import * as fs from 'fs'
+import * as path from 'path'
+import type { DynamoDBItem } from './types.ts'
+
+export interface ExportInfo {
+  exportArn: string
+  tableArn: string
+  s3Bucket: string
+  s3Prefix?: string
+  clientToken?: string
+  exportTime: number // Milliseconds since epoch, as are the times below
+  startTime: number
+  endTime: number
+  itemCount: number
+  billedSizeBytes: number
+  // Key of manifest-summary.json in the bucket
+  manifestKey: string
+}
+
+interface ExportRow {
+  export_arn: string
+  table_arn: string
+  s3_bucket: string
+  s3_prefix: string | null
+  client_token: string | null
+  export_time: number
+  start_time: number
+  end_time: number
+  item_count: number
+  billed_size_bytes: number
+  manifest_key: string
+}
+
+// Where export files are written, by key within a bucket
+export interface ExportDestination {
+  write(key: string, data: string | Uint8Array): Promise<void>
+}
+
+// Writes bucket keys as files under <dir>/<bucket>/
+export function localDestination(
+  dir: string,
+  bucket: string
+): ExportDestination {
+  return {
+    async write(key, data) {
+      const file = path.join(dir, bucket, key)
+      await fs.promises.mkdir(path.dirname(file), { recursive: true })
+      await fs.promises.writeFile(file, data)
+    },
+  }
+}
+
+// Writes to a bucket on an S3-compatible endpoint; credentials come from
+// the S3_* or AWS_* environment variables
+export function s3Destination(
+  endpoint: string,
+  bucket: string
+): ExportDestination {
+  const client = new Bun.S3Client({ endpoint, bucket })
+  return {
+    async write(key, data) {
+      await client.write(key, data)
+    },
+  }
+}
+
+export class ExportStore {
+  private db: Database
+
+  constructor(dataDir: string) {
+    if (!fs.existsSync(dataDir)) {
+      fs.mkdirSync(dataDir, { recursive: true })
+    }
+    this.db = new Database(`${dataDir}/exports.db`)
+
+    this.db.run(`
+      CREATE TABLE IF NOT EXISTS exports (
+        export_arn TEXT PRIMARY KEY,
+        table_arn TEXT NOT NULL,
+        s3_bucket TEXT NOT NULL,
+        s3_prefix TEXT,
+        client_token TEXT,
+        export_time INTEGER NOT NULL,
+        start_time INTEGER NOT NULL,
+        end_time INTEGER NOT NULL,
+        item_count INTEGER NOT NULL,
+        billed_size_bytes INTEGER NOT NULL,
+        manifest_key TEXT NOT NULL
+      )
+    `)
+  }
+
+  createExport(info: ExportInfo): void {
+    this.db.run(
+      `INSERT INTO exports
+       (export_arn, table_arn, s3_bucket, s3_prefix, client_token,
+        export_time, start_time, end_time, item_count, billed_size_bytes,
+        manifest_key)
+       VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+      [
+        info.exportArn,
+        info.tableArn,
+        info.s3Bucket,
+        info.s3Prefix ?? null,
+        info.clientToken ?? null,
+        info.exportTime,
+        info.startTime,
+        info.endTime,
+        info.itemCount,
+        info.billedSizeBytes,
+        info.manifestKey,
+      ]
+    )
+  }
+
+  getExport(exportArn: string): ExportInfo | null {
+    const row = this.db
+      .query<ExportRow, [string]>('SELECT * FROM exports WHERE export_arn = ?')
+      .get(exportArn)
+    return row ? toExportInfo(row) : null
+  }
+
+  findByClientToken(clientToken: string): ExportInfo | null {
+    const row = this.db
+      .query<ExportRow, [string]>(
+        'SELECT * FROM exports WHERE client_token = ?'
+      )
+      .get(clientToken)
+    return row ? toExportInfo(row) : null
+  }
+
+  // Oldest first, so ListExports pages are stable
+  listExports(tableArn?: string): ExportInfo[] {
+    const rows = tableArn
+      ? this.db
+          .query<ExportRow, [string]>(
+            'SELECT * FROM exports WHERE table_arn = ? ORDER BY rowid'
+          )
+          .all(tableArn)
+      : this.db
+          .query<ExportRow, []>('SELECT * FROM exports ORDER BY rowid')
+          .all()
+    return rows.map(toExportInfo)
+  }
+
+  close() {
+    this.db.close()
+  }
+}
+
+function toExportInfo(row: ExportRow): ExportInfo {
+  return {
+    exportArn: row.export_arn,
+    tableArn: row.table_arn,
+    s3Bucket: row.s3_bucket,
+    s3Prefix: row.s3_prefix ?? undefined,
+    clientToken: row.client_token ?? undefined,
+    exportTime: row.export_time,
+    startTime: row.start_time,
+    endTime: row.end_time,
+    itemCount: row.item_count,
+    billedSizeBytes: row.billed_size_bytes,
+    manifestKey: row.manifest_key,
+  }
+}
+
+function md5(data: string | Uint8Array): Buffer {
+  return createHash('md5').update(data).digest()
+}
+
+/**
+ * Writes the items of an export as AWS lays them out under
+ * <prefix>/AWSDynamoDB/<exportId>/: a _started marker, the items as one
+ * gzipped file of {"Item": ...} lines under data/, manifest-files.json
+ * listing the data files, and manifest-summary.json describing the export,
+ * each manifest with an .md5 file of its checksum. Returns the key of
+ * manifest-summary.json.
+ */
+export async function writeExport(
+  destination: ExportDestination,
+  exportId: string,
+  items: DynamoDBItem[],
+  summary: Omit<ExportInfo, 'manifestKey' | 'clientToken'>
+): Promise<string> {
+  const root = [summary.s3Prefix, 'AWSDynamoDB', exportId]
+    .filter(Boolean)
+    .join('/')
+  await destination.write(`${root}/_started`, '')
+
+  const manifestFiles: string[] = []
+  if (items.length > 0) {
+    const lines = items.map((item) => JSON.stringify({ Item: item }) + '\n')
+    const data = Bun.gzipSync(lines.join(''))
+    const dataFileS3Key = `${root}/data/${crypto.randomUUID()}.json.gz`
+    await destination.write(dataFileS3Key, data)
+    manifestFiles.push(
+      JSON.stringify({
+        itemCount: items.length,
+        md5Checksum: md5(data).toString('base64'),
+        etag: md5(data).toString('hex'),
+        dataFileS3Key,
+      })
+    )
+  }
+  const manifestFilesKey = `${root}/manifest-files.json`
+  const manifestFilesData = manifestFiles.map((line) => line + '\n').join('')
+  await destination.write(manifestFilesKey, manifestFilesData)
+  await destination.write(
+    `${root}/manifest-files.md5`,
+    md5(manifestFilesData).toString('base64')
+  )
+
+  const manifestKey = `${root}/manifest-summary.json`
+  const manifestSummary = JSON.stringify({
+    version: '2020-06-30',
+    exportArn: summary.exportArn,
+    startTime: new Date(summary.startTime).toISOString(),
+    endTime: new Date(summary.endTime).toISOString(),
+    tableArn: summary.tableArn,
+    exportTime: new Date(summary.exportTime).toISOString(),
+    s3Bucket: summary.s3Bucket,
+    s3Prefix: summary.s3Prefix ?? null,
+    s3SseAlgorithm: 'AES256',
+    s3SseKmsKeyId: null,
+    manifestFilesS3Key: manifestFilesKey,
+    billedSizeBytes: summary.billedSizeBytes,
+    itemCount: summary.itemCount,
+    outputFormat: 'DYNAMODB_JSON',
+  })
+  await destination.write(manifestKey, manifestSummary)
+  await destination.write(
+    `${root}/manifest-summary.md5`,
+    md5(manifestSummary).toString('base64')
+  )
+  return manifestKey
+}
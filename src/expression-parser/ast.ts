@@ -20,8 +20,8 @@ export type ComparisonOperator = '=' | '<>' | '<' | '>' | '<=' | '>='
 export interface ComparisonExpression {
   type: 'comparison'
   operator: ComparisonOperator
-  left: AttributePath
-  right: Value
+  left: Operand
+  right: Operand
 }
 
 export interface LogicalExpression {
@@ -43,22 +43,30 @@ export interface FunctionExpression {
     | 'attribute_not_exists'
     | 'begins_with'
     | 'contains'
-    | 'size'
     | 'attribute_type'
-  args: (AttributePath | Value | ComparisonOperator)[]
+  args: Operand[]
 }
 
 export interface BetweenExpression {
   type: 'between'
-  value: AttributePath
-  lower: Value
-  upper: Value
+  value: Operand
+  lower: Operand
+  upper: Operand
 }
 
 export interface InExpression {
   type: 'in'
-  value: AttributePath
-  list: Value[]
+  value: Operand
+  list: Operand[]
+}
+
+// Either side of a comparison, BETWEEN or IN can be a path, a value or the
+// size of a path
+export type Operand = AttributePath | Value | SizeOperand
+
+export interface SizeOperand {
+  type: 'size'
+  path: AttributePath
 }
 
 // ============================================================================
@@ -78,29 +86,33 @@ export interface SetAction {
   value: SetValue
 }
 
-export type SetValue =
+export type SetValue = UpdateOperand | ArithmeticExpression
+
+// An operand of a SET value: functions nest, as in
+// list_append(if_not_exists(a, :empty), :more)
+export type UpdateOperand =
+  | AttributePath
   | Value
-  | ArithmeticExpression
   | IfNotExistsExpression
   | ListAppendExpression
 
 export interface ArithmeticExpression {
   type: 'arithmetic'
   operator: '+' | '-'
-  left: AttributePath | Value
-  right: AttributePath | Value
+  left: UpdateOperand
+  right: UpdateOperand
 }
 
 export interface IfNotExistsExpression {
   type: 'if_not_exists'
   path: AttributePath
-  defaultValue: Value
+  defaultValue: UpdateOperand
 }
 
 export interface ListAppendExpression {
   type: 'list_append'
-  list1: AttributePath | Value
-  list2: AttributePath | Value
+  list1: UpdateOperand
+  list2: UpdateOperand
 }
 
 export interface RemoveAction {
@@ -127,8 +139,13 @@ export interface DeleteAction {
 export interface AttributePath {
   type: 'attribute_path'
   name: string // Resolved attribute name (after applying expressionAttributeNames)
+  elements?: PathElement[] // Nested map keys and list indexes, e.g. a.b[2]
 }
 
+export type PathElement =
+  | { type: 'key'; name: string }
+  | { type: 'index'; index: number }
+
 export interface Value {
   type: 'value'
   value: AttributeValue | string | number | boolean | null
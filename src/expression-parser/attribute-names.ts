@@ -0,0 +1,56 @@
+// ExpressionAttributeNames validation and alias resolution
+
+const ALIAS_PATTERN = /^#[a-zA-Z0-9_]+$/
+
+/**
+ * Validate ExpressionAttributeNames declarations. Two aliases may name the
+ * same attribute, but an alias whose value is itself a declared alias (or
+ * itself) is ambiguous and rejected.
+ */
+export function validateExpressionAttributeNames(
+  expressionAttributeNames?: Record<string, string>
+): void {
+  if (!expressionAttributeNames) return
+
+  for (const [alias, name] of Object.entries(expressionAttributeNames)) {
+    if (!ALIAS_PATTERN.test(alias)) {
+      throw {
+        name: 'ValidationException',
+        message: `ExpressionAttributeNames contains invalid key: Syntax error; key: "${alias}"`,
+      }
+    }
+    if (name === '') {
+      throw {
+        name: 'ValidationException',
+        message: `ExpressionAttributeNames contains invalid value: Empty attribute name; key: "${alias}"`,
+      }
+    }
+    if (name in expressionAttributeNames) {
+      throw {
+        name: 'ValidationException',
+        message: `ExpressionAttributeNames contains invalid value: Attribute name refers to another placeholder; key: "${alias}", value: "${name}"`,
+      }
+    }
+  }
+}
+
+/**
+ * Resolve a #alias to its attribute name. Plain names pass through;
+ * undeclared aliases are a ValidationException, as in DynamoDB.
+ */
+export function resolveAttributeName(
+  name: string,
+  expressionAttributeNames?: Record<string, string>
+): string {
+  if (!name.startsWith('#')) {
+    return name
+  }
+  const resolved = expressionAttributeNames?.[name]
+  if (resolved === undefined) {
+    throw {
+      name: 'ValidationException',
+      message: `An expression attribute name used in the document path is not defined; attribute name: ${name}`,
+    }
+  }
+  return resolved
+}
@@ -0,0 +1,108 @@
+// Document path construction shared by the condition and update visitors,
+// and the checks projections and updates share once aliases are resolved
+
+import type { IToken } from 'chevrotain'
+import type { AttributePath, PathElement } from './ast.ts'
+import { resolveAttributeName } from './attribute-names.ts'
+import { validationError } from '../errors.ts'
+
+// A document path with its aliases resolved: the attribute name first, then
+// map keys and list indexes
+export type DocumentPath = [{ type: 'key'; name: string }, ...PathElement[]]
+
+/**
+ * Build an AttributePath from the tokens of an attributePath CST node.
+ * The CST groups tokens by type, so source order is restored first; names
+ * become map keys and numbers become list indexes. Aliases are kept as-is
+ * and resolved per segment at evaluation time.
+ */
+export function buildAttributePath(tokens: IToken[]): AttributePath {
+  const ordered = [...tokens].sort((a, b) => a.startOffset - b.startOffset)
+
+  const [first, ...rest] = ordered
+  if (!first) {
+    throw new Error('Attribute path missing identifier')
+  }
+
+  const path: AttributePath = { type: 'attribute_path', name: first.image }
+  if (rest.length > 0) {
+    path.elements = rest.map((token): PathElement => {
+      if (token.tokenType.name !== 'NumberLiteral') {
+        return { type: 'key', name: token.image }
+      }
+      const index = Number(token.image)
+      if (!Number.isInteger(index) || index < 0) {
+        throw new Error(`Invalid list index: ${token.image}`)
+      }
+      return { type: 'index', index }
+    })
+  }
+  return path
+}
+
+export function resolvePaths(
+  paths: AttributePath[],
+  expressionAttributeNames?: Record<string, string>
+): DocumentPath[] {
+  const resolve = (name: string) =>
+    resolveAttributeName(name, expressionAttributeNames)
+  return paths.map((path): DocumentPath => [
+    { type: 'key', name: resolve(path.name) },
+    ...(path.elements ?? []).map((element) =>
+      element.type === 'key'
+        ? { type: 'key' as const, name: resolve(element.name) }
+        : element
+    ),
+  ])
+}
+
+/**
+ * Each path must address its own part of the item: one path may not
+ * contain another (a and a.b), and two may not treat the same value as
+ * both a map and a list (a.b and a[0]). expressionKind names the request
+ * parameter in the error message.
+ */
+export function assertDisjointPaths(
+  expressionKind: string,
+  paths: DocumentPath[]
+): void {
+  for (const [i, one] of paths.entries()) {
+    for (const two of paths.slice(i + 1)) {
+      const length = Math.min(one.length, two.length)
+      let k = 0
+      while (k < length && sameElement(one[k]!, two[k]!)) k++
+      if (k === length) {
+        throw pathError(expressionKind, 'overlap', one, two)
+      }
+      if (one[k]!.type !== two[k]!.type) {
+        throw pathError(expressionKind, 'conflict', one, two)
+      }
+    }
+  }
+}
+
+function sameElement(a: PathElement, b: PathElement): boolean {
+  return a.type === 'key'
+    ? b.type === 'key' && a.name === b.name
+    : b.type === 'index' && a.index === b.index
+}
+
+function pathError(
+  expressionKind: string,
+  problem: 'overlap' | 'conflict',
+  one: DocumentPath,
+  two: DocumentPath
+) {
+  return validationError(
+    'EXPRESSION_SYNTAX',
+    `Invalid ${expressionKind}: Two document paths ${problem} with each other; must remove or rewrite one of these paths; path one: [${describePath(one)}], path two: [${describePath(two)}]`
+  )
+}
+
+function describePath(path: DocumentPath): string {
+  return path
+    .map((element) =>
+      element.type === 'key' ? element.name : `[${element.index}]`
+    )
+    .join(', ')
+}
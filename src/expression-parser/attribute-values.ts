@@ -0,0 +1,28 @@
+// ExpressionAttributeValues placeholder checks
+
+import type { IToken } from 'chevrotain'
+import type { AttributeValue } from '@aws-sdk/client-dynamodb'
+import { ExpressionAttributeValue } from './lexer.ts'
+
+/**
+ * Reject :placeholders that ExpressionAttributeValues does not declare.
+ * Runs on the tokens of an expression that already parsed, so a syntax
+ * error is always reported ahead of this semantic one.
+ */
+export function assertAttributeValuesDefined(
+  tokens: IToken[],
+  expressionAttributeValues: Record<string, AttributeValue> | undefined,
+  expressionKind: string
+): void {
+  for (const token of tokens) {
+    if (
+      token.tokenType === ExpressionAttributeValue &&
+      expressionAttributeValues?.[token.image] === undefined
+    ) {
+      throw {
+        name: 'ValidationException',
+        message: `Invalid ${expressionKind}: An expression attribute value used in expression is not defined; attribute value: ${token.image}`,
+      }
+    }
+  }
+}
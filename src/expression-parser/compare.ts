@@ -0,0 +1,155 @@
+// Ordering and identity of scalar attribute values, shared by range
+// validation and set arithmetic
+
+import type { AttributeValue } from '@aws-sdk/client-dynamodb'
+import { validationError } from '../errors.ts'
+
+function toBytes(value: Uint8Array | string): Uint8Array {
+  // Binary values arrive base64-encoded over the wire
+  return typeof value === 'string' ? Buffer.from(value, 'base64') : value
+}
+
+function compareBytes(a: Uint8Array, b: Uint8Array): number {
+  const length = Math.min(a.length, b.length)
+  for (let i = 0; i < length; i++) {
+    if (a[i] !== b[i]) return a[i]! - b[i]!
+  }
+  return a.length - b.length
+}
+
+/**
+ * Compare two scalar attribute values the way DynamoDB orders them:
+ * numbers numerically, strings and binaries by their bytes.
+ * Returns undefined when the values are not the same scalar type.
+ */
+export function compareScalars(
+  a: AttributeValue,
+  b: AttributeValue
+): number | undefined {
+  if (a.N !== undefined && b.N !== undefined) {
+    return compareNumbers(a.N, b.N)
+  }
+  if (a.S !== undefined && b.S !== undefined) {
+    return compareBytes(Buffer.from(a.S), Buffer.from(b.S))
+  }
+  if (a.B !== undefined && b.B !== undefined) {
+    return compareBytes(
+      toBytes(a.B as Uint8Array | string),
+      toBytes(b.B as Uint8Array | string)
+    )
+  }
+  return undefined
+}
+
+/**
+ * Identity of a set element: numbers equal by value, so 1 and 1.0 are the
+ * same NS element, and binaries by their bytes however they are encoded.
+ */
+export function setElementKey(
+  type: 'SS' | 'NS' | 'BS',
+  element: string | Uint8Array
+): string {
+  if (type === 'BS') return Buffer.from(toBytes(element)).toString('base64')
+  return type === 'NS' ? numberKey(element as string) : (element as string)
+}
+
+// A number string read exactly, without float rounding: its sign (0 for
+// zero), its significant digits, and the power of ten of the last of them
+function parseDecimal(
+  value: string
+): { sign: number; significant: string; power: number } | undefined {
+  const match = /^([+-]?)0*(\d*?)(?:\.(\d*))?(?:[eE]([+-]?\d+))?$/.exec(
+    value.trim()
+  )
+  if (!match) return undefined
+  const [, sign, whole = '', fraction = '', exponent = '0'] = match
+  const digits = (whole + fraction).replace(/^0+/, '')
+  const significant = digits.replace(/0+$/, '')
+  const power =
+    Number(exponent) - fraction.length + (digits.length - significant.length)
+  if (significant === '') return { sign: 0, significant, power: 0 }
+  return { sign: sign === '-' ? -1 : 1, significant, power }
+}
+
+// Exact canonical form of a number string: significant digits and a power
+// of ten
+function numberKey(value: string): string {
+  const parsed = parseDecimal(value)
+  if (!parsed) return value
+  const { sign, significant, power } = parsed
+  if (sign === 0) return '0'
+  return `${sign < 0 ? '-' : ''}${significant}e${power}`
+}
+
+// Orders number strings by their decimal digits, so numbers with more
+// digits than a float holds still compare exactly: by sign, then by the
+// length of the integer part, then digit by digit
+function compareNumbers(a: string, b: string): number {
+  const x = parseDecimal(a)
+  const y = parseDecimal(b)
+  // Numbers are validated before they are compared
+  if (!x || !y) return a < b ? -1 : a > b ? 1 : 0
+  if (x.sign !== y.sign) return x.sign - y.sign
+  if (x.sign === 0) return 0
+  // Digits before the decimal point; negative for numbers below 0.1
+  const integerLength = x.significant.length + x.power
+  const otherIntegerLength = y.significant.length + y.power
+  let order = integerLength - otherIntegerLength
+  if (order === 0) {
+    // Neither has trailing zeros, so a digit string that is a prefix of
+    // the other is the smaller number
+    order =
+      x.significant < y.significant ? -1 : x.significant > y.significant ? 1 : 0
+  }
+  return x.sign * order
+}
+
+/**
+ * begins_with for scalar values: a string prefix of a string, or a byte
+ * prefix of a binary. Any other pairing does not match.
+ */
+export function hasScalarPrefix(
+  value: AttributeValue,
+  prefix: AttributeValue
+): boolean {
+  if (value.S !== undefined && prefix.S !== undefined) {
+    return value.S.startsWith(prefix.S)
+  }
+  if (value.B !== undefined && prefix.B !== undefined) {
+    const bytes = toBytes(value.B as Uint8Array | string)
+    const head = toBytes(prefix.B as Uint8Array | string)
+    return (
+      head.length <= bytes.length &&
+      compareBytes(bytes.subarray(0, head.length), head) === 0
+    )
+  }
+  return false
+}
+
+/**
+ * Reject BETWEEN ranges whose bounds differ in type or are reversed.
+ * expressionKind names the request parameter in the error message.
+ */
+export function assertBetweenBounds(
+  lower: AttributeValue | undefined,
+  upper: AttributeValue | undefined,
+  expressionKind: string
+): void {
+  if (!lower || !upper) return
+
+  const comparison = compareScalars(lower, upper)
+  if (comparison === undefined) {
+    throw validationError(
+      'TYPE_MISMATCH',
+      `Invalid ${expressionKind}: The BETWEEN operator requires same data type for lower and upper bounds`
+    )
+  }
+  if (comparison > 0) {
+    throw {
+      name: 'ValidationException',
+      message:
+        `Invalid ${expressionKind}: The BETWEEN operator requires upper bound to be greater than or equal to lower bound; ` +
+        `lower bound operand: ${JSON.stringify(lower)}, upper bound operand: ${JSON.stringify(upper)}`,
+    }
+  }
+}
@@ -16,6 +16,9 @@ import {
   GreaterThanOrEqual,
   LParen,
   RParen,
+  LBracket,
+  RBracket,
+  Dot,
   Comma,
   ExpressionAttributeName,
   ExpressionAttributeValue,
@@ -41,6 +44,15 @@ class ConditionExpressionParser extends CstParser {
     this.SUBRULE(this.orExpression)
   })
 
+  // ProjectionExpression: attribute paths separated by commas. It shares
+  // this parser for the attribute path rule.
+  public projectionExpression = this.RULE('projectionExpression', () => {
+    this.AT_LEAST_ONE_SEP({
+      SEP: Comma,
+      DEF: () => this.SUBRULE(this.attributePath),
+    })
+  })
+
   // OR expression
   private orExpression = this.RULE('orExpression', () => {
     this.SUBRULE(this.andExpression, { LABEL: 'lhs' })
@@ -59,12 +71,18 @@ class ConditionExpressionParser extends CstParser {
     })
   })
 
-  // NOT expression
+  // NOT expression: applies to any operand, including functions and
+  // another NOT
   private notExpression = this.RULE('notExpression', () => {
-    this.OPTION(() => {
-      this.CONSUME(Not)
-    })
-    this.SUBRULE(this.comparisonExpression)
+    this.OR([
+      {
+        ALT: () => {
+          this.CONSUME(Not)
+          this.SUBRULE(this.notExpression)
+        },
+      },
+      { ALT: () => this.SUBRULE(this.comparisonExpression) },
+    ])
   })
 
   // Comparison and other atomic expressions
@@ -79,32 +97,6 @@ class ConditionExpressionParser extends CstParser {
         },
       },
 
-      // BETWEEN expression
-      {
-        ALT: () => {
-          this.SUBRULE(this.attributePath, { LABEL: 'value' })
-          this.CONSUME(Between)
-          this.SUBRULE(this.operandValue, { LABEL: 'lower' })
-          this.CONSUME(And)
-          this.SUBRULE2(this.operandValue, { LABEL: 'upper' })
-        },
-      },
-
-      // IN expression
-      {
-        ALT: () => {
-          this.SUBRULE2(this.attributePath, { LABEL: 'value' })
-          this.CONSUME(In)
-          this.CONSUME2(LParen)
-          this.SUBRULE3(this.operandValue, { LABEL: 'listItem' })
-          this.MANY(() => {
-            this.CONSUME(Comma)
-            this.SUBRULE4(this.operandValue, { LABEL: 'listItem' })
-          })
-          this.CONSUME2(RParen)
-        },
-      },
-
       // Function call
       {
         ALT: () => {
@@ -112,12 +104,44 @@ class ConditionExpressionParser extends CstParser {
         },
       },
 
-      // Comparison (attr op value)
+      // Expressions on an operand share the prefix, so the operand is
+      // parsed once and the operator decides the form
       {
         ALT: () => {
-          this.SUBRULE3(this.attributePath)
-          this.SUBRULE(this.comparisonOperator)
-          this.SUBRULE5(this.operandValue)
+          this.SUBRULE(this.operand, { LABEL: 'lhs' })
+          this.OR2([
+            // BETWEEN expression
+            {
+              ALT: () => {
+                this.CONSUME(Between)
+                this.SUBRULE2(this.operand, { LABEL: 'lower' })
+                this.CONSUME(And)
+                this.SUBRULE3(this.operand, { LABEL: 'upper' })
+              },
+            },
+
+            // IN expression
+            {
+              ALT: () => {
+                this.CONSUME(In)
+                this.CONSUME2(LParen)
+                this.SUBRULE4(this.operand, { LABEL: 'listItem' })
+                this.MANY(() => {
+                  this.CONSUME(Comma)
+                  this.SUBRULE5(this.operand, { LABEL: 'listItem' })
+                })
+                this.CONSUME2(RParen)
+              },
+            },
+
+            // Comparison (operand op operand)
+            {
+              ALT: () => {
+                this.SUBRULE(this.comparisonOperator)
+                this.SUBRULE6(this.operand, { LABEL: 'rhs' })
+              },
+            },
+          ])
         },
       },
     ])
@@ -158,42 +182,30 @@ class ConditionExpressionParser extends CstParser {
         },
       },
 
-      // begins_with(path, value)
+      // begins_with(path, operand)
       {
         ALT: () => {
           this.CONSUME(BeginsWith)
           this.CONSUME3(LParen)
           this.SUBRULE3(this.attributePath)
           this.CONSUME(Comma)
-          this.SUBRULE(this.operandValue)
+          this.SUBRULE(this.operand)
           this.CONSUME3(RParen)
         },
       },
 
-      // contains(path, value)
+      // contains(path, operand)
       {
         ALT: () => {
           this.CONSUME(Contains)
           this.CONSUME4(LParen)
           this.SUBRULE4(this.attributePath)
           this.CONSUME2(Comma)
-          this.SUBRULE2(this.operandValue)
+          this.SUBRULE2(this.operand)
           this.CONSUME4(RParen)
         },
       },
 
-      // size(path) - returns a number, used in comparisons
-      {
-        ALT: () => {
-          this.CONSUME(Size)
-          this.CONSUME5(LParen)
-          this.SUBRULE5(this.attributePath)
-          this.CONSUME5(RParen)
-          this.SUBRULE3(this.comparisonOperator)
-          this.SUBRULE3(this.operandValue)
-        },
-      },
-
       // attribute_type(path, type)
       {
         ALT: () => {
@@ -201,19 +213,57 @@ class ConditionExpressionParser extends CstParser {
           this.CONSUME6(LParen)
           this.SUBRULE6(this.attributePath)
           this.CONSUME3(Comma)
-          this.SUBRULE4(this.operandValue)
+          this.SUBRULE(this.operandValue)
           this.CONSUME6(RParen)
         },
       },
     ])
   })
 
-  // Attribute path (for now, just a simple name)
+  // Operand of a comparison, BETWEEN, IN, begins_with or contains
+  private operand = this.RULE('operand', () => {
+    this.OR([
+      { ALT: () => this.SUBRULE(this.attributePath) },
+      { ALT: () => this.SUBRULE(this.operandValue) },
+      {
+        // size(path) - the size of the path's value, as a number
+        ALT: () => {
+          this.CONSUME(Size)
+          this.CONSUME(LParen)
+          this.SUBRULE2(this.attributePath)
+          this.CONSUME(RParen)
+        },
+      },
+    ])
+  })
+
+  // Attribute path: a name followed by nested map keys and list indexes,
+  // e.g. a.#b[2].c
   private attributePath = this.RULE('attributePath', () => {
     this.OR([
       { ALT: () => this.CONSUME(ExpressionAttributeName) },
       { ALT: () => this.CONSUME(Identifier) },
     ])
+    this.MANY(() => {
+      this.OR2([
+        {
+          ALT: () => {
+            this.CONSUME(Dot)
+            this.OR3([
+              { ALT: () => this.CONSUME2(ExpressionAttributeName) },
+              { ALT: () => this.CONSUME2(Identifier) },
+            ])
+          },
+        },
+        {
+          ALT: () => {
+            this.CONSUME(LBracket)
+            this.CONSUME(NumberLiteral)
+            this.CONSUME(RBracket)
+          },
+        },
+      ])
+    })
   })
 
   // Operand value (expression attribute value or literal)
@@ -12,8 +12,10 @@ import type {
   InExpression,
   AttributePath,
   Value,
+  Operand,
   ComparisonOperator,
 } from './ast.ts'
+import { buildAttributePath } from './attribute-path.ts'
 
 const BaseVisitor = conditionParser.getBaseCstVisitorConstructor()
 
@@ -24,28 +26,32 @@ interface ConditionExpressionCtx {
   orExpression: NodeArray
 }
 
+interface ProjectionExpressionCtx {
+  attributePath: NodeArray
+}
+
 interface BinaryExpressionCtx {
   lhs: NodeArray
   rhs?: NodeArray[]
 }
 
 interface NotExpressionCtx {
-  comparisonExpression: NodeArray
+  comparisonExpression?: NodeArray
+  notExpression?: NodeArray
   Not?: TokenArray
 }
 
 interface ComparisonExpressionCtx {
   conditionExpression?: NodeArray
   Between?: TokenArray
-  value?: NodeArray
   lower?: NodeArray
   upper?: NodeArray
   In?: TokenArray
   listItem?: NodeArray[]
   functionCall?: NodeArray
   comparisonOperator?: NodeArray
-  attributePath?: NodeArray
-  operandValue?: NodeArray
+  lhs?: NodeArray
+  rhs?: NodeArray
 }
 
 interface ComparisonOperatorCtx {
@@ -62,16 +68,22 @@ interface FunctionCallCtx {
   AttributeNotExists?: TokenArray
   BeginsWith?: TokenArray
   Contains?: TokenArray
-  Size?: TokenArray
   AttributeType?: TokenArray
   attributePath: NodeArray
+  operand?: NodeArray
   operandValue?: NodeArray
-  comparisonOperator?: NodeArray
+}
+
+interface OperandCtx {
+  attributePath?: NodeArray
+  operandValue?: NodeArray
+  Size?: TokenArray
 }
 
 interface AttributePathCtx {
   ExpressionAttributeName?: TokenArray
   Identifier?: TokenArray
+  NumberLiteral?: TokenArray
 }
 
 interface OperandValueCtx {
@@ -90,6 +102,10 @@ class ConditionVisitor extends BaseVisitor {
     return this.visit(ctx.orExpression)
   }
 
+  projectionExpression(ctx: ProjectionExpressionCtx): AttributePath[] {
+    return ctx.attributePath.map((path) => this.visit(path))
+  }
+
   orExpression(ctx: BinaryExpressionCtx): ConditionExpression {
     let result = this.visit(ctx.lhs)
 
@@ -125,16 +141,17 @@ class ConditionVisitor extends BaseVisitor {
   }
 
   notExpression(ctx: NotExpressionCtx): ConditionExpression {
-    const operand = this.visit(ctx.comparisonExpression)
-
-    if (ctx.Not) {
+    if (ctx.Not && ctx.notExpression) {
       return {
         type: 'not',
-        operand,
+        operand: this.visit(ctx.notExpression),
       } as NotExpression
     }
 
-    return operand
+    if (!ctx.comparisonExpression) {
+      throw new Error('NOT expression missing operand')
+    }
+    return this.visit(ctx.comparisonExpression)
   }
 
   comparisonExpression(ctx: ComparisonExpressionCtx): ConditionExpression {
@@ -145,32 +162,26 @@ class ConditionVisitor extends BaseVisitor {
 
     // BETWEEN expression
     if (ctx.Between) {
-      const valueNode = ctx.value
-      const lowerNode = ctx.lower
-      const upperNode = ctx.upper
-
-      if (!valueNode || !lowerNode || !upperNode) {
+      if (!ctx.lhs || !ctx.lower || !ctx.upper) {
         throw new Error('Invalid BETWEEN expression')
       }
       return {
         type: 'between',
-        value: this.visit(valueNode),
-        lower: this.visit(lowerNode),
-        upper: this.visit(upperNode),
+        value: this.visit(ctx.lhs),
+        lower: this.visit(ctx.lower),
+        upper: this.visit(ctx.upper),
       } as BetweenExpression
     }
 
     // IN expression
     if (ctx.In) {
-      const valueNode = ctx.value
-      const listItems = ctx.listItem
-      if (!valueNode || !listItems) {
+      if (!ctx.lhs || !ctx.listItem) {
         throw new Error('Invalid IN expression')
       }
       return {
         type: 'in',
-        value: this.visit(valueNode),
-        list: listItems.map((item) => this.visit(item)),
+        value: this.visit(ctx.lhs),
+        list: ctx.listItem.map((item) => this.visit(item)),
       } as InExpression
     }
 
@@ -180,15 +191,15 @@ class ConditionVisitor extends BaseVisitor {
     }
 
     // Regular comparison
-    if (ctx.comparisonOperator && ctx.attributePath && ctx.operandValue) {
+    if (ctx.comparisonOperator && ctx.lhs && ctx.rhs) {
       const operatorToken = this.visit(
         ctx.comparisonOperator
       ) as ComparisonOperator
       return {
         type: 'comparison',
         operator: operatorToken,
-        left: this.visit(ctx.attributePath),
-        right: this.visit(ctx.operandValue),
+        left: this.visit(ctx.lhs),
+        right: this.visit(ctx.rhs),
       } as ComparisonExpression
     }
 
@@ -223,42 +234,24 @@ class ConditionVisitor extends BaseVisitor {
     }
 
     if (ctx.BeginsWith) {
-      if (!ctx.operandValue) {
+      if (!ctx.operand) {
         throw new Error('begins_with requires operand value')
       }
       return {
         type: 'function',
         name: 'begins_with',
-        args: [this.visit(ctx.attributePath), this.visit(ctx.operandValue)],
+        args: [this.visit(ctx.attributePath), this.visit(ctx.operand)],
       }
     }
 
     if (ctx.Contains) {
-      if (!ctx.operandValue) {
+      if (!ctx.operand) {
         throw new Error('contains requires operand value')
       }
       return {
         type: 'function',
         name: 'contains',
-        args: [this.visit(ctx.attributePath), this.visit(ctx.operandValue)],
-      }
-    }
-
-    if (ctx.Size) {
-      if (!ctx.operandValue) {
-        throw new Error('size() requires operand value')
-      }
-      // size(path) op value - create a special comparison
-      return {
-        type: 'function',
-        name: 'size',
-        args: [
-          this.visit(ctx.attributePath),
-          ctx.comparisonOperator
-            ? (this.visit(ctx.comparisonOperator) as ComparisonOperator)
-            : '=',
-          this.visit(ctx.operandValue),
-        ],
+        args: [this.visit(ctx.attributePath), this.visit(ctx.operand)],
       }
     }
 
@@ -276,15 +269,25 @@ class ConditionVisitor extends BaseVisitor {
     throw new Error('Unknown function')
   }
 
-  attributePath(ctx: AttributePathCtx): AttributePath {
-    const token = ctx.ExpressionAttributeName?.[0] || ctx.Identifier?.[0]
-    if (!token) {
-      throw new Error('Attribute path missing identifier')
+  operand(ctx: OperandCtx): Operand {
+    if (ctx.attributePath && ctx.Size) {
+      return { type: 'size', path: this.visit(ctx.attributePath) }
     }
-    return {
-      type: 'attribute_path',
-      name: token.image,
+    if (ctx.attributePath) {
+      return this.visit(ctx.attributePath)
     }
+    if (ctx.operandValue) {
+      return this.visit(ctx.operandValue)
+    }
+    throw new Error('Unknown operand')
+  }
+
+  attributePath(ctx: AttributePathCtx): AttributePath {
+    return buildAttributePath([
+      ...(ctx.ExpressionAttributeName ?? []),
+      ...(ctx.Identifier ?? []),
+      ...(ctx.NumberLiteral ?? []),
+    ])
   }
 
   operandValue(ctx: OperandValueCtx): Value {
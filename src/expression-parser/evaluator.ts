@@ -10,11 +10,18 @@ import type {
   InExpression,
   AttributePath,
   Value,
+  Operand,
   EvaluationContext,
 } from './ast.ts'
+import { resolveAttributeName as resolveAliasedName } from './attribute-names.ts'
 import type { DynamoDBItem } from '../types.ts'
 import type { AttributeValue } from '@aws-sdk/client-dynamodb'
-import type { ComparisonOperator } from './ast.ts'
+import {
+  assertBetweenBounds,
+  compareScalars,
+  hasScalarPrefix,
+} from './compare.ts'
+import { validationError } from '../errors.ts'
 
 type AttributeValueLike =
   | AttributeValue
@@ -55,20 +62,76 @@ export function evaluateCondition(
   }
 }
 
+/**
+ * Check operand constraints that do not depend on the item, so invalid
+ * expressions fail even when there is nothing to evaluate them against.
+ */
+export function validateCondition(
+  expression: ConditionExpression,
+  context: EvaluationContext,
+  expressionKind: string
+): void {
+  switch (expression.type) {
+    case 'logical':
+      validateCondition(expression.left, context, expressionKind)
+      validateCondition(expression.right, context, expressionKind)
+      return
+    case 'not':
+      validateCondition(expression.operand, context, expressionKind)
+      return
+    case 'function': {
+      const prefix = expression.args[1]
+      if (expression.name === 'begins_with' && prefix?.type === 'value') {
+        assertPrefixOperand(
+          toAttributeValue(resolveValue(prefix, context)),
+          expressionKind
+        )
+      }
+      return
+    }
+    case 'between':
+      // Bounds read from the item can only be checked per item
+      if (
+        expression.lower.type === 'value' &&
+        expression.upper.type === 'value'
+      ) {
+        assertBetweenBounds(
+          toAttributeValue(resolveValue(expression.lower, context)),
+          toAttributeValue(resolveValue(expression.upper, context)),
+          expressionKind
+        )
+      }
+      return
+    default:
+      return
+  }
+}
+
+function toAttributeValue(
+  value: AttributeValueLike | undefined
+): AttributeValue | undefined {
+  return typeof value === 'object' && value !== null && !Array.isArray(value)
+    ? (value as AttributeValue)
+    : undefined
+}
+
 function evaluateComparison(
   expr: ComparisonExpression,
   context: EvaluationContext
 ): boolean {
-  const leftValue = getAttributeValue(expr.left, context)
-  const rightValue = resolveValue(expr.right, context)
+  const leftValue = resolveOperand(expr.left, context)
+  const rightValue = resolveOperand(expr.right, context)
 
-  if (leftValue === undefined) return false
+  // A missing attribute equals nothing, so only <> holds
+  if (leftValue === undefined || rightValue === undefined) {
+    return expr.operator === '<>'
+  }
 
   switch (expr.operator) {
     case '=':
-      return JSON.stringify(leftValue) === JSON.stringify(rightValue)
+      return valuesEqual(leftValue, rightValue)
     case '<>':
-      return JSON.stringify(leftValue) !== JSON.stringify(rightValue)
+      return !valuesEqual(leftValue, rightValue)
     case '<':
       return compareValues(leftValue, rightValue) < 0
     case '>':
@@ -109,25 +172,29 @@ function evaluateFunction(
   switch (expr.name) {
     case 'attribute_exists': {
       const path = expr.args[0] as AttributePath
-      const attrName = resolveAttributeName(path.name, context)
-      return context.item !== null && attrName in context.item
+      return getAttributeValue(path, context) !== undefined
     }
 
     case 'attribute_not_exists': {
       const path = expr.args[0] as AttributePath
-      const attrName = resolveAttributeName(path.name, context)
-      return context.item === null || !(attrName in context.item)
+      return getAttributeValue(path, context) === undefined
     }
 
     case 'begins_with': {
       const path = expr.args[0] as AttributePath
-      const valueArg = expr.args[1] as Value
 
       const attrValue = getAttributeValue(path, context)
-      const prefixValue = resolveValue(valueArg, context)
+      const prefixValue = resolveOperand(expr.args[1]!, context)
 
       if (!attrValue || !prefixValue) return false
 
+      // A target of another type, such as a number or map, never matches
+      const typedAttr = toAttributeValue(attrValue)
+      const typedPrefix = toAttributeValue(prefixValue)
+      if (typedAttr && typedPrefix) {
+        return hasScalarPrefix(typedAttr, typedPrefix)
+      }
+
       const attrStr = getStringValue(attrValue)
       const prefixStr = getStringValue(prefixValue)
 
@@ -140,10 +207,9 @@ function evaluateFunction(
 
     case 'contains': {
       const path = expr.args[0] as AttributePath
-      const valueArg = expr.args[1] as Value
 
       const attrValue = getAttributeValue(path, context)
-      const searchValue = resolveValue(valueArg, context)
+      const searchValue = resolveOperand(expr.args[1]!, context)
 
       if (!attrValue || !searchValue) return false
 
@@ -171,64 +237,21 @@ function evaluateFunction(
         )
       }
 
-      return false
-    }
-
-    case 'size': {
-      const path = expr.args[0] as AttributePath
-      const operatorArg = expr.args[1]
-      const valueArg = expr.args[2] as Value
-
-      const attrValue = getAttributeValue(path, context)
-      const compareValue = resolveValue(valueArg, context)
-
-      if (!attrValue) return false
-
-      let size = 0
-      if (typeof attrValue === 'string') {
-        size = attrValue.length
-      } else if (
-        typeof attrValue === 'object' &&
-        attrValue !== null &&
-        'S' in attrValue &&
-        typeof attrValue.S === 'string'
-      ) {
-        size = attrValue.S.length
-      } else if (Array.isArray(attrValue)) {
-        size = attrValue.length
-      } else if (
-        typeof attrValue === 'object' &&
-        attrValue !== null &&
-        'L' in attrValue &&
-        Array.isArray(attrValue.L)
-      ) {
-        size = attrValue.L.length
-      }
-
-      const compareNum = getNumericValue(compareValue)
-      if (compareNum === null) {
-        return false
+      // Set contains: the operand must be a scalar of the set's element type
+      if (typeof attrValue === 'object' && typeof searchValue === 'object') {
+        const set = attrValue as AttributeValue
+        const search = searchValue as AttributeValue
+        if (set.SS && search.S !== undefined) return set.SS.includes(search.S)
+        if (set.NS && search.N !== undefined) {
+          return set.NS.some((n) => parseFloat(n) === parseFloat(search.N!))
+        }
+        if (set.BS && search.B !== undefined) {
+          const encoded = JSON.stringify(search.B)
+          return set.BS.some((b) => JSON.stringify(b) === encoded)
+        }
       }
 
-      const operator = isComparisonOperator(operatorArg) ? operatorArg : '='
-
-      // operator is the comparison operator token
-      switch (operator) {
-        case '=':
-          return size === compareNum
-        case '<>':
-          return size !== compareNum
-        case '<':
-          return size < compareNum
-        case '>':
-          return size > compareNum
-        case '<=':
-          return size <= compareNum
-        case '>=':
-          return size >= compareNum
-        default:
-          return false
-      }
+      return false
     }
 
     case 'attribute_type': {
@@ -256,30 +279,26 @@ function evaluateBetween(
   expr: BetweenExpression,
   context: EvaluationContext
 ): boolean {
-  const value = getAttributeValue(expr.value, context)
-  const lower = resolveValue(expr.lower, context)
-  const upper = resolveValue(expr.upper, context)
+  const value = resolveOperand(expr.value, context)
+  const lower = resolveOperand(expr.lower, context)
+  const upper = resolveOperand(expr.upper, context)
 
-  if (value === undefined) return false
+  if (value === undefined || lower === undefined || upper === undefined) {
+    return false
+  }
 
   return compareValues(value, lower) >= 0 && compareValues(value, upper) <= 0
 }
 
 function evaluateIn(expr: InExpression, context: EvaluationContext): boolean {
-  const value = getAttributeValue(expr.value, context)
+  const value = resolveOperand(expr.value, context)
 
   if (value === undefined) return false
 
-  const valueStr = JSON.stringify(value)
-
-  for (const listItem of expr.list) {
-    const itemValue = resolveValue(listItem, context)
-    if (JSON.stringify(itemValue) === valueStr) {
-      return true
-    }
-  }
-
-  return false
+  return expr.list.some((listItem) => {
+    const itemValue = resolveOperand(listItem, context)
+    return itemValue !== undefined && valuesEqual(value, itemValue)
+  })
 }
 
 // Helper functions
@@ -288,10 +307,7 @@ function resolveAttributeName(
   name: string,
   context: EvaluationContext
 ): string {
-  if (name.startsWith('#')) {
-    return context.expressionAttributeNames?.[name] || name
-  }
-  return name
+  return resolveAliasedName(name, context.expressionAttributeNames)
 }
 
 function getAttributeValue(
@@ -300,8 +316,65 @@ function getAttributeValue(
 ): AttributeValueLike | undefined {
   if (!context.item) return undefined
 
-  const attrName = resolveAttributeName(path.name, context)
-  return context.item[attrName]
+  // Aliases may appear at any segment of a nested path
+  let current: AttributeValue | undefined =
+    context.item[resolveAttributeName(path.name, context)]
+  for (const element of path.elements ?? []) {
+    if (element.type === 'index') {
+      current = current?.L?.[element.index]
+    } else {
+      current = current?.M?.[resolveAttributeName(element.name, context)]
+    }
+  }
+  return current
+}
+
+function resolveOperand(
+  operand: Operand,
+  context: EvaluationContext
+): AttributeValueLike | undefined {
+  switch (operand.type) {
+    case 'attribute_path':
+      return getAttributeValue(operand, context)
+    case 'value':
+      return resolveValue(operand, context)
+    case 'size': {
+      const size = sizeOf(getAttributeValue(operand.path, context))
+      return size === undefined ? undefined : { N: String(size) }
+    }
+  }
+}
+
+// size() of a string counts characters, of a binary its bytes, of a set its
+// elements and of a map its keys. Numbers, booleans and nulls have no
+// size, so comparisons on it are false.
+function sizeOf(value: AttributeValueLike | undefined): number | undefined {
+  if (typeof value === 'string' || Array.isArray(value)) {
+    return value.length
+  }
+  const typed = toAttributeValue(value)
+  if (!typed) return undefined
+  if (typed.S !== undefined) return typed.S.length
+  if (typed.L) return typed.L.length
+  if (typed.B !== undefined) {
+    const b = typed.B as Uint8Array | string
+    return typeof b === 'string' ? Buffer.from(b, 'base64').length : b.length
+  }
+  if (typed.SS || typed.NS || typed.BS) {
+    return (typed.SS ?? typed.NS ?? typed.BS)!.length
+  }
+  if (typed.M) return Object.keys(typed.M).length
+  return undefined
+}
+
+// Numbers are equal by value, so 1 equals 1.0; other values by content
+function valuesEqual(a: AttributeValueLike, b: AttributeValueLike): boolean {
+  const typedA = toAttributeValue(a)
+  const typedB = toAttributeValue(b)
+  if (typedA?.N !== undefined && typedB?.N !== undefined) {
+    return compareScalars(typedA, typedB) === 0
+  }
+  return JSON.stringify(a) === JSON.stringify(b)
 }
 
 function resolveValue(
@@ -315,10 +388,31 @@ function resolveValue(
   return value.value
 }
 
+// begins_with only takes a string or binary prefix
+function assertPrefixOperand(
+  prefix: AttributeValue | undefined,
+  expressionKind: string
+): void {
+  if (!prefix || prefix.S !== undefined || prefix.B !== undefined) return
+  throw validationError(
+    'TYPE_MISMATCH',
+    `Invalid ${expressionKind}: Incorrect operand type for operator or function; operator or function: begins_with, operand type: ${getAttributeType(prefix)}`
+  )
+}
+
 function compareValues(
   a: AttributeValueLike | undefined,
   b: AttributeValueLike | undefined
 ): number {
+  // Attribute values order the way DynamoDB does (binaries byte-wise).
+  // Values of different types are not comparable: NaN makes every
+  // ordering operator false.
+  const typedA = toAttributeValue(a)
+  const typedB = toAttributeValue(b)
+  if (typedA && typedB) {
+    return compareScalars(typedA, typedB) ?? NaN
+  }
+
   // Get numeric values
   const aNum = getNumericValue(a)
   const bNum = getNumericValue(b)
@@ -397,16 +491,6 @@ function getAttributeType(value: AttributeValueLike): string {
   return 'UNKNOWN'
 }
 
-function isComparisonOperator(value: unknown): value is ComparisonOperator {
-  return (
-    value === '=' ||
-    value === '<>' ||
-    value === '<' ||
-    value === '>' ||
-    value === '<=' ||
-    value === '>='
-  )
-}
 function hasNumericAttribute(
   value: AttributeValueLike | undefined
 ): value is { N: string } {
@@ -62,6 +62,61 @@ describe('Condition Expression Evaluator', () => {
         })
       ).toBe(false)
     })
+
+    test('should compare two attributes', () => {
+      const item: DynamoDBItem = { low: { N: '5' }, high: { N: '10' } }
+      expect(evaluateConditionExpression(item, 'low < high')).toBe(true)
+      expect(evaluateConditionExpression(item, 'high = low')).toBe(false)
+      expect(
+        evaluateConditionExpression(item, ':min <= low', undefined, {
+          ':min': { N: '5' },
+        })
+      ).toBe(true)
+      expect(
+        evaluateConditionExpression(
+          item,
+          ':v BETWEEN low AND high',
+          undefined,
+          { ':v': { N: '7' } }
+        )
+      ).toBe(true)
+    })
+
+    test('should treat a missing attribute as unequal to anything', () => {
+      const item: DynamoDBItem = { name: { S: 'Alice' } }
+      const values = { ':val': { S: 'Alice' } }
+      expect(
+        evaluateConditionExpression(item, 'missing = :val', undefined, values)
+      ).toBe(false)
+      expect(
+        evaluateConditionExpression(item, 'missing <> :val', undefined, values)
+      ).toBe(true)
+      expect(
+        evaluateConditionExpression(item, 'missing < :val', undefined, values)
+      ).toBe(false)
+    })
+
+    test('should compare numbers by value', () => {
+      const item: DynamoDBItem = { price: { N: '10.50' } }
+      expect(
+        evaluateConditionExpression(item, 'price IN (:a, :b)', undefined, {
+          ':a': { N: '1' },
+          ':b': { N: '10.5' },
+        })
+      ).toBe(true)
+    })
+
+    test('should accept keywords in any case', () => {
+      const item: DynamoDBItem = { age: { N: '25' } }
+      expect(
+        evaluateConditionExpression(
+          item,
+          'not age in (:a) and age between :a and :b or age = :a',
+          undefined,
+          { ':a': { N: '20' }, ':b': { N: '30' } }
+        )
+      ).toBe(true)
+    })
   })
 
   describe('Existence Functions', () => {
@@ -92,6 +147,16 @@ describe('Condition Expression Evaluator', () => {
       ).toBe(false)
     })
 
+    test('should treat NULL-valued attributes as present', () => {
+      const item: DynamoDBItem = { deletedAt: { NULL: true } }
+      expect(
+        evaluateConditionExpression(item, 'attribute_exists(deletedAt)')
+      ).toBe(true)
+      expect(
+        evaluateConditionExpression(item, 'attribute_not_exists(deletedAt)')
+      ).toBe(false)
+    })
+
     test('should handle attribute_not_exists for null item', () => {
       expect(
         evaluateConditionExpression(null, 'attribute_not_exists(id)')
@@ -223,6 +288,28 @@ describe('Condition Expression Evaluator', () => {
       ).toBe(true)
     })
 
+    test('should handle size on either side of a comparison', () => {
+      const item: DynamoDBItem = {
+        tags: { SS: ['a', 'b'] },
+        name: { S: 'Al' },
+        count: { N: '3' },
+      }
+      expect(
+        evaluateConditionExpression(item, 'size(tags) = size(name)')
+      ).toBe(true)
+      expect(
+        evaluateConditionExpression(item, ':max >= size(tags)', undefined, {
+          ':max': { N: '2' },
+        })
+      ).toBe(true)
+      // Numbers have no size
+      expect(
+        evaluateConditionExpression(item, 'size(count) >= :zero', undefined, {
+          ':zero': { N: '0' },
+        })
+      ).toBe(false)
+    })
+
     test('should handle size with missing attribute', () => {
       const item: DynamoDBItem = { name: { S: 'Alice' } }
       expect(
@@ -288,6 +375,54 @@ describe('Condition Expression Evaluator', () => {
       ).toBe(false)
     })
 
+    test('should apply NOT to function results', () => {
+      const item: DynamoDBItem = { tags: { SS: ['red', 'blue'] } }
+      expect(evaluateConditionExpression(item, 'NOT attribute_exists(x)')).toBe(
+        true
+      )
+      expect(
+        evaluateConditionExpression(item, 'NOT contains(tags, :t)', undefined, {
+          ':t': { S: 'red' },
+        })
+      ).toBe(false)
+      expect(
+        evaluateConditionExpression(item, 'NOT NOT attribute_exists(tags)')
+      ).toBe(true)
+    })
+
+    test('should resolve nested paths with aliases at any segment', () => {
+      const item: DynamoDBItem = {
+        config: {
+          M: {
+            status: { S: 'on' },
+            levels: { L: [{ N: '1' }, { N: '5' }] },
+          },
+        },
+      }
+      const names = { '#cfg': 'config', '#status': 'status' }
+      expect(
+        evaluateConditionExpression(
+          item,
+          'attribute_exists(#cfg.#status)',
+          names
+        )
+      ).toBe(true)
+      expect(
+        evaluateConditionExpression(
+          item,
+          'attribute_not_exists(config.missing.deeper)'
+        )
+      ).toBe(true)
+      expect(
+        evaluateConditionExpression(
+          item,
+          'config.#status = :on AND config.levels[1] BETWEEN :low AND :high',
+          names,
+          { ':on': { S: 'on' }, ':low': { N: '2' }, ':high': { N: '9' } }
+        )
+      ).toBe(true)
+    })
+
     test('should handle complex AND/OR combinations', () => {
       const item: DynamoDBItem = {
         age: { N: '25' },
@@ -381,6 +516,31 @@ describe('Condition Expression Evaluator', () => {
       ).toBe(true)
     })
 
+    test('should compare binary values as unsigned bytes', () => {
+      // Binaries reach the evaluator base64-encoded, and base64 text orders
+      // '/w==' (0xff) before 'AQ==' (0x01)
+      const binary = (base64: string) => ({
+        B: base64 as unknown as Uint8Array,
+      })
+      const item: DynamoDBItem = { b: binary('/w==') }
+      const values = { ':low': binary('AQ==') }
+      expect(
+        evaluateConditionExpression(item, 'b > :low', undefined, values)
+      ).toBe(true)
+      expect(
+        evaluateConditionExpression(item, 'b < :low', undefined, values)
+      ).toBe(false)
+    })
+
+    test('should not order values of different types', () => {
+      const item: DynamoDBItem = { version: { N: '2' } }
+      expect(
+        evaluateConditionExpression(item, 'version < :v', undefined, {
+          ':v': { S: '3' },
+        })
+      ).toBe(false)
+    })
+
     test('should handle zero values', () => {
       const item: DynamoDBItem = { counter: { N: '0' } }
       expect(
@@ -3,17 +3,29 @@
 import { expressionLexer } from './lexer.ts'
 import { conditionParser } from './condition-parser.ts'
 import { conditionVisitor } from './condition-visitor.ts'
-import { evaluateCondition } from './evaluator.ts'
+import { evaluateCondition, validateCondition } from './evaluator.ts'
 import { updateParser } from './update-parser.ts'
 import { updateVisitor } from './update-visitor.ts'
 import { applyUpdateExpression } from './update-evaluator.ts'
 import type {
+  AttributePath,
   ConditionExpression,
   UpdateExpression,
   EvaluationContext,
 } from './ast.ts'
 import type { DynamoDBItem } from '../types.ts'
 import type { AttributeValue } from '@aws-sdk/client-dynamodb'
+import { syntaxError } from '../errors.ts'
+import { assertAttributeValuesDefined } from './attribute-values.ts'
+import { assertDisjointPaths, resolvePaths } from './attribute-path.ts'
+
+// DynamoDB errors (plain { name, message } objects such as
+// ValidationException) pass through unchanged; anything else is wrapped
+function isServiceError(error: unknown): boolean {
+  return (
+    typeof error === 'object' && error !== null && !(error instanceof Error)
+  )
+}
 
 /**
  * Parse and evaluate a DynamoDB ConditionExpression
@@ -22,7 +34,8 @@ export function evaluateConditionExpression(
   item: DynamoDBItem | null,
   conditionExpression?: string,
   expressionAttributeNames?: Record<string, string>,
-  expressionAttributeValues?: Record<string, AttributeValue>
+  expressionAttributeValues?: Record<string, AttributeValue>,
+  expressionKind: string = 'ConditionExpression'
 ): boolean {
   // Empty or undefined expression always passes
   if (!conditionExpression || conditionExpression.trim() === '') {
@@ -35,7 +48,8 @@ export function evaluateConditionExpression(
 
     if (lexResult.errors.length > 0) {
       const error = lexResult.errors[0]
-      throw new Error(
+      throw syntaxError(
+        expressionKind,
         `Lexer error at line ${error?.line}, column ${error?.column}: ${error?.message}`
       )
     }
@@ -46,11 +60,18 @@ export function evaluateConditionExpression(
 
     if (conditionParser.errors.length > 0) {
       const error = conditionParser.errors[0]
-      throw new Error(
+      throw syntaxError(
+        expressionKind,
         `Parser error at token "${error?.token?.image}": ${error?.message}`
       )
     }
 
+    assertAttributeValuesDefined(
+      lexResult.tokens,
+      expressionAttributeValues,
+      expressionKind
+    )
+
     // Convert CST to AST
     const ast = conditionVisitor.visit(cst) as ConditionExpression
 
@@ -61,8 +82,12 @@ export function evaluateConditionExpression(
       expressionAttributeValues,
     }
 
+    validateCondition(ast, context, expressionKind)
     return evaluateCondition(ast, context)
   } catch (error: unknown) {
+    if (isServiceError(error)) {
+      throw error
+    }
     // Provide helpful error message
     const message =
       error instanceof Error ? error.message : 'Unknown evaluation error'
@@ -86,29 +111,15 @@ export function applyUpdateExpressionToItem(
   }
 
   try {
-    // Lexing
-    const lexResult = expressionLexer.tokenize(updateExpression)
-
-    if (lexResult.errors.length > 0) {
-      const error = lexResult.errors[0]
-      throw new Error(
-        `Lexer error at line ${error?.line}, column ${error?.column}: ${error?.message}`
-      )
-    }
-
-    // Parsing
-    updateParser.input = lexResult.tokens
-    const cst = updateParser.updateExpression()
-
-    if (updateParser.errors.length > 0) {
-      const error = updateParser.errors[0]
-      throw new Error(
-        `Parser error at token "${error?.token?.image}": ${error?.message}`
-      )
-    }
-
-    // Convert CST to AST
-    const ast = updateVisitor.visit(cst) as UpdateExpression
+    const ast = parseUpdateExpression(
+      updateExpression,
+      expressionAttributeValues
+    )
+    // Every action must write its own part of the item
+    assertDisjointPaths(
+      'UpdateExpression',
+      resolvePaths(actionPaths(ast), expressionAttributeNames)
+    )
 
     // Apply update
     const context: EvaluationContext = {
@@ -119,6 +130,9 @@ export function applyUpdateExpressionToItem(
 
     return applyUpdateExpression(item, ast, context)
   } catch (error: unknown) {
+    if (isServiceError(error)) {
+      throw error
+    }
     // Provide helpful error message
     const message =
       error instanceof Error ? error.message : 'Unknown update error'
@@ -128,6 +142,91 @@ export function applyUpdateExpressionToItem(
   }
 }
 
+/**
+ * The document paths an UpdateExpression writes, in the order its actions
+ * list them, for ReturnValues UPDATED_OLD and UPDATED_NEW
+ */
+export function updatedAttributePaths(
+  updateExpression: string,
+  expressionAttributeValues?: Record<string, AttributeValue>
+): AttributePath[] {
+  if (!updateExpression || updateExpression.trim() === '') {
+    return []
+  }
+  return actionPaths(
+    parseUpdateExpression(updateExpression, expressionAttributeValues)
+  )
+}
+
+/**
+ * The top-level attributes an UpdateExpression writes, with aliases
+ * resolved, whatever values it would write to them
+ */
+export function updatedAttributeNames(
+  updateExpression: string,
+  expressionAttributeNames?: Record<string, string>,
+  expressionAttributeValues?: Record<string, AttributeValue>
+): string[] {
+  return resolvePaths(
+    updatedAttributePaths(updateExpression, expressionAttributeValues),
+    expressionAttributeNames
+  ).map(([{ name }]) => name)
+}
+
+function actionPaths(ast: UpdateExpression): AttributePath[] {
+  return [
+    ...(ast.set ?? []),
+    ...(ast.remove ?? []),
+    ...(ast.add ?? []),
+    ...(ast.delete ?? []),
+  ].map((action) => action.path)
+}
+
+function parseUpdateExpression(
+  updateExpression: string,
+  expressionAttributeValues?: Record<string, AttributeValue>
+): UpdateExpression {
+  // Lexing
+  const lexResult = expressionLexer.tokenize(updateExpression)
+
+  if (lexResult.errors.length > 0) {
+    const error = lexResult.errors[0]
+    throw syntaxError(
+      'UpdateExpression',
+      `Lexer error at line ${error?.line}, column ${error?.column}: ${error?.message}`
+    )
+  }
+
+  // Parsing
+  updateParser.input = lexResult.tokens
+  const cst = updateParser.updateExpression()
+
+  if (updateParser.errors.length > 0) {
+    const error = updateParser.errors[0]
+    throw syntaxError(
+      'UpdateExpression',
+      `Parser error at token "${error?.token?.image}": ${error?.message}`
+    )
+  }
+
+  assertAttributeValuesDefined(
+    lexResult.tokens,
+    expressionAttributeValues,
+    'UpdateExpression'
+  )
+
+  // Convert CST to AST
+  return updateVisitor.visit(cst) as UpdateExpression
+}
+
+export {
+  applyProjection,
+  projectAttributePaths,
+  validateProjectionExpression,
+} from './projection.ts'
+export { validateExpressionAttributeNames } from './attribute-names.ts'
+export { validateReservedWords } from './reserved-words.ts'
+
 // Re-export types for convenience
 export type {
   ConditionExpression,
@@ -7,17 +7,18 @@ import {
   type KeyConditionAST,
 } from './key-condition-visitor.ts'
 import type { DynamoDBItem } from '../types.ts'
-import type { AttributeValue } from '@aws-sdk/client-dynamodb'
-
-function resolveAttributeName(
-  name: string,
-  expressionAttributeNames?: Record<string, string>
-): string {
-  if (name.startsWith('#') && expressionAttributeNames) {
-    return expressionAttributeNames[name] || name
-  }
-  return name
-}
+import type {
+  AttributeDefinition,
+  AttributeValue,
+} from '@aws-sdk/client-dynamodb'
+import {
+  assertBetweenBounds,
+  compareScalars,
+  hasScalarPrefix,
+} from './compare.ts'
+import { resolveAttributeName } from './attribute-names.ts'
+import { syntaxError, validationError } from '../errors.ts'
+import { assertAttributeValuesDefined } from './attribute-values.ts'
 
 function resolveAttributeValue(
   ref: string,
@@ -29,72 +30,45 @@ function resolveAttributeValue(
   return undefined
 }
 
+// Key values compare the way DynamoDB sorts them: numbers by value, and
+// strings and binaries by their bytes. Values of different types never
+// match.
 function compareValues(
   itemValue: AttributeValue,
   compareValue: AttributeValue,
   operator: string
 ): boolean {
-  // Handle string comparisons
-  if (itemValue.S !== undefined && compareValue.S !== undefined) {
-    const a = itemValue.S
-    const b = compareValue.S
-
-    switch (operator) {
-      case '=':
-        return a === b
-      case '<':
-        return a < b
-      case '>':
-        return a > b
-      case '<=':
-        return a <= b
-      case '>=':
-        return a >= b
-      case 'begins_with':
-        return a.startsWith(b)
-      default:
-        return false
-    }
+  if (operator === 'begins_with') {
+    return hasScalarPrefix(itemValue, compareValue)
   }
-
-  // Handle number comparisons
-  if (itemValue.N !== undefined && compareValue.N !== undefined) {
-    const a = parseFloat(itemValue.N)
-    const b = parseFloat(compareValue.N)
-
-    switch (operator) {
-      case '=':
-        return a === b
-      case '<':
-        return a < b
-      case '>':
-        return a > b
-      case '<=':
-        return a <= b
-      case '>=':
-        return a >= b
-      default:
-        return false
-    }
+  const comparison = compareScalars(itemValue, compareValue)
+  if (comparison === undefined) return false
+
+  switch (operator) {
+    case '=':
+      return comparison === 0
+    case '<':
+      return comparison < 0
+    case '>':
+      return comparison > 0
+    case '<=':
+      return comparison <= 0
+    case '>=':
+      return comparison >= 0
+    default:
+      return false
   }
-
-  return false
 }
 
-export function evaluateKeyCondition(
-  item: DynamoDBItem,
+function parseKeyCondition(
   keyConditionExpression: string,
-  expressionAttributeNames?: Record<string, string>,
   expressionAttributeValues?: Record<string, AttributeValue>
-): boolean {
-  if (!keyConditionExpression) {
-    return true
-  }
-
+): KeyConditionAST {
   // Lex and parse
   const lexResult = expressionLexer.tokenize(keyConditionExpression)
   if (lexResult.errors.length > 0) {
-    throw new Error(
+    throw syntaxError(
+      'KeyConditionExpression',
       `Lexer error: ${lexResult.errors.map((e) => e.message).join(', ')}`
     )
   }
@@ -103,15 +77,92 @@ export function evaluateKeyCondition(
   const cst = keyConditionParser.keyConditionExpression()
 
   if (keyConditionParser.errors.length > 0) {
-    throw new Error(
+    throw syntaxError(
+      'KeyConditionExpression',
       `Parser error: ${keyConditionParser.errors
         .map((e) => e.message)
         .join(', ')}`
     )
   }
 
+  assertAttributeValuesDefined(
+    lexResult.tokens,
+    expressionAttributeValues,
+    'KeyConditionExpression'
+  )
+
   // Visit CST to get AST
-  const ast: KeyConditionAST = keyConditionVisitor.visit(cst)
+  return keyConditionVisitor.visit(cst)
+}
+
+/**
+ * Check a KeyConditionExpression up front, independent of any item, so
+ * invalid ranges fail even when the query would match nothing.
+ */
+export function validateKeyCondition(
+  keyConditionExpression: string,
+  expressionAttributeValues?: Record<string, AttributeValue>,
+  expressionAttributeNames?: Record<string, string>,
+  attributeDefinitions: AttributeDefinition[] = []
+): void {
+  const ast = parseKeyCondition(
+    keyConditionExpression,
+    expressionAttributeValues
+  )
+
+  // Values must have the key's declared type, or nothing could ever match
+  const conditions: Array<{ attributeName: string; refs: string[] }> = [
+    {
+      attributeName: ast.partitionKey.attributeName,
+      refs: [ast.partitionKey.value],
+    },
+  ]
+  if (ast.sortKey) {
+    conditions.push({
+      attributeName: ast.sortKey.attributeName,
+      refs: ast.sortKey.value2
+        ? [ast.sortKey.value, ast.sortKey.value2]
+        : [ast.sortKey.value],
+    })
+  }
+  for (const { attributeName, refs } of conditions) {
+    const name = resolveAttributeName(attributeName, expressionAttributeNames)
+    const declared = attributeDefinitions.find(
+      (definition) => definition.AttributeName === name
+    )?.AttributeType
+    for (const ref of refs) {
+      const value = resolveAttributeValue(ref, expressionAttributeValues)
+      if (declared && value && !(declared in value)) {
+        throw validationError(
+          'SCHEMA_MISMATCH',
+          'One or more parameter values were invalid: Condition parameter type does not match schema type'
+        )
+      }
+    }
+  }
+  if (ast.sortKey?.operator === 'BETWEEN' && ast.sortKey.value2) {
+    assertBetweenBounds(
+      resolveAttributeValue(ast.sortKey.value, expressionAttributeValues),
+      resolveAttributeValue(ast.sortKey.value2, expressionAttributeValues),
+      'KeyConditionExpression'
+    )
+  }
+}
+
+export function evaluateKeyCondition(
+  item: DynamoDBItem,
+  keyConditionExpression: string,
+  expressionAttributeNames?: Record<string, string>,
+  expressionAttributeValues?: Record<string, AttributeValue>
+): boolean {
+  if (!keyConditionExpression) {
+    return true
+  }
+
+  const ast = parseKeyCondition(
+    keyConditionExpression,
+    expressionAttributeValues
+  )
 
   // Evaluate partition key condition
   const pkName = resolveAttributeName(
@@ -130,7 +181,7 @@ export function evaluateKeyCondition(
   }
 
   const itemPkValue = item[pkName]
-  if (!itemPkValue || JSON.stringify(itemPkValue) !== JSON.stringify(pkValue)) {
+  if (!itemPkValue || !compareValues(itemPkValue, pkValue, '=')) {
     return false
   }
 
@@ -31,8 +31,9 @@ class KeyConditionExpressionParser extends CstParser {
     // Partition key must be an equality
     this.SUBRULE(this.partitionKeyCondition)
 
-    // Optional sort key condition
-    this.OPTION(() => {
+    // Optional sort key condition. Further conditions are parsed so the
+    // visitor can reject them with a clear message instead of a syntax error
+    this.MANY(() => {
       this.CONSUME(And)
       this.SUBRULE(this.sortKeyCondition)
     })
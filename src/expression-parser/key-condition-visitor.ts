@@ -2,6 +2,7 @@
 
 import { keyConditionParser } from './key-condition-parser.ts'
 import type { CstNode } from 'chevrotain'
+import { validationError } from '../errors.ts'
 
 const BaseVisitor = keyConditionParser.getBaseCstVisitorConstructor()
 
@@ -41,7 +42,7 @@ interface SortKeyConditionCtx extends PartitionKeyConditionCtx {
 
 interface KeyConditionExpressionCtx {
   partitionKeyCondition: CstNode | CstNode[]
-  sortKeyCondition?: CstNode | CstNode[]
+  sortKeyCondition?: CstNode[]
 }
 
 function extractAttributeName(children: KeyChildren): string {
@@ -81,6 +82,16 @@ class KeyConditionVisitor extends BaseVisitor {
   }
 
   keyConditionExpression(ctx: KeyConditionExpressionCtx): KeyConditionAST {
+    // DynamoDB allows one condition on the sort key; a range needs BETWEEN
+    // rather than two ANDed comparisons
+    if (ctx.sortKeyCondition && ctx.sortKeyCondition.length > 1) {
+      throw validationError(
+        'EXPRESSION_SYNTAX',
+        'Invalid KeyConditionExpression: KeyConditionExpressions must only contain one condition per key; ' +
+          'use BETWEEN to bound the sort key on both sides'
+      )
+    }
+
     const partitionKey = this.visit(ctx.partitionKeyCondition)
     const sortKey = ctx.sortKeyCondition
       ? this.visit(ctx.sortKeyCondition)
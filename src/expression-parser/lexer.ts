@@ -6,11 +6,12 @@ import { createToken, Lexer } from 'chevrotain'
 // Keywords and Operators
 // ============================================================================
 
-export const And = createToken({ name: 'And', pattern: /AND\b/ })
-export const Or = createToken({ name: 'Or', pattern: /OR\b/ })
-export const Not = createToken({ name: 'Not', pattern: /NOT\b/ })
-export const Between = createToken({ name: 'Between', pattern: /BETWEEN\b/ })
-export const In = createToken({ name: 'In', pattern: /IN\b/ })
+// Keywords are case-insensitive, as in DynamoDB
+export const And = createToken({ name: 'And', pattern: /AND\b/i })
+export const Or = createToken({ name: 'Or', pattern: /OR\b/i })
+export const Not = createToken({ name: 'Not', pattern: /NOT\b/i })
+export const Between = createToken({ name: 'Between', pattern: /BETWEEN\b/i })
+export const In = createToken({ name: 'In', pattern: /IN\b/i })
 
 // Update expression keywords
 export const Set = createToken({ name: 'Set', pattern: /SET\b/ })
@@ -75,6 +76,9 @@ export const Minus = createToken({ name: 'Minus', pattern: /-/ })
 export const LParen = createToken({ name: 'LParen', pattern: /\(/ })
 export const RParen = createToken({ name: 'RParen', pattern: /\)/ })
 export const Comma = createToken({ name: 'Comma', pattern: /,/ })
+export const LBracket = createToken({ name: 'LBracket', pattern: /\[/ })
+export const RBracket = createToken({ name: 'RBracket', pattern: /\]/ })
+export const Dot = createToken({ name: 'Dot', pattern: /\./ })
 
 // ============================================================================
 // Identifiers and Literals
@@ -162,6 +166,9 @@ export const allTokens = [
   LParen,
   RParen,
   Comma,
+  LBracket,
+  RBracket,
+  Dot,
 
   // Identifiers and literals
   ExpressionAttributeName,
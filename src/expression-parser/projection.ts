@@ -0,0 +1,182 @@
+// ProjectionExpression parsing and evaluation
+
+import type { AttributeValue } from '@aws-sdk/client-dynamodb'
+import type { DynamoDBItem } from '../types.ts'
+import type { AttributePath, PathElement } from './ast.ts'
+import {
+  assertDisjointPaths,
+  resolvePaths,
+  type DocumentPath,
+} from './attribute-path.ts'
+import { expressionLexer } from './lexer.ts'
+import { conditionParser } from './condition-parser.ts'
+import { conditionVisitor } from './condition-visitor.ts'
+import { syntaxError, validationError } from '../errors.ts'
+
+/**
+ * Apply a ProjectionExpression to an item.
+ * Only the listed attributes are returned; key attributes are not added
+ * implicitly, and attributes missing from the item are simply omitted.
+ * Document paths like a.b[1].c return just the addressed element, nested
+ * inside its parent maps and lists; a path through a missing or
+ * mistyped intermediate is omitted rather than an error. Elements of one
+ * list keep their order in the list, whatever order they are listed in.
+ */
+export function applyProjection(
+  item: DynamoDBItem,
+  projectionExpression: string,
+  expressionAttributeNames?: Record<string, string>
+): DynamoDBItem {
+  return projectDocumentPaths(
+    item,
+    parseProjection(projectionExpression, expressionAttributeNames)
+  )
+}
+
+/**
+ * Project an item to document paths taken from another expression, such as
+ * the attributes an UpdateExpression wrote
+ */
+export function projectAttributePaths(
+  item: DynamoDBItem,
+  paths: AttributePath[],
+  expressionAttributeNames?: Record<string, string>
+): DynamoDBItem {
+  return projectDocumentPaths(
+    item,
+    resolvePaths(paths, expressionAttributeNames)
+  )
+}
+
+function projectDocumentPaths(
+  item: DynamoDBItem,
+  paths: DocumentPath[]
+): DynamoDBItem {
+  const projected: DynamoDBItem = {}
+  for (const [{ name }, ...elements] of paths) {
+    const value = projectElements(item[name], elements)
+    if (value === undefined) continue
+    projected[name] =
+      projected[name] === undefined
+        ? value
+        : mergeProjected(projected[name]!, value)
+  }
+
+  for (const [name, value] of Object.entries(projected)) {
+    projected[name] = compact(value)
+  }
+  return projected
+}
+
+/**
+ * Check a ProjectionExpression without an item, so a bad one fails even
+ * when a read finds nothing to project.
+ */
+export function validateProjectionExpression(
+  projectionExpression: string,
+  expressionAttributeNames?: Record<string, string>
+): void {
+  parseProjection(projectionExpression, expressionAttributeNames)
+}
+
+function parseProjection(
+  projectionExpression: string,
+  expressionAttributeNames?: Record<string, string>
+): DocumentPath[] {
+  if (projectionExpression.trim() === '') {
+    throw validationError(
+      'EXPRESSION_SYNTAX',
+      'Invalid ProjectionExpression: The expression can not be empty;'
+    )
+  }
+
+  const lexResult = expressionLexer.tokenize(projectionExpression)
+  if (lexResult.errors.length > 0) {
+    const error = lexResult.errors[0]
+    throw syntaxError(
+      'ProjectionExpression',
+      `Lexer error at line ${error?.line}, column ${error?.column}: ${error?.message}`
+    )
+  }
+
+  conditionParser.input = lexResult.tokens
+  const cst = conditionParser.projectionExpression()
+  if (conditionParser.errors.length > 0) {
+    const error = conditionParser.errors[0]
+    throw syntaxError(
+      'ProjectionExpression',
+      `Parser error at token "${error?.token?.image}": ${error?.message}`
+    )
+  }
+
+  const paths = resolvePaths(
+    conditionVisitor.visit(cst) as AttributePath[],
+    expressionAttributeNames
+  )
+  assertDisjointPaths('ProjectionExpression', paths)
+  return paths
+}
+
+// Copies the value at the path, keeping only the containers leading to it.
+// A list element is placed at its own index, leaving holes that compact
+// removes once every path is merged.
+function projectElements(
+  current: AttributeValue | undefined,
+  elements: PathElement[]
+): AttributeValue | undefined {
+  if (current === undefined) return undefined
+  const [element, ...rest] = elements
+  if (!element) return current
+
+  if (element.type === 'index') {
+    const child = projectElements(current.L?.[element.index], rest)
+    if (child === undefined) return undefined
+    const list: AttributeValue[] = []
+    list[element.index] = child
+    return { L: list }
+  }
+  const child = projectElements(current.M?.[element.name], rest)
+  return child === undefined ? undefined : { M: { [element.name]: child } }
+}
+
+// Combines two projections of the same attribute, e.g. a.b and a.c
+function mergeProjected(
+  existing: AttributeValue,
+  addition: AttributeValue
+): AttributeValue {
+  if (existing.M && addition.M) {
+    const merged = { ...existing.M }
+    for (const [key, value] of Object.entries(addition.M)) {
+      merged[key] =
+        merged[key] === undefined ? value : mergeProjected(merged[key]!, value)
+    }
+    return { M: merged }
+  }
+  if (existing.L && addition.L) {
+    // slice and forEach keep and skip the holes of unprojected elements
+    const merged = existing.L.slice()
+    addition.L.forEach((value, index) => {
+      merged[index] =
+        merged[index] === undefined
+          ? value
+          : mergeProjected(merged[index]!, value)
+    })
+    return { L: merged }
+  }
+  return addition
+}
+
+// Closes the holes projectElements left in lists
+function compact(value: AttributeValue): AttributeValue {
+  if (value.L) {
+    return { L: value.L.filter(() => true).map(compact) }
+  }
+  if (value.M) {
+    return {
+      M: Object.fromEntries(
+        Object.entries(value.M).map(([key, child]) => [key, compact(child)])
+      ),
+    }
+  }
+  return value
+}
@@ -1,5 +1,6 @@
 // Update Expression Evaluator
 
+import { validationError } from '../errors.ts'
 import type {
   UpdateExpression,
   SetAction,
@@ -7,13 +8,14 @@ import type {
   RemoveAction,
   AddAction,
   DeleteAction,
-  ArithmeticExpression,
-  IfNotExistsExpression,
-  ListAppendExpression,
   AttributePath,
+  PathElement,
+  UpdateOperand,
   Value,
   EvaluationContext,
 } from './ast.ts'
+import { resolveAttributeName as resolveAliasedName } from './attribute-names.ts'
+import { setElementKey } from './compare.ts'
 import type { DynamoDBItem } from '../types.ts'
 import type { AttributeValue } from '@aws-sdk/client-dynamodb'
 
@@ -24,10 +26,11 @@ export function applyUpdateExpression(
 ): DynamoDBItem {
   const updatedItem = { ...item }
 
-  // Apply SET actions
+  // Apply SET actions. Their values read the item as it was before the
+  // update, so SET a = b, b = a swaps two attributes.
   if (expression.set) {
     for (const action of expression.set) {
-      applySetAction(updatedItem, action, context)
+      applySetAction(updatedItem, item, action, context)
     }
   }
 
@@ -57,14 +60,14 @@ export function applyUpdateExpression(
 
 function applySetAction(
   item: DynamoDBItem,
+  original: DynamoDBItem,
   action: SetAction,
   context: EvaluationContext
 ): void {
-  const attrName = resolveAttributeName(action.path.name, context)
-  const value = evaluateSetValue(item, action.value, context)
+  const value = evaluateSetValue(original, action.value, context)
 
   if (value !== undefined) {
-    item[attrName] = value
+    updateAtPath(item, action.path, context, () => value)
   }
 }
 
@@ -73,54 +76,70 @@ function evaluateSetValue(
   value: SetValue,
   context: EvaluationContext
 ): AttributeValue | undefined {
-  // Arithmetic expression
-  if (value.type === 'arithmetic') {
-    const expr = value as ArithmeticExpression
-    const left = resolveOperand(item, expr.left, context)
-    const right = resolveOperand(item, expr.right, context)
-
-    const leftNum = getNumericValue(left)
-    const rightNum = getNumericValue(right)
-
-    if (leftNum !== null && rightNum !== null) {
-      const result =
-        expr.operator === '+' ? leftNum + rightNum : leftNum - rightNum
-      return { N: String(result) }
-    }
-
-    return undefined
+  if (value.type !== 'arithmetic') {
+    return evaluateOperand(item, value, context)
   }
 
-  // if_not_exists function
-  if (value.type === 'if_not_exists') {
-    const expr = value as IfNotExistsExpression
-    const attrName = resolveAttributeName(expr.path.name, context)
-
-    if (attrName in item) {
-      return item[attrName]
+  // Both sides of + and - must be numbers that exist
+  const [left, right] = [value.left, value.right].map((operand) => {
+    const number = existingOperand(item, operand, context)
+    if (!isNumberAttribute(number)) {
+      throw validationError(
+        'TYPE_MISMATCH',
+        'An operand in the update expression has an incorrect data type'
+      )
     }
+    return number.N
+  })
+  return { N: addNumbers(left!, right!, value.operator === '-') }
+}
 
-    return resolveValue(expr.defaultValue, context)
-  }
-
-  // list_append function
-  if (value.type === 'list_append') {
-    const expr = value as ListAppendExpression
-    const list1 = resolveOperand(item, expr.list1, context)
-    const list2 = resolveOperand(item, expr.list2, context)
-
-    const arr1 = toAttributeValueArray(list1)
-    const arr2 = toAttributeValueArray(list2)
-
-    return { L: [...arr1, ...arr2] }
+function evaluateOperand(
+  item: DynamoDBItem,
+  operand: UpdateOperand,
+  context: EvaluationContext
+): AttributeValue | undefined {
+  switch (operand.type) {
+    case 'attribute_path':
+      return getAtPath(item, operand, context)
+    case 'value':
+      return resolveValue(operand, context)
+    case 'if_not_exists':
+      return (
+        getAtPath(item, operand.path, context) ??
+        evaluateOperand(item, operand.defaultValue, context)
+      )
+    case 'list_append': {
+      const lists = [operand.list1, operand.list2].map((list) => {
+        const value = existingOperand(item, list, context)
+        if (!value.L) {
+          throw validationError(
+            'TYPE_MISMATCH',
+            `Invalid UpdateExpression: Incorrect operand type for operator or function; operator or function: list_append, operand type: ${Object.keys(value)[0]}`
+          )
+        }
+        return value.L
+      })
+      return { L: lists.flat() }
+    }
   }
+}
 
-  // Simple value
-  if (value.type === 'value') {
-    return resolveValue(value as Value, context)
+// Functions and arithmetic cannot read an attribute the item lacks
+function existingOperand(
+  item: DynamoDBItem,
+  operand: UpdateOperand,
+  context: EvaluationContext
+): AttributeValue {
+  const value = evaluateOperand(item, operand, context)
+  if (value === undefined) {
+    throw {
+      name: 'ValidationException',
+      message:
+        'The provided expression refers to an attribute that does not exist in the item',
+    }
   }
-
-  return undefined
+  return value
 }
 
 function applyRemoveAction(
@@ -128,8 +147,7 @@ function applyRemoveAction(
   action: RemoveAction,
   context: EvaluationContext
 ): void {
-  const attrName = resolveAttributeName(action.path.name, context)
-  delete item[attrName]
+  updateAtPath(item, action.path, context, () => undefined)
 }
 
 function applyAddAction(
@@ -137,32 +155,199 @@ function applyAddAction(
   action: AddAction,
   context: EvaluationContext
 ): void {
-  const attrName = resolveAttributeName(action.path.name, context)
   const addValue = resolveValue(action.value, context)
 
-  if (!isNumberAttribute(addValue)) return
+  // ADD of a number to a missing attribute, including on an item the
+  // update creates, starts from zero
+  if (isNumberAttribute(addValue)) {
+    const addend = addValue.N
+    updateAtPath(item, action.path, context, (currentValue) => {
+      if (currentValue !== undefined && !isNumberAttribute(currentValue)) {
+        throw validationError(
+          'TYPE_MISMATCH',
+          'An operand in the update expression has an incorrect data type'
+        )
+      }
+      return { N: addNumbers(currentValue?.N ?? '0', addend) }
+    })
+    return
+  }
 
-  const currentValue = item[attrName]
-  const currentNum = isNumberAttribute(currentValue)
-    ? parseInt(currentValue.N)
-    : 0
-  const addNum = parseInt(addValue.N)
+  // ADD of a set is a union with the existing set of the same type
+  const setType = SET_TYPES.find((type) => addValue?.[type] !== undefined)
+  if (!setType) {
+    throw validationError(
+      'TYPE_MISMATCH',
+      'An operand in the update expression has an incorrect data type'
+    )
+  }
 
-  item[attrName] = { N: String(currentNum + addNum) }
+  updateAtPath(item, action.path, context, (currentValue) => {
+    if (currentValue !== undefined && currentValue[setType] === undefined) {
+      throw validationError(
+        'TYPE_MISMATCH',
+        'An operand in the update expression has an incorrect data type'
+      )
+    }
+    const current = (currentValue?.[setType] ?? []) as SetElement[]
+    const additions = addValue![setType] as SetElement[]
+    const keyOf = (element: SetElement) => setElementKey(setType, element)
+    const seen = new Set(current.map(keyOf))
+    const union = [...current]
+    for (const element of additions) {
+      const key = keyOf(element)
+      if (!seen.has(key)) {
+        seen.add(key)
+        union.push(element)
+      }
+    }
+    return { [setType]: union } as AttributeValue
+  })
 }
 
+const SET_TYPES = ['SS', 'NS', 'BS'] as const
+type SetElement = string | Uint8Array
+
 function applyDeleteAction(
   item: DynamoDBItem,
   action: DeleteAction,
   context: EvaluationContext
 ): void {
-  const attrName = resolveAttributeName(action.path.name, context)
   const deleteValue = resolveValue(action.value, context)
+  const setType = SET_TYPES.find((type) => deleteValue?.[type] !== undefined)
+  if (!setType) {
+    throw validationError(
+      'TYPE_MISMATCH',
+      'An operand in the update expression has an incorrect data type'
+    )
+  }
+
+  // DELETE is a set difference; deleting from an absent set is a no-op
+  updateAtPath(item, action.path, context, (currentValue) => {
+    if (currentValue === undefined) return undefined
+    if (currentValue[setType] === undefined) {
+      throw validationError(
+        'TYPE_MISMATCH',
+        'An operand in the update expression has an incorrect data type'
+      )
+    }
+    const keyOf = (element: SetElement) => setElementKey(setType, element)
+    const removals = deleteValue![setType] as SetElement[]
+    const removed = new Set(removals.map(keyOf))
+    const remaining = (currentValue[setType] as SetElement[]).filter(
+      (element) => !removed.has(keyOf(element))
+    )
+    // Empty sets cannot be stored, so the last element takes the attribute
+    return remaining.length > 0
+      ? ({ [setType]: remaining } as AttributeValue)
+      : undefined
+  })
+}
+
+// Document path helpers
+
+function invalidDocumentPath(): object {
+  return {
+    name: 'ValidationException',
+    message:
+      'The document path provided in the update expression is invalid for update',
+  }
+}
+
+function getAtPath(
+  item: DynamoDBItem,
+  path: AttributePath,
+  context: EvaluationContext
+): AttributeValue | undefined {
+  let current: AttributeValue | undefined =
+    item[resolveAttributeName(path.name, context)]
+  for (const element of path.elements ?? []) {
+    if (element.type === 'index') {
+      current = current?.L?.[element.index]
+    } else {
+      current = current?.M?.[resolveAttributeName(element.name, context)]
+    }
+  }
+  return current
+}
+
+// Replaces the element at path with update(current), or removes it when
+// update returns undefined. Containers along the path are copied so the
+// original item is never mutated.
+function updateAtPath(
+  item: DynamoDBItem,
+  path: AttributePath,
+  context: EvaluationContext,
+  update: (current: AttributeValue | undefined) => AttributeValue | undefined
+): void {
+  const attrName = resolveAttributeName(path.name, context)
+  const result = updateElement(
+    item[attrName],
+    path.elements ?? [],
+    context,
+    update
+  )
+  if (result === undefined) {
+    delete item[attrName]
+  } else {
+    item[attrName] = result
+  }
+}
+
+function updateElement(
+  current: AttributeValue | undefined,
+  elements: PathElement[],
+  context: EvaluationContext,
+  update: (current: AttributeValue | undefined) => AttributeValue | undefined
+): AttributeValue | undefined {
+  const [element, ...rest] = elements
+  if (!element) {
+    return update(current)
+  }
+
+  if (element.type === 'index') {
+    if (!current?.L) {
+      throw invalidDocumentPath()
+    }
+    const list = [...current.L]
+    const existing = list[element.index]
+    if (existing === undefined && rest.length > 0) {
+      throw invalidDocumentPath()
+    }
 
-  // DELETE is used for removing elements from sets
-  // For now, we'll skip this implementation as it's complex
-  // and not used in our current tests
-  console.warn(`DELETE action not fully implemented for ${attrName}`)
+    const updated = updateElement(existing, rest, context, update)
+    if (updated === undefined) {
+      // Removing past the end of a list is a no-op
+      list.splice(element.index, 1)
+    } else if (element.index > list.length) {
+      // Setting exactly at the end appends; anything further leaves a gap
+      throw {
+        name: 'ValidationException',
+        message: `List index ${element.index} is out of bounds for a list of length ${list.length}`,
+      }
+    } else {
+      list[element.index] = updated
+    }
+    return { L: list }
+  }
+
+  if (!current?.M) {
+    throw invalidDocumentPath()
+  }
+  const key = resolveAttributeName(element.name, context)
+  const map = { ...current.M }
+  const existing = map[key]
+  if (existing === undefined && rest.length > 0) {
+    throw invalidDocumentPath()
+  }
+
+  const updated = updateElement(existing, rest, context, update)
+  if (updated === undefined) {
+    delete map[key]
+  } else {
+    map[key] = updated
+  }
+  return { M: map }
 }
 
 // Helper functions
@@ -171,10 +356,7 @@ function resolveAttributeName(
   name: string,
   context: EvaluationContext
 ): string {
-  if (name.startsWith('#')) {
-    return context.expressionAttributeNames?.[name] || name
-  }
-  return name
+  return resolveAliasedName(name, context.expressionAttributeNames)
 }
 
 function resolveValue(
@@ -191,70 +373,46 @@ function resolveValue(
   return undefined
 }
 
-function resolveOperand(
-  item: DynamoDBItem,
-  operand: AttributePath | Value,
-  context: EvaluationContext
-): AttributeValue | AttributeValue[] | undefined {
-  if (operand.type === 'attribute_path') {
-    const attrName = resolveAttributeName(operand.name, context)
-    return item[attrName]
-  }
-
-  if (operand.type === 'value') {
-    return resolveValue(operand, context)
-  }
-
-  return undefined
+// Exact decimal arithmetic, since DynamoDB numbers carry up to 38
+// significant digits that floats would round
+function addNumbers(a: string, b: string, subtract = false): string {
+  const x = toDecimal(a)
+  const y = toDecimal(b)
+  const scale = Math.max(x.scale, y.scale)
+  const align = (decimal: Decimal) =>
+    decimal.units * 10n ** BigInt(scale - decimal.scale)
+  const sum = align(x) + (subtract ? -align(y) : align(y))
+
+  const digits = (sum < 0n ? -sum : sum).toString().padStart(scale + 1, '0')
+  const whole = digits.slice(0, digits.length - scale)
+  const fraction = digits.slice(digits.length - scale).replace(/0+$/, '')
+  return `${sum < 0n ? '-' : ''}${whole}${fraction ? `.${fraction}` : ''}`
 }
 
-function getNumericValue(
-  value: AttributeValue | AttributeValue[] | undefined
-): number | null {
-  if (value === null || value === undefined) return null
-
-  if (Array.isArray(value)) {
-    return null
-  }
-
-  if (
-    typeof value === 'object' &&
-    value !== null &&
-    'N' in value &&
-    value.N !== undefined
-  ) {
-    const num = parseFloat(value.N)
-    return isNaN(num) ? null : num
-  }
-
-  if (typeof value === 'number') {
-    return value
-  }
-
-  if (typeof value === 'string') {
-    const num = parseFloat(value)
-    return isNaN(num) ? null : num
-  }
-
-  return null
+// A number as units of 10^-scale
+interface Decimal {
+  units: bigint
+  scale: number
 }
 
-function toAttributeValueArray(
-  value: AttributeValue | AttributeValue[] | undefined
-): AttributeValue[] {
-  if (!value) return []
-  if (Array.isArray(value)) {
-    return value
+function toDecimal(value: string): Decimal {
+  const match = /^([+-]?)(\d*)(?:\.(\d*))?(?:[eE]([+-]?\d+))?$/.exec(
+    value.trim()
+  )
+  if (!match) {
+    throw validationError(
+      'TYPE_MISMATCH',
+      'An operand in the update expression has an incorrect data type'
+    )
   }
-  if (
-    typeof value === 'object' &&
-    value !== null &&
-    'L' in value &&
-    Array.isArray(value.L)
-  ) {
-    return value.L as AttributeValue[]
+  const [, sign, whole = '', fraction = '', exponent = '0'] = match
+  let units = BigInt(`${whole}${fraction}` || '0')
+  let scale = fraction.length - Number(exponent)
+  if (scale < 0) {
+    units *= 10n ** BigInt(-scale)
+    scale = 0
   }
-  return []
+  return { units: sign === '-' ? -units : units, scale }
 }
 
 function isNumberAttribute(
@@ -13,6 +13,9 @@ import {
   Comma,
   LParen,
   RParen,
+  LBracket,
+  RBracket,
+  Dot,
   ExpressionAttributeName,
   ExpressionAttributeValue,
   Identifier,
@@ -57,64 +60,48 @@ class UpdateExpressionParser extends CstParser {
     this.SUBRULE(this.setValue, { LABEL: 'value' })
   })
 
-  // SET value: can be literal, expression attribute value, or function
+  // SET value: an operand, or the sum or difference of two
   private setValue = this.RULE('setValue', () => {
-    this.OR([
-      // Arithmetic: path + value or path - value
-      {
-        ALT: () => {
-          this.SUBRULE(this.attributePath, { LABEL: 'left' })
-          this.OR2([
-            { ALT: () => this.CONSUME(Plus, { LABEL: 'operator' }) },
-            { ALT: () => this.CONSUME(Minus, { LABEL: 'operator' }) },
-          ])
-          this.SUBRULE(this.operandValue, { LABEL: 'right' })
-        },
-      },
-
-      // if_not_exists(path, value)
-      {
-        ALT: () => {
-          this.CONSUME(IfNotExists)
-          this.CONSUME(LParen)
-          this.SUBRULE2(this.attributePath, { LABEL: 'path' })
-          this.CONSUME(Comma)
-          this.SUBRULE2(this.operandValue, { LABEL: 'default' })
-          this.CONSUME(RParen)
-        },
-      },
-
-      // list_append(list1, list2)
-      {
-        ALT: () => {
-          this.CONSUME(ListAppend)
-          this.CONSUME2(LParen)
-          this.OR3([
-            {
-              ALT: () => this.SUBRULE3(this.attributePath, { LABEL: 'list1' }),
-            },
-            { ALT: () => this.SUBRULE3(this.operandValue, { LABEL: 'list1' }) },
-          ])
-          this.CONSUME2(Comma)
-          this.OR4([
-            {
-              ALT: () => this.SUBRULE4(this.attributePath, { LABEL: 'list2' }),
-            },
-            { ALT: () => this.SUBRULE4(this.operandValue, { LABEL: 'list2' }) },
-          ])
-          this.CONSUME2(RParen)
-        },
-      },
+    this.SUBRULE(this.updateOperand, { LABEL: 'left' })
+    this.OPTION(() => {
+      this.OR([
+        { ALT: () => this.CONSUME(Plus, { LABEL: 'operator' }) },
+        { ALT: () => this.CONSUME(Minus, { LABEL: 'operator' }) },
+      ])
+      this.SUBRULE2(this.updateOperand, { LABEL: 'right' })
+    })
+  })
 
-      // Simple value
-      {
-        ALT: () => {
-          this.SUBRULE5(this.operandValue)
-        },
-      },
+  // Operand: a function, an attribute path, or a value
+  private updateOperand = this.RULE('updateOperand', () => {
+    this.OR([
+      { ALT: () => this.SUBRULE(this.ifNotExists) },
+      { ALT: () => this.SUBRULE(this.listAppend) },
+      { ALT: () => this.SUBRULE(this.attributePath) },
+      { ALT: () => this.SUBRULE(this.operandValue) },
     ])
   })
 
+  // if_not_exists(path, operand)
+  private ifNotExists = this.RULE('ifNotExists', () => {
+    this.CONSUME(IfNotExists)
+    this.CONSUME(LParen)
+    this.SUBRULE(this.attributePath, { LABEL: 'path' })
+    this.CONSUME(Comma)
+    this.SUBRULE(this.updateOperand, { LABEL: 'default' })
+    this.CONSUME(RParen)
+  })
+
+  // list_append(operand, operand)
+  private listAppend = this.RULE('listAppend', () => {
+    this.CONSUME(ListAppend)
+    this.CONSUME(LParen)
+    this.SUBRULE(this.updateOperand, { LABEL: 'list1' })
+    this.CONSUME(Comma)
+    this.SUBRULE2(this.updateOperand, { LABEL: 'list2' })
+    this.CONSUME(RParen)
+  })
+
   // REMOVE clause: REMOVE path, path2, ...
   private removeClause = this.RULE('removeClause', () => {
     this.CONSUME(Remove)
@@ -157,12 +144,32 @@ class UpdateExpressionParser extends CstParser {
     this.SUBRULE(this.operandValue, { LABEL: 'value' })
   })
 
-  // Attribute path (for now, just a simple name)
+  // Attribute path: a name followed by nested map keys and list indexes
   private attributePath = this.RULE('attributePath', () => {
     this.OR([
       { ALT: () => this.CONSUME(ExpressionAttributeName) },
       { ALT: () => this.CONSUME(Identifier) },
     ])
+    this.MANY(() => {
+      this.OR2([
+        {
+          ALT: () => {
+            this.CONSUME(Dot)
+            this.OR3([
+              { ALT: () => this.CONSUME2(ExpressionAttributeName) },
+              { ALT: () => this.CONSUME2(Identifier) },
+            ])
+          },
+        },
+        {
+          ALT: () => {
+            this.CONSUME(LBracket)
+            this.CONSUME(NumberLiteral)
+            this.CONSUME(RBracket)
+          },
+        },
+      ])
+    })
   })
 
   // Operand value (expression attribute value or literal)
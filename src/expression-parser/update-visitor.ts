@@ -13,8 +13,11 @@ import type {
   IfNotExistsExpression,
   ListAppendExpression,
   AttributePath,
+  UpdateOperand,
   Value,
 } from './ast.ts'
+import { buildAttributePath } from './attribute-path.ts'
+import { validationError } from '../errors.ts'
 
 const BaseVisitor = updateParser.getBaseCstVisitorConstructor()
 
@@ -38,16 +41,26 @@ interface SetActionCtx {
 }
 
 interface SetValueCtx {
+  left: NodeArray
   operator?: TokenArray
-  left?: NodeArray
   right?: NodeArray
-  IfNotExists?: TokenArray
-  path?: NodeArray
-  default?: NodeArray
-  ListAppend?: TokenArray
-  list1?: NodeArray
-  list2?: NodeArray
-  operandValue: NodeArray
+}
+
+interface UpdateOperandCtx {
+  ifNotExists?: NodeArray
+  listAppend?: NodeArray
+  attributePath?: NodeArray
+  operandValue?: NodeArray
+}
+
+interface IfNotExistsCtx {
+  path: NodeArray
+  default: NodeArray
+}
+
+interface ListAppendCtx {
+  list1: NodeArray
+  list2: NodeArray
 }
 
 interface RemoveClauseCtx {
@@ -75,6 +88,7 @@ interface DeleteActionCtx {
 interface AttributePathCtx {
   ExpressionAttributeName?: TokenArray
   Identifier?: TokenArray
+  NumberLiteral?: TokenArray
 }
 
 interface OperandValueCtx {
@@ -90,6 +104,22 @@ class UpdateVisitor extends BaseVisitor {
   }
 
   updateExpression(ctx: UpdateExpressionCtx): UpdateExpression {
+    // Clauses may come in any order, but each only once
+    const sections = {
+      SET: ctx.setClause,
+      REMOVE: ctx.removeClause,
+      ADD: ctx.addClause,
+      DELETE: ctx.deleteClause,
+    }
+    for (const [section, clauses] of Object.entries(sections)) {
+      if (clauses && clauses.length > 1) {
+        throw validationError(
+          'EXPRESSION_SYNTAX',
+          `Invalid UpdateExpression: The "${section}" section can only be used once in an update expression;`
+        )
+      }
+    }
+
     const result: UpdateExpression = {}
 
     if (ctx.setClause) {
@@ -153,50 +183,44 @@ class UpdateVisitor extends BaseVisitor {
   }
 
   setValue(ctx: SetValueCtx): SetValue {
-    // Arithmetic expression
-    if (ctx.operator) {
-      const operatorToken = ctx.operator[0]
-      if (!operatorToken) {
-        throw new Error('Arithmetic operator missing symbol')
-      }
-      const operator = operatorToken.image === '+' ? '+' : '-'
-      if (!ctx.left || !ctx.right) {
-        throw new Error('Arithmetic set expression missing operands')
-      }
-      return {
-        type: 'arithmetic',
-        operator,
-        left: this.visit(ctx.left),
-        right: this.visit(ctx.right),
-      } as ArithmeticExpression
+    const left: UpdateOperand = this.visit(ctx.left)
+    if (!ctx.operator) return left
+
+    const operatorToken = ctx.operator[0]
+    if (!operatorToken || !ctx.right) {
+      throw new Error('Arithmetic set expression missing operands')
     }
+    return {
+      type: 'arithmetic',
+      operator: operatorToken.image === '+' ? '+' : '-',
+      left,
+      right: this.visit(ctx.right),
+    } as ArithmeticExpression
+  }
 
-    // if_not_exists function
-    if (ctx.IfNotExists) {
-      if (!ctx.path || !ctx.default) {
-        throw new Error('if_not_exists requires path and default value')
-      }
-      return {
-        type: 'if_not_exists',
-        path: this.visit(ctx.path),
-        defaultValue: this.visit(ctx.default),
-      } as IfNotExistsExpression
+  updateOperand(ctx: UpdateOperandCtx): UpdateOperand {
+    const node =
+      ctx.ifNotExists ?? ctx.listAppend ?? ctx.attributePath ?? ctx.operandValue
+    if (!node) {
+      throw new Error('Unknown update operand')
     }
+    return this.visit(node)
+  }
 
-    // list_append function
-    if (ctx.ListAppend) {
-      if (!ctx.list1 || !ctx.list2) {
-        throw new Error('list_append requires two list operands')
-      }
-      return {
-        type: 'list_append',
-        list1: this.visit(ctx.list1),
-        list2: this.visit(ctx.list2),
-      } as ListAppendExpression
+  ifNotExists(ctx: IfNotExistsCtx): IfNotExistsExpression {
+    return {
+      type: 'if_not_exists',
+      path: this.visit(ctx.path),
+      defaultValue: this.visit(ctx.default),
     }
+  }
 
-    // Simple value
-    return this.visit(ctx.operandValue)
+  listAppend(ctx: ListAppendCtx): ListAppendExpression {
+    return {
+      type: 'list_append',
+      list1: this.visit(ctx.list1),
+      list2: this.visit(ctx.list2),
+    }
   }
 
   removeClause(ctx: RemoveClauseCtx): RemoveAction[] {
@@ -233,14 +257,11 @@ class UpdateVisitor extends BaseVisitor {
   }
 
   attributePath(ctx: AttributePathCtx): AttributePath {
-    const token = ctx.ExpressionAttributeName?.[0] || ctx.Identifier?.[0]
-    if (!token) {
-      throw new Error('Attribute path missing identifier')
-    }
-    return {
-      type: 'attribute_path',
-      name: token.image,
-    }
+    return buildAttributePath([
+      ...(ctx.ExpressionAttributeName ?? []),
+      ...(ctx.Identifier ?? []),
+      ...(ctx.NumberLiteral ?? []),
+    ])
   }
 
   operandValue(ctx: OperandValueCtx): Value {
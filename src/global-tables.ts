@@ -0,0 +1,162 @@
+// Global tables: a table name replicated across regions, each region served
+// from its own tables. GlobalTableStore keeps which regions replicate each
+// global table; ItemVersionStore keeps, per replica, when each item was
+// last written and where, so replicated writes settle last writer wins.
+
+import { Database } from 'bun:sqlite'
+import * as fs from 'fs'
+
+export interface GlobalTableInfo {
+  globalTableName: string
+  regions: string[]
+  createdAt: number // Milliseconds since epoch
+}
+
+export class GlobalTableStore {
+  private db: Database
+
+  constructor(dataDir: string) {
+    if (!fs.existsSync(dataDir)) {
+      fs.mkdirSync(dataDir, { recursive: true })
+    }
+    this.db = new Database(`${dataDir}/global-tables.db`)
+
+    this.db.run(`
+      CREATE TABLE IF NOT EXISTS global_tables (
+        global_table_name TEXT PRIMARY KEY,
+        regions TEXT NOT NULL,
+        created_at INTEGER NOT NULL
+      )
+    `)
+  }
+
+  createGlobalTable(info: GlobalTableInfo): void {
+    this.db.run(
+      `INSERT INTO global_tables (global_table_name, regions, created_at)
+       VALUES (?, ?, ?)`,
+      [info.globalTableName, JSON.stringify(info.regions), info.createdAt]
+    )
+  }
+
+  getGlobalTable(globalTableName: string): GlobalTableInfo | null {
+    const row = this.db
+      .query<GlobalTableRow, [string]>(
+        'SELECT * FROM global_tables WHERE global_table_name = ?'
+      )
+      .get(globalTableName)
+    return row ? toGlobalTableInfo(row) : null
+  }
+
+  // In name order, as ListGlobalTables returns them
+  listGlobalTables(): GlobalTableInfo[] {
+    return this.db
+      .query<GlobalTableRow, []>(
+        'SELECT * FROM global_tables ORDER BY global_table_name'
+      )
+      .all()
+      .map(toGlobalTableInfo)
+  }
+
+  setRegions(globalTableName: string, regions: string[]): void {
+    this.db.run(
+      'UPDATE global_tables SET regions = ? WHERE global_table_name = ?',
+      [JSON.stringify(regions), globalTableName]
+    )
+  }
+
+  close() {
+    this.db.close()
+  }
+}
+
+interface GlobalTableRow {
+  global_table_name: string
+  regions: string
+  created_at: number
+}
+
+function toGlobalTableInfo(row: GlobalTableRow): GlobalTableInfo {
+  return {
+    globalTableName: row.global_table_name,
+    regions: JSON.parse(row.regions),
+    createdAt: row.created_at,
+  }
+}
+
+// When and where an item was last written
+export interface ItemVersion {
+  updatedAt: number // Milliseconds since epoch
+  region: string
+}
+
+/**
+ * Whether a replicated write should replace the replica's current one: the
+ * later write wins, and of two made in the same millisecond the one from
+ * the region that sorts last, so every replica settles on the same item.
+ */
+export function isNewerVersion(
+  incoming: ItemVersion,
+  current: ItemVersion
+): boolean {
+  if (incoming.updatedAt !== current.updatedAt) {
+    return incoming.updatedAt > current.updatedAt
+  }
+  return incoming.region > current.region
+}
+
+export class ItemVersionStore {
+  private db: Database
+
+  constructor(dataDir: string) {
+    if (!fs.existsSync(dataDir)) {
+      fs.mkdirSync(dataDir, { recursive: true })
+    }
+    this.db = new Database(`${dataDir}/replication.db`)
+
+    // Deleted items keep their version, so an older write replicated after
+    // the delete does not bring them back
+    this.db.run(`
+      CREATE TABLE IF NOT EXISTS item_versions (
+        table_name TEXT NOT NULL,
+        item_key TEXT NOT NULL,
+        updated_at INTEGER NOT NULL,
+        region TEXT NOT NULL,
+        PRIMARY KEY (table_name, item_key)
+      )
+    `)
+  }
+
+  get(tableName: string, key: string): ItemVersion | null {
+    const row = this.db
+      .query<{ updated_at: number; region: string }, [string, string]>(
+        `SELECT updated_at, region FROM item_versions
+         WHERE table_name = ? AND item_key = ?`
+      )
+      .get(tableName, key)
+    return row ? { updatedAt: row.updated_at, region: row.region } : null
+  }
+
+  set(tableName: string, key: string, version: ItemVersion): void {
+    this.db.run(
+      `INSERT OR REPLACE INTO item_versions
+       (table_name, item_key, updated_at, region) VALUES (?, ?, ?, ?)`,
+      [tableName, key, version.updatedAt, version.region]
+    )
+  }
+
+  // Forgets a table's versions when the table is deleted
+  drop(tableName: string): void {
+    this.db.run('DELETE FROM item_versions WHERE table_name = ?', [tableName])
+  }
+
+  close() {
+    this.db.close()
+  }
+}
+
+// The region a request was signed for, from the SigV4 credential scope
+// <key>/<date>/<region>/<service>/aws4_request
+export function requestRegion(req: Request): string | undefined {
+  const authorization = req.headers.get('authorization') ?? ''
+  return /Credential=[^/,]*\/[^/,]*\/([^/,]+)\//.exec(authorization)?.[1]
+}
@@ -0,0 +1,415 @@
+// Table imports: ImportTable reads items in DynamoDB JSON, CSV or Ion from
+// the objects under a prefix of a bucket, kept in a local directory or on an
+// S3-compatible endpoint
+
+import { Database } from 'bun:sqlite'
+import type {
+  AttributeValue,
+  ImportTableCommandInput,
+  InputCompressionType,
+  InputFormat,
+  ScalarAttributeType,
+} from '@aws-sdk/client-dynamodb'
+import * as fs from 'fs'
+import * as path from 'path'
+import { parseIon, type IonValue } from './ion.ts'
+import type { DynamoDBItem } from './types.ts'
+
+export interface ImportInfo {
+  importArn: string
+  tableArn: string
+  clientToken?: string
+  // The request, less its ClientToken
+  request: Omit<ImportTableCommandInput, 'ClientToken'>
+  status: 'COMPLETED' | 'FAILED'
+  startTime: number // Milliseconds since epoch, as is endTime
+  endTime: number
+  processedSizeBytes: number
+  processedItemCount: number
+  importedItemCount: number
+  errorCount: number
+  failureCode?: string
+  failureMessage?: string
+}
+
+export class ImportStore {
+  private db: Database
+
+  constructor(dataDir: string) {
+    if (!fs.existsSync(dataDir)) {
+      fs.mkdirSync(dataDir, { recursive: true })
+    }
+    this.db = new Database(`${dataDir}/imports.db`)
+
+    this.db.run(`
+      CREATE TABLE IF NOT EXISTS imports (
+        import_arn TEXT PRIMARY KEY,
+        table_arn TEXT NOT NULL,
+        client_token TEXT,
+        import_data TEXT NOT NULL
+      )
+    `)
+  }
+
+  createImport(info: ImportInfo): void {
+    this.db.run(
+      `INSERT INTO imports (import_arn, table_arn, client_token, import_data)
+       VALUES (?, ?, ?, ?)`,
+      [
+        info.importArn,
+        info.tableArn,
+        info.clientToken ?? null,
+        JSON.stringify(info),
+      ]
+    )
+  }
+
+  getImport(importArn: string): ImportInfo | null {
+    const row = this.db
+      .query<{ import_data: string }, [string]>(
+        'SELECT import_data FROM imports WHERE import_arn = ?'
+      )
+      .get(importArn)
+    return row ? JSON.parse(row.import_data) : null
+  }
+
+  findByClientToken(clientToken: string): ImportInfo | null {
+    const row = this.db
+      .query<{ import_data: string }, [string]>(
+        'SELECT import_data FROM imports WHERE client_token = ?'
+      )
+      .get(clientToken)
+    return row ? JSON.parse(row.import_data) : null
+  }
+
+  // Oldest first, so ListImports pages are stable
+  listImports(tableArn?: string): ImportInfo[] {
+    const rows = tableArn
+      ? this.db
+          .query<{ import_data: string }, [string]>(
+            'SELECT import_data FROM imports WHERE table_arn = ? ORDER BY rowid'
+          )
+          .all(tableArn)
+      : this.db
+          .query<{ import_data: string }, []>(
+            'SELECT import_data FROM imports ORDER BY rowid'
+          )
+          .all()
+    return rows.map((row) => JSON.parse(row.import_data))
+  }
+
+  close() {
+    this.db.close()
+  }
+}
+
+// Where import files are read from, by key within a bucket
+export interface ImportSource {
+  // Keys starting with prefix, in key order
+  list(prefix: string): Promise<string[]>
+  read(key: string): Promise<Uint8Array>
+}
+
+// Reads bucket keys as files under <dir>/<bucket>/
+export function localSource(dir: string, bucket: string): ImportSource {
+  const root = path.join(dir, bucket)
+  return {
+    async list(prefix) {
+      if (!fs.existsSync(root)) return []
+      const entries = await fs.promises.readdir(root, {
+        recursive: true,
+        withFileTypes: true,
+      })
+      return entries
+        .filter((entry) => entry.isFile())
+        .map((entry) =>
+          path
+            .relative(root, path.join(entry.parentPath, entry.name))
+            .split(path.sep)
+            .join('/')
+        )
+        .filter((key) => key.startsWith(prefix))
+        .sort()
+    },
+    async read(key) {
+      return fs.promises.readFile(path.join(root, key))
+    },
+  }
+}
+
+// Reads from a bucket on an S3-compatible endpoint; credentials come from
+// the S3_* or AWS_* environment variables
+export function s3Source(endpoint: string, bucket: string): ImportSource {
+  const client = new Bun.S3Client({ endpoint, bucket })
+  return {
+    async list(prefix) {
+      const keys: string[] = []
+      let continuationToken: string | undefined
+      do {
+        const page = await client.list({ prefix, continuationToken })
+        keys.push(...(page.contents ?? []).map((object) => object.key))
+        continuationToken = page.isTruncated
+          ? page.nextContinuationToken
+          : undefined
+      } while (continuationToken)
+      return keys.sort()
+    },
+    async read(key) {
+      return client.file(key).bytes()
+    },
+  }
+}
+
+export interface ImportOptions {
+  format: InputFormat
+  compression: InputCompressionType
+  // For CSV: the field delimiter, and the column names when the files have
+  // no header line
+  delimiter?: string
+  headerList?: string[]
+  // Types of the attributes the table defines; other CSV columns are strings
+  attributeTypes: Record<string, ScalarAttributeType>
+}
+
+export interface ImportedItems {
+  items: DynamoDBItem[]
+  // Lines or values that are not items
+  errorCount: number
+  processedSizeBytes: number
+}
+
+/**
+ * Reads the items of every object under prefix. An item that cannot be
+ * parsed counts as an error and is skipped, as DynamoDB does; an object
+ * that cannot be decompressed or parsed at all throws, failing the whole
+ * import.
+ */
+export async function readImport(
+  source: ImportSource,
+  prefix: string,
+  options: ImportOptions
+): Promise<ImportedItems> {
+  const keys = await source.list(prefix)
+  if (keys.length === 0) {
+    throw new Error(`No objects found under the prefix '${prefix}'`)
+  }
+
+  const result: ImportedItems = {
+    items: [],
+    errorCount: 0,
+    processedSizeBytes: 0,
+  }
+  for (const key of keys) {
+    const data = await source.read(key)
+    result.processedSizeBytes += data.length
+    try {
+      const text = new TextDecoder().decode(
+        decompress(data, options.compression)
+      )
+      const { items, errorCount } = parseObject(text, options)
+      result.items.push(...items)
+      result.errorCount += errorCount
+    } catch (error: unknown) {
+      const message = error instanceof Error ? error.message : String(error)
+      throw new Error(`Failed to read ${key}: ${message}`)
+    }
+  }
+  return result
+}
+
+function decompress(
+  data: Uint8Array,
+  compression: InputCompressionType
+): Uint8Array {
+  switch (compression) {
+    case 'GZIP':
+      return Bun.gunzipSync(data)
+    case 'ZSTD':
+      return Bun.zstdDecompressSync(data)
+    default:
+      return data
+  }
+}
+
+function parseObject(
+  text: string,
+  options: ImportOptions
+): { items: DynamoDBItem[]; errorCount: number } {
+  switch (options.format) {
+    case 'CSV':
+      return parseCsv(text, options)
+    case 'ION':
+      return parseIonItems(text)
+    default:
+      return parseDynamoDBJson(text)
+  }
+}
+
+// One {"Item": {...}} object per line
+function parseDynamoDBJson(text: string) {
+  const items: DynamoDBItem[] = []
+  let errorCount = 0
+  for (const line of text.split('\n')) {
+    if (line.trim() === '') continue
+    try {
+      const { Item } = JSON.parse(line)
+      if (typeof Item !== 'object' || Item === null || Array.isArray(Item)) {
+        throw new Error('not an item')
+      }
+      items.push(Item)
+    } catch {
+      errorCount++
+    }
+  }
+  return { items, errorCount }
+}
+
+/**
+ * One item per row. The first line names the columns unless headerList is
+ * given. Columns the table defines as N or B attributes get those types and
+ * the rest are strings; empty fields are left out of the item.
+ */
+function parseCsv(text: string, options: ImportOptions) {
+  const rows = parseCsvRows(text, options.delimiter ?? ',')
+  const header = options.headerList ?? rows.shift() ?? []
+  const items: DynamoDBItem[] = []
+  let errorCount = 0
+  for (const row of rows) {
+    if (row.length !== header.length) {
+      errorCount++
+      continue
+    }
+    const item: DynamoDBItem = {}
+    let valid = true
+    header.forEach((name, i) => {
+      const field = row[i]!
+      if (field === '') return
+      const type = options.attributeTypes[name] ?? 'S'
+      if (type === 'N' && !Number.isFinite(Number(field))) valid = false
+      item[name] = { [type]: field } as AttributeValue
+    })
+    if (valid) {
+      items.push(item)
+    } else {
+      errorCount++
+    }
+  }
+  return { items, errorCount }
+}
+
+// Splits CSV text into rows of fields, with RFC 4180 quoting. Blank lines
+// are skipped.
+function parseCsvRows(text: string, delimiter: string): string[][] {
+  const rows: string[][] = []
+  let row: string[] = []
+  let field = ''
+  let quoted = false
+  const endRow = () => {
+    row.push(field)
+    if (row.length > 1 || field !== '') rows.push(row)
+    row = []
+    field = ''
+  }
+
+  for (let i = 0; i < text.length; i++) {
+    const char = text[i]!
+    if (quoted) {
+      if (char !== '"') {
+        field += char
+      } else if (text[i + 1] === '"') {
+        field += '"'
+        i++
+      } else {
+        quoted = false
+      }
+    } else if (char === '"' && field === '') {
+      quoted = true
+    } else if (char === delimiter) {
+      row.push(field)
+      field = ''
+    } else if (char === '\n') {
+      endRow()
+    } else if (char === '\r') {
+      if (text[i + 1] === '\n') i++
+      endRow()
+    } else {
+      field += char
+    }
+  }
+  if (quoted) throw new Error('CSV has an unterminated quoted field')
+  if (field !== '' || row.length > 0) endRow()
+  return rows
+}
+
+// Each top-level value is a struct with the item in its Item field, as in
+// DynamoDB's Ion exports. A syntax error fails the object, since parsing
+// cannot resume after it.
+function parseIonItems(text: string) {
+  const items: DynamoDBItem[] = []
+  let errorCount = 0
+  for (const value of parseIon(text)) {
+    const item = value.type === 'struct' ? value.fields.get('Item') : undefined
+    try {
+      if (item?.type !== 'struct') throw new Error('not an item')
+      items.push(ionToItem(item.fields))
+    } catch {
+      errorCount++
+    }
+  }
+  return { items, errorCount }
+}
+
+// Lists annotated with these are sets
+const ION_SET_TYPES: Record<string, 'SS' | 'NS' | 'BS'> = {
+  $dynamodb_SS: 'SS',
+  $dynamodb_NS: 'NS',
+  $dynamodb_BS: 'BS',
+}
+
+function ionToItem(fields: Map<string, IonValue>): DynamoDBItem {
+  const item: DynamoDBItem = {}
+  for (const [name, value] of fields) {
+    item[name] = ionToAttributeValue(value)
+  }
+  return item
+}
+
+function ionToAttributeValue(value: IonValue): AttributeValue {
+  const [annotation] = value.annotations
+  if (annotation !== undefined) {
+    const setType = ION_SET_TYPES[annotation]
+    if (!setType || value.type !== 'list') {
+      throw new Error(`Unsupported Ion annotation ${annotation}`)
+    }
+    const memberType = setType === 'SS' ? 'S' : setType === 'NS' ? 'N' : 'B'
+    const members = value.values.map((member) => {
+      const converted = ionToAttributeValue(member) as Record<string, unknown>
+      if (typeof converted[memberType] !== 'string') {
+        throw new Error(`${setType} members must be ${memberType} values`)
+      }
+      return converted[memberType]
+    })
+    return { [setType]: members } as AttributeValue
+  }
+
+  switch (value.type) {
+    case 'null':
+      return { NULL: true }
+    case 'bool':
+      return { BOOL: value.value }
+    case 'number':
+      return { N: value.value }
+    case 'string':
+      return { S: value.value }
+    // The JSON protocol carries binary values as base64 text, and items are
+    // stored as they arrive
+    case 'blob':
+      return { B: value.value } as unknown as AttributeValue
+    case 'list':
+      return { L: value.values.map(ionToAttributeValue) }
+    case 'struct':
+      return { M: ionToItem(value.fields) }
+    case 'symbol':
+      throw new Error(`Unexpected Ion symbol ${value.value}`)
+  }
+}
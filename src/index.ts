@@ -6,69 +6,428 @@ import {
   type AttributeValue,
   type BatchGetItemCommandInput,
   type BatchWriteItemCommandInput,
+  type CancellationReason,
+  type ConsumedCapacity,
+  type ReturnConsumedCapacity,
+  type CreateBackupCommandInput,
+  type CreateGlobalTableCommandInput,
   type CreateTableCommandInput,
+  type DeleteBackupCommandInput,
   type DeleteItemCommandInput,
   type DeleteTableCommandInput,
+  type DisableKinesisStreamingDestinationCommandInput,
+  type DescribeBackupCommandInput,
+  type DescribeContributorInsightsCommandInput,
+  type DescribeContinuousBackupsCommandInput,
+  type DescribeExportCommandInput,
+  type DescribeGlobalTableCommandInput,
+  type DescribeImportCommandInput,
+  type DescribeKinesisStreamingDestinationCommandInput,
   type DescribeTableCommandInput,
+  type DescribeTimeToLiveCommandInput,
+  type EnableKinesisStreamingDestinationCommandInput,
+  type ExecuteStatementCommandInput,
+  type BatchExecuteStatementCommandInput,
+  type ExecuteTransactionCommandInput,
+  type ExportTableToPointInTimeCommandInput,
+  type ImportTableCommandInput,
+  type ItemCollectionMetrics,
+  type StreamSpecification,
   type GetItemCommandInput,
+  type KeySchemaElement,
+  type ListBackupsCommandInput,
+  type ListContributorInsightsCommandInput,
+  type ListExportsCommandInput,
+  type ListGlobalTablesCommandInput,
+  type ListImportsCommandInput,
   type ListTablesCommandInput,
+  type ListTagsOfResourceCommandInput,
+  type LocalSecondaryIndex,
   type PutItemCommandInput,
   type QueryCommandInput,
+  type RestoreTableFromBackupCommandInput,
+  type RestoreTableToPointInTimeCommandInput,
   type ScanCommandInput,
+  type SSEDescription,
+  type SSESpecification,
+  type Tag,
+  type TagResourceCommandInput,
   type TransactGetItem,
   type TransactGetItemsCommandInput,
+  type TransactWriteItem,
   type TransactWriteItemsCommandInput,
+  type UntagResourceCommandInput,
+  type UpdateContinuousBackupsCommandInput,
+  type UpdateContributorInsightsCommandInput,
+  type UpdateGlobalTableCommandInput,
   type UpdateItemCommandInput,
+  type UpdateTableCommandInput,
+  type UpdateTimeToLiveCommandInput,
   type WriteRequest,
 } from '@aws-sdk/client-dynamodb'
 import * as fs from 'fs/promises'
 import * as nodeFs from 'fs'
+import { AsyncLocalStorage } from 'async_hooks'
 import CRC32 from 'crc-32'
-import { evaluateKeyCondition } from './expression-parser/key-condition-evaluator.ts'
 import {
+  evaluateKeyCondition,
+  validateKeyCondition,
+} from './expression-parser/key-condition-evaluator.ts'
+import {
+  applyProjection,
   applyUpdateExpressionToItem,
   evaluateConditionExpression,
+  projectAttributePaths,
+  updatedAttributeNames,
+  updatedAttributePaths,
+  validateExpressionAttributeNames,
+  validateProjectionExpression,
+  validateReservedWords,
 } from './expression-parser/index.ts'
+import { compareScalars, setElementKey } from './expression-parser/compare.ts'
+import { validationError } from './errors.ts'
+import {
+  detectShardCount,
+  recoverReshard,
+  reshard,
+  shardPath,
+} from './reshard.ts'
+import {
+  CapacityTally,
+  consumedCapacity,
+  readCapacityUnits,
+  reportCapacity,
+  transactionReadUnits,
+  transactionUsage,
+  writeCapacityUnits,
+  type CapacityUsage,
+} from './capacity.ts'
+import { StatsdClient } from './statsd.ts'
+import { isExpired } from './ttl.ts'
+import { KinesisForwarder, kinesisStreamName } from './kinesis.ts'
+import { StreamWebhookSink } from './webhook.ts'
+import { ContributorInsightsTracker } from './contributor-insights.ts'
+import { StaleReadLog } from './stale-reads.ts'
+import { WriteGate } from './write-gate.ts'
+import { BackupStore, type BackupInfo } from './backups.ts'
+import { RecoveryLog } from './recovery.ts'
+import {
+  GlobalTableStore,
+  ItemVersionStore,
+  isNewerVersion,
+  requestRegion,
+  type GlobalTableInfo,
+  type ItemVersion,
+} from './global-tables.ts'
+import {
+  ExportStore,
+  localDestination,
+  s3Destination,
+  writeExport,
+  type ExportDestination,
+  type ExportInfo,
+} from './exports.ts'
+import {
+  ImportStore,
+  localSource,
+  readImport,
+  s3Source,
+  type ImportedItems,
+  type ImportInfo,
+  type ImportSource,
+} from './imports.ts'
+import {
+  STREAM_SHARD_ID,
+  StreamLog,
+  decodeShardIterator,
+  encodeShardIterator,
+  formatSequenceNumber,
+  parseSequenceNumber,
+  type DescribeStreamInput,
+  type GetRecordsInput,
+  type GetShardIteratorInput,
+  type ListStreamsInput,
+  type StreamRecord,
+} from './streams.ts'
 import { Router } from './router.ts'
+import { readSeedFile, type Seed } from './seed.ts'
+import {
+  compileStatement,
+  compileTransactItem,
+  decodeNextToken,
+  encodeNextToken,
+  parseStatement,
+  selectsOneItem,
+  type Statement,
+} from './partiql.ts'
 import { Shard } from './shard.ts'
 import { MetadataStore } from './metadata-store.ts'
 import { TransactionCoordinator } from './coordinator.ts'
-import { type DynamoDBItem, type TableSchema } from './types.ts'
+import {
+  findIndex,
+  hasIndexKeys,
+  isBackfilling,
+  assertSelectSupported,
+  isGlobalIndex,
+  projectToIndex,
+  requireIndex,
+  toIndexSchema,
+} from './indexes.ts'
+import {
+  type DynamoDBItem,
+  type ItemChange,
+  type SecondaryIndexSchema,
+  type TableSchema,
+} from './types.ts'
 
 export const MAX_ITEMS_PER_TRANSACTION = 100
+export const MAX_ITEMS_PER_BATCH_WRITE = 25
+export const MAX_STATEMENTS_PER_BATCH = 25
+export const MAX_GLOBAL_SECONDARY_INDEXES = 20
+export const MAX_LOCAL_SECONDARY_INDEXES = 5
+export const MAX_SCAN_SEGMENTS = 1000000
+export const MAX_NESTING_DEPTH = 32
+export const MAX_ITEM_SIZE_BYTES = 400 * 1024
+export const MAX_LIST_TABLES_LIMIT = 100
+export const MAX_PAGE_BYTES = 1024 * 1024
+export const MAX_GET_RECORDS_LIMIT = 1000
+export const MAX_LIST_STREAMS_LIMIT = 100
+export const MAX_LIST_BACKUPS_LIMIT = 100
+export const MAX_LIST_EXPORTS_RESULTS = 25
+export const MAX_LIST_IMPORTS_PAGE_SIZE = 25
+export const MAX_TAGS_PER_RESOURCE = 50
+export const MAX_LIST_GLOBAL_TABLES_LIMIT = 100
+export const MAX_LIST_CONTRIBUTOR_INSIGHTS_RESULTS = 100
+// Dynado-specific request header: validate a CreateTable without creating
+export const DRY_RUN_HEADER = 'x-dynado-dry-run'
+// Item collection sizes are estimated in whole gigabytes
+const GIGABYTE = 1024 * 1024 * 1024
 
 export class DB {
   server: Bun.Server<undefined>
   router: Router
   metadataStore: MetadataStore
+  streams: StreamLog
+  backups: BackupStore
+  recovery: RecoveryLog
+  exports: ExportStore
+  imports: ImportStore
+  // Shared by every region; see replicate
+  globalTables: GlobalTableStore
+  itemVersions: ItemVersionStore
+  // Sends records to KINESIS_ENDPOINT, when set; shared by every region
+  kinesis: KinesisForwarder | null
+  // Posts stream records to STREAM_WEBHOOK_URL, when set; shared by every
+  // region
+  streamWebhook: StreamWebhookSink | null
+  // Access counts of tables and indexes with Contributor Insights enabled
+  insights: ContributorInsightsTracker
+  // Recent writes eventually consistent reads do not see yet, when
+  // STALE_READ_MS is set
+  staleReads: StaleReadLog | null
   config: Config
+  // The request the current handler is serving; see withRequestTimeout
+  private requests = new AsyncLocalStorage<RequestContext>()
+  // Shards items are hashed across; fixed for the life of the data directory
+  shardCount: number
+  // Settles once the seed file, if any, is loaded; requests wait for it
+  ready: Promise<void>
+  private itemLocks: Map<string, Promise<unknown>> = new Map()
+  // Holds writes off while CreateBackup reads a table
+  private writeGate = new WriteGate()
+  private statsd: StatsdClient | null
+  // Runs sweepExpiredItems every TTL_SWEEP_INTERVAL_MS until stop
+  private ttlSweeper?: ReturnType<typeof setInterval>
+  // The instances serving REPLICA_REGIONS, and for those the main instance
+  private replicas: Map<string, DB>
+  private parent?: DB
 
-  constructor(config?: Config) {
+  // A parent is passed for the instances serving replica regions, which
+  // answer requests through the parent's server
+  constructor(config?: Config, parent?: DB) {
     this.config = config ?? getConfigFromEnv()
     // Create data directory if it doesn't exist
     if (!nodeFs.existsSync(this.config.dataDir)) {
       nodeFs.mkdirSync(this.config.dataDir, { recursive: true })
     }
+    const seed = this.config.seedFile
+      ? readSeedFile(this.config.seedFile)
+      : undefined
 
-    const shards: Shard[] = []
+    // 1. Create metadata store
+    this.metadataStore = new MetadataStore(
+      this.config.dataDir,
+      this.config.maxTables
+    )
+    this.shardCount = this.resolveShardCount()
+    this.streams = new StreamLog(this.config.dataDir)
+    this.backups = new BackupStore(this.config.dataDir)
+    this.recovery = new RecoveryLog(this.config.dataDir)
+    this.exports = new ExportStore(this.config.dataDir)
+    this.imports = new ImportStore(this.config.dataDir)
+    this.globalTables =
+      parent?.globalTables ?? new GlobalTableStore(this.config.dataDir)
+    this.itemVersions = new ItemVersionStore(this.config.dataDir)
+    this.kinesis =
+      parent?.kinesis ??
+      (this.config.kinesisEndpoint
+        ? new KinesisForwarder(this.config.kinesisEndpoint)
+        : null)
+    this.streamWebhook =
+      parent?.streamWebhook ??
+      (this.config.streamWebhookUrl
+        ? new StreamWebhookSink(
+            this.config.streamWebhookUrl,
+            this.config.streamWebhookMaxAttempts
+          )
+        : null)
+    this.insights = new ContributorInsightsTracker()
+    this.staleReads =
+      this.config.staleReadMs > 0
+        ? new StaleReadLog(this.config.staleReadMs)
+        : null
+    this.parent = parent
 
-    // 1. Create shards
-    for (let i = 0; i < this.config.shardCount; i++) {
-      const shard = new Shard(`${this.config.dataDir}/shard_${i}.db`, i)
+    // 2. Create shards
+    const shards: Shard[] = []
+    for (let i = 0; i < this.shardCount; i++) {
+      const shard = new Shard(
+        shardPath(this.config.dataDir, i),
+        i,
+        this.config.fsyncPolicy,
+        this.config.isolationLevel,
+        this.config.readCacheSize
+      )
       shards.push(shard)
     }
 
-    // 2. Create metadata store
-    this.metadataStore = new MetadataStore(this.config.dataDir)
     // 3. Create transaction coordinator
     const coordinator = new TransactionCoordinator(this.config.dataDir)
 
     // 4. Create router that ties everything together
     this.router = new Router(shards, this.metadataStore, coordinator)
-    this.server = Bun.serve({
-      port: this.config.port,
-      fetch: (req) => this.handleDynamoDBRequest(req),
-    })
+    this.statsd = this.config.statsdAddr
+      ? new StatsdClient(
+          this.config.statsdAddr.host,
+          this.config.statsdAddr.port
+        )
+      : null
+    this.server =
+      parent?.server ??
+      Bun.serve({
+        port: this.config.port,
+        fetch: (req) => this.handleDynamoDBRequest(req),
+      })
+    // Each replica region keeps its tables under regions/<region>
+    this.replicas = new Map(
+      parent
+        ? []
+        : this.config.replicaRegions.map((region): [string, DB] => [
+            region,
+            new DB(
+              {
+                ...this.config,
+                dataDir: `${this.config.dataDir}/regions/${region}`,
+                replicaRegions: [],
+                seedFile: undefined,
+              },
+              this
+            ),
+          ])
+    )
+    this.ready = seed ? this.applySeed(seed) : Promise.resolve()
+
+    if (this.config.ttlSweepIntervalMs > 0) {
+      this.ttlSweeper = setInterval(() => {
+        this.sweepExpiredItems().catch((error) =>
+          console.error('TTL sweep failed:', error)
+        )
+      }, this.config.ttlSweepIntervalMs)
+      // Sweeps alone should not keep the process running
+      this.ttlSweeper.unref()
+    }
+  }
+
+  // Stops serving requests, and the background work and StatsD socket of
+  // every region
+  async stop(): Promise<void> {
+    for (const db of [this, ...this.replicas.values()]) {
+      clearInterval(db.ttlSweeper)
+      db.statsd?.close()
+    }
+    await this.server.stop()
+  }
+
+  /**
+   * Deletes every item whose TTL has passed and returns how many. Each item
+   * is checked again under its lock, so a write that extends its TTL wins.
+   */
+  async sweepExpiredItems(nowMs: number = Date.now()): Promise<number> {
+    let deleted = 0
+    for (const tableName of await this.metadataStore.listTables()) {
+      const schema = await this.metadataStore.describeTable(tableName)
+      const attributeName = schema?.timeToLiveAttribute
+      if (!schema || !attributeName) continue
+
+      const { items } = await this.router.scan(schema)
+      for (const item of items) {
+        if (!isExpired(item, attributeName, nowMs)) continue
+        const key = extractKey(schema, item)
+        await this.withItemLock(tableName, key, async () => {
+          const current = await this.router.getItem(tableName, key)
+          if (current && isExpired(current, attributeName, nowMs)) {
+            await this.router.deleteItem(tableName, key)
+            // DynamoDB marks TTL deletions as made by the service
+            await this.recordChanges(
+              [{ tableName, oldItem: current, newItem: null }],
+              { Type: 'Service', PrincipalId: 'dynamodb.amazonaws.com' }
+            )
+            deleted++
+          }
+        })
+      }
+    }
+    return deleted
+  }
+
+  // Items are hashed across shards by count, so opening a data directory
+  // with a different count would hide every item on the wrong shard
+  private resolveShardCount(): number {
+    const { dataDir, shardCount, reshard: migrate } = this.config
+    recoverReshard(dataDir, this.metadataStore)
+    const onDisk = detectShardCount(dataDir, this.metadataStore)
+    const resolved = shardCount ?? onDisk ?? 4
+    if (onDisk !== undefined && onDisk !== resolved) {
+      if (!migrate) {
+        this.metadataStore.close()
+        throw new Error(
+          `DATA_DIR ${dataDir} was written with ${onDisk} shards but SHARD_COUNT is ${resolved}; ` +
+            `unset SHARD_COUNT to use ${onDisk} shards, or set RESHARD=1 to move every item to ${resolved} shards`
+        )
+      }
+      reshard(dataDir, onDisk, resolved, this.metadataStore)
+    }
+    this.metadataStore.setShardCount(resolved)
+    return resolved
+  }
+
+  // Creates the seed tables and their items. Tables that already exist were
+  // seeded on an earlier start against the same data directory.
+  private async applySeed(seed: Seed): Promise<void> {
+    for (const { Items, ...table } of seed.Tables) {
+      if (await this.metadataStore.describeTable(table.TableName!)) continue
+      try {
+        await this.handleCreateTable(table)
+        for (const { Item } of Items ?? []) {
+          await this.handlePutItem({ TableName: table.TableName, Item })
+        }
+      } catch (error: unknown) {
+        const { __type, message } = serializeError(error)
+        throw new Error(
+          `Failed to seed table ${table.TableName}: ${__type}: ${message}`
+        )
+      }
+    }
   }
 
   async deleteAllData() {
@@ -76,349 +435,1245 @@ export class DB {
   }
 
   async handleDynamoDBRequest(req: Request): Promise<Response> {
+    // Requests signed for a replica region are served from its own tables
+    const replica = this.replicas.get(requestRegion(req) ?? '')
+    if (replica) {
+      return replica.handleDynamoDBRequest(req)
+    }
+
     const target = req.headers.get('x-amz-target')
 
     if (!target) {
-      const body = JSON.stringify({
+      return this.jsonResponse(400, {
         __type: 'MissingAuthenticationTokenException',
       })
-      const checksum = CRC32.str(body) >>> 0 // Convert to unsigned 32-bit
-      return new Response(body, {
-        status: 400,
-        headers: {
-          'Content-Type': 'application/x-amz-json-1.0',
-          'X-Amz-Crc32': String(checksum),
-        },
-      })
     }
 
     const operation = target.split('.')[1]
-    const body = (await req.json()) as unknown
+    const start = performance.now()
 
     try {
-      let response
-
-      switch (operation) {
-        case 'ListTables':
-          response = await this.handleListTables(body as ListTablesCommandInput)
-          break
-        case 'CreateTable':
-          response = await this.handleCreateTable(
-            body as CreateTableCommandInput
-          )
-          break
-        case 'DescribeTable':
-          response = await this.handleDescribeTable(
-            body as DescribeTableCommandInput
-          )
-          break
-        case 'PutItem':
-          response = await this.handlePutItem(body as PutItemCommandInput)
-          break
-        case 'GetItem':
-          response = await this.handleGetItem(body as GetItemCommandInput)
-          break
-        case 'UpdateItem':
-          response = await this.handleUpdateItem(body as UpdateItemCommandInput)
-          break
-        case 'DeleteItem':
-          response = await this.handleDeleteItem(body as DeleteItemCommandInput)
-          break
-        case 'BatchGetItem':
-          response = await this.handleBatchGetItem(
-            body as BatchGetItemCommandInput
-          )
-          break
-        case 'BatchWriteItem':
-          response = await this.handleBatchWriteItem(
-            body as BatchWriteItemCommandInput
-          )
-          break
-        case 'Scan':
-          response = await this.handleScan(body as ScanCommandInput)
-          break
-        case 'Query':
-          response = await this.handleQuery(body as QueryCommandInput)
-          break
-        case 'DeleteTable':
-          response = await this.handleDeleteTable(
-            body as DeleteTableCommandInput
-          )
-          break
-        case 'TransactWriteItems':
-          response = await this.handleTransactWriteItems(
-            body as TransactWriteItemsCommandInput
-          )
-          break
-        case 'TransactGetItems':
-          response = await this.handleTransactGetItems(
-            body as TransactGetItemsCommandInput
-          )
-          break
-        default:
-          const errorBody = JSON.stringify({
-            __type: 'UnknownOperationException',
-          })
-          const errorChecksum = CRC32.str(errorBody) >>> 0 // Convert to unsigned 32-bit
-          return new Response(errorBody, {
-            status: 400,
-            headers: {
-              'Content-Type': 'application/x-amz-json-1.0',
-              'X-Amz-Crc32': String(errorChecksum),
-            },
-          })
+      await this.ready
+      const body = await this.readRequestBody(req)
+      const dryRun = req.headers.get(DRY_RUN_HEADER) === 'true'
+      // The address the client reached this server at
+      const host = req.headers.get('host') ?? `localhost:${this.server.port}`
+      const response = await this.withRequestTimeout(() =>
+        this.dispatch(operation, body, dryRun, host)
+      )
+
+      if (response === undefined) {
+        return this.jsonResponse(400, { __type: 'UnknownOperationException' })
       }
 
-      const responseBody = JSON.stringify(response)
-      const responseChecksum = CRC32.str(responseBody) >>> 0 // Convert to unsigned 32-bit
-      return new Response(responseBody, {
-        status: 200,
-        headers: {
-          'Content-Type': 'application/x-amz-json-1.0',
-          'X-Amz-Crc32': String(responseChecksum),
-        },
-      })
+      this.recordRequest(operation, start)
+      return this.jsonResponse(200, response)
     } catch (error: unknown) {
-      const errorPayload = serializeError(error)
-      const catchBody = JSON.stringify(errorPayload)
-      const catchChecksum = CRC32.str(catchBody) >>> 0 // Convert to unsigned 32-bit
-      return new Response(catchBody, {
-        status: 400,
-        headers: {
-          'Content-Type': 'application/x-amz-json-1.0',
-          'X-Amz-Crc32': String(catchChecksum),
-        },
-      })
+      const payload = serializeError(error)
+      this.recordRequest(operation, start, payload.__type)
+      return this.jsonResponse(400, payload)
+    }
+  }
+
+  // Emits request.<Operation> (count), request.<Operation>.latency (timer),
+  // and, for failures, error.<Operation>.<ErrorType> (count)
+  private recordRequest(
+    operation: string | undefined,
+    start: number,
+    errorType?: string
+  ) {
+    if (!this.statsd || !operation) return
+    this.statsd.increment(`request.${operation}`)
+    this.statsd.timing(
+      `request.${operation}.latency`,
+      performance.now() - start
+    )
+    if (errorType) {
+      this.statsd.increment(`error.${operation}.${errorType}`)
     }
   }
 
-  async handleListTables(_body: ListTablesCommandInput) {
-    const tableNames = await this.metadataStore.listTables()
-    return { TableNames: tableNames }
+  // Serializes read-modify-write operations per item, so concurrent writes
+  // to one key apply one after another instead of overwriting each other.
+  // The table's write gate is taken once the item's lock is held.
+  private async withItemLock<T>(
+    tableName: string,
+    itemOrKey: DynamoDBItem,
+    fn: () => Promise<T>
+  ): Promise<T> {
+    const key = this.metadataStore.extractKey(tableName, itemOrKey)
+    const lockKey = `${tableName}/${getKeyString(key)}`
+    const previous = this.itemLocks.get(lockKey) ?? Promise.resolve()
+    const current = previous
+      .catch(() => {})
+      .then(() => this.writeGate.write([tableName], fn))
+    this.itemLocks.set(lockKey, current)
+    try {
+      return await current
+    } finally {
+      if (this.itemLocks.get(lockKey) === current) {
+        this.itemLocks.delete(lockKey)
+      }
+    }
   }
 
-  async handleCreateTable(body: CreateTableCommandInput) {
-    const { TableName, KeySchema, AttributeDefinitions } = body
+  /**
+   * Appends each change to its table's stream and point-in-time recovery
+   * log, sends it to the table's Kinesis destinations and the stream
+   * webhook, replicates it to the table's other regions, and hides it from
+   * eventually consistent reads for STALE_READ_MS, where those are
+   * enabled. Callers hold the item's lock, so records of one item are
+   * appended in the order its writes were applied.
+   */
+  private async recordChanges(
+    changes: ItemChange[],
+    userIdentity?: StreamRecord['userIdentity'],
+    // Set for writes replicated from another region, which are not
+    // replicated again
+    replicated: boolean = false
+  ) {
+    for (const { tableName, oldItem, newItem } of changes) {
+      const schema = await this.metadataStore.describeTable(tableName)
+      if (!schema) continue
+      // Writes that change nothing produce no record
+      if (!oldItem && !newItem) continue
+      if (oldItem && newItem && Bun.deepEquals(oldItem, newItem)) continue
+      const image = (newItem ?? oldItem)!
+      const key = extractKey(schema, image)
+      this.staleReads?.record(tableName, getKeyString(key), oldItem)
 
-    if (!TableName || !KeySchema || !AttributeDefinitions) {
-      throw {
-        name: 'ValidationException',
-        message: 'TableName, KeySchema, and AttributeDefinitions are required',
+      // Replicas of global tables all have streams, so other tables skip
+      // looking for a global table
+      if (!replicated && schema.streamSpecification?.StreamEnabled) {
+        this.replicate(tableName, key, newItem)
       }
-    }
 
-    await this.metadataStore.createTable({
-      tableName: TableName,
-      keySchema: KeySchema,
-      attributeDefinitions: AttributeDefinitions,
-    })
+      if (schema.pointInTimeRecoveryEnabledAt !== undefined) {
+        const now = Date.now()
+        this.recovery.append(tableName, getKeyString(key), newItem, now)
+        this.recovery.trim(tableName, now - this.config.pitrRetentionMs)
+      }
 
-    return {
-      TableDescription: {
-        TableName,
-        KeySchema,
-        AttributeDefinitions,
-        TableStatus: 'ACTIVE',
-        CreationDateTime: Math.floor(Date.now() / 1000),
-      },
+      for (const destination of schema.kinesisDestinations ?? []) {
+        if (!this.kinesis || destination.status !== 'ACTIVE') continue
+        const now = Date.now()
+        this.kinesis.send(destination.streamArn, getKeyString(key), {
+          awsRegion: 'local',
+          eventID: crypto.randomUUID(),
+          eventName: !oldItem ? 'INSERT' : !newItem ? 'REMOVE' : 'MODIFY',
+          userIdentity: userIdentity ?? null,
+          recordFormat: 'application/json',
+          tableName,
+          dynamodb: {
+            ApproximateCreationDateTime:
+              destination.precision === 'MICROSECOND' ? now * 1000 : now,
+            ApproximateCreationDateTimePrecision: destination.precision,
+            Keys: key,
+            ...(newItem && { NewImage: newItem }),
+            ...(oldItem && { OldImage: oldItem }),
+            SizeBytes: itemSize(image),
+          },
+          eventSource: 'aws:dynamodb',
+        })
+      }
+
+      const specification = schema.streamSpecification
+      if (!specification?.StreamEnabled) continue
+      const viewType = specification.StreamViewType!
+      const withNew =
+        viewType === 'NEW_IMAGE' || viewType === 'NEW_AND_OLD_IMAGES'
+      const withOld =
+        viewType === 'OLD_IMAGE' || viewType === 'NEW_AND_OLD_IMAGES'
+      const record: StreamRecord = {
+        eventID: crypto.randomUUID().replaceAll('-', ''),
+        eventName: !oldItem ? 'INSERT' : !newItem ? 'REMOVE' : 'MODIFY',
+        eventVersion: '1.1',
+        eventSource: 'aws:dynamodb',
+        awsRegion: 'local',
+        dynamodb: {
+          ApproximateCreationDateTime: Math.floor(Date.now() / 1000),
+          Keys: key,
+          ...(withNew && newItem && { NewImage: newItem }),
+          ...(withOld && oldItem && { OldImage: oldItem }),
+          SizeBytes: itemSize(image),
+          StreamViewType: viewType,
+        },
+        ...(userIdentity && { userIdentity }),
+      }
+      const sequence = this.streams.append(streamArn(schema), record)
+      this.streamWebhook?.send({
+        ...record,
+        eventSourceARN: streamArn(schema),
+        dynamodb: {
+          ...record.dynamodb,
+          SequenceNumber: formatSequenceNumber(sequence),
+        },
+      })
     }
   }
 
-  async handlePutItem(body: PutItemCommandInput) {
-    const {
-      TableName,
-      Item,
-      ConditionExpression,
-      ExpressionAttributeNames,
-      ExpressionAttributeValues,
-      ReturnValues,
-    } = body
+  // The ConsumedCapacity of a single-item write, if the request asked for it
+  private async writeCapacity(
+    mode: ReturnConsumedCapacity | undefined,
+    { tableName, oldItem, newItem }: ItemChange
+  ): Promise<ConsumedCapacity | undefined> {
+    if (mode !== 'TOTAL' && mode !== 'INDEXES') return undefined
+    const schema = (await this.metadataStore.describeTable(tableName))!
+    return reportCapacity(mode, schema, writeUsage(schema, oldItem, newItem))
+  }
 
-    if (!TableName || !Item) {
-      throw {
-        name: 'ValidationException',
-        message: 'TableName and Item are required',
+  /**
+   * The size of the item collection an item or key belongs to: every item
+   * with its partition key, plus their entries in the table's LSIs. Only
+   * tables with LSIs have item collections, so others return undefined.
+   * Like DynamoDB, the size is estimated as a range of whole gigabytes.
+   */
+  private async itemCollectionMetrics(
+    tableName: string,
+    itemOrKey: DynamoDBItem
+  ): Promise<ItemCollectionMetrics | undefined> {
+    const schema = await this.metadataStore.describeTable(tableName)
+    if (!schema?.localSecondaryIndexes?.length) return undefined
+
+    const partitionKey = schema.keySchema.find(
+      (key) => key.KeyType === 'HASH'
+    )!.AttributeName!
+    const value = itemOrKey[partitionKey]!
+    const { items } = await this.router.query(
+      schema,
+      (item) =>
+        item[partitionKey] !== undefined &&
+        compareScalars(item[partitionKey]!, value) === 0
+    )
+    let bytes = totalItemSize(items)
+    for (const index of schema.localSecondaryIndexes) {
+      for (const item of items) {
+        if (hasIndexKeys(index, item)) {
+          bytes += itemSize(projectToIndex(schema, index, item))
+        }
       }
     }
+    const lower = Math.floor(bytes / GIGABYTE)
+    return {
+      ItemCollectionKey: { [partitionKey]: value },
+      SizeEstimateRangeGB: [lower, lower + 1],
+    }
+  }
 
-    const existingItem = await this.router.getItem(TableName, Item)
-    assertConditionExpression(
-      existingItem,
-      ConditionExpression,
-      ExpressionAttributeNames,
-      ExpressionAttributeValues
+  // The ItemCollectionMetrics of a batch or transaction, by table, with one
+  // entry per item collection its writes touched
+  private async itemCollectionMetricsByTable(
+    writes: { tableName: string; itemOrKey: DynamoDBItem }[]
+  ): Promise<Record<string, ItemCollectionMetrics[]> | undefined> {
+    const byTable: Record<string, ItemCollectionMetrics[]> = {}
+    const seen = new Set<string>()
+    for (const { tableName, itemOrKey } of writes) {
+      const metrics = await this.itemCollectionMetrics(tableName, itemOrKey)
+      if (!metrics) continue
+      const id = `${tableName}/${getKeyString(metrics.ItemCollectionKey!)}`
+      if (seen.has(id)) continue
+      seen.add(id)
+      byTable[tableName] = [...(byTable[tableName] ?? []), metrics]
+    }
+    return Object.keys(byTable).length > 0 ? byTable : undefined
+  }
+
+  // Counts accesses to items for the table's Contributor Insights, or the
+  // index's when indexName is given, if enabled. Items may be whole items
+  // or just their keys.
+  private async recordAccess(
+    tableName: string,
+    items: DynamoDBItem[],
+    indexName?: string
+  ) {
+    const schema = await this.metadataStore.describeTable(tableName)
+    const enabled = schema?.contributorInsights?.some(
+      (s) => s.indexName === indexName
     )
-    await this.router.putItem(TableName, Item)
+    const keySchema = indexName
+      ? schema && findIndex(schema, indexName)?.keySchema
+      : schema?.keySchema
+    if (!enabled || !keySchema) return
 
-    if (ReturnValues === 'ALL_OLD') {
-      return { Attributes: existingItem || {} }
+    const partitionKeyName = keySchema.find((k) => k.KeyType === 'HASH')!
+      .AttributeName!
+    const sortKeyName = keySchema.find((k) => k.KeyType === 'RANGE')
+      ?.AttributeName
+    for (const item of items) {
+      const partitionKey = item[partitionKeyName]
+      if (!partitionKey) continue
+      const sortKey = sortKeyName ? item[sortKeyName] : undefined
+      this.insights.record(
+        tableName,
+        indexName,
+        keyValueText(partitionKey),
+        sortKey && keyValueText(sortKey)
+      )
     }
-
-    return {}
   }
 
-  async handleGetItem(body: GetItemCommandInput) {
-    const { TableName, Key } = body
+  // Copies a write to the other replicas of its global table after
+  // replicationLagMs, and records it as this replica's latest write of the
+  // item
+  private replicate(
+    tableName: string,
+    key: DynamoDBItem,
+    item: DynamoDBItem | null
+  ) {
+    const root = this.parent ?? this
+    const globalTable = this.globalTables.getGlobalTable(tableName)
+    const region = globalTable?.regions.find(
+      (region) => root.replicaFor(region) === this
+    )
+    if (!globalTable || region === undefined) return
 
-    if (!TableName || !Key) {
-      throw {
-        name: 'ValidationException',
-        message: 'TableName and Key are required',
-      }
+    const version = { updatedAt: Date.now(), region }
+    this.itemVersions.set(tableName, getKeyString(key), version)
+    for (const other of globalTable.regions) {
+      const replica = root.replicaFor(other)
+      if (replica === this) continue
+      setTimeout(() => {
+        replica
+          .applyReplicatedWrite(tableName, key, item, version)
+          .catch((error) => console.error('Replication failed:', error))
+      }, this.config.replicationLagMs)
     }
+  }
 
-    const item = await this.router.getItem(TableName, Key)
+  /**
+   * Applies a write replicated from another region, unless this replica
+   * already holds a newer write of the item. A replica whose table has been
+   * deleted skips the write.
+   */
+  private async applyReplicatedWrite(
+    tableName: string,
+    key: DynamoDBItem,
+    item: DynamoDBItem | null,
+    version: ItemVersion
+  ) {
+    if (!(await this.metadataStore.describeTable(tableName))) return
+    const keyString = getKeyString(key)
+    await this.withItemLock(tableName, key, async () => {
+      const current = this.itemVersions.get(tableName, keyString)
+      if (current && !isNewerVersion(version, current)) return
 
-    if (item) {
-      return { Item: item }
-    }
-    return {}
+      let oldItem: DynamoDBItem | null
+      if (item) {
+        oldItem = await this.router.getItem(tableName, key)
+        await this.router.putItem(tableName, item)
+      } else {
+        oldItem = await this.router.deleteItem(tableName, key)
+      }
+      this.itemVersions.set(tableName, keyString, version)
+      await this.recordChanges(
+        [{ tableName, oldItem, newItem: item }],
+        undefined,
+        true
+      )
+    })
   }
 
-  async handleDescribeTable(body: DescribeTableCommandInput) {
-    const { TableName } = body
+  // The instance serving a region: its replica if it is one of
+  // REPLICA_REGIONS, otherwise this, the main instance
+  private replicaFor(region: string): DB {
+    return this.replicas.get(region) ?? this
+  }
 
-    if (!TableName) {
-      throw { name: 'ValidationException', message: 'TableName is required' }
+  // Reads and parses the JSON body, refusing bodies over the configured
+  // size before they are fully buffered
+  private async readRequestBody(req: Request): Promise<unknown> {
+    const limit = this.config.maxRequestBodyBytes
+    const tooLarge = validationError(
+      'SIZE_LIMIT',
+      `Request body exceeds the maximum allowed size of ${limit} bytes`
+    )
+
+    const contentLength = Number(req.headers.get('content-length'))
+    if (contentLength > limit) {
+      throw tooLarge
     }
 
-    const table = await this.metadataStore.describeTable(TableName)
-    if (!table) {
-      throw { name: 'ResourceNotFoundException', message: 'Table not found' }
+    const chunks: Uint8Array[] = []
+    let size = 0
+    if (req.body) {
+      for await (const chunk of req.body) {
+        size += chunk.byteLength
+        if (size > limit) {
+          throw tooLarge
+        }
+        chunks.push(chunk)
+      }
     }
 
-    const itemCount = await this.router.getTableItemCount(TableName)
+    try {
+      return JSON.parse(Buffer.concat(chunks).toString('utf8'))
+    } catch {
+      throw {
+        name: 'SerializationException',
+        message: 'Request body is not valid JSON',
+      }
+    }
+  }
 
-    return {
-      Table: {
-        TableName: table.tableName,
-        KeySchema: table.keySchema,
-        AttributeDefinitions: table.attributeDefinitions,
-        TableStatus: 'ACTIVE',
-        CreationDateTime: Math.floor(Date.now() / 1000),
-        ItemCount: itemCount,
+  // Every response carries a unique request id and a CRC32 of the body, which
+  // the SDKs use for correlation and integrity checks. Request signatures are
+  // not validated, so there is no clock skew to enforce.
+  private jsonResponse(status: number, payload: unknown): Response {
+    const body = JSON.stringify(
+      payload,
+      this.config.sortedKeys ? sortObjectKeys : undefined
+    )
+    const checksum = CRC32.str(body) >>> 0 // Convert to unsigned 32-bit
+    return new Response(body, {
+      status,
+      headers: {
+        'Content-Type': 'application/x-amz-json-1.0',
+        'X-Amz-Crc32': String(checksum),
+        'x-amzn-RequestId': crypto.randomUUID(),
       },
-    }
+    })
   }
 
-  async handleUpdateItem(body: UpdateItemCommandInput) {
-    const {
-      TableName,
-      Key,
-      UpdateExpression,
-      ExpressionAttributeValues,
-      ExpressionAttributeNames,
-      ConditionExpression,
-      ReturnValues,
-    } = body
+  // Returns undefined for operations dynado does not implement
+  private async dispatch(
+    operation: string | undefined,
+    body: unknown,
+    dryRun: boolean = false,
+    host: string = `localhost:${this.server.port}`
+  ): Promise<unknown> {
+    let response
 
-    if (!TableName || !Key) {
+    // A dry run must never fall through to an operation that writes
+    if (dryRun && operation !== 'CreateTable') {
       throw {
         name: 'ValidationException',
-        message: 'TableName and Key are required',
+        message: `${DRY_RUN_HEADER} is only supported for CreateTable`,
       }
     }
 
-    // TODO: cache this?
-    const table = await this.metadataStore.describeTable(TableName)
-    if (!table) {
-      throw { name: 'ResourceNotFoundException', message: 'Table not found' }
-    }
-
-    const oldItem = await this.router.getItem(TableName, Key)
-    assertConditionExpression(
-      oldItem,
-      ConditionExpression,
-      ExpressionAttributeNames ?? undefined,
-      ExpressionAttributeValues ?? undefined
+    // Alias declarations, reserved words, and expression values are
+    // validated the same way for every operation
+    validateExpressionAttributeNames(
+      (body as { ExpressionAttributeNames?: Record<string, string> })
+        .ExpressionAttributeNames
+    )
+    validateReservedWords(body as Record<string, unknown>)
+    assertValidSetValues(
+      (body as { ExpressionAttributeValues?: Record<string, AttributeValue> })
+        .ExpressionAttributeValues
     )
-    let item: DynamoDBItem = oldItem ? { ...oldItem } : { ...Key }
 
-    if (UpdateExpression) {
-      item = applyUpdateExpressionToItem(
-        item,
-        UpdateExpression,
-        ExpressionAttributeNames,
-        ExpressionAttributeValues ?? undefined
-      )
+    switch (operation) {
+      case 'ListTables':
+        response = await this.handleListTables(body as ListTablesCommandInput)
+        break
+      case 'CreateTable':
+        response = await this.handleCreateTable(
+          body as CreateTableCommandInput,
+          { dryRun }
+        )
+        break
+      case 'DescribeTable':
+        response = await this.handleDescribeTable(
+          body as DescribeTableCommandInput
+        )
+        break
+      case 'DescribeEndpoints':
+        response = this.handleDescribeEndpoints(host)
+        break
+      case 'PutItem':
+        response = await this.handlePutItem(body as PutItemCommandInput)
+        break
+      case 'GetItem':
+        response = await this.handleGetItem(body as GetItemCommandInput)
+        break
+      case 'UpdateItem':
+        response = await this.handleUpdateItem(body as UpdateItemCommandInput)
+        break
+      case 'DeleteItem':
+        response = await this.handleDeleteItem(body as DeleteItemCommandInput)
+        break
+      case 'BatchGetItem':
+        response = await this.handleBatchGetItem(
+          body as BatchGetItemCommandInput
+        )
+        break
+      case 'BatchWriteItem':
+        response = await this.handleBatchWriteItem(
+          body as BatchWriteItemCommandInput
+        )
+        break
+      case 'Scan':
+        response = await this.handleScan(body as ScanCommandInput)
+        break
+      case 'Query':
+        response = await this.handleQuery(body as QueryCommandInput)
+        break
+      case 'UpdateTable':
+        response = await this.handleUpdateTable(
+          body as UpdateTableCommandInput
+        )
+        break
+      case 'UpdateTimeToLive':
+        response = await this.handleUpdateTimeToLive(
+          body as UpdateTimeToLiveCommandInput
+        )
+        break
+      case 'DescribeTimeToLive':
+        response = await this.handleDescribeTimeToLive(
+          body as DescribeTimeToLiveCommandInput
+        )
+        break
+      case 'EnableKinesisStreamingDestination':
+        response = await this.handleEnableKinesisStreamingDestination(
+          body as EnableKinesisStreamingDestinationCommandInput
+        )
+        break
+      case 'DisableKinesisStreamingDestination':
+        response = await this.handleDisableKinesisStreamingDestination(
+          body as DisableKinesisStreamingDestinationCommandInput
+        )
+        break
+      case 'DescribeKinesisStreamingDestination':
+        response = await this.handleDescribeKinesisStreamingDestination(
+          body as DescribeKinesisStreamingDestinationCommandInput
+        )
+        break
+      case 'UpdateContributorInsights':
+        response = await this.handleUpdateContributorInsights(
+          body as UpdateContributorInsightsCommandInput
+        )
+        break
+      case 'DescribeContributorInsights':
+        response = await this.handleDescribeContributorInsights(
+          body as DescribeContributorInsightsCommandInput
+        )
+        break
+      case 'ListContributorInsights':
+        response = await this.handleListContributorInsights(
+          body as ListContributorInsightsCommandInput
+        )
+        break
+      case 'CreateGlobalTable':
+        response = await this.handleCreateGlobalTable(
+          body as CreateGlobalTableCommandInput
+        )
+        break
+      case 'UpdateGlobalTable':
+        response = await this.handleUpdateGlobalTable(
+          body as UpdateGlobalTableCommandInput
+        )
+        break
+      case 'DescribeGlobalTable':
+        response = this.handleDescribeGlobalTable(
+          body as DescribeGlobalTableCommandInput
+        )
+        break
+      case 'ListGlobalTables':
+        response = this.handleListGlobalTables(
+          body as ListGlobalTablesCommandInput
+        )
+        break
+      case 'TagResource':
+        response = await this.handleTagResource(body as TagResourceCommandInput)
+        break
+      case 'UntagResource':
+        response = await this.handleUntagResource(
+          body as UntagResourceCommandInput
+        )
+        break
+      case 'ListTagsOfResource':
+        response = await this.handleListTagsOfResource(
+          body as ListTagsOfResourceCommandInput
+        )
+        break
+      case 'DeleteTable':
+        response = await this.handleDeleteTable(
+          body as DeleteTableCommandInput
+        )
+        break
+      case 'CreateBackup':
+        response = await this.handleCreateBackup(
+          body as CreateBackupCommandInput
+        )
+        break
+      case 'DescribeBackup':
+        response = this.handleDescribeBackup(body as DescribeBackupCommandInput)
+        break
+      case 'ListBackups':
+        response = this.handleListBackups(body as ListBackupsCommandInput)
+        break
+      case 'DeleteBackup':
+        response = this.handleDeleteBackup(body as DeleteBackupCommandInput)
+        break
+      case 'RestoreTableFromBackup':
+        response = await this.handleRestoreTableFromBackup(
+          body as RestoreTableFromBackupCommandInput
+        )
+        break
+      case 'UpdateContinuousBackups':
+        response = await this.handleUpdateContinuousBackups(
+          body as UpdateContinuousBackupsCommandInput
+        )
+        break
+      case 'DescribeContinuousBackups':
+        response = await this.handleDescribeContinuousBackups(
+          body as DescribeContinuousBackupsCommandInput
+        )
+        break
+      case 'RestoreTableToPointInTime':
+        response = await this.handleRestoreTableToPointInTime(
+          body as RestoreTableToPointInTimeCommandInput
+        )
+        break
+      case 'ExportTableToPointInTime':
+        response = await this.handleExportTableToPointInTime(
+          body as ExportTableToPointInTimeCommandInput
+        )
+        break
+      case 'DescribeExport':
+        response = this.handleDescribeExport(body as DescribeExportCommandInput)
+        break
+      case 'ListExports':
+        response = this.handleListExports(body as ListExportsCommandInput)
+        break
+      case 'ImportTable':
+        response = await this.handleImportTable(body as ImportTableCommandInput)
+        break
+      case 'DescribeImport':
+        response = this.handleDescribeImport(body as DescribeImportCommandInput)
+        break
+      case 'ListImports':
+        response = this.handleListImports(body as ListImportsCommandInput)
+        break
+      case 'TransactWriteItems':
+        response = await this.handleTransactWriteItems(
+          body as TransactWriteItemsCommandInput
+        )
+        break
+      case 'TransactGetItems':
+        response = await this.handleTransactGetItems(
+          body as TransactGetItemsCommandInput
+        )
+        break
+      case 'ExecuteStatement':
+        response = await this.handleExecuteStatement(
+          body as ExecuteStatementCommandInput
+        )
+        break
+      case 'BatchExecuteStatement':
+        response = await this.handleBatchExecuteStatement(
+          body as BatchExecuteStatementCommandInput
+        )
+        break
+      case 'ExecuteTransaction':
+        response = await this.handleExecuteTransaction(
+          body as ExecuteTransactionCommandInput
+        )
+        break
+      // Streams operations arrive under the DynamoDBStreams_20120810 prefix
+      case 'ListStreams':
+        response = this.handleListStreams(body as ListStreamsInput)
+        break
+      case 'DescribeStream':
+        response = this.handleDescribeStream(body as DescribeStreamInput)
+        break
+      case 'GetShardIterator':
+        response = this.handleGetShardIterator(body as GetShardIteratorInput)
+        break
+      case 'GetRecords':
+        response = this.handleGetRecords(body as GetRecordsInput)
+        break
+      default:
+        return undefined
     }
 
-    await this.router.putItem(TableName, item)
+    return response
+  }
 
-    switch (ReturnValues) {
-      case 'ALL_OLD':
-      case 'UPDATED_OLD':
-        return { Attributes: oldItem || {} }
-      case 'ALL_NEW':
-      case 'UPDATED_NEW':
-        return { Attributes: item }
-      case 'NONE':
-      case undefined:
-        return {}
-      default:
-        return {}
+  // Abandons requests that outlive the configured timeout with a retryable
+  // throttling error. The abandoned handler fails at its next beginCommit,
+  // so a retry never applies the same write twice. A request that has
+  // already begun committing cannot be cancelled, so it is waited for.
+  private async withRequestTimeout<T>(handler: () => Promise<T>): Promise<T> {
+    const timeoutMs = this.config.requestTimeoutMs
+    const controller = new AbortController()
+    const context = { signal: controller.signal, committing: false }
+    const operation = this.requests.run(context, handler)
+    let timer: ReturnType<typeof setTimeout> | undefined
+    const timeout = new Promise<never>((_, reject) => {
+      timer = setTimeout(() => {
+        if (context.committing) return
+        controller.abort()
+        reject({
+          name: 'RequestLimitExceeded',
+          message: `Request did not complete within ${timeoutMs}ms`,
+        })
+      }, timeoutMs)
+    })
+    // Avoid unhandled rejections from requests abandoned after the timeout
+    operation.catch(() => {})
+
+    try {
+      return await Promise.race([operation, timeout])
+    } finally {
+      clearTimeout(timer)
     }
   }
 
-  async handleDeleteItem(body: DeleteItemCommandInput) {
-    const {
-      TableName,
-      Key,
-      ReturnValues,
-      ConditionExpression,
-      ExpressionAttributeNames,
-      ExpressionAttributeValues,
-    } = body
+  // Called before a request writes anything. Past this point the request
+  // runs to completion even if it times out.
+  private beginCommit() {
+    const context = this.requests.getStore()
+    if (!context) return
+    if (context.signal.aborted) {
+      throw {
+        name: 'RequestLimitExceeded',
+        message: 'Request was abandoned before it was applied',
+      }
+    }
+    context.committing = true
+  }
 
-    if (!TableName || !Key) {
+  async handleListTables(body: ListTablesCommandInput) {
+    const { ExclusiveStartTableName, Limit = MAX_LIST_TABLES_LIMIT } = body
+
+    if (Limit < 1 || Limit > MAX_LIST_TABLES_LIMIT) {
       throw {
         name: 'ValidationException',
-        message: 'TableName and Key are required',
+        message:
+          `1 validation error detected: Value '${Limit}' at 'limit' failed to satisfy constraint: ` +
+          `Member must have value between 1 and ${MAX_LIST_TABLES_LIMIT}`,
       }
     }
 
-    const existingItem = await this.router.getItem(TableName, Key)
-    assertConditionExpression(
-      existingItem,
-      ConditionExpression,
-      ExpressionAttributeNames ?? undefined,
-      ExpressionAttributeValues ?? undefined
+    // Names are sorted, so a page resumes after the start name whether or
+    // not that table still exists
+    const tableNames = (await this.metadataStore.listTables()).filter(
+      (name) =>
+        ExclusiveStartTableName === undefined || name > ExclusiveStartTableName
     )
-    await this.router.deleteItem(TableName, Key)
+    const page = tableNames.slice(0, Limit)
 
-    if (ReturnValues === 'ALL_OLD') {
-      return { Attributes: existingItem || {} }
+    if (tableNames.length > Limit) {
+      return { TableNames: page, LastEvaluatedTableName: page[page.length - 1] }
     }
-
-    return {}
+    return { TableNames: page }
   }
 
-  async handleScan(body: ScanCommandInput) {
+  async handleCreateTable(
+    body: CreateTableCommandInput,
+    options: { dryRun?: boolean } = {}
+  ) {
     const {
       TableName,
-      Limit,
-      FilterExpression,
-      ExpressionAttributeValues,
-      ExpressionAttributeNames,
-      ExclusiveStartKey,
+      KeySchema,
+      AttributeDefinitions,
+      GlobalSecondaryIndexes,
+      LocalSecondaryIndexes,
+      SSESpecification,
+      BillingMode,
+      StreamSpecification,
+      Tags,
     } = body
 
-    if (!TableName) {
-      throw { name: 'ValidationException', message: 'TableName is required' }
+    if (!TableName || !KeySchema || !AttributeDefinitions) {
+      throw {
+        name: 'ValidationException',
+        message: 'TableName, KeySchema, and AttributeDefinitions are required',
+      }
     }
 
-    const schema = await this.metadataStore.describeTable(TableName)
-    if (!schema) {
+    if ((GlobalSecondaryIndexes?.length ?? 0) > MAX_GLOBAL_SECONDARY_INDEXES) {
+      throw {
+        name: 'LimitExceededException',
+        message: `One or more parameter values were invalid: Number of GlobalSecondaryIndexes exceeds per-table limit of ${MAX_GLOBAL_SECONDARY_INDEXES}`,
+      }
+    }
+    if ((LocalSecondaryIndexes?.length ?? 0) > MAX_LOCAL_SECONDARY_INDEXES) {
+      throw {
+        name: 'LimitExceededException',
+        message: `One or more parameter values were invalid: Number of LocalSecondaryIndexes exceeds per-table limit of ${MAX_LOCAL_SECONDARY_INDEXES}`,
+      }
+    }
+
+    assertKeySchema(KeySchema)
+    for (const index of [
+      ...(GlobalSecondaryIndexes ?? []),
+      ...(LocalSecondaryIndexes ?? []),
+    ]) {
+      assertKeySchema(index.KeySchema ?? [])
+    }
+    assertLocalIndexKeys(KeySchema, LocalSecondaryIndexes ?? [])
+    assertStreamSpecification(StreamSpecification)
+    assertTags(Tags ?? [])
+    if ((Tags?.length ?? 0) > MAX_TAGS_PER_RESOURCE) {
+      throw {
+        name: 'LimitExceededException',
+        message: `A resource can have at most ${MAX_TAGS_PER_RESOURCE} tags`,
+      }
+    }
+
+    const schema: TableSchema = {
+      tableName: TableName,
+      keySchema: KeySchema,
+      attributeDefinitions: AttributeDefinitions,
+      globalSecondaryIndexes: GlobalSecondaryIndexes?.map(toIndexSchema),
+      localSecondaryIndexes: LocalSecondaryIndexes?.map(toIndexSchema),
+      sseSpecification: SSESpecification,
+      billingMode: BillingMode ?? 'PROVISIONED',
+      ...(StreamSpecification?.StreamEnabled && {
+        streamSpecification: StreamSpecification,
+        latestStreamLabel: newStreamLabel(),
+      }),
+      ...(Tags && Tags.length > 0 && {
+        tags: Object.fromEntries(Tags.map(({ Key, Value }) => [Key, Value])),
+      }),
+    }
+    assertKeyAttributesDefined(schema)
+
+    // A dry run stops after every check CreateTable would make, and
+    // describes the table it would have created
+    if (options.dryRun) {
+      this.metadataStore.assertCanCreateTable(TableName)
+      return { TableDescription: describeTableSchema(schema) }
+    }
+
+    await this.metadataStore.withTableLock(TableName, async () => {
+      this.beginCommit()
+      await this.metadataStore.createTable(schema)
+      this.createStream(schema)
+    })
+
+    const table = await this.metadataStore.describeTable(TableName)
+    return { TableDescription: describeTableSchema(table!) }
+  }
+
+  async handlePutItem(body: PutItemCommandInput) {
+    const {
+      TableName,
+      Item,
+      ConditionExpression,
+      ExpressionAttributeNames,
+      ExpressionAttributeValues,
+      ReturnValues,
+      ReturnValuesOnConditionCheckFailure,
+      ReturnConsumedCapacity,
+      ReturnItemCollectionMetrics,
+    } = body
+
+    if (!TableName || !Item) {
+      throw {
+        name: 'ValidationException',
+        message: 'TableName and Item are required',
+      }
+    }
+    assertReturnValues(ReturnValues, 'PutItem')
+    assertReturnValuesOnConditionCheckFailure(
+      ReturnValuesOnConditionCheckFailure
+    )
+
+    const table = await this.metadataStore.describeTable(TableName)
+    if (!table) {
       throw { name: 'ResourceNotFoundException', message: 'Table not found' }
     }
+    assertItemKeys(table, Item)
+    assertNestingDepth(Item)
+    assertValidSets(Item)
+    assertItemSize(Item, 'Item size has exceeded the maximum allowed size')
+    await this.recordAccess(TableName, [Item])
 
-    const scanResult = await this.router.scan(
-      schema,
-      undefined,
-      ExclusiveStartKey
+    const existingItem = await this.withItemLock(TableName, Item, async () => {
+      const currentItem = await this.router.getItem(TableName, Item)
+      assertConditionExpression(
+        currentItem,
+        ConditionExpression,
+        ExpressionAttributeNames,
+        ExpressionAttributeValues,
+        ReturnValuesOnConditionCheckFailure
+      )
+      this.beginCommit()
+      await this.router.putItem(TableName, Item)
+      await this.recordChanges([
+        { tableName: TableName, oldItem: currentItem, newItem: Item },
+      ])
+      return currentItem
+    })
+
+    const capacity = await this.writeCapacity(ReturnConsumedCapacity, {
+      tableName: TableName,
+      oldItem: existingItem,
+      newItem: Item,
+    })
+    const metrics =
+      ReturnItemCollectionMetrics === 'SIZE'
+        ? await this.itemCollectionMetrics(TableName, Item)
+        : undefined
+    return {
+      ...(ReturnValues === 'ALL_OLD' &&
+        existingItem && { Attributes: existingItem }),
+      ...(capacity && { ConsumedCapacity: capacity }),
+      ...(metrics && { ItemCollectionMetrics: metrics }),
+    }
+  }
+
+  async handleGetItem(body: GetItemCommandInput) {
+    const {
+      TableName,
+      Key,
+      ProjectionExpression,
+      ExpressionAttributeNames,
+      ConsistentRead,
+      ReturnConsumedCapacity,
+    } = body
+
+    if (!TableName || !Key) {
+      throw {
+        name: 'ValidationException',
+        message: 'TableName and Key are required',
+      }
+    }
+    assertSingleProjectionForm(body)
+
+    const table = await this.metadataStore.describeTable(TableName)
+    if (!table) {
+      throw { name: 'ResourceNotFoundException', message: 'Table not found' }
+    }
+    assertKeyMatchesSchema(table, Key)
+    await this.recordAccess(TableName, [Key])
+
+    let item = await this.router.getItem(TableName, Key)
+    if (this.staleReads && !ConsistentRead) {
+      item = this.staleReads.item(
+        TableName,
+        getKeyString(extractKey(table, Key)),
+        item
+      )
+    }
+
+    // A missing item still costs the smallest read
+    const capacity = consumedCapacity(
+      ReturnConsumedCapacity,
+      table,
+      readCapacityUnits(item ? itemSize(item) : 0, ConsistentRead)
+    )
+    return {
+      ...(item && {
+        Item: ProjectionExpression
+          ? applyProjection(
+              item,
+              ProjectionExpression,
+              ExpressionAttributeNames
+            )
+          : item,
+      }),
+      ...(capacity && { ConsumedCapacity: capacity }),
+    }
+  }
+
+  // Endpoint discovery sends every request to the one address returned, so
+  // it must be the address the client already reached
+  handleDescribeEndpoints(host: string) {
+    return {
+      Endpoints: [{ Address: host, CachePeriodInMinutes: 1440 }],
+    }
+  }
+
+  async handleDescribeTable(body: DescribeTableCommandInput) {
+    const { TableName } = body
+
+    if (!TableName) {
+      throw { name: 'ValidationException', message: 'TableName is required' }
+    }
+
+    const table = await this.metadataStore.describeTable(TableName)
+    if (!table) {
+      throw { name: 'ResourceNotFoundException', message: 'Table not found' }
+    }
+
+    const itemCount = await this.router.getTableItemCount(TableName)
+
+    return {
+      Table: { ...describeTableSchema(table), ItemCount: itemCount },
+    }
+  }
+
+  async handleUpdateItem(body: UpdateItemCommandInput) {
+    const {
+      TableName,
+      Key,
+      UpdateExpression,
+      ExpressionAttributeValues,
+      ExpressionAttributeNames,
+      ConditionExpression,
+      ReturnValues,
+      ReturnValuesOnConditionCheckFailure,
+      ReturnConsumedCapacity,
+      ReturnItemCollectionMetrics,
+    } = body
+
+    if (!TableName || !Key) {
+      throw {
+        name: 'ValidationException',
+        message: 'TableName and Key are required',
+      }
+    }
+    // A condition with nothing to update would check without writing
+    if (ConditionExpression && !UpdateExpression?.trim()) {
+      throw {
+        name: 'ValidationException',
+        message:
+          'Invalid UpdateItem request: ConditionExpression requires an UpdateExpression with at least one SET, REMOVE, ADD, or DELETE action',
+      }
+    }
+    assertReturnValues(ReturnValues, 'UpdateItem')
+    assertReturnValuesOnConditionCheckFailure(
+      ReturnValuesOnConditionCheckFailure
     )
+
+    // TODO: cache this?
+    const table = await this.metadataStore.describeTable(TableName)
+    if (!table) {
+      throw { name: 'ResourceNotFoundException', message: 'Table not found' }
+    }
+    assertKeyMatchesSchema(table, Key)
+    assertKeyNotUpdated(
+      table,
+      UpdateExpression,
+      ExpressionAttributeNames,
+      ExpressionAttributeValues ?? undefined
+    )
+    await this.recordAccess(TableName, [Key])
+
+    const { oldItem, item } = await this.withItemLock(
+      TableName,
+      Key,
+      async () => {
+        const currentItem = await this.router.getItem(TableName, Key)
+        assertConditionExpression(
+          currentItem,
+          ConditionExpression,
+          ExpressionAttributeNames ?? undefined,
+          ExpressionAttributeValues ?? undefined,
+          ReturnValuesOnConditionCheckFailure
+        )
+        let updatedItem: DynamoDBItem = currentItem
+          ? { ...currentItem }
+          : { ...Key }
+
+        if (UpdateExpression) {
+          updatedItem = applyUpdateExpressionToItem(
+            updatedItem,
+            UpdateExpression,
+            ExpressionAttributeNames,
+            ExpressionAttributeValues ?? undefined
+          )
+        }
+        assertNestingDepth(updatedItem)
+        // The limit applies to the item the update produces, not the request
+        assertItemSize(
+          updatedItem,
+          'Item size to update has exceeded the maximum allowed size'
+        )
+
+        // Removing every non-key attribute still leaves the item in place
+        this.beginCommit()
+        await this.router.putItem(TableName, updatedItem)
+        await this.recordChanges([
+          { tableName: TableName, oldItem: currentItem, newItem: updatedItem },
+        ])
+        return { oldItem: currentItem, item: updatedItem }
+      }
+    )
+
+    let attributes: DynamoDBItem | null = null
+    switch (ReturnValues) {
+      case 'ALL_OLD':
+        attributes = oldItem
+        break
+      case 'ALL_NEW':
+        attributes = item
+        break
+      case 'UPDATED_OLD':
+      case 'UPDATED_NEW': {
+        // Only the attributes the update wrote, as they were or now are;
+        // attributes it added or removed are missing from one side
+        const updated = projectAttributePaths(
+          (ReturnValues === 'UPDATED_OLD' ? oldItem : item) ?? {},
+          updatedAttributePaths(
+            UpdateExpression ?? '',
+            ExpressionAttributeValues ?? undefined
+          ),
+          ExpressionAttributeNames
+        )
+        if (Object.keys(updated).length > 0) attributes = updated
+        break
+      }
+    }
+
+    const capacity = await this.writeCapacity(ReturnConsumedCapacity, {
+      tableName: TableName,
+      oldItem,
+      newItem: item,
+    })
+    const metrics =
+      ReturnItemCollectionMetrics === 'SIZE'
+        ? await this.itemCollectionMetrics(TableName, Key)
+        : undefined
+    return {
+      ...(attributes && { Attributes: attributes }),
+      ...(capacity && { ConsumedCapacity: capacity }),
+      ...(metrics && { ItemCollectionMetrics: metrics }),
+    }
+  }
+
+  async handleDeleteItem(body: DeleteItemCommandInput) {
+    const {
+      TableName,
+      Key,
+      ReturnValues,
+      ConditionExpression,
+      ExpressionAttributeNames,
+      ExpressionAttributeValues,
+      ReturnValuesOnConditionCheckFailure,
+      ReturnConsumedCapacity,
+      ReturnItemCollectionMetrics,
+    } = body
+
+    if (!TableName || !Key) {
+      throw {
+        name: 'ValidationException',
+        message: 'TableName and Key are required',
+      }
+    }
+    assertReturnValues(ReturnValues, 'DeleteItem')
+    assertReturnValuesOnConditionCheckFailure(
+      ReturnValuesOnConditionCheckFailure
+    )
+
+    const table = await this.metadataStore.describeTable(TableName)
+    if (!table) {
+      throw { name: 'ResourceNotFoundException', message: 'Table not found' }
+    }
+    assertKeyMatchesSchema(table, Key)
+    await this.recordAccess(TableName, [Key])
+
+    const existingItem = await this.withItemLock(TableName, Key, async () => {
+      const currentItem = await this.router.getItem(TableName, Key)
+      assertConditionExpression(
+        currentItem,
+        ConditionExpression,
+        ExpressionAttributeNames ?? undefined,
+        ExpressionAttributeValues ?? undefined,
+        ReturnValuesOnConditionCheckFailure
+      )
+      this.beginCommit()
+      await this.router.deleteItem(TableName, Key)
+      await this.recordChanges([
+        { tableName: TableName, oldItem: currentItem, newItem: null },
+      ])
+      return currentItem
+    })
+
+    const capacity = await this.writeCapacity(ReturnConsumedCapacity, {
+      tableName: TableName,
+      oldItem: existingItem,
+      newItem: null,
+    })
+    const metrics =
+      ReturnItemCollectionMetrics === 'SIZE'
+        ? await this.itemCollectionMetrics(TableName, Key)
+        : undefined
+    return {
+      ...(ReturnValues === 'ALL_OLD' &&
+        existingItem && { Attributes: existingItem }),
+      ...(capacity && { ConsumedCapacity: capacity }),
+      ...(metrics && { ItemCollectionMetrics: metrics }),
+    }
+  }
+
+  async handleScan(body: ScanCommandInput) {
+    const {
+      TableName,
+      IndexName,
+      Limit,
+      FilterExpression,
+      ExpressionAttributeValues,
+      ExpressionAttributeNames,
+      ExclusiveStartKey,
+      ConsistentRead,
+      Select,
+      ProjectionExpression,
+      Segment,
+      TotalSegments,
+      ReturnConsumedCapacity,
+    } = body
+
+    if (!TableName) {
+      throw { name: 'ValidationException', message: 'TableName is required' }
+    }
+    assertSingleFilterForm(body)
+    assertScanSegment(Segment, TotalSegments)
+    assertLimit(Limit)
+    assertSingleProjectionForm(body)
+
+    const schema = await this.metadataStore.describeTable(TableName)
+    if (!schema) {
+      throw { name: 'ResourceNotFoundException', message: 'Table not found' }
+    }
+    const index = IndexName ? requireIndex(schema, IndexName) : undefined
+    assertConsistentReadSupported(schema, IndexName, ConsistentRead)
+    assertSelectSupported(schema, IndexName, Select, ProjectionExpression)
+
+    const scanResult = await this.router.scan(schema)
     let items = scanResult.items
-    const scannedCount = items.length
+    // Eventually consistent reads see items as they were STALE_READ_MS ago
+    if (this.staleReads && !ConsistentRead) {
+      items = this.staleReads.items(TableName, items, (item) =>
+        getKeyString(extractKey(schema, item))
+      )
+    }
+
+    // Index reads only see what the index itself stores, except LSI reads
+    // that ask for ALL_ATTRIBUTES, which DynamoDB fetches from the table
+    if (index) {
+      items = items.filter((item) => hasIndexKeys(index, item))
+      if (Select !== 'ALL_ATTRIBUTES') {
+        items = items.map((item) => projectToIndex(schema, index, item))
+      }
+    }
+
+    // Parallel scans split the table or index by partition key hash, so
+    // each item belongs to exactly one segment
+    if (TotalSegments !== undefined && TotalSegments > 1) {
+      items = items.filter(
+        (item) => scanSegment(schema, index, item, TotalSegments) === Segment
+      )
+    }
+    items.sort((a, b) => compareScanOrder(schema, index, a, b))
+
+    // Items up to the start key were read by earlier pages. The page
+    // resumes by position, so it holds even if that item has since been
+    // deleted.
+    let readBefore: DynamoDBItem[] = []
+    if (ExclusiveStartKey) {
+      assertStartKey(schema, index, ExclusiveStartKey)
+      const start = items.findIndex(
+        (item) => compareScanOrder(schema, index, item, ExclusiveStartKey) > 0
+      )
+      readBefore = start === -1 ? items : items.slice(0, start)
+      items = start === -1 ? [] : items.slice(start)
+    }
+
+    // A page stops after Limit items, after 1MB of items, or sooner at
+    // MAX_PAGE_ITEMS. Limit counts the items read, so the filter runs on
+    // the page afterwards and can return fewer.
+    const { page: scanned, truncated } = readPage(
+      items,
+      Limit,
+      this.config.maxPageItems
+    )
+    items = scanned
 
     // Apply FilterExpression
     if (FilterExpression) {
@@ -430,26 +1685,46 @@ export class DB {
       )
     }
 
-    // Apply limit
+    // The next page resumes after the last item read, even one the filter
+    // dropped
     let lastEvaluatedKey
-    if (Limit && items.length > Limit) {
-      const limitedItems = items.slice(0, Limit)
-      const lastItem = limitedItems[limitedItems.length - 1]
-      if (lastItem) {
-        lastEvaluatedKey = extractKey(schema, lastItem)
-      }
-      items = limitedItems
+    const lastScanned = scanned[scanned.length - 1]
+    if (truncated && lastScanned) {
+      lastEvaluatedKey = extractKey(schema, lastScanned, index)
+    }
+
+    // Capacity is charged for every item read, including filtered ones
+    const readBytes = totalItemSize(scanned)
+    await this.recordAccess(TableName, scanned, IndexName)
+
+    // Projection runs last so the pagination key still comes from full items
+    if (ProjectionExpression) {
+      items = items.map((item) =>
+        applyProjection(item, ProjectionExpression, ExpressionAttributeNames)
+      )
     }
 
     const result: {
-      Items: DynamoDBItem[]
+      Items?: DynamoDBItem[]
       Count: number
       ScannedCount: number
       LastEvaluatedKey?: DynamoDBItem
+      ConsumedCapacity?: ConsumedCapacity
     } = {
-      Items: items,
+      // COUNT returns how many items matched, not the items
+      ...(Select !== 'COUNT' && { Items: items }),
       Count: items.length,
-      ScannedCount: scannedCount,
+      ScannedCount: scanned.length,
+      ConsumedCapacity: consumedCapacity(
+        ReturnConsumedCapacity,
+        schema,
+        readCapacityUnits(
+          readBytes,
+          ConsistentRead,
+          totalItemSize(readBefore)
+        ),
+        IndexName
+      ),
     }
 
     if (lastEvaluatedKey) {
@@ -462,6 +1737,7 @@ export class DB {
   async handleQuery(body: QueryCommandInput) {
     const {
       TableName,
+      IndexName,
       KeyConditionExpression,
       FilterExpression,
       ExpressionAttributeValues,
@@ -469,21 +1745,37 @@ export class DB {
       Limit,
       ExclusiveStartKey,
       ScanIndexForward = true,
+      ProjectionExpression,
+      ConsistentRead,
+      Select,
+      ReturnConsumedCapacity,
     } = body
 
     if (!TableName) {
       throw { name: 'ValidationException', message: 'TableName is required' }
     }
+    assertSingleFilterForm(body)
+    assertLimit(Limit)
+    assertSingleProjectionForm(body)
 
     const schema = await this.metadataStore.describeTable(TableName)
     if (!schema) {
       throw { name: 'ResourceNotFoundException', message: 'Table not found' }
     }
+    const index = IndexName ? requireIndex(schema, IndexName) : undefined
+    assertConsistentReadSupported(schema, IndexName, ConsistentRead)
+    assertSelectSupported(schema, IndexName, Select, ProjectionExpression)
 
     // Build filter function from KeyConditionExpression using proper parser
     let keyCondition = (_item: DynamoDBItem) => true
 
     if (KeyConditionExpression) {
+      validateKeyCondition(
+        KeyConditionExpression,
+        ExpressionAttributeValues ?? undefined,
+        ExpressionAttributeNames,
+        schema.attributeDefinitions
+      )
       keyCondition = (item: DynamoDBItem) => {
         return evaluateKeyCondition(
           item,
@@ -496,45 +1788,54 @@ export class DB {
 
     const queryResult = await this.router.query(schema, keyCondition)
     let items = queryResult.items
+    // Items deleted since the read's point in time come back, so the key
+    // condition is applied again
+    if (this.staleReads && !ConsistentRead) {
+      items = this.staleReads
+        .items(TableName, items, (item) =>
+          getKeyString(extractKey(schema, item))
+        )
+        .filter(keyCondition)
+    }
 
-    // Sort items by sort key based on ScanIndexForward
-    if (schema.keySchema.length > 1 && items.length > 0) {
-      const sortKeyElement = schema.keySchema[1]
-      const sortKeyName = sortKeyElement?.AttributeName
-      if (sortKeyName) {
-        items.sort((a, b) => {
-          const aVal = a[sortKeyName]
-          const bVal = b[sortKeyName]
-
-          // Handle string sort keys
-          if (aVal?.S !== undefined && bVal?.S !== undefined) {
-            const comparison = aVal.S.localeCompare(bVal.S)
-            return ScanIndexForward ? comparison : -comparison
-          }
-
-          // Handle number sort keys
-          if (aVal?.N !== undefined && bVal?.N !== undefined) {
-            const comparison = parseFloat(aVal.N) - parseFloat(bVal.N)
-            return ScanIndexForward ? comparison : -comparison
-          }
-
-          return 0
-        })
+    // Index reads only see what the index itself stores, except LSI reads
+    // that ask for ALL_ATTRIBUTES, which DynamoDB fetches from the table
+    if (index) {
+      items = items.filter((item) => hasIndexKeys(index, item))
+      if (Select !== 'ALL_ATTRIBUTES') {
+        items = items.map((item) => projectToIndex(schema, index, item))
       }
     }
 
+    // Sort items by the (index) sort key based on ScanIndexForward
+    const compareOrder = (a: DynamoDBItem, b: DynamoDBItem) => {
+      const comparison = compareQueryOrder(schema, index, a, b)
+      return ScanIndexForward ? comparison : -comparison
+    }
+    items.sort(compareOrder)
+
+    // Items up to the start key were read by earlier pages. The page
+    // resumes by position, so it holds even if that item has since been
+    // deleted.
+    let readBefore: DynamoDBItem[] = []
     if (ExclusiveStartKey) {
-      const exclusiveKeyString = getKeyString(ExclusiveStartKey)
-      const startIndex = items.findIndex((item) => {
-        const key = extractKey(schema, item)
-        return getKeyString(key) === exclusiveKeyString
-      })
-      if (startIndex >= 0) {
-        items = items.slice(startIndex + 1)
-      }
+      assertStartKey(schema, index, ExclusiveStartKey)
+      const start = items.findIndex(
+        (item) => compareOrder(item, ExclusiveStartKey) > 0
+      )
+      readBefore = start === -1 ? items : items.slice(0, start)
+      items = start === -1 ? [] : items.slice(start)
     }
 
-    const scannedCount = items.length
+    // A page stops after Limit items, after 1MB of items, or sooner at
+    // MAX_PAGE_ITEMS. Limit counts the items read, so the filter runs on
+    // the page afterwards and can return fewer.
+    const { page: scanned, truncated } = readPage(
+      items,
+      Limit,
+      this.config.maxPageItems
+    )
+    items = scanned
 
     // Apply FilterExpression
     if (FilterExpression) {
@@ -546,203 +1847,3430 @@ export class DB {
       )
     }
 
-    // Apply limit
+    // The next page resumes after the last item read, even one the filter
+    // dropped
     let lastEvaluatedKey: DynamoDBItem | undefined
-    if (Limit && items.length > Limit) {
-      const limitedItems = items.slice(0, Limit)
-      const lastItem = limitedItems[limitedItems.length - 1]
-      if (lastItem) {
-        lastEvaluatedKey = extractKey(schema, lastItem)
-      }
-      items = limitedItems
+    const lastScanned = scanned[scanned.length - 1]
+    if (truncated && lastScanned) {
+      lastEvaluatedKey = extractKey(schema, lastScanned, index)
     }
 
-    return {
-      Items: items,
-      Count: items.length,
-      ScannedCount: scannedCount,
+    // Capacity is charged for every item read, including filtered ones
+    const readBytes = totalItemSize(scanned)
+    await this.recordAccess(TableName, scanned, IndexName)
+
+    // Projection runs last so the pagination key still comes from full items
+    if (ProjectionExpression) {
+      items = items.map((item) =>
+        applyProjection(item, ProjectionExpression, ExpressionAttributeNames)
+      )
+    }
+
+    return {
+      // COUNT returns how many items matched, not the items
+      ...(Select !== 'COUNT' && { Items: items }),
+      Count: items.length,
+      ScannedCount: scanned.length,
       LastEvaluatedKey: lastEvaluatedKey,
+      ConsumedCapacity: consumedCapacity(
+        ReturnConsumedCapacity,
+        schema,
+        readCapacityUnits(
+          readBytes,
+          ConsistentRead,
+          totalItemSize(readBefore)
+        ),
+        IndexName
+      ),
+    }
+  }
+
+  // Only GlobalSecondaryIndexUpdates and StreamSpecification are supported.
+  // Index reads filter the table's items, so a new GSI already covers every
+  // existing item; its backfill is simulated by INDEX_BACKFILL_MS.
+  async handleUpdateTable(body: UpdateTableCommandInput) {
+    const {
+      TableName,
+      AttributeDefinitions,
+      GlobalSecondaryIndexUpdates,
+      StreamSpecification,
+    } = body
+
+    if (!TableName) {
+      throw { name: 'ValidationException', message: 'TableName is required' }
+    }
+    // LSIs are fixed when the table is created
+    if (
+      'LocalSecondaryIndexes' in body ||
+      'LocalSecondaryIndexUpdates' in body
+    ) {
+      throw {
+        name: 'ValidationException',
+        message:
+          'One or more parameter values were invalid: LocalSecondaryIndexes can only be created with the table',
+      }
+    }
+
+    const updates = (GlobalSecondaryIndexUpdates ?? []).filter(
+      (update) => update.Create || update.Delete
+    )
+    if (updates.length > 1) {
+      throw {
+        name: 'LimitExceededException',
+        message:
+          'Subscriber limit exceeded: Only 1 online index can be created or deleted simultaneously per table',
+      }
+    }
+    assertStreamSpecification(StreamSpecification)
+
+    return await this.metadataStore.withTableLock(TableName, async () => {
+      const table = await this.metadataStore.describeTable(TableName)
+      if (!table) {
+        throw { name: 'ResourceNotFoundException', message: 'Table not found' }
+      }
+
+      // New definitions add to the table's, for the keys of new indexes
+      const attributeDefinitions = [
+        ...table.attributeDefinitions.filter(
+          (existing) =>
+            !AttributeDefinitions?.some(
+              (definition) =>
+                definition.AttributeName === existing.AttributeName
+            )
+        ),
+        ...(AttributeDefinitions ?? []),
+      ]
+      let globalSecondaryIndexes = table.globalSecondaryIndexes ?? []
+
+      for (const { Create, Delete } of updates) {
+        if (Create) {
+          if (findIndex(table, Create.IndexName!)) {
+            throw {
+              name: 'ValidationException',
+              message: `One or more parameter values were invalid: Index ${Create.IndexName} already exists`,
+            }
+          }
+          if (globalSecondaryIndexes.length >= MAX_GLOBAL_SECONDARY_INDEXES) {
+            throw {
+              name: 'LimitExceededException',
+              message: `One or more parameter values were invalid: Number of GlobalSecondaryIndexes exceeds per-table limit of ${MAX_GLOBAL_SECONDARY_INDEXES}`,
+            }
+          }
+          assertKeySchema(Create.KeySchema ?? [])
+          const backfillMs = this.config.indexBackfillMs
+          globalSecondaryIndexes = [
+            ...globalSecondaryIndexes,
+            {
+              ...toIndexSchema(Create),
+              ...(backfillMs > 0 && { backfillUntil: Date.now() + backfillMs }),
+            },
+          ]
+        }
+        if (Delete) {
+          if (
+            !globalSecondaryIndexes.some(
+              (index) => index.indexName === Delete.IndexName
+            )
+          ) {
+            throw {
+              name: 'ResourceNotFoundException',
+              message: `Requested resource not found: Index: ${Delete.IndexName} not found`,
+            }
+          }
+          globalSecondaryIndexes = globalSecondaryIndexes.filter(
+            (index) => index.indexName !== Delete.IndexName
+          )
+        }
+      }
+
+      const updated: TableSchema = {
+        ...table,
+        attributeDefinitions,
+        globalSecondaryIndexes,
+      }
+      const enabled = table.streamSpecification?.StreamEnabled
+      if (StreamSpecification?.StreamEnabled) {
+        if (enabled) {
+          throw {
+            name: 'ValidationException',
+            message: `Table already has an enabled stream: ${streamArn(table)}`,
+          }
+        }
+        updated.streamSpecification = StreamSpecification
+        updated.latestStreamLabel = newStreamLabel()
+      } else if (StreamSpecification) {
+        if (!enabled) {
+          throw {
+            name: 'ValidationException',
+            message: 'Table does not have an enabled stream to disable',
+          }
+        }
+        updated.streamSpecification = undefined
+      }
+      assertKeyAttributesDefined(updated)
+      this.beginCommit()
+      await this.metadataStore.updateTable(updated)
+      // Contributor Insights of deleted indexes are deleted with them
+      const insights = table.contributorInsights ?? []
+      const kept = insights.filter(
+        (s) => s.indexName === undefined || findIndex(updated, s.indexName)
+      )
+      if (kept.length < insights.length) {
+        await this.metadataStore.setContributorInsights(TableName, kept)
+        for (const s of insights.filter((s) => !kept.includes(s))) {
+          this.insights.reset(TableName, s.indexName)
+        }
+      }
+      if (StreamSpecification?.StreamEnabled) {
+        this.createStream(updated)
+      } else if (StreamSpecification) {
+        this.streams.disableStream(streamArn(table))
+      }
+
+      const described = await this.metadataStore.describeTable(TableName)
+      return { TableDescription: describeTableSchema(described!) }
+    })
+  }
+
+  async handleUpdateTimeToLive(body: UpdateTimeToLiveCommandInput) {
+    const { TableName, TimeToLiveSpecification } = body
+    const { Enabled, AttributeName } = TimeToLiveSpecification ?? {}
+
+    if (!TableName || Enabled === undefined || !AttributeName) {
+      throw {
+        name: 'ValidationException',
+        message:
+          'TableName and TimeToLiveSpecification with Enabled and AttributeName are required',
+      }
+    }
+
+    return await this.metadataStore.withTableLock(TableName, async () => {
+      const table = await this.metadataStore.describeTable(TableName)
+      if (!table) {
+        throw { name: 'ResourceNotFoundException', message: 'Table not found' }
+      }
+      if (Enabled && table.timeToLiveAttribute) {
+        throw {
+          name: 'ValidationException',
+          message: 'TimeToLive is already enabled',
+        }
+      }
+      if (!Enabled && !table.timeToLiveAttribute) {
+        throw {
+          name: 'ValidationException',
+          message: 'TimeToLive is already disabled',
+        }
+      }
+
+      await this.metadataStore.setTimeToLive(
+        TableName,
+        Enabled ? AttributeName : undefined
+      )
+      return { TimeToLiveSpecification: { Enabled, AttributeName } }
+    })
+  }
+
+  async handleDescribeTimeToLive(body: DescribeTimeToLiveCommandInput) {
+    const { TableName } = body
+
+    if (!TableName) {
+      throw { name: 'ValidationException', message: 'TableName is required' }
+    }
+
+    const table = await this.metadataStore.describeTable(TableName)
+    if (!table) {
+      throw { name: 'ResourceNotFoundException', message: 'Table not found' }
+    }
+
+    // Changes apply immediately, so there is no ENABLING or DISABLING
+    return {
+      TimeToLiveDescription: table.timeToLiveAttribute
+        ? {
+            TimeToLiveStatus: 'ENABLED',
+            AttributeName: table.timeToLiveAttribute,
+          }
+        : { TimeToLiveStatus: 'DISABLED' },
+    }
+  }
+
+  async handleEnableKinesisStreamingDestination(
+    body: EnableKinesisStreamingDestinationCommandInput
+  ) {
+    const { TableName, StreamArn, EnableKinesisStreamingConfiguration } = body
+    const precision =
+      EnableKinesisStreamingConfiguration
+        ?.ApproximateCreationDateTimePrecision ?? 'MILLISECOND'
+
+    if (!TableName || !StreamArn) {
+      throw {
+        name: 'ValidationException',
+        message: 'TableName and StreamArn are required',
+      }
+    }
+    if (!kinesisStreamName(StreamArn)) {
+      throw {
+        name: 'ValidationException',
+        message: `Invalid Kinesis stream ARN: ${StreamArn}`,
+      }
+    }
+    if (precision !== 'MILLISECOND' && precision !== 'MICROSECOND') {
+      throw {
+        name: 'ValidationException',
+        message: `Invalid ApproximateCreationDateTimePrecision: ${precision}`,
+      }
+    }
+
+    return await this.metadataStore.withTableLock(TableName, async () => {
+      const table = await this.metadataStore.describeTable(TableName)
+      if (!table) {
+        throw { name: 'ResourceNotFoundException', message: 'Table not found' }
+      }
+      const destinations = table.kinesisDestinations ?? []
+      if (
+        destinations.some(
+          (d) => d.streamArn === StreamArn && d.status === 'ACTIVE'
+        )
+      ) {
+        throw {
+          name: 'ResourceInUseException',
+          message: `Table ${TableName} is already streaming to ${StreamArn}`,
+        }
+      }
+
+      // Changes apply immediately, so there is no ENABLING or DISABLING
+      await this.metadataStore.setKinesisDestinations(TableName, [
+        ...destinations.filter((d) => d.streamArn !== StreamArn),
+        { streamArn: StreamArn, status: 'ACTIVE', precision },
+      ])
+      return {
+        TableName,
+        StreamArn,
+        DestinationStatus: 'ACTIVE',
+        EnableKinesisStreamingConfiguration: {
+          ApproximateCreationDateTimePrecision: precision,
+        },
+      }
+    })
+  }
+
+  async handleDisableKinesisStreamingDestination(
+    body: DisableKinesisStreamingDestinationCommandInput
+  ) {
+    const { TableName, StreamArn } = body
+
+    if (!TableName || !StreamArn) {
+      throw {
+        name: 'ValidationException',
+        message: 'TableName and StreamArn are required',
+      }
+    }
+
+    return await this.metadataStore.withTableLock(TableName, async () => {
+      const table = await this.metadataStore.describeTable(TableName)
+      if (!table) {
+        throw { name: 'ResourceNotFoundException', message: 'Table not found' }
+      }
+      const destinations = table.kinesisDestinations ?? []
+      const destination = destinations.find(
+        (d) => d.streamArn === StreamArn && d.status === 'ACTIVE'
+      )
+      if (!destination) {
+        throw {
+          name: 'ValidationException',
+          message: `Table ${TableName} is not streaming to ${StreamArn}`,
+        }
+      }
+
+      // Disabled destinations stay listed, as in DynamoDB
+      await this.metadataStore.setKinesisDestinations(
+        TableName,
+        destinations.map((d) =>
+          d === destination ? { ...d, status: 'DISABLED' as const } : d
+        )
+      )
+      return {
+        TableName,
+        StreamArn,
+        DestinationStatus: 'DISABLED',
+        EnableKinesisStreamingConfiguration: {
+          ApproximateCreationDateTimePrecision: destination.precision,
+        },
+      }
+    })
+  }
+
+  async handleDescribeKinesisStreamingDestination(
+    body: DescribeKinesisStreamingDestinationCommandInput
+  ) {
+    const { TableName } = body
+
+    if (!TableName) {
+      throw { name: 'ValidationException', message: 'TableName is required' }
+    }
+
+    const table = await this.metadataStore.describeTable(TableName)
+    if (!table) {
+      throw { name: 'ResourceNotFoundException', message: 'Table not found' }
+    }
+
+    return {
+      TableName,
+      KinesisDataStreamDestinations: (table.kinesisDestinations ?? []).map(
+        (d) => ({
+          StreamArn: d.streamArn,
+          DestinationStatus: d.status,
+          ApproximateCreationDateTimePrecision: d.precision,
+        })
+      ),
+    }
+  }
+
+  async handleUpdateContributorInsights(
+    body: UpdateContributorInsightsCommandInput
+  ) {
+    const { TableName, IndexName, ContributorInsightsAction } = body
+
+    if (!TableName || !ContributorInsightsAction) {
+      throw {
+        name: 'ValidationException',
+        message: 'TableName and ContributorInsightsAction are required',
+      }
+    }
+    if (
+      ContributorInsightsAction !== 'ENABLE' &&
+      ContributorInsightsAction !== 'DISABLE'
+    ) {
+      throw {
+        name: 'ValidationException',
+        message: `Invalid ContributorInsightsAction: ${ContributorInsightsAction}`,
+      }
+    }
+
+    return await this.metadataStore.withTableLock(TableName, async () => {
+      const table = await this.requireInsightsTarget(TableName, IndexName)
+      const settings = table.contributorInsights ?? []
+      const existing = settings.find((s) => s.indexName === IndexName)
+      const others = settings.filter((s) => s !== existing)
+
+      // Changes apply immediately, so there is no ENABLING or DISABLING.
+      // Enabling again keeps the counts so far.
+      if (ContributorInsightsAction === 'ENABLE') {
+        await this.metadataStore.setContributorInsights(TableName, [
+          ...others,
+          existing ?? { indexName: IndexName, enabledAt: Date.now() },
+        ])
+      } else {
+        await this.metadataStore.setContributorInsights(TableName, others)
+        this.insights.reset(TableName, IndexName)
+      }
+      return {
+        TableName,
+        IndexName,
+        ContributorInsightsStatus:
+          ContributorInsightsAction === 'ENABLE' ? 'ENABLED' : 'DISABLED',
+      }
+    })
+  }
+
+  /**
+   * Besides DynamoDB's fields, the response has TopContributors: for each
+   * rule that counts accesses, the most accessed keys since insights were
+   * enabled, as CloudWatch would report them. SDKs drop fields they do not
+   * know, so read it from the raw response.
+   */
+  async handleDescribeContributorInsights(
+    body: DescribeContributorInsightsCommandInput
+  ) {
+    const { TableName, IndexName } = body
+
+    if (!TableName) {
+      throw { name: 'ValidationException', message: 'TableName is required' }
+    }
+
+    const table = await this.requireInsightsTarget(TableName, IndexName)
+    const setting = table.contributorInsights?.find(
+      (s) => s.indexName === IndexName
+    )
+    if (!setting) {
+      return {
+        TableName,
+        IndexName,
+        ContributorInsightsRuleList: [],
+        ContributorInsightsStatus: 'DISABLED',
+      }
+    }
+
+    // Accessed (C) and throttled (T) partition keys (PK) and items (SK).
+    // Nothing is throttled, so the T rules never have contributors.
+    const target = IndexName ? `${TableName}-${IndexName}` : TableName
+    const rule = (kind: string) =>
+      `DynamoDBContributorInsights-${kind}-${target}-${setting.enabledAt}`
+    const keySchema = IndexName
+      ? findIndex(table, IndexName)!.keySchema
+      : table.keySchema
+    const hasSortKey = keySchema.some((k) => k.KeyType === 'RANGE')
+    const top = this.insights.top(TableName, IndexName)
+
+    return {
+      TableName,
+      IndexName,
+      ContributorInsightsRuleList: hasSortKey
+        ? [rule('PKC'), rule('PKT'), rule('SKC'), rule('SKT')]
+        : [rule('PKC'), rule('PKT')],
+      ContributorInsightsStatus: 'ENABLED',
+      LastUpdateDateTime: setting.enabledAt / 1000,
+      TopContributors: [
+        { RuleName: rule('PKC'), Contributors: top.partitions },
+        ...(hasSortKey
+          ? [{ RuleName: rule('SKC'), Contributors: top.items }]
+          : []),
+      ],
+    }
+  }
+
+  // Lists the table and every index of each table, or of TableName, with
+  // their status. NextToken is the table and index the last page ended on.
+  async handleListContributorInsights(
+    body: ListContributorInsightsCommandInput
+  ) {
+    const {
+      TableName,
+      MaxResults = MAX_LIST_CONTRIBUTOR_INSIGHTS_RESULTS,
+      NextToken,
+    } = body
+
+    if (MaxResults < 1 || MaxResults > MAX_LIST_CONTRIBUTOR_INSIGHTS_RESULTS) {
+      throw {
+        name: 'ValidationException',
+        message:
+          `1 validation error detected: Value '${MaxResults}' at 'maxResults' failed to satisfy constraint: ` +
+          `Member must have value between 1 and ${MAX_LIST_CONTRIBUTOR_INSIGHTS_RESULTS}`,
+      }
+    }
+
+    const tableNames = TableName
+      ? [(await this.requireInsightsTarget(TableName, undefined)).tableName]
+      : (await this.metadataStore.listTables()).sort()
+    let summaries: {
+      TableName: string
+      IndexName?: string
+      ContributorInsightsStatus: string
+    }[] = []
+    for (const tableName of tableNames) {
+      const table = await this.metadataStore.describeTable(tableName)
+      if (!table) continue
+      const indexNames = [
+        ...(table.globalSecondaryIndexes ?? []),
+        ...(table.localSecondaryIndexes ?? []),
+      ].map((index) => index.indexName)
+      for (const indexName of [undefined, ...indexNames]) {
+        const enabled = table.contributorInsights?.some(
+          (s) => s.indexName === indexName
+        )
+        summaries.push({
+          TableName: tableName,
+          IndexName: indexName,
+          ContributorInsightsStatus: enabled ? 'ENABLED' : 'DISABLED',
+        })
+      }
+    }
+
+    const token = (summary: (typeof summaries)[number]) =>
+      JSON.stringify([summary.TableName, summary.IndexName ?? ''])
+    if (NextToken) {
+      summaries = summaries.slice(
+        summaries.findIndex((s) => token(s) === NextToken) + 1
+      )
+    }
+    const page = summaries.slice(0, MaxResults)
+
+    return {
+      ContributorInsightsSummaries: page,
+      ...(summaries.length > MaxResults && {
+        NextToken: token(page[page.length - 1]!),
+      }),
+    }
+  }
+
+  private async requireInsightsTarget(
+    tableName: string,
+    indexName: string | undefined
+  ): Promise<TableSchema> {
+    const table = await this.metadataStore.describeTable(tableName)
+    if (!table) {
+      throw { name: 'ResourceNotFoundException', message: 'Table not found' }
+    }
+    if (indexName && !findIndex(table, indexName)) {
+      throw {
+        name: 'ResourceNotFoundException',
+        message: `Requested resource not found: Index: ${indexName} not found`,
+      }
+    }
+    return table
+  }
+
+  async handleCreateGlobalTable(body: CreateGlobalTableCommandInput) {
+    const { GlobalTableName, ReplicationGroup } = body
+
+    if (!GlobalTableName || !ReplicationGroup?.length) {
+      throw {
+        name: 'ValidationException',
+        message: 'GlobalTableName and ReplicationGroup are required',
+      }
+    }
+    if (this.globalTables.getGlobalTable(GlobalTableName)) {
+      throw {
+        name: 'GlobalTableAlreadyExistsException',
+        message: `Global table already exists: ${GlobalTableName}`,
+      }
+    }
+
+    const regions = ReplicationGroup.map(({ RegionName }) => RegionName ?? '')
+    await this.assertReplicas(GlobalTableName, regions, regions)
+    const info = {
+      globalTableName: GlobalTableName,
+      regions,
+      createdAt: Date.now(),
+    }
+    this.globalTables.createGlobalTable(info)
+    return { GlobalTableDescription: describeGlobalTable(info) }
+  }
+
+  async handleUpdateGlobalTable(body: UpdateGlobalTableCommandInput) {
+    const { GlobalTableName, ReplicaUpdates } = body
+
+    if (!GlobalTableName || !ReplicaUpdates?.length) {
+      throw {
+        name: 'ValidationException',
+        message: 'GlobalTableName and ReplicaUpdates are required',
+      }
+    }
+    const info = this.requireGlobalTable(GlobalTableName)
+
+    let regions = [...info.regions]
+    const added: string[] = []
+    for (const { Create, Delete } of ReplicaUpdates) {
+      if (Create?.RegionName) {
+        if (regions.includes(Create.RegionName)) {
+          throw {
+            name: 'ReplicaAlreadyExistsException',
+            message: `Replica already exists in region ${Create.RegionName}`,
+          }
+        }
+        regions.push(Create.RegionName)
+        added.push(Create.RegionName)
+      } else if (Delete?.RegionName) {
+        if (!regions.includes(Delete.RegionName)) {
+          throw {
+            name: 'ReplicaNotFoundException',
+            message: `Replica not found in region ${Delete.RegionName}`,
+          }
+        }
+        regions = regions.filter((region) => region !== Delete.RegionName)
+      } else {
+        throw {
+          name: 'ValidationException',
+          message: 'Each ReplicaUpdate must Create or Delete a RegionName',
+        }
+      }
+    }
+
+    await this.assertReplicas(GlobalTableName, regions, added)
+    this.globalTables.setRegions(GlobalTableName, regions)
+    return { GlobalTableDescription: describeGlobalTable({ ...info, regions }) }
+  }
+
+  handleDescribeGlobalTable(body: DescribeGlobalTableCommandInput) {
+    const info = this.requireGlobalTable(body.GlobalTableName)
+    return { GlobalTableDescription: describeGlobalTable(info) }
+  }
+
+  handleListGlobalTables(body: ListGlobalTablesCommandInput) {
+    const {
+      ExclusiveStartGlobalTableName,
+      Limit = MAX_LIST_GLOBAL_TABLES_LIMIT,
+      RegionName,
+    } = body
+
+    if (Limit < 1 || Limit > MAX_LIST_GLOBAL_TABLES_LIMIT) {
+      throw {
+        name: 'ValidationException',
+        message:
+          `1 validation error detected: Value '${Limit}' at 'limit' failed to satisfy constraint: ` +
+          `Member must have value between 1 and ${MAX_LIST_GLOBAL_TABLES_LIMIT}`,
+      }
+    }
+
+    const tables = this.globalTables
+      .listGlobalTables()
+      .filter(
+        (info) =>
+          (!RegionName || info.regions.includes(RegionName)) &&
+          (!ExclusiveStartGlobalTableName ||
+            info.globalTableName > ExclusiveStartGlobalTableName)
+      )
+    const page = tables.slice(0, Limit)
+
+    return {
+      GlobalTables: page.map((info) => ({
+        GlobalTableName: info.globalTableName,
+        ReplicationGroup: info.regions.map((RegionName) => ({ RegionName })),
+      })),
+      ...(tables.length > Limit && {
+        LastEvaluatedGlobalTableName: page[page.length - 1]!.globalTableName,
+      }),
+    }
+  }
+
+  private requireGlobalTable(
+    globalTableName: string | undefined
+  ): GlobalTableInfo {
+    if (!globalTableName) {
+      throw {
+        name: 'ValidationException',
+        message: 'GlobalTableName is required',
+      }
+    }
+    const info = this.globalTables.getGlobalTable(globalTableName)
+    if (!info) {
+      throw {
+        name: 'GlobalTableNotFoundException',
+        message: `Global table not found: ${globalTableName}`,
+      }
+    }
+    return info
+  }
+
+  /**
+   * Checks a replication group as DynamoDB does: each region has the table,
+   * with the same key schema and a NEW_AND_OLD_IMAGES stream, and tables
+   * joining the group are empty. Regions outside REPLICA_REGIONS share the
+   * main tables, so at most one of them can be in a group.
+   */
+  private async assertReplicas(
+    tableName: string,
+    regions: string[],
+    added: string[]
+  ) {
+    const root = this.parent ?? this
+    const replicas = regions.map((region) => root.replicaFor(region))
+    if (regions.includes('') || new Set(replicas).size !== replicas.length) {
+      throw {
+        name: 'ValidationException',
+        message:
+          'Each region in a replication group must have its own tables; list all but one of them in REPLICA_REGIONS',
+      }
+    }
+
+    let keySchema: string | undefined
+    for (const [i, region] of regions.entries()) {
+      const replica = replicas[i]!
+      const table = await replica.metadataStore.describeTable(tableName)
+      if (!table) {
+        throw {
+          name: 'TableNotFoundException',
+          message: `Table not found: ${tableName} in region ${region}`,
+        }
+      }
+      const stream = table.streamSpecification
+      if (
+        !stream?.StreamEnabled ||
+        stream.StreamViewType !== 'NEW_AND_OLD_IMAGES'
+      ) {
+        throw {
+          name: 'ValidationException',
+          message: `Table ${tableName} in region ${region} must have a stream with StreamViewType NEW_AND_OLD_IMAGES`,
+        }
+      }
+      keySchema ??= JSON.stringify(table.keySchema)
+      if (JSON.stringify(table.keySchema) !== keySchema) {
+        throw {
+          name: 'ValidationException',
+          message: `Table ${tableName} in region ${region} has a different key schema`,
+        }
+      }
+      if (
+        added.includes(region) &&
+        (await replica.router.getTableItemCount(tableName)) > 0
+      ) {
+        throw {
+          name: 'ValidationException',
+          message: `Table ${tableName} in region ${region} must be empty to become a replica`,
+        }
+      }
+    }
+  }
+
+  async handleTagResource(body: TagResourceCommandInput) {
+    const { ResourceArn, Tags } = body
+
+    if (!Tags || Tags.length === 0) {
+      throw {
+        name: 'ValidationException',
+        message: 'ResourceArn and Tags are required',
+      }
+    }
+    assertTags(Tags)
+    const tableName = taggedTableName(ResourceArn)
+
+    await this.metadataStore.withTableLock(tableName, async () => {
+      const table = await this.requireTaggedTable(tableName, ResourceArn!)
+      const tags = { ...table.tags }
+      for (const { Key, Value } of Tags) {
+        tags[Key!] = Value!
+      }
+      if (Object.keys(tags).length > MAX_TAGS_PER_RESOURCE) {
+        throw {
+          name: 'LimitExceededException',
+          message: `A resource can have at most ${MAX_TAGS_PER_RESOURCE} tags`,
+        }
+      }
+      await this.metadataStore.setTags(tableName, tags)
+    })
+    return {}
+  }
+
+  async handleUntagResource(body: UntagResourceCommandInput) {
+    const { ResourceArn, TagKeys } = body
+
+    if (!TagKeys || TagKeys.length === 0) {
+      throw {
+        name: 'ValidationException',
+        message: 'ResourceArn and TagKeys are required',
+      }
+    }
+    const tableName = taggedTableName(ResourceArn)
+
+    await this.metadataStore.withTableLock(tableName, async () => {
+      const table = await this.requireTaggedTable(tableName, ResourceArn!)
+      const tags = { ...table.tags }
+      for (const key of TagKeys) {
+        delete tags[key]
+      }
+      await this.metadataStore.setTags(tableName, tags)
+    })
+    return {}
+  }
+
+  // A table has at most MAX_TAGS_PER_RESOURCE tags, so they fit on one page
+  // and NextToken is never returned
+  async handleListTagsOfResource(body: ListTagsOfResourceCommandInput) {
+    const { ResourceArn } = body
+    const tableName = taggedTableName(ResourceArn)
+    const table = await this.requireTaggedTable(tableName, ResourceArn!)
+
+    return {
+      Tags: Object.entries(table.tags ?? {}).map(([Key, Value]) => ({
+        Key,
+        Value,
+      })),
+    }
+  }
+
+  private async requireTaggedTable(
+    tableName: string,
+    resourceArn: string
+  ): Promise<TableSchema> {
+    const table = await this.metadataStore.describeTable(tableName)
+    if (!table) {
+      throw {
+        name: 'ResourceNotFoundException',
+        message: `Requested resource not found: ResourceArn: ${resourceArn} not found`,
+      }
+    }
+    return table
+  }
+
+  async handleDeleteTable(body: DeleteTableCommandInput) {
+    const { TableName } = body
+
+    if (!TableName) {
+      throw { name: 'ValidationException', message: 'TableName is required' }
+    }
+
+    // Items are purged under the same lock so a racing CreateTable never
+    // sees leftovers from the table being deleted
+    await this.metadataStore.withTableLock(TableName, async () => {
+      const table = await this.metadataStore.describeTable(TableName)
+      this.beginCommit()
+      await this.metadataStore.deleteTable(TableName)
+      // The stream stays readable until its records are consumed
+      if (table?.streamSpecification?.StreamEnabled) {
+        this.streams.disableStream(streamArn(table))
+      }
+      this.recovery.drop(TableName)
+      this.itemVersions.drop(TableName)
+      this.insights.drop(TableName)
+      this.staleReads?.drop(TableName)
+      // TODO: defer?
+      await this.router.deleteAllTableItems(TableName)
+    })
+    return { TableDescription: { TableName, TableStatus: 'DELETING' } }
+  }
+
+  async handleCreateBackup(body: CreateBackupCommandInput) {
+    const { TableName, BackupName } = body
+
+    if (!TableName || !BackupName) {
+      throw {
+        name: 'ValidationException',
+        message: 'TableName and BackupName are required',
+      }
+    }
+    if (!/^[a-zA-Z0-9_.-]{3,255}$/.test(BackupName)) {
+      throw {
+        name: 'ValidationException',
+        message:
+          "1 validation error detected: Value at 'backupName' failed to " +
+          'satisfy constraint: Member must satisfy regular expression pattern: [a-zA-Z0-9_.-]+ and have length between 3 and 255',
+      }
+    }
+
+    const schema = await this.requireBackupTable(TableName)
+
+    // Writes in flight, including transactions committing shard by shard,
+    // finish before the scan and later ones wait for it, so the backup is
+    // a point-in-time copy
+    const { items } = await this.writeGate.exclusive(TableName, () =>
+      this.router.scan(schema)
+    )
+    const createdAt = Date.now()
+    const backup: BackupInfo = {
+      backupArn: `${tableArn(TableName)}/backup/${newResourceId(createdAt)}`,
+      backupName: BackupName,
+      tableName: TableName,
+      schema,
+      itemCount: items.length,
+      sizeBytes: totalItemSize(items),
+      createdAt,
+    }
+    this.backups.createBackup(backup, items)
+
+    return { BackupDetails: describeBackupDetails(backup) }
+  }
+
+  handleDescribeBackup(body: DescribeBackupCommandInput) {
+    const backup = this.requireBackup(body.BackupArn)
+    return { BackupDescription: describeBackup(backup) }
+  }
+
+  // Backups are listed oldest first, and a page resumes after the backup
+  // whose ARN it was given
+  handleListBackups(body: ListBackupsCommandInput) {
+    const {
+      TableName,
+      Limit = MAX_LIST_BACKUPS_LIMIT,
+      ExclusiveStartBackupArn,
+      TimeRangeLowerBound,
+      TimeRangeUpperBound,
+      BackupType = 'USER',
+    } = body
+
+    if (Limit < 1 || Limit > MAX_LIST_BACKUPS_LIMIT) {
+      throw {
+        name: 'ValidationException',
+        message:
+          `1 validation error detected: Value '${Limit}' at 'limit' failed to satisfy constraint: ` +
+          `Member must have value between 1 and ${MAX_LIST_BACKUPS_LIMIT}`,
+      }
+    }
+
+    // Bounds arrive as epoch seconds; the lower bound is inclusive and the
+    // upper bound exclusive
+    const lower = TimeRangeLowerBound && Number(TimeRangeLowerBound) * 1000
+    const upper = TimeRangeUpperBound && Number(TimeRangeUpperBound) * 1000
+    // Every backup is an on-demand USER backup
+    let backups = ['USER', 'ALL'].includes(BackupType)
+      ? this.backups
+          .listBackups(TableName)
+          .filter(
+            ({ createdAt }) =>
+              (!lower || createdAt >= lower) && (!upper || createdAt < upper)
+          )
+      : []
+    if (ExclusiveStartBackupArn) {
+      const start = backups.findIndex(
+        (backup) => backup.backupArn === ExclusiveStartBackupArn
+      )
+      backups = backups.slice(start + 1)
+    }
+    const page = backups.slice(0, Limit)
+
+    return {
+      BackupSummaries: page.map((backup) => ({
+        TableName: backup.tableName,
+        TableArn: tableArn(backup.tableName),
+        ...describeBackupDetails(backup),
+      })),
+      ...(backups.length > Limit && {
+        LastEvaluatedBackupArn: page[page.length - 1]!.backupArn,
+      }),
+    }
+  }
+
+  handleDeleteBackup(body: DeleteBackupCommandInput) {
+    const backup = this.requireBackup(body.BackupArn)
+    this.backups.deleteBackup(backup.backupArn)
+    return { BackupDescription: describeBackup(backup, 'DELETED') }
+  }
+
+  async handleRestoreTableFromBackup(body: RestoreTableFromBackupCommandInput) {
+    const { TargetTableName, BackupArn, ...overrides } = body
+
+    if (!TargetTableName) {
+      throw {
+        name: 'ValidationException',
+        message: 'TargetTableName is required',
+      }
+    }
+    const backup = this.requireBackup(BackupArn)
+
+    const table = await this.restoreTable(
+      TargetTableName,
+      backup.schema,
+      this.backups.readItems(backup.backupArn),
+      overrides
+    )
+    return {
+      TableDescription: {
+        ...describeTableSchema(table),
+        RestoreSummary: {
+          SourceBackupArn: backup.backupArn,
+          SourceTableArn: tableArn(backup.tableName),
+          RestoreDateTime: Math.floor(Date.now() / 1000),
+          RestoreInProgress: false,
+        },
+      },
+    }
+  }
+
+  // Enables point-in-time recovery from a copy of the table's current items,
+  // or disables it and forgets the table's change log
+  async handleUpdateContinuousBackups(
+    body: UpdateContinuousBackupsCommandInput
+  ) {
+    const { TableName, PointInTimeRecoverySpecification } = body
+    const enabled = PointInTimeRecoverySpecification?.PointInTimeRecoveryEnabled
+
+    if (!TableName || enabled === undefined) {
+      throw {
+        name: 'ValidationException',
+        message:
+          'TableName and PointInTimeRecoverySpecification.PointInTimeRecoveryEnabled are required',
+      }
+    }
+
+    return await this.metadataStore.withTableLock(TableName, async () => {
+      const table = await this.requireBackupTable(TableName)
+      const wasEnabled = table.pointInTimeRecoveryEnabledAt !== undefined
+
+      if (enabled && !wasEnabled) {
+        // Writes are logged from here on, before the copy is read, so no
+        // write falls between the two
+        await this.metadataStore.setPointInTimeRecovery(TableName, Date.now())
+        const { items } = await this.router.scan(table)
+        this.recovery.start(
+          TableName,
+          items.map((item) => ({
+            key: getKeyString(extractKey(table, item)),
+            item,
+          }))
+        )
+      } else if (!enabled && wasEnabled) {
+        await this.metadataStore.setPointInTimeRecovery(TableName, undefined)
+        this.recovery.drop(TableName)
+      }
+
+      const updated = await this.metadataStore.describeTable(TableName)
+      return {
+        ContinuousBackupsDescription: describeContinuousBackups(
+          updated!,
+          this.config.pitrRetentionMs
+        ),
+      }
+    })
+  }
+
+  async handleDescribeContinuousBackups(
+    body: DescribeContinuousBackupsCommandInput
+  ) {
+    const { TableName } = body
+
+    if (!TableName) {
+      throw { name: 'ValidationException', message: 'TableName is required' }
+    }
+
+    const table = await this.requireBackupTable(TableName)
+    return {
+      ContinuousBackupsDescription: describeContinuousBackups(
+        table,
+        this.config.pitrRetentionMs
+      ),
+    }
+  }
+
+  // Restores the table as of RestoreDateTime, or as of now with
+  // UseLatestRestorableTime, into a new table
+  async handleRestoreTableToPointInTime(
+    body: RestoreTableToPointInTimeCommandInput
+  ) {
+    const {
+      SourceTableArn,
+      SourceTableName,
+      TargetTableName,
+      UseLatestRestorableTime,
+      RestoreDateTime,
+      ...overrides
+    } = body
+    const sourceName =
+      SourceTableName ?? (SourceTableArn && tableNameFromArn(SourceTableArn))
+
+    if (!sourceName || !TargetTableName) {
+      throw {
+        name: 'ValidationException',
+        message: 'SourceTableName and TargetTableName are required',
+      }
+    }
+    if (!UseLatestRestorableTime === (RestoreDateTime === undefined)) {
+      throw {
+        name: 'ValidationException',
+        message:
+          'Exactly one of UseLatestRestorableTime and RestoreDateTime must be specified',
+      }
+    }
+
+    const source = await this.requireBackupTable(sourceName)
+    const { earliest, latest } = this.requireRecoveryWindow(source)
+    // The JSON protocol encodes RestoreDateTime as epoch seconds
+    const restoreAt = UseLatestRestorableTime
+      ? latest
+      : Number(RestoreDateTime) * 1000
+    if (!(restoreAt >= earliest && restoreAt <= latest)) {
+      throw {
+        name: 'InvalidRestoreTimeException',
+        message: `RestoreDateTime must be between ${new Date(earliest).toISOString()} and ${new Date(latest).toISOString()}`,
+      }
+    }
+
+    const table = await this.restoreTable(
+      TargetTableName,
+      source,
+      this.recovery.itemsAt(sourceName, restoreAt),
+      overrides
+    )
+    return {
+      TableDescription: {
+        ...describeTableSchema(table),
+        RestoreSummary: {
+          SourceTableArn: tableArn(sourceName),
+          RestoreDateTime: restoreAt / 1000,
+          RestoreInProgress: false,
+        },
+      },
+    }
+  }
+
+  // Writes the table as of ExportTime, or now, in the layout AWS exports to
+  // S3 use. The files are written before the request returns, so exports
+  // are COMPLETED straight away.
+  async handleExportTableToPointInTime(
+    body: ExportTableToPointInTimeCommandInput
+  ) {
+    const {
+      TableArn,
+      ExportTime,
+      ClientToken,
+      S3Bucket,
+      S3Prefix,
+      ExportFormat = 'DYNAMODB_JSON',
+      ExportType = 'FULL_EXPORT',
+    } = body
+
+    if (!TableArn || !S3Bucket) {
+      throw {
+        name: 'ValidationException',
+        message: 'TableArn and S3Bucket are required',
+      }
+    }
+    if (ExportFormat !== 'DYNAMODB_JSON' || ExportType !== 'FULL_EXPORT') {
+      throw {
+        name: 'ValidationException',
+        message: 'Only FULL_EXPORT exports in DYNAMODB_JSON format are supported',
+      }
+    }
+
+    const tableName = tableNameFromArn(TableArn)
+    // Retrying with the same ClientToken returns the original export
+    const previous = ClientToken && this.exports.findByClientToken(ClientToken)
+    if (previous) {
+      if (
+        previous.tableArn !== tableArn(tableName) ||
+        previous.s3Bucket !== S3Bucket ||
+        previous.s3Prefix !== S3Prefix
+      ) {
+        throw {
+          name: 'ExportConflictException',
+          message: `ClientToken ${ClientToken} was already used by a different export`,
+        }
+      }
+      return { ExportDescription: describeExport(previous) }
+    }
+
+    const table = await this.requireBackupTable(tableName)
+    const { earliest, latest } = this.requireRecoveryWindow(table)
+    // The JSON protocol encodes ExportTime as epoch seconds
+    const exportTime =
+      ExportTime === undefined ? latest : Number(ExportTime) * 1000
+    if (!(exportTime >= earliest && exportTime <= latest)) {
+      throw {
+        name: 'InvalidExportTimeException',
+        message: `ExportTime must be between ${new Date(earliest).toISOString()} and ${new Date(latest).toISOString()}`,
+      }
+    }
+
+    const startTime = Date.now()
+    const exportId = newResourceId(startTime)
+    const items = this.recovery.itemsAt(tableName, exportTime)
+    const summary = {
+      exportArn: `${tableArn(tableName)}/export/${exportId}`,
+      tableArn: tableArn(tableName),
+      s3Bucket: S3Bucket,
+      s3Prefix: S3Prefix,
+      exportTime,
+      startTime,
+      endTime: Date.now(),
+      itemCount: items.length,
+      billedSizeBytes: totalItemSize(items),
+    }
+    let manifestKey: string
+    try {
+      manifestKey = await writeExport(
+        this.exportDestination(S3Bucket),
+        exportId,
+        items,
+        summary
+      )
+    } catch (error: unknown) {
+      throw {
+        name: 'InternalServerError',
+        message: `Failed to write export to ${S3Bucket}: ${error}`,
+      }
+    }
+
+    const info: ExportInfo = {
+      ...summary,
+      clientToken: ClientToken,
+      manifestKey,
+    }
+    this.exports.createExport(info)
+    return { ExportDescription: describeExport(info) }
+  }
+
+  handleDescribeExport(body: DescribeExportCommandInput) {
+    const { ExportArn } = body
+
+    if (!ExportArn) {
+      throw { name: 'ValidationException', message: 'ExportArn is required' }
+    }
+    const info = this.exports.getExport(ExportArn)
+    if (!info) {
+      throw {
+        name: 'ExportNotFoundException',
+        message: `Export not found: ${ExportArn}`,
+      }
+    }
+    return { ExportDescription: describeExport(info) }
+  }
+
+  // NextToken is the ARN of the last export on the previous page
+  handleListExports(body: ListExportsCommandInput) {
+    const { TableArn, MaxResults = MAX_LIST_EXPORTS_RESULTS, NextToken } = body
+
+    if (MaxResults < 1 || MaxResults > MAX_LIST_EXPORTS_RESULTS) {
+      throw {
+        name: 'ValidationException',
+        message:
+          `1 validation error detected: Value '${MaxResults}' at 'maxResults' failed to satisfy constraint: ` +
+          `Member must have value between 1 and ${MAX_LIST_EXPORTS_RESULTS}`,
+      }
+    }
+
+    let exports = this.exports.listExports(
+      TableArn && tableArn(tableNameFromArn(TableArn))
+    )
+    if (NextToken) {
+      const start = exports.findIndex((info) => info.exportArn === NextToken)
+      exports = exports.slice(start + 1)
+    }
+    const page = exports.slice(0, MaxResults)
+
+    return {
+      ExportSummaries: page.map((info) => ({
+        ExportArn: info.exportArn,
+        ExportStatus: 'COMPLETED',
+        ExportType: 'FULL_EXPORT',
+      })),
+      ...(exports.length > MaxResults && {
+        NextToken: page[page.length - 1]!.exportArn,
+      }),
+    }
+  }
+
+  // Creates a table from the objects under S3KeyPrefix. The objects are read
+  // before the request returns, so an import is COMPLETED or FAILED straight
+  // away, and a failed import creates no table.
+  async handleImportTable(body: ImportTableCommandInput) {
+    const { ClientToken, ...request } = body
+    const {
+      S3BucketSource,
+      InputFormat,
+      InputFormatOptions,
+      InputCompressionType = 'NONE',
+      TableCreationParameters,
+    } = request
+
+    if (!S3BucketSource?.S3Bucket || !InputFormat || !TableCreationParameters) {
+      throw {
+        name: 'ValidationException',
+        message:
+          'S3BucketSource, InputFormat and TableCreationParameters are required',
+      }
+    }
+    if (!['DYNAMODB_JSON', 'ION', 'CSV'].includes(InputFormat)) {
+      throw {
+        name: 'ValidationException',
+        message: `Unsupported InputFormat: ${InputFormat}`,
+      }
+    }
+    if (!['GZIP', 'ZSTD', 'NONE'].includes(InputCompressionType)) {
+      throw {
+        name: 'ValidationException',
+        message: `Unsupported InputCompressionType: ${InputCompressionType}`,
+      }
+    }
+    const csv = InputFormatOptions?.Csv
+    if (csv?.Delimiter !== undefined && csv.Delimiter.length !== 1) {
+      throw {
+        name: 'ValidationException',
+        message: 'The CSV Delimiter must be a single character',
+      }
+    }
+
+    // Retrying with the same ClientToken returns the original import
+    const previous = ClientToken && this.imports.findByClientToken(ClientToken)
+    if (previous) {
+      if (JSON.stringify(previous.request) !== JSON.stringify(request)) {
+        throw {
+          name: 'ImportConflictException',
+          message: `ClientToken ${ClientToken} was already used by a different import`,
+        }
+      }
+      return { ImportTableDescription: describeImport(previous) }
+    }
+
+    // Makes every check CreateTable would, so a bad table fails the request
+    // rather than the import
+    await this.handleCreateTable(TableCreationParameters, { dryRun: true })
+    const schema: TableSchema = {
+      tableName: TableCreationParameters.TableName!,
+      keySchema: TableCreationParameters.KeySchema!,
+      attributeDefinitions: TableCreationParameters.AttributeDefinitions!,
+      globalSecondaryIndexes:
+        TableCreationParameters.GlobalSecondaryIndexes?.map(toIndexSchema),
+      sseSpecification: TableCreationParameters.SSESpecification,
+      billingMode: TableCreationParameters.BillingMode ?? 'PROVISIONED',
+    }
+
+    const startTime = Date.now()
+    const info: ImportInfo = {
+      importArn: `${tableArn(schema.tableName)}/import/${newResourceId(startTime)}`,
+      tableArn: tableArn(schema.tableName),
+      clientToken: ClientToken,
+      request,
+      status: 'COMPLETED',
+      startTime,
+      endTime: startTime,
+      processedSizeBytes: 0,
+      processedItemCount: 0,
+      importedItemCount: 0,
+      errorCount: 0,
+    }
+    let imported: ImportedItems | undefined
+    try {
+      imported = await readImport(
+        this.importSource(S3BucketSource.S3Bucket),
+        S3BucketSource.S3KeyPrefix ?? '',
+        {
+          format: InputFormat,
+          compression: InputCompressionType,
+          delimiter: csv?.Delimiter,
+          headerList: csv?.HeaderList,
+          attributeTypes: Object.fromEntries(
+            schema.attributeDefinitions.map((def) => [
+              def.AttributeName,
+              def.AttributeType,
+            ])
+          ),
+        }
+      )
+    } catch (error: unknown) {
+      info.status = 'FAILED'
+      info.failureCode = 'ImportSourceError'
+      info.failureMessage =
+        error instanceof Error ? error.message : String(error)
+    }
+    if (imported) {
+      const items = imported.items.filter((item) =>
+        isImportableItem(schema, item)
+      )
+      await this.restoreTable(schema.tableName, schema, items, {})
+      info.processedSizeBytes = imported.processedSizeBytes
+      info.processedItemCount = imported.items.length + imported.errorCount
+      info.importedItemCount = items.length
+      info.errorCount = info.processedItemCount - items.length
+    }
+    info.endTime = Date.now()
+
+    this.imports.createImport(info)
+    return { ImportTableDescription: describeImport(info) }
+  }
+
+  handleDescribeImport(body: DescribeImportCommandInput) {
+    const { ImportArn } = body
+
+    if (!ImportArn) {
+      throw { name: 'ValidationException', message: 'ImportArn is required' }
+    }
+    const info = this.imports.getImport(ImportArn)
+    if (!info) {
+      throw {
+        name: 'ImportNotFoundException',
+        message: `Import not found: ${ImportArn}`,
+      }
+    }
+    return { ImportTableDescription: describeImport(info) }
+  }
+
+  // NextToken is the ARN of the last import on the previous page
+  handleListImports(body: ListImportsCommandInput) {
+    const { TableArn, PageSize = MAX_LIST_IMPORTS_PAGE_SIZE, NextToken } = body
+
+    if (PageSize < 1 || PageSize > MAX_LIST_IMPORTS_PAGE_SIZE) {
+      throw {
+        name: 'ValidationException',
+        message:
+          `1 validation error detected: Value '${PageSize}' at 'pageSize' failed to satisfy constraint: ` +
+          `Member must have value between 1 and ${MAX_LIST_IMPORTS_PAGE_SIZE}`,
+      }
+    }
+
+    let imports = this.imports.listImports(
+      TableArn && tableArn(tableNameFromArn(TableArn))
+    )
+    if (NextToken) {
+      const start = imports.findIndex((info) => info.importArn === NextToken)
+      imports = imports.slice(start + 1)
+    }
+    const page = imports.slice(0, PageSize)
+
+    return {
+      ImportSummaryList: page.map((info) => ({
+        ImportArn: info.importArn,
+        ImportStatus: info.status,
+        TableArn: info.tableArn,
+        S3BucketSource: info.request.S3BucketSource,
+        InputFormat: info.request.InputFormat,
+        StartTime: info.startTime / 1000,
+        EndTime: info.endTime / 1000,
+      })),
+      ...(imports.length > PageSize && {
+        NextToken: page[page.length - 1]!.importArn,
+      }),
+    }
+  }
+
+  private importSource(bucket: string): ImportSource {
+    const { exportS3Endpoint, exportDir, dataDir } = this.config
+    return exportS3Endpoint
+      ? s3Source(exportS3Endpoint, bucket)
+      : localSource(exportDir ?? `${dataDir}/exports`, bucket)
+  }
+
+  private exportDestination(bucket: string): ExportDestination {
+    const { exportS3Endpoint, exportDir, dataDir } = this.config
+    return exportS3Endpoint
+      ? s3Destination(exportS3Endpoint, bucket)
+      : localDestination(exportDir ?? `${dataDir}/exports`, bucket)
+  }
+
+  private requireRecoveryWindow(table: TableSchema) {
+    const window = recoveryWindow(table, this.config.pitrRetentionMs)
+    if (!window) {
+      throw {
+        name: 'PointInTimeRecoveryUnavailableException',
+        message: `Point in time recovery is not enabled for table '${table.tableName}'`,
+      }
+    }
+    return window
+  }
+
+  // Backup and recovery operations report a missing table as
+  // TableNotFoundException rather than ResourceNotFoundException
+  private async requireBackupTable(tableName: string): Promise<TableSchema> {
+    const table = await this.metadataStore.describeTable(tableName)
+    if (!table) {
+      throw {
+        name: 'TableNotFoundException',
+        message: `Table not found: ${tableName}`,
+      }
+    }
+    return table
+  }
+
+  /**
+   * Creates targetTableName with the source's key schema, indexes, billing
+   * mode and encryption, unless the request overrides them, and writes the
+   * items into it. Like DynamoDB, the new table does not keep the source's
+   * stream or TTL settings.
+   */
+  private async restoreTable(
+    targetTableName: string,
+    source: TableSchema,
+    items: DynamoDBItem[],
+    overrides: RestoreOverrides
+  ): Promise<TableSchema> {
+    const {
+      BillingModeOverride,
+      GlobalSecondaryIndexOverride,
+      LocalSecondaryIndexOverride,
+      SSESpecificationOverride,
+    } = overrides
+
+    for (const index of [
+      ...(GlobalSecondaryIndexOverride ?? []),
+      ...(LocalSecondaryIndexOverride ?? []),
+    ]) {
+      assertKeySchema(index.KeySchema ?? [])
+    }
+    assertLocalIndexKeys(source.keySchema, LocalSecondaryIndexOverride ?? [])
+
+    const schema: TableSchema = {
+      tableName: targetTableName,
+      keySchema: source.keySchema,
+      attributeDefinitions: source.attributeDefinitions,
+      globalSecondaryIndexes:
+        GlobalSecondaryIndexOverride?.map(toIndexSchema) ??
+        source.globalSecondaryIndexes?.map((index) => ({
+          indexName: index.indexName,
+          keySchema: index.keySchema,
+          projection: index.projection,
+        })),
+      localSecondaryIndexes:
+        LocalSecondaryIndexOverride?.map(toIndexSchema) ??
+        source.localSecondaryIndexes,
+      sseSpecification: SSESpecificationOverride ?? source.sseSpecification,
+      billingMode: BillingModeOverride ?? source.billingMode,
+    }
+    assertKeyAttributesDefined(schema)
+
+    await this.metadataStore.withTableLock(targetTableName, async () => {
+      if (await this.metadataStore.describeTable(targetTableName)) {
+        throw {
+          name: 'TableAlreadyExistsException',
+          message: `Table already exists: ${targetTableName}`,
+        }
+      }
+      this.beginCommit()
+      await this.metadataStore.createTable(schema)
+      await this.router.batchWrite(targetTableName, items, [])
+    })
+
+    return (await this.metadataStore.describeTable(targetTableName))!
+  }
+
+  private requireBackup(backupArn: string | undefined): BackupInfo {
+    if (!backupArn) {
+      throw { name: 'ValidationException', message: 'BackupArn is required' }
+    }
+    const backup = this.backups.getBackup(backupArn)
+    if (!backup) {
+      throw {
+        name: 'BackupNotFoundException',
+        message: `Backup not found: ${backupArn}`,
+      }
+    }
+    return backup
+  }
+
+  async handleBatchGetItem(body: BatchGetItemCommandInput) {
+    const { RequestItems, ReturnConsumedCapacity } = body
+
+    if (!RequestItems || Object.keys(RequestItems).length === 0) {
+      throw {
+        name: 'ValidationException',
+        message:
+          "1 validation error detected: Value at 'requestItems' failed to " +
+          'satisfy constraint: Member must have length greater than or equal to 1',
+      }
+    }
+
+    for (const [tableName, request] of Object.entries(RequestItems)) {
+      if (!request.Keys || request.Keys.length === 0) {
+        throw {
+          name: 'ValidationException',
+          message:
+            `1 validation error detected: Value at 'requestItems.${tableName}.member.keys' ` +
+            'failed to satisfy constraint: Member must have length greater than or equal to 1',
+        }
+      }
+      assertSingleProjectionForm(request)
+      // Each table's projection carries its own aliases
+      validateExpressionAttributeNames(request.ExpressionAttributeNames)
+      validateReservedWords(request as Record<string, unknown>)
+    }
+
+    for (const [tableName, request] of Object.entries(RequestItems)) {
+      const schema = await this.requireBatchTable(tableName)
+      assertNoDuplicateKeys(schema, request.Keys!)
+    }
+
+    // Responses mirror the request's table keys, with an entry per table
+    // even when none of its keys were found
+    const responses: Record<string, DynamoDBItem[]> = {}
+    const capacity = new CapacityTally()
+
+    for (const [tableName, request] of Object.entries(RequestItems)) {
+      const keys = request.Keys ?? []
+      const { ProjectionExpression, ExpressionAttributeNames } = request
+      await this.recordAccess(tableName, keys)
+      let items = await this.router.batchGet(tableName, keys)
+      if (this.staleReads && !request.ConsistentRead) {
+        items = await this.rewindBatch(tableName, keys, items)
+      }
+      // Each item is charged on its own, and a missing one costs the
+      // smallest read
+      const units = (bytes: number) =>
+        readCapacityUnits(bytes, request.ConsistentRead)
+      capacity.add(await this.requireBatchTable(tableName), {
+        table:
+          items.reduce((sum, item) => sum + units(itemSize(item)), 0) +
+          (keys.length - items.length) * units(0),
+        indexes: {},
+      })
+      responses[tableName] = ProjectionExpression
+        ? items.map((item) =>
+            applyProjection(
+              item,
+              ProjectionExpression,
+              ExpressionAttributeNames
+            )
+          )
+        : items
+    }
+
+    const consumed = capacity.report(ReturnConsumedCapacity)
+    return {
+      Responses: responses,
+      UnprocessedKeys: {},
+      ...(consumed && { ConsumedCapacity: consumed }),
+    }
+  }
+
+  async handleBatchWriteItem(body: BatchWriteItemCommandInput) {
+    const {
+      RequestItems,
+      ReturnConsumedCapacity,
+      ReturnItemCollectionMetrics,
+    } = body
+
+    if (!RequestItems || Object.keys(RequestItems).length === 0) {
+      throw {
+        name: 'ValidationException',
+        message:
+          "1 validation error detected: Value at 'requestItems' failed to " +
+          'satisfy constraint: Member must have length greater than or equal to 1',
+      }
+    }
+
+    for (const [tableName, requests] of Object.entries(RequestItems)) {
+      if (requests.length === 0) {
+        throw {
+          name: 'ValidationException',
+          message:
+            `1 validation error detected: Value at 'requestItems.${tableName}' ` +
+            'failed to satisfy constraint: Member must have length greater than or equal to 1',
+        }
+      }
+    }
+
+    // The limit applies to the whole request, not to each table
+    const totalRequests = Object.values(RequestItems).reduce(
+      (total, requests) => total + requests.length,
+      0
+    )
+    if (totalRequests > MAX_ITEMS_PER_BATCH_WRITE) {
+      throw {
+        name: 'ValidationException',
+        message: 'Too many items requested for the BatchWriteItem call',
+      }
+    }
+
+    // Validate every table before writing anything
+    const writes: Array<{
+      tableName: string
+      puts: DynamoDBItem[]
+      deletes: DynamoDBItem[]
+    }> = []
+
+    for (const [tableName, requests] of Object.entries(RequestItems)) {
+      const schema = await this.requireBatchTable(tableName)
+      const puts: DynamoDBItem[] = []
+      const deletes: DynamoDBItem[] = []
+
+      for (const request of requests as WriteRequest[]) {
+        if (request.PutRequest?.Item) {
+          assertItemKeys(schema, request.PutRequest.Item)
+          assertNestingDepth(request.PutRequest.Item)
+          assertValidSets(request.PutRequest.Item)
+          assertItemSize(
+            request.PutRequest.Item,
+            'Item size has exceeded the maximum allowed size'
+          )
+          puts.push(request.PutRequest.Item)
+        } else if (request.DeleteRequest?.Key) {
+          assertKeyMatchesSchema(schema, request.DeleteRequest.Key)
+          deletes.push(request.DeleteRequest.Key)
+        }
+      }
+      assertNoDuplicateKeys(schema, [...puts, ...deletes])
+      writes.push({ tableName, puts, deletes })
+    }
+
+    const capacity = new CapacityTally()
+    const withCapacity =
+      ReturnConsumedCapacity === 'TOTAL' || ReturnConsumedCapacity === 'INDEXES'
+
+    for (const { tableName, puts, deletes } of writes) {
+      await this.recordAccess(tableName, [...puts, ...deletes])
+      const schema = (await this.metadataStore.describeTable(tableName))!
+      this.beginCommit()
+      if (
+        schema.streamSpecification?.StreamEnabled ||
+        schema.pointInTimeRecoveryEnabledAt !== undefined ||
+        schema.kinesisDestinations?.some((d) => d.status === 'ACTIVE') ||
+        this.staleReads ||
+        withCapacity
+      ) {
+        const changes = await this.batchWriteRecorded(tableName, puts, deletes)
+        for (const { oldItem, newItem } of changes) {
+          capacity.add(schema, writeUsage(schema, oldItem, newItem))
+        }
+      } else {
+        await this.writeGate.write([tableName], () =>
+          this.router.batchWrite(tableName, puts, deletes)
+        )
+      }
+    }
+
+    const consumed = capacity.report(ReturnConsumedCapacity)
+    const metrics =
+      ReturnItemCollectionMetrics === 'SIZE'
+        ? await this.itemCollectionMetricsByTable(
+            writes.flatMap(({ tableName, puts, deletes }) =>
+              [...puts, ...deletes].map((itemOrKey) => ({
+                tableName,
+                itemOrKey,
+              }))
+            )
+          )
+        : undefined
+    return {
+      UnprocessedItems: {},
+      ...(consumed && { ConsumedCapacity: consumed }),
+      ...(metrics && { ItemCollectionMetrics: metrics }),
+    }
+  }
+
+  // Stream records, stale reads and consumed capacity need each item's old
+  // image, and recovery logs must be in write order, so writes to a table
+  // with any of them are applied one at a time under the item's lock
+  private async batchWriteRecorded(
+    tableName: string,
+    puts: DynamoDBItem[],
+    deletes: DynamoDBItem[]
+  ): Promise<ItemChange[]> {
+    const changes: ItemChange[] = []
+    for (const item of puts) {
+      await this.withItemLock(tableName, item, async () => {
+        const oldItem = await this.router.getItem(tableName, item)
+        await this.router.putItem(tableName, item)
+        const change = { tableName, oldItem, newItem: item }
+        await this.recordChanges([change])
+        changes.push(change)
+      })
+    }
+    for (const key of deletes) {
+      await this.withItemLock(tableName, key, async () => {
+        const oldItem = await this.router.deleteItem(tableName, key)
+        const change = { tableName, oldItem, newItem: null }
+        await this.recordChanges([change])
+        changes.push(change)
+      })
+    }
+    return changes
+  }
+
+  // The items of a batch read as they were STALE_READ_MS ago, in the
+  // order of their keys
+  private async rewindBatch(
+    tableName: string,
+    keys: DynamoDBItem[],
+    items: DynamoDBItem[]
+  ): Promise<DynamoDBItem[]> {
+    const schema = await this.requireBatchTable(tableName)
+    const found = new Map(
+      items.map((item) => [getKeyString(extractKey(schema, item)), item])
+    )
+    return keys.flatMap((key) => {
+      const keyString = getKeyString(extractKey(schema, key))
+      const item = this.staleReads!.item(
+        tableName,
+        keyString,
+        found.get(keyString) ?? null
+      )
+      return item ? [item] : []
+    })
+  }
+
+  private async requireBatchTable(tableName: string): Promise<TableSchema> {
+    const schema = await this.metadataStore.describeTable(tableName)
+    if (!schema) {
+      throw {
+        name: 'ResourceNotFoundException',
+        message: 'Requested resource not found',
+      }
+    }
+    return schema
+  }
+
+  async handleTransactWriteItems(body: TransactWriteItemsCommandInput) {
+    const {
+      TransactItems,
+      ClientRequestToken,
+      ReturnConsumedCapacity,
+      ReturnItemCollectionMetrics,
+    } = body
+
+    if (!TransactItems || TransactItems.length === 0) {
+      throw {
+        name: 'ValidationException',
+        message:
+          "1 validation error detected: Value at 'transactItems' failed to " +
+          'satisfy constraint: Member must have length greater than or equal to 1',
+      }
+    }
+
+    if (TransactItems.length > MAX_ITEMS_PER_TRANSACTION) {
+      throw {
+        name: 'ValidationException',
+        message: 'Transaction cannot contain more than 100 items',
+      }
+    }
+    for (const item of TransactItems) {
+      const operation =
+        item.Put ?? item.Update ?? item.Delete ?? item.ConditionCheck
+      assertValidSetValues(operation?.ExpressionAttributeValues)
+      if (item.Update?.UpdateExpression) {
+        const schema = await this.metadataStore.describeTable(
+          item.Update.TableName!
+        )
+        if (schema) {
+          assertKeyNotUpdated(
+            schema,
+            item.Update.UpdateExpression,
+            item.Update.ExpressionAttributeNames,
+            item.Update.ExpressionAttributeValues
+          )
+        }
+      }
+      if (!item.Put?.Item) continue
+      const schema = await this.metadataStore.describeTable(
+        item.Put.TableName!
+      )
+      if (schema) assertItemKeys(schema, item.Put.Item)
+      assertNestingDepth(item.Put.Item)
+      assertValidSets(item.Put.Item)
+      assertItemSize(
+        item.Put.Item,
+        'Item size has exceeded the maximum allowed size'
+      )
+    }
+
+    for (const item of TransactItems) {
+      const operation =
+        item.Put ?? item.Update ?? item.Delete ?? item.ConditionCheck
+      const key = item.Put?.Item ?? operation?.Key
+      if (operation?.TableName && key) {
+        await this.recordAccess(operation.TableName, [key])
+      }
+    }
+
+    const tableNames = TransactItems.flatMap(
+      ({ Put, Update, Delete, ConditionCheck }) =>
+        (Put ?? Update ?? Delete ?? ConditionCheck)?.TableName ?? []
+    )
+    this.beginCommit()
+    try {
+      const changes = await this.writeGate.write(tableNames, () =>
+        this.router.transactWrite(TransactItems, ClientRequestToken)
+      )
+      await this.recordChanges(changes)
+
+      const capacity = new CapacityTally()
+      for (const { tableName, oldItem, newItem } of changes) {
+        const schema = (await this.metadataStore.describeTable(tableName))!
+        capacity.add(
+          schema,
+          transactionUsage(writeUsage(schema, oldItem, newItem))
+        )
+      }
+      // A ConditionCheck writes nothing, and is charged the smallest write
+      for (const { ConditionCheck } of TransactItems) {
+        if (!ConditionCheck?.TableName) continue
+        const schema = await this.metadataStore.describeTable(
+          ConditionCheck.TableName
+        )
+        capacity.add(
+          schema!,
+          transactionUsage({ table: writeCapacityUnits(0), indexes: {} })
+        )
+      }
+      const consumed = capacity.report(ReturnConsumedCapacity)
+      const metrics =
+        ReturnItemCollectionMetrics === 'SIZE'
+          ? await this.itemCollectionMetricsByTable(
+              TransactItems.flatMap(({ Put, Update, Delete }) => {
+                const tableName = (Put ?? Update ?? Delete)?.TableName
+                const itemOrKey = Put?.Item ?? Update?.Key ?? Delete?.Key
+                return tableName && itemOrKey ? [{ tableName, itemOrKey }] : []
+              })
+            )
+          : undefined
+      return {
+        ...(consumed && { ConsumedCapacity: consumed }),
+        ...(metrics && { ItemCollectionMetrics: metrics }),
+      }
+    } catch (error: unknown) {
+      if (error instanceof TransactionCanceledException) {
+        throw {
+          name: 'TransactionCanceledException',
+          message: error.message,
+          CancellationReasons: error.CancellationReasons,
+        }
+      }
+      throw error
+    }
+  }
+
+  async handleTransactGetItems(body: TransactGetItemsCommandInput) {
+    const { TransactItems, ReturnConsumedCapacity } = body
+
+    if (!TransactItems || TransactItems.length === 0) {
+      throw {
+        name: 'ValidationException',
+        message:
+          "1 validation error detected: Value at 'transactItems' failed to " +
+          'satisfy constraint: Member must have length greater than or equal to 1',
+      }
+    }
+
+    if (TransactItems.length > MAX_ITEMS_PER_TRANSACTION) {
+      throw {
+        name: 'ValidationException',
+        message: `Transaction cannot contain more than ${MAX_ITEMS_PER_TRANSACTION} items`,
+      }
+    }
+
+    for (const { Get } of TransactItems) {
+      if (Get) assertSingleProjectionForm(Get)
+    }
+    for (const { Get } of TransactItems) {
+      if (Get?.TableName && Get.Key) {
+        await this.recordAccess(Get.TableName, [Get.Key])
+      }
+    }
+    const results = await this.router.transactGet(TransactItems)
+
+    const capacity = new CapacityTally()
+    for (const [i, { Get }] of TransactItems.entries()) {
+      if (!Get?.TableName) continue
+      const schema = await this.metadataStore.describeTable(Get.TableName)
+      const item = results[i]
+      capacity.add(schema!, {
+        table: transactionReadUnits(item ? itemSize(item) : 0),
+        indexes: {},
+      })
+    }
+    const consumed = capacity.report(ReturnConsumedCapacity)
+    return {
+      Responses: results.map((item) => ({ Item: item })),
+      ...(consumed && { ConsumedCapacity: consumed }),
+    }
+  }
+
+  async handleExecuteStatement(body: ExecuteStatementCommandInput) {
+    if (!body.Statement) {
+      throw { name: 'ValidationException', message: 'Statement is required' }
+    }
+    const statement = parseStatement(body.Statement, body.Parameters)
+    return await this.executeStatement(statement, body)
+  }
+
+  // Runs each statement on its own and reports failures per statement, so
+  // one failed statement does not fail the batch
+  async handleBatchExecuteStatement(body: BatchExecuteStatementCommandInput) {
+    const { Statements } = body
+
+    if (!Statements || Statements.length === 0) {
+      throw {
+        name: 'ValidationException',
+        message:
+          "1 validation error detected: Value at 'statements' failed to " +
+          'satisfy constraint: Member must have length greater than or equal to 1',
+      }
+    }
+    if (Statements.length > MAX_STATEMENTS_PER_BATCH) {
+      throw {
+        name: 'ValidationException',
+        message:
+          "1 validation error detected: Value at 'statements' failed to " +
+          `satisfy constraint: Member must have length less than or equal to ${MAX_STATEMENTS_PER_BATCH}`,
+      }
+    }
+
+    // A statement that does not parse fails alone, as a ValidationError
+    const parsed = Statements.map((request) => {
+      try {
+        const { Statement = '', Parameters } = request
+        return { statement: parseStatement(Statement, Parameters) }
+      } catch (error: unknown) {
+        return { error }
+      }
+    })
+    const kinds = new Set(
+      parsed.map(({ statement }) =>
+        statement?.kind === 'select' ? 'read' : statement && 'write'
+      )
+    )
+    if (kinds.has('read') && kinds.has('write')) {
+      throw {
+        name: 'ValidationException',
+        message:
+          'Unsupported operation: Mixing read and write operations is not supported in BatchExecuteStatement',
+      }
+    }
+
+    const responses = []
+    for (const [i, request] of Statements.entries()) {
+      const { statement, error } = parsed[i]!
+      try {
+        if (!statement) throw error
+        // Batched reads are single-item reads, so they return Item
+        const { Items } = await this.executeStatement(statement, request, {
+          singleItem: true,
+        })
+        responses.push({
+          TableName: statement.tableName,
+          ...(statement.kind === 'select' && Items?.[0] && { Item: Items[0] }),
+        })
+      } catch (error: unknown) {
+        const { __type, message } = serializeError(error)
+        responses.push({
+          ...(statement && { TableName: statement.tableName }),
+          Error: {
+            Code: BATCH_STATEMENT_ERROR_CODES[__type] ?? 'InternalServerError',
+            Message: message,
+          },
+        })
+      }
+    }
+
+    return { Responses: responses }
+  }
+
+  // Runs the statements as one TransactGetItems or TransactWriteItems call,
+  // so they share its atomicity and cancellation reasons
+  async handleExecuteTransaction(body: ExecuteTransactionCommandInput) {
+    const { TransactStatements, ClientRequestToken } = body
+
+    if (!TransactStatements || TransactStatements.length === 0) {
+      throw {
+        name: 'ValidationException',
+        message:
+          "1 validation error detected: Value at 'transactStatements' failed to " +
+          'satisfy constraint: Member must have length greater than or equal to 1',
+      }
+    }
+    if (TransactStatements.length > MAX_ITEMS_PER_TRANSACTION) {
+      throw {
+        name: 'ValidationException',
+        message: `Transaction cannot contain more than ${MAX_ITEMS_PER_TRANSACTION} items`,
+      }
+    }
+
+    const statements: Statement[] = []
+    const items: Array<TransactGetItem | TransactWriteItem> = []
+    for (const { Statement = '', Parameters } of TransactStatements) {
+      const statement = parseStatement(Statement, Parameters)
+      const schema = await this.metadataStore.describeTable(
+        statement.tableName
+      )
+      if (!schema) {
+        throw {
+          name: 'ResourceNotFoundException',
+          message: 'Requested resource not found',
+        }
+      }
+      statements.push(statement)
+      items.push(compileTransactItem(statement, schema))
+    }
+
+    const reads = items.filter((item): item is TransactGetItem => 'Get' in item)
+    if (reads.length === items.length) {
+      return await this.handleTransactGetItems({ TransactItems: reads })
+    }
+    if (reads.length > 0) {
+      throw {
+        name: 'ValidationException',
+        message:
+          'Unsupported operation: Mixing read and write operations is not supported in ExecuteTransaction',
+      }
+    }
+
+    try {
+      return await this.handleTransactWriteItems({
+        TransactItems: items as TransactWriteItem[],
+        ClientRequestToken,
+      })
+    } catch (error: unknown) {
+      const { CancellationReasons: reasons } = error as {
+        CancellationReasons?: CancellationReason[]
+      }
+      if (!reasons) throw error
+      // An INSERT fails its condition only when the key is already taken
+      throw {
+        ...(error as object),
+        CancellationReasons: reasons.map((reason, i) =>
+          statements[i]?.kind === 'insert' &&
+          reason.Code === 'ConditionalCheckFailed'
+            ? {
+                Code: 'DuplicateItem',
+                Message: 'Duplicate primary key exists in table',
+              }
+            : reason
+        ),
+      }
+    }
+  }
+
+  /**
+   * Runs a parsed PartiQL statement as the item operation it compiles to.
+   * A SELECT pages like that Query or Scan, with its LastEvaluatedKey in
+   * NextToken; with `singleItem`, it must name a whole primary key.
+   */
+  private async executeStatement(
+    statement: Statement,
+    request: ExecuteStatementCommandInput,
+    options: { singleItem?: boolean } = {}
+  ): Promise<{ Items?: DynamoDBItem[]; NextToken?: string }> {
+    const {
+      Statement: source = '',
+      Parameters = [],
+      NextToken,
+      Limit,
+      ConsistentRead,
+    } = request
+
+    const schema = await this.metadataStore.describeTable(statement.tableName)
+    if (!schema) {
+      throw {
+        name: 'ResourceNotFoundException',
+        message: 'Requested resource not found',
+      }
+    }
+    if (
+      options.singleItem &&
+      statement.kind === 'select' &&
+      !selectsOneItem(statement, schema)
+    ) {
+      throw {
+        name: 'ValidationException',
+        message:
+          'Select statements within BatchExecuteStatement must specify the equality condition on all key attributes',
+      }
+    }
+    const compiled = compileStatement(statement, schema)
+
+    switch (compiled.operation) {
+      case 'Query':
+      case 'Scan': {
+        const input = {
+          ...compiled.input,
+          Limit,
+          ConsistentRead,
+          ...(NextToken && {
+            ExclusiveStartKey: decodeNextToken(NextToken, source, Parameters),
+          }),
+        }
+        const { Items, LastEvaluatedKey } =
+          compiled.operation === 'Query'
+            ? await this.handleQuery(input)
+            : await this.handleScan(input)
+        return {
+          Items,
+          ...(LastEvaluatedKey && {
+            NextToken: encodeNextToken(source, Parameters, LastEvaluatedKey),
+          }),
+        }
+      }
+      case 'PutItem':
+        try {
+          await this.handlePutItem(compiled.input)
+        } catch (error: unknown) {
+          const { __type } = serializeError(error)
+          if (__type === 'ConditionalCheckFailedException') {
+            throw {
+              name: 'DuplicateItemException',
+              message: 'Duplicate primary key exists in table',
+            }
+          }
+          throw error
+        }
+        return {}
+      case 'UpdateItem':
+      case 'DeleteItem': {
+        const { Attributes } =
+          compiled.operation === 'UpdateItem'
+            ? await this.handleUpdateItem(compiled.input)
+            : await this.handleDeleteItem(compiled.input)
+        // RETURNING yields the item as the statement's only result
+        return compiled.input.ReturnValues && Attributes
+          ? { Items: [Attributes] }
+          : {}
+      }
+    }
+  }
+
+  // Opens the stream a table's StreamSpecification asks for, if any
+  private createStream(schema: TableSchema) {
+    const specification = schema.streamSpecification
+    if (!specification?.StreamEnabled) return
+    this.streams.createStream({
+      streamArn: streamArn(schema),
+      tableName: schema.tableName,
+      streamLabel: schema.latestStreamLabel!,
+      viewType: specification.StreamViewType!,
+      keySchema: schema.keySchema,
+      createdAt: Date.now(),
+    })
+  }
+
+  private requireStream(arn: string | undefined) {
+    const stream = arn ? this.streams.getStream(arn) : null
+    if (!stream) {
+      throw {
+        name: 'ResourceNotFoundException',
+        message: `Requested resource not found: Stream: ${arn} not found`,
+      }
+    }
+    return stream
+  }
+
+  // Streams of deleted tables are listed too, until dynado is restarted
+  // against a fresh data directory
+  handleListStreams(body: ListStreamsInput) {
+    const {
+      TableName,
+      ExclusiveStartStreamArn,
+      Limit = MAX_LIST_STREAMS_LIMIT,
+    } = body
+
+    if (Limit < 1 || Limit > MAX_LIST_STREAMS_LIMIT) {
+      throw {
+        name: 'ValidationException',
+        message:
+          `1 validation error detected: Value '${Limit}' at 'limit' failed to satisfy constraint: ` +
+          `Member must have value between 1 and ${MAX_LIST_STREAMS_LIMIT}`,
+      }
+    }
+
+    const streams = this.streams
+      .listStreams(TableName)
+      .filter(
+        (stream) =>
+          ExclusiveStartStreamArn === undefined ||
+          stream.streamArn > ExclusiveStartStreamArn
+      )
+    const page = streams.slice(0, Limit)
+
+    return {
+      Streams: page.map((stream) => ({
+        StreamArn: stream.streamArn,
+        TableName: stream.tableName,
+        StreamLabel: stream.streamLabel,
+      })),
+      ...(streams.length > Limit && {
+        LastEvaluatedStreamArn: page[page.length - 1]!.streamArn,
+      }),
+    }
+  }
+
+  // Every stream has one shard, which closes when the stream is disabled
+  handleDescribeStream(body: DescribeStreamInput) {
+    const stream = this.requireStream(body.StreamArn)
+    const last = this.streams.lastSequence(stream.streamArn)
+
+    return {
+      StreamDescription: {
+        StreamArn: stream.streamArn,
+        StreamLabel: stream.streamLabel,
+        StreamStatus: stream.enabled ? 'ENABLED' : 'DISABLED',
+        StreamViewType: stream.viewType,
+        CreationRequestDateTime: Math.floor(stream.createdAt / 1000),
+        TableName: stream.tableName,
+        KeySchema: stream.keySchema,
+        Shards: [
+          {
+            ShardId: STREAM_SHARD_ID,
+            SequenceNumberRange: {
+              StartingSequenceNumber: formatSequenceNumber(
+                stream.startSequence
+              ),
+              ...(!stream.enabled &&
+                last > 0 && {
+                  EndingSequenceNumber: formatSequenceNumber(last),
+                }),
+            },
+          },
+        ],
+      },
+    }
+  }
+
+  handleGetShardIterator(body: GetShardIteratorInput) {
+    const { StreamArn, ShardId, ShardIteratorType, SequenceNumber } = body
+    const stream = this.requireStream(StreamArn)
+    if (ShardId !== STREAM_SHARD_ID) {
+      throw {
+        name: 'ResourceNotFoundException',
+        message: `Requested resource not found: Shard: ${ShardId} not found`,
+      }
+    }
+
+    let next: number
+    if (ShardIteratorType === 'TRIM_HORIZON') {
+      next = stream.startSequence
+    } else if (ShardIteratorType === 'LATEST') {
+      next = this.streams.lastSequence() + 1
+    } else if (
+      ShardIteratorType === 'AT_SEQUENCE_NUMBER' ||
+      ShardIteratorType === 'AFTER_SEQUENCE_NUMBER'
+    ) {
+      const sequence =
+        SequenceNumber === undefined
+          ? undefined
+          : parseSequenceNumber(SequenceNumber)
+      if (sequence === undefined) {
+        throw {
+          name: 'ValidationException',
+          message: `A valid SequenceNumber is required for ${ShardIteratorType}`,
+        }
+      }
+      next =
+        ShardIteratorType === 'AT_SEQUENCE_NUMBER' ? sequence : sequence + 1
+    } else {
+      throw {
+        name: 'ValidationException',
+        message: `Invalid ShardIteratorType: ${ShardIteratorType}`,
+      }
+    }
+
+    return {
+      ShardIterator: encodeShardIterator({
+        streamArn: stream.streamArn,
+        shardId: STREAM_SHARD_ID,
+        next,
+      }),
+    }
+  }
+
+  // Iterators do not expire. A disabled stream's shard is closed once it is
+  // drained, which GetRecords signals by omitting NextShardIterator.
+  handleGetRecords(body: GetRecordsInput) {
+    const { ShardIterator, Limit = MAX_GET_RECORDS_LIMIT } = body
+
+    const state = ShardIterator ? decodeShardIterator(ShardIterator) : undefined
+    if (!state) {
+      throw { name: 'ValidationException', message: 'Invalid ShardIterator' }
+    }
+    if (Limit < 1 || Limit > MAX_GET_RECORDS_LIMIT) {
+      throw {
+        name: 'ValidationException',
+        message:
+          `1 validation error detected: Value '${Limit}' at 'limit' failed to satisfy constraint: ` +
+          `Member must have value between 1 and ${MAX_GET_RECORDS_LIMIT}`,
+      }
+    }
+    const stream = this.requireStream(state.streamArn)
+
+    const rows = this.streams.read(stream.streamArn, state.next, Limit)
+    const next = rows.length ? rows[rows.length - 1]!.sequence + 1 : state.next
+    const closed =
+      !stream.enabled && next > this.streams.lastSequence(stream.streamArn)
+
+    return {
+      Records: rows.map(({ sequence, record }) => ({
+        ...record,
+        dynamodb: {
+          ...record.dynamodb,
+          SequenceNumber: formatSequenceNumber(sequence),
+        },
+      })),
+      ...(!closed && {
+        NextShardIterator: encodeShardIterator({ ...state, next }),
+      }),
+    }
+  }
+}
+
+interface RequestContext {
+  // Aborted when the request times out
+  signal: AbortSignal
+  // Set once the request has begun writing
+  committing: boolean
+}
+
+// BatchExecuteStatement reports failures with these codes instead of
+// exception names
+const BATCH_STATEMENT_ERROR_CODES: Record<string, string> = {
+  ConditionalCheckFailedException: 'ConditionalCheckFailed',
+  DuplicateItemException: 'DuplicateItem',
+  ResourceNotFoundException: 'ResourceNotFound',
+  TransactionConflictException: 'TransactionConflict',
+  ValidationException: 'ValidationError',
+}
+
+// Schema overrides shared by RestoreTableFromBackup and
+// RestoreTableToPointInTime
+type RestoreOverrides = Pick<
+  RestoreTableFromBackupCommandInput,
+  | 'BillingModeOverride'
+  | 'GlobalSecondaryIndexOverride'
+  | 'LocalSecondaryIndexOverride'
+  | 'SSESpecificationOverride'
+>
+
+// Builds the TableDescription returned by CreateTable and DescribeTable.
+// Tables and indexes are usable immediately, so everything reports ACTIVE
+// except a GSI that UpdateTable added and is still backfilling.
+// Tags attach to tables, named by a table ARN in any region or account
+function taggedTableName(resourceArn: string | undefined): string {
+  const match = /^arn:[^:]+:dynamodb:[^:]*:[^:]*:table\/([^/]+)$/.exec(
+    resourceArn ?? ''
+  )
+  if (!match) {
+    throw {
+      name: 'ValidationException',
+      message: `Invalid ResourceArn provided as input ${resourceArn}`,
+    }
+  }
+  return match[1]!
+}
+
+// Keys are 1 to 128 characters and values at most 256; the aws: prefix is
+// reserved
+function assertTags(tags: Tag[]): void {
+  for (const { Key, Value } of tags) {
+    if (!Key || Key.length > 128 || Value === undefined || Value.length > 256) {
+      throw {
+        name: 'ValidationException',
+        message:
+          'One or more parameter values were invalid: Tag keys must be 1 to 128 characters and values at most 256',
+      }
+    }
+    if (Key.startsWith('aws:')) {
+      throw {
+        name: 'ValidationException',
+        message: `One or more parameter values were invalid: Tag key ${Key} uses the reserved prefix aws:`,
+      }
+    }
+  }
+}
+
+function describeTableSchema(table: TableSchema) {
+  const arn = tableArn(table.tableName)
+  return {
+    TableName: table.tableName,
+    TableArn: arn,
+    KeySchema: table.keySchema,
+    AttributeDefinitions: table.attributeDefinitions,
+    TableStatus: 'ACTIVE',
+    // The JSON protocol encodes timestamps as epoch seconds
+    CreationDateTime: Math.floor((table.createdAt ?? Date.now()) / 1000),
+    BillingModeSummary: {
+      BillingMode: table.billingMode ?? 'PROVISIONED',
+    },
+    GlobalSecondaryIndexes: table.globalSecondaryIndexes?.map((index) => ({
+      IndexName: index.indexName,
+      IndexArn: `${arn}/index/${index.indexName}`,
+      KeySchema: index.keySchema,
+      Projection: index.projection,
+      IndexStatus: isBackfilling(index) ? 'CREATING' : 'ACTIVE',
+      ...(isBackfilling(index) && { Backfilling: true }),
+    })),
+    LocalSecondaryIndexes: table.localSecondaryIndexes?.map((index) => ({
+      IndexName: index.indexName,
+      IndexArn: `${arn}/index/${index.indexName}`,
+      KeySchema: index.keySchema,
+      Projection: index.projection,
+    })),
+    SSEDescription: describeSSE(table.sseSpecification),
+    ...(table.streamSpecification?.StreamEnabled && {
+      StreamSpecification: table.streamSpecification,
+    }),
+    ...(table.latestStreamLabel && {
+      LatestStreamLabel: table.latestStreamLabel,
+      LatestStreamArn: streamArn(table),
+    }),
+  }
+}
+
+function tableArn(tableName: string): string {
+  return `arn:aws:dynamodb:local:000000000000:table/${tableName}`
+}
+
+// Table ARNs end in table/<name>, and may be followed by a resource such as
+// /backup/<id>
+function tableNameFromArn(arn: string): string {
+  return arn.split('/')[1] ?? ''
+}
+
+// The ARN of a table's current or most recent stream
+function streamArn(table: TableSchema): string {
+  return `${tableArn(table.tableName)}/stream/${table.latestStreamLabel}`
+}
+
+// Backup and export IDs are the creation time in milliseconds and a random
+// suffix, as in DynamoDB
+function newResourceId(createdAt: number): string {
+  const suffix = crypto.randomUUID().slice(0, 8)
+  return `${String(createdAt).padStart(14, '0')}-${suffix}`
+}
+
+// The times, in milliseconds since epoch, a table can be restored or
+// exported as of, or undefined when point-in-time recovery is disabled
+function recoveryWindow(
+  table: TableSchema,
+  retentionMs: number
+): { earliest: number; latest: number } | undefined {
+  const enabledAt = table.pointInTimeRecoveryEnabledAt
+  if (enabledAt === undefined) return undefined
+  const now = Date.now()
+  return { earliest: Math.max(enabledAt, now - retentionMs), latest: now }
+}
+
+function describeContinuousBackups(table: TableSchema, retentionMs: number) {
+  const window = recoveryWindow(table, retentionMs)
+  return {
+    // On-demand backups are always available
+    ContinuousBackupsStatus: 'ENABLED',
+    PointInTimeRecoveryDescription: window
+      ? {
+          PointInTimeRecoveryStatus: 'ENABLED',
+          EarliestRestorableDateTime: window.earliest / 1000,
+          LatestRestorableDateTime: window.latest / 1000,
+        }
+      : { PointInTimeRecoveryStatus: 'DISABLED' },
+  }
+}
+
+function describeExport(info: ExportInfo) {
+  return {
+    ExportArn: info.exportArn,
+    ExportStatus: 'COMPLETED',
+    StartTime: info.startTime / 1000,
+    EndTime: info.endTime / 1000,
+    ExportManifest: info.manifestKey,
+    TableArn: info.tableArn,
+    ExportTime: info.exportTime / 1000,
+    ...(info.clientToken && { ClientToken: info.clientToken }),
+    S3Bucket: info.s3Bucket,
+    ...(info.s3Prefix && { S3Prefix: info.s3Prefix }),
+    S3SseAlgorithm: 'AES256',
+    ExportFormat: 'DYNAMODB_JSON',
+    BilledSizeBytes: info.billedSizeBytes,
+    ItemCount: info.itemCount,
+    ExportType: 'FULL_EXPORT',
+  }
+}
+
+function describeGlobalTable(info: GlobalTableInfo) {
+  return {
+    GlobalTableName: info.globalTableName,
+    GlobalTableArn: `arn:aws:dynamodb::000000000000:global-table/${info.globalTableName}`,
+    GlobalTableStatus: 'ACTIVE',
+    CreationDateTime: info.createdAt / 1000,
+    ReplicationGroup: info.regions.map((RegionName) => ({
+      RegionName,
+      ReplicaStatus: 'ACTIVE',
+    })),
+  }
+}
+
+function describeImport(info: ImportInfo) {
+  const { request } = info
+  return {
+    ImportArn: info.importArn,
+    ImportStatus: info.status,
+    TableArn: info.tableArn,
+    ...(info.clientToken && { ClientToken: info.clientToken }),
+    S3BucketSource: request.S3BucketSource,
+    ErrorCount: info.errorCount,
+    InputFormat: request.InputFormat,
+    ...(request.InputFormatOptions && {
+      InputFormatOptions: request.InputFormatOptions,
+    }),
+    InputCompressionType: request.InputCompressionType ?? 'NONE',
+    TableCreationParameters: request.TableCreationParameters,
+    StartTime: info.startTime / 1000,
+    EndTime: info.endTime / 1000,
+    ProcessedSizeBytes: info.processedSizeBytes,
+    ProcessedItemCount: info.processedItemCount,
+    ImportedItemCount: info.importedItemCount,
+    ...(info.failureCode && {
+      FailureCode: info.failureCode,
+      FailureMessage: info.failureMessage,
+    }),
+  }
+}
+
+// Imported items that PutItem would reject are counted as errors instead
+function isImportableItem(schema: TableSchema, item: DynamoDBItem): boolean {
+  try {
+    assertItemKeys(schema, item)
+    assertValidSets(item)
+    assertNestingDepth(item)
+    assertItemSize(item, 'Item size has exceeded the maximum allowed size')
+    return true
+  } catch {
+    return false
+  }
+}
+
+function describeBackupDetails(
+  backup: BackupInfo,
+  status: 'AVAILABLE' | 'DELETED' = 'AVAILABLE'
+) {
+  return {
+    BackupArn: backup.backupArn,
+    BackupName: backup.backupName,
+    BackupSizeBytes: backup.sizeBytes,
+    // Backups are copied before CreateBackup returns, so never CREATING
+    BackupStatus: status,
+    BackupType: 'USER',
+    BackupCreationDateTime: backup.createdAt / 1000,
+  }
+}
+
+function describeBackup(
+  backup: BackupInfo,
+  status: 'AVAILABLE' | 'DELETED' = 'AVAILABLE'
+) {
+  const { schema } = backup
+  const indexes = (list: TableSchema['globalSecondaryIndexes']) =>
+    list?.map((index) => ({
+      IndexName: index.indexName,
+      KeySchema: index.keySchema,
+      Projection: index.projection,
+    }))
+  return {
+    BackupDetails: describeBackupDetails(backup, status),
+    SourceTableDetails: {
+      TableName: backup.tableName,
+      TableArn: tableArn(backup.tableName),
+      KeySchema: schema.keySchema,
+      TableCreationDateTime: Math.floor((schema.createdAt ?? 0) / 1000),
+      ItemCount: backup.itemCount,
+      TableSizeBytes: backup.sizeBytes,
+      BillingMode: schema.billingMode ?? 'PROVISIONED',
+    },
+    SourceTableFeatureDetails: {
+      GlobalSecondaryIndexes: indexes(schema.globalSecondaryIndexes),
+      LocalSecondaryIndexes: indexes(schema.localSecondaryIndexes),
+      SSEDescription: describeSSE(schema.sseSpecification),
+    },
+  }
+}
+
+// Stream labels are creation timestamps, as in DynamoDB
+function newStreamLabel(): string {
+  return new Date().toISOString().replace(/Z$/, '')
+}
+
+function assertStreamSpecification(
+  specification: StreamSpecification | undefined
+): void {
+  if (!specification?.StreamEnabled) return
+  const viewTypes = [
+    'KEYS_ONLY',
+    'NEW_IMAGE',
+    'OLD_IMAGE',
+    'NEW_AND_OLD_IMAGES',
+  ]
+  if (!viewTypes.includes(specification.StreamViewType ?? '')) {
+    throw {
+      name: 'ValidationException',
+      message:
+        'One or more parameter values were invalid: StreamViewType must be one of KEYS_ONLY, NEW_IMAGE, OLD_IMAGE, NEW_AND_OLD_IMAGES when StreamEnabled is true',
+    }
+  }
+}
+
+// Encryption is metadata only: tables report the requested KMS settings but
+// data is stored as-is. Tables using the default AWS owned key have no
+// SSEDescription.
+function describeSSE(
+  specification: SSESpecification | undefined
+): SSEDescription | undefined {
+  if (!specification?.Enabled) {
+    return undefined
+  }
+
+  const keyId = specification.KMSMasterKeyId ?? 'alias/aws/dynamodb'
+  const resource = keyId.startsWith('alias/') ? keyId : `key/${keyId}`
+  return {
+    Status: 'ENABLED',
+    SSEType: specification.SSEType ?? 'KMS',
+    KMSMasterKeyArn: keyId.startsWith('arn:')
+      ? keyId
+      : `arn:aws:kms:local:000000000000:${resource}`,
+  }
+}
+
+// Query and Scan take either the legacy KeyConditions, QueryFilter and
+// ScanFilter parameters or the expressions that replaced them, never both
+function assertSingleFilterForm(request: object): void {
+  const present = (names: string[]) =>
+    names.filter(
+      (name) => (request as Record<string, unknown>)[name] !== undefined
+    )
+  const legacy = present([
+    'KeyConditions',
+    'QueryFilter',
+    'ScanFilter',
+    'ConditionalOperator',
+  ])
+  const expressions = present(['KeyConditionExpression', 'FilterExpression'])
+  if (legacy.length > 0 && expressions.length > 0) {
+    throw {
+      name: 'ValidationException',
+      message:
+        'Can not use both expression and non-expression parameters in the same request: ' +
+        `Non-expression parameters: {${legacy.join(', ')}} Expression parameters: {${expressions.join(', ')}}`,
+    }
+  }
+}
+
+// Helper to apply FilterExpression
+function applyFilterExpression(
+  items: DynamoDBItem[],
+  filterExpression: string,
+  expressionAttributeValues?: Record<string, AttributeValue>,
+  expressionAttributeNames?: Record<string, string>
+): DynamoDBItem[] {
+  // Evaluating against no item first surfaces invalid filters even when
+  // there are no items to filter
+  evaluateConditionExpression(
+    null,
+    filterExpression,
+    expressionAttributeNames,
+    expressionAttributeValues,
+    'FilterExpression'
+  )
+  return items.filter((item) =>
+    evaluateConditionExpression(
+      item,
+      filterExpression,
+      expressionAttributeNames,
+      expressionAttributeValues,
+      'FilterExpression'
+    )
+  )
+}
+
+// Helper to extract key from item. Pagination keys of index reads carry
+// the index keys too, as DynamoDB's do.
+// A key attribute's value as Contributor Insights reports it
+function keyValueText(value: AttributeValue): string {
+  return String(Object.values(value)[0])
+}
+
+function extractKey(
+  schema: TableSchema,
+  item: DynamoDBItem,
+  index?: SecondaryIndexSchema
+): DynamoDBItem {
+  const key: DynamoDBItem = {} as DynamoDBItem
+  for (const keySchema of [...schema.keySchema, ...(index?.keySchema ?? [])]) {
+    const attrName = keySchema.AttributeName
+    if (!attrName) {
+      throw new Error('Key schema entry missing AttributeName')
+    }
+    const value = item[attrName]
+    if (value === undefined) {
+      throw new Error(`Key attribute missing from item: ${attrName}`)
     }
+    key[attrName] = value
   }
+  return key
+}
 
-  async handleDeleteTable(body: DeleteTableCommandInput) {
-    const { TableName } = body
+// Keys must name exactly the key schema attributes, with the declared types
+function assertKeyMatchesSchema(schema: TableSchema, key: DynamoDBItem): void {
+  const mismatch = validationError(
+    'SCHEMA_MISMATCH',
+    'The provided key element does not match the schema'
+  )
 
-    if (!TableName) {
-      throw { name: 'ValidationException', message: 'TableName is required' }
+  if (Object.keys(key).length !== schema.keySchema.length) {
+    throw mismatch
+  }
+  for (const keySchema of schema.keySchema) {
+    const attrName = keySchema.AttributeName
+    const value = attrName === undefined ? undefined : key[attrName]
+    if (value === undefined) {
+      throw mismatch
     }
+    const definition = schema.attributeDefinitions.find(
+      (def) => def.AttributeName === attrName
+    )
+    if (definition?.AttributeType && !(definition.AttributeType in value)) {
+      throw mismatch
+    }
+    assertKeyNotEmpty(attrName!, value)
+  }
+}
 
-    await this.metadataStore.deleteTable(TableName)
-    // TODO: defer?
-    await this.router.deleteAllTableItems(TableName)
-    return { TableDescription: { TableName, TableStatus: 'DELETING' } }
+// A written item must carry every table key attribute with its declared
+// type
+function assertItemKeys(schema: TableSchema, item: DynamoDBItem): void {
+  for (const { AttributeName } of schema.keySchema) {
+    const name = AttributeName!
+    const value = item[name]
+    if (value === undefined) {
+      throw validationError(
+        'SCHEMA_MISMATCH',
+        `One or more parameter values were invalid: Missing the key ${name} in the item`
+      )
+    }
+    const declared = schema.attributeDefinitions.find(
+      (definition) => definition.AttributeName === name
+    )?.AttributeType
+    if (declared && !(declared in value)) {
+      throw validationError(
+        'SCHEMA_MISMATCH',
+        `One or more parameter values were invalid: Type mismatch for key ${name} expected: ${declared} actual: ${Object.keys(value)[0]}`
+      )
+    }
+    assertKeyNotEmpty(name, value)
   }
+}
 
-  async handleBatchGetItem(body: BatchGetItemCommandInput) {
-    const { RequestItems } = body
+// String and binary key values must be at least one byte long
+function assertKeyNotEmpty(name: string, value: AttributeValue): void {
+  const empty =
+    value.S === ''
+      ? 'string'
+      : value.B !== undefined && binarySize(value.B) === 0
+        ? 'binary'
+        : undefined
+  if (empty) {
+    throw validationError(
+      'SCHEMA_MISMATCH',
+      `One or more parameter values are not valid. The AttributeValue for a key attribute cannot contain an empty ${empty} value. Key: ${name}`
+    )
+  }
+}
 
-    if (!RequestItems || Object.keys(RequestItems).length === 0) {
-      throw {
-        name: 'ValidationException',
-        message: 'RequestItems must contain at least one entry',
-      }
+// UpdateExpression may not write key attributes at all, even to set the
+// value they already have
+function assertKeyNotUpdated(
+  schema: TableSchema,
+  updateExpression: string | undefined,
+  expressionAttributeNames?: Record<string, string>,
+  expressionAttributeValues?: Record<string, AttributeValue>
+): void {
+  if (!updateExpression) return
+  const keyNames = schema.keySchema.map((key) => key.AttributeName)
+  const names = updatedAttributeNames(
+    updateExpression,
+    expressionAttributeNames,
+    expressionAttributeValues
+  )
+  const attrName = names.find((name) => keyNames.includes(name))
+  if (attrName !== undefined) {
+    throw {
+      name: 'ValidationException',
+      message: `One or more parameter values were invalid: Cannot update attribute ${attrName}. This attribute is part of the key`,
     }
+  }
+}
 
-    const responses: Record<string, DynamoDBItem[]> = {}
+// A key schema is one HASH key, optionally followed by one RANGE key
+function assertKeySchema(keySchema: KeySchemaElement[]): void {
+  const [hash, range, ...rest] = keySchema
+  let problem: string | undefined
+  if (hash?.KeyType !== 'HASH') {
+    problem = 'The first KeySchemaElement is not a HASH key type'
+  } else if (range && range.KeyType !== 'RANGE') {
+    problem = 'The second KeySchemaElement is not a RANGE key type'
+  } else if (rest.length > 0) {
+    problem = 'Too many KeySchemaElements; expected at most 2'
+  } else if (range && range.AttributeName === hash.AttributeName) {
+    problem = 'Both the Hash Key and the Range Key element are the same'
+  }
+  if (problem) {
+    throw {
+      name: 'ValidationException',
+      message: `Invalid KeySchema: ${problem}`,
+    }
+  }
+}
 
-    for (const [tableName, request] of Object.entries(RequestItems)) {
-      const keys = request.Keys ?? []
-      const items = await this.router.batchGet(tableName, keys)
-      responses[tableName] = items
+// An LSI re-sorts one partition, so it shares the table's partition key
+// and needs a sort key of its own
+function assertLocalIndexKeys(
+  tableKeySchema: KeySchemaElement[],
+  localIndexes: LocalSecondaryIndex[]
+): void {
+  if (localIndexes.length === 0) return
+  const invalid = (detail: string) => ({
+    name: 'ValidationException',
+    message: `One or more parameter values were invalid: ${detail}`,
+  })
+
+  const tableHash = tableKeySchema[0]?.AttributeName
+  if (tableKeySchema.length < 2) {
+    throw invalid(
+      'Table KeySchema does not have a range key, which is required when specifying a LocalSecondaryIndex'
+    )
+  }
+  for (const index of localIndexes) {
+    const [hash, range] = index.KeySchema ?? []
+    if (hash?.AttributeName !== tableHash) {
+      throw invalid(
+        `Index KeySchema does not have the same leading hash key as table KeySchema for index: ${index.IndexName}. index hash key: ${hash?.AttributeName}, table hash key: ${tableHash}`
+      )
+    }
+    if (!range) {
+      throw invalid(
+        `Index KeySchema does not have a range key for index: ${index.IndexName}`
+      )
     }
+  }
+}
 
-    return { Responses: responses }
+// Every table and index key attribute needs a type in AttributeDefinitions
+function assertKeyAttributesDefined(schema: TableSchema): void {
+  const defined = schema.attributeDefinitions.map(
+    (definition) => definition.AttributeName
+  )
+  const keys = [
+    ...schema.keySchema,
+    ...(schema.globalSecondaryIndexes ?? []).flatMap((i) => i.keySchema),
+    ...(schema.localSecondaryIndexes ?? []).flatMap((i) => i.keySchema),
+  ].map((key) => key.AttributeName)
+  const missing = [...new Set(keys.filter((name) => !defined.includes(name)))]
+  if (missing.length > 0) {
+    throw {
+      name: 'ValidationException',
+      message: `One or more parameter values were invalid: Some index key attributes are not defined in AttributeDefinitions. Keys: [${missing.join(', ')}], AttributeDefinitions: [${defined.join(', ')}]`,
+    }
   }
+}
 
-  async handleBatchWriteItem(body: BatchWriteItemCommandInput) {
-    const { RequestItems } = body
+// The legacy AttributesToGet parameter cannot be mixed with the
+// ProjectionExpression that replaced it. The projection itself is checked
+// before any item is read, so a bad one fails even when nothing is found.
+function assertSingleProjectionForm(request: {
+  AttributesToGet?: string[]
+  ProjectionExpression?: string
+  ExpressionAttributeNames?: Record<string, string>
+}): void {
+  if (request.AttributesToGet && request.ProjectionExpression !== undefined) {
+    throw validationError(
+      'EXPRESSION_SYNTAX',
+      'Can not use both expression and non-expression parameters in the same request: ' +
+        'Non-expression parameters: {AttributesToGet} Expression parameters: {ProjectionExpression}'
+    )
+  }
+  if (request.ProjectionExpression !== undefined) {
+    validateProjectionExpression(
+      request.ProjectionExpression,
+      request.ExpressionAttributeNames
+    )
+  }
+}
 
-    if (!RequestItems || Object.keys(RequestItems).length === 0) {
+// A batch may address each item at most once per table
+function assertNoDuplicateKeys(
+  schema: TableSchema,
+  itemsOrKeys: DynamoDBItem[]
+): void {
+  const seen = new Set<string>()
+  for (const itemOrKey of itemsOrKeys) {
+    const keyString = getKeyString(extractKey(schema, itemOrKey))
+    if (seen.has(keyString)) {
       throw {
         name: 'ValidationException',
-        message: 'RequestItems must contain at least one entry',
+        message: 'Provided list of item keys contains duplicates',
       }
     }
+    seen.add(keyString)
+  }
+}
 
-    for (const [tableName, requests] of Object.entries(RequestItems)) {
-      const puts: DynamoDBItem[] = []
-      const deletes: DynamoDBItem[] = []
-
-      for (const request of requests as WriteRequest[]) {
-        if (request.PutRequest?.Item) {
-          puts.push(request.PutRequest.Item)
-        } else if (request.DeleteRequest?.Key) {
-          deletes.push(request.DeleteRequest.Key)
-        }
-      }
-
-      await this.router.batchWrite(tableName, puts, deletes)
+// DynamoDB never stores an empty SS, NS, or BS, or one that repeats an
+// element, even inside a document. Returns why the value is invalid.
+function invalidSet(value: AttributeValue): string | undefined {
+  for (const type of ['SS', 'NS', 'BS'] as const) {
+    const elements = value[type] as Array<string | Uint8Array> | undefined
+    if (!elements) continue
+    if (elements.length === 0) {
+      return 'One or more parameter values were invalid: An attribute value may not be an empty set'
     }
-
-    return {}
+    const keys = elements.map((element) => setElementKey(type, element))
+    if (new Set(keys).size < keys.length) {
+      const shown = elements.map((element) =>
+        typeof element === 'string'
+          ? element
+          : Buffer.from(element).toString('base64')
+      )
+      return `One or more parameter values were invalid: Input collection [${shown.join(', ')}] contains duplicates.`
+    }
+  }
+  const children = value.M ? Object.values(value.M) : value.L
+  for (const child of children ?? []) {
+    const problem = invalidSet(child)
+    if (problem) return problem
   }
+  return undefined
+}
 
-  async handleTransactWriteItems(body: TransactWriteItemsCommandInput) {
-    const { TransactItems, ClientRequestToken } = body
+function assertValidSets(item: DynamoDBItem): void {
+  for (const value of Object.values(item)) {
+    const problem = invalidSet(value)
+    if (problem) throw { name: 'ValidationException', message: problem }
+  }
+}
 
-    if (!TransactItems || TransactItems.length === 0) {
+function assertValidSetValues(
+  expressionAttributeValues?: Record<string, AttributeValue>
+): void {
+  for (const [key, value] of Object.entries(expressionAttributeValues ?? {})) {
+    const problem = invalidSet(value)
+    if (problem) {
       throw {
         name: 'ValidationException',
-        message: 'TransactItems is required',
+        message: `ExpressionAttributeValues contains invalid value: ${problem} for key ${key}`,
       }
     }
+  }
+}
 
-    if (TransactItems.length > MAX_ITEMS_PER_TRANSACTION) {
-      throw {
-        name: 'ValidationException',
-        message: 'Transaction cannot contain more than 100 items',
-      }
+// Maps and lists may nest at most MAX_NESTING_DEPTH levels deep
+function assertNestingDepth(item: DynamoDBItem): void {
+  const depth = (value: AttributeValue): number => {
+    const children = value.M ? Object.values(value.M) : value.L
+    if (!children) return 0
+    let deepest = 0
+    for (const child of children) {
+      deepest = Math.max(deepest, depth(child))
     }
+    return 1 + deepest
+  }
 
-    try {
-      await this.router.transactWrite(TransactItems, ClientRequestToken)
-      return {}
-    } catch (error: unknown) {
-      if (error instanceof TransactionCanceledException) {
-        throw {
-          name: 'TransactionCanceledException',
-          message: error.message,
-          CancellationReasons: error.CancellationReasons,
-        }
-      }
-      throw error
+  for (const value of Object.values(item)) {
+    if (depth(value) > MAX_NESTING_DEPTH) {
+      throw validationError(
+        'SIZE_LIMIT',
+        'Nesting Levels have exceeded supported limits'
+      )
     }
   }
+}
 
-  async handleTransactGetItems(body: TransactGetItemsCommandInput) {
-    const { TransactItems } = body
+// Item sizes follow DynamoDB's accounting: attribute name bytes plus value
+// bytes, with numbers stored as two digits per byte and documents paying a
+// small overhead per container and element
+function itemSize(item: DynamoDBItem): number {
+  let size = 0
+  for (const [name, value] of Object.entries(item)) {
+    size += Buffer.byteLength(name) + attributeValueSize(value)
+  }
+  return size
+}
 
-    if (!TransactItems || TransactItems.length === 0) {
-      throw {
-        name: 'ValidationException',
-        message: 'TransactItems is required',
-      }
-    }
+function totalItemSize(items: DynamoDBItem[]): number {
+  return items.reduce((total, item) => total + itemSize(item), 0)
+}
 
-    if (TransactItems.length > MAX_ITEMS_PER_TRANSACTION) {
-      throw {
-        name: 'ValidationException',
-        message: `Transaction cannot contain more than ${MAX_ITEMS_PER_TRANSACTION} items`,
+/**
+ * The write capacity of replacing oldItem with newItem, either of which
+ * may be missing. The table pays for the larger of the two. Each index
+ * pays for the entry it gains or loses; an entry whose index key changes
+ * is deleted and put again, and an entry left unchanged costs nothing.
+ */
+function writeUsage(
+  schema: TableSchema,
+  oldItem: DynamoDBItem | null,
+  newItem: DynamoDBItem | null
+): CapacityUsage {
+  const usage: CapacityUsage = {
+    table: writeCapacityUnits(
+      Math.max(oldItem ? itemSize(oldItem) : 0, newItem ? itemSize(newItem) : 0)
+    ),
+    indexes: {},
+  }
+  const entry = (index: SecondaryIndexSchema, item: DynamoDBItem | null) =>
+    item && hasIndexKeys(index, item)
+      ? projectToIndex(schema, index, item)
+      : null
+  for (const index of [
+    ...(schema.globalSecondaryIndexes ?? []),
+    ...(schema.localSecondaryIndexes ?? []),
+  ]) {
+    const before = entry(index, oldItem)
+    const after = entry(index, newItem)
+    let units = 0
+    if (before && after && sameIndexKey(index, before, after)) {
+      if (!Bun.deepEquals(before, after)) {
+        units = writeCapacityUnits(Math.max(itemSize(before), itemSize(after)))
       }
+    } else {
+      if (before) units += writeCapacityUnits(itemSize(before))
+      if (after) units += writeCapacityUnits(itemSize(after))
     }
+    if (units > 0) usage.indexes[index.indexName] = units
+  }
+  return usage
+}
 
-    const results = await this.router.transactGet(TransactItems)
+function sameIndexKey(
+  index: SecondaryIndexSchema,
+  a: DynamoDBItem,
+  b: DynamoDBItem
+): boolean {
+  return index.keySchema.every(
+    ({ AttributeName }) =>
+      JSON.stringify(a[AttributeName!]) === JSON.stringify(b[AttributeName!])
+  )
+}
 
-    return {
-      Responses: results.map((item) => ({ Item: item })),
+/**
+ * The items a Query or Scan page examines. DynamoDB stops a page after
+ * Limit items or once it has read 1MB; a nonzero maxItems also stops it
+ * after that many items, so tests can paginate small tables. truncated is
+ * set when items remain.
+ */
+function readPage(
+  items: DynamoDBItem[],
+  limit: number | undefined,
+  maxItems: number
+): { page: DynamoDBItem[]; truncated: boolean } {
+  const cap = Math.min(limit ?? Infinity, maxItems > 0 ? maxItems : Infinity)
+  let bytes = 0
+  for (const [i, item] of items.entries()) {
+    if (i >= cap) {
+      return { page: items.slice(0, i), truncated: true }
+    }
+    bytes += itemSize(item)
+    if (bytes >= MAX_PAGE_BYTES && i + 1 < items.length) {
+      return { page: items.slice(0, i + 1), truncated: true }
     }
   }
+  return { page: items, truncated: false }
 }
 
-// Helper to apply FilterExpression
-function applyFilterExpression(
-  items: DynamoDBItem[],
-  filterExpression: string,
-  expressionAttributeValues?: Record<string, AttributeValue>,
-  expressionAttributeNames?: Record<string, string>
-): DynamoDBItem[] {
-  return items.filter((item) => {
-    // Simple filter for equality: "#attr = :value"
-    const eqMatch = filterExpression.match(/([#\w]+)\s*=\s*(:\w+)/)
-    if (eqMatch && eqMatch[1] && eqMatch[2]) {
-      const resolvedName =
-        eqMatch[1].startsWith('#') && expressionAttributeNames
-          ? (expressionAttributeNames[eqMatch[1]] ?? eqMatch[1])
-          : eqMatch[1]
-      const valueRef = eqMatch[2]
+function attributeValueSize(value: AttributeValue): number {
+  if (value.S !== undefined) return Buffer.byteLength(value.S)
+  if (value.N !== undefined) return numberSize(value.N)
+  if (value.B !== undefined) return binarySize(value.B)
+  if (value.SS) {
+    return value.SS.reduce((sum, s) => sum + Buffer.byteLength(s), 0)
+  }
+  if (value.NS) return value.NS.reduce((sum, n) => sum + numberSize(n), 0)
+  if (value.BS) return value.BS.reduce((sum, b) => sum + binarySize(b), 0)
+  if (value.M) {
+    let size = 3
+    for (const [name, child] of Object.entries(value.M)) {
+      size += 1 + Buffer.byteLength(name) + attributeValueSize(child)
+    }
+    return size
+  }
+  if (value.L) {
+    let size = 3
+    for (const child of value.L) {
+      size += 1 + attributeValueSize(child)
+    }
+    return size
+  }
+  // BOOL and NULL
+  return 1
+}
 
-      const filterValue = expressionAttributeValues?.[valueRef]
-      const itemValue = resolvedName ? item[resolvedName] : undefined
-      if (filterValue && itemValue !== undefined) {
-        return JSON.stringify(itemValue) === JSON.stringify(filterValue)
-      }
+function numberSize(value: string): number {
+  const digits = value
+    .replace(/[eE].*$/, '')
+    .replace(/[-+.]/g, '')
+    .replace(/^0+|0+$/g, '')
+  return Math.ceil(digits.length / 2) + 1
+}
+
+function binarySize(value: Uint8Array | string): number {
+  // Binary values arrive base64-encoded over the wire
+  return typeof value === 'string'
+    ? Buffer.from(value, 'base64').length
+    : value.length
+}
+
+function assertItemSize(item: DynamoDBItem, message: string): void {
+  if (itemSize(item) > MAX_ITEM_SIZE_BYTES) {
+    throw validationError('SIZE_LIMIT', message)
+  }
+}
+
+// GSIs are maintained asynchronously in DynamoDB, so they only support
+// eventually consistent reads; LSIs share their table's partition
+function assertConsistentReadSupported(
+  schema: TableSchema,
+  indexName: string | undefined,
+  consistentRead: boolean | undefined
+): void {
+  if (consistentRead && indexName && isGlobalIndex(schema, indexName)) {
+    throw {
+      name: 'ValidationException',
+      message: 'Consistent reads are not supported on global secondary indexes',
     }
+  }
+}
 
-    // Simple filter for greater than: "#attr > :value"
-    const gtMatch = filterExpression.match(/([#\w]+)\s*>\s*(:\w+)/)
-    if (gtMatch && gtMatch[1] && gtMatch[2]) {
-      const resolvedName =
-        gtMatch[1].startsWith('#') && expressionAttributeNames
-          ? (expressionAttributeNames[gtMatch[1]] ?? gtMatch[1])
-          : gtMatch[1]
-      const valueRef = gtMatch[2]
+const RETURN_VALUES = [
+  'ALL_NEW',
+  'UPDATED_OLD',
+  'ALL_OLD',
+  'NONE',
+  'UPDATED_NEW',
+]
 
-      const filterValue = expressionAttributeValues?.[valueRef]
-      const candidate = resolvedName ? item[resolvedName] : undefined
-      if (filterValue?.N && candidate?.N) {
-        return parseInt(candidate.N) > parseInt(filterValue.N)
-      }
+// Every write takes the same ReturnValues enum, but PutItem and DeleteItem
+// have no new item to return, only the one they replaced
+function assertReturnValues(
+  returnValues: string | undefined,
+  operation: 'PutItem' | 'UpdateItem' | 'DeleteItem'
+): void {
+  if (returnValues === undefined) return
+  if (!RETURN_VALUES.includes(returnValues)) {
+    throw {
+      name: 'ValidationException',
+      message:
+        `1 validation error detected: Value '${returnValues}' at 'returnValues' ` +
+        `failed to satisfy constraint: Member must satisfy enum value set: [${RETURN_VALUES.join(', ')}]`,
+    }
+  }
+  if (
+    operation !== 'UpdateItem' &&
+    returnValues !== 'NONE' &&
+    returnValues !== 'ALL_OLD'
+  ) {
+    throw {
+      name: 'ValidationException',
+      message: 'Return values set to invalid value',
     }
+  }
+}
 
-    return true
-  })
+function assertReturnValuesOnConditionCheckFailure(
+  returnValues: string | undefined
+): void {
+  if (
+    returnValues !== undefined &&
+    !['ALL_OLD', 'NONE'].includes(returnValues)
+  ) {
+    throw {
+      name: 'ValidationException',
+      message:
+        `1 validation error detected: Value '${returnValues}' at 'returnValuesOnConditionCheckFailure' ` +
+        'failed to satisfy constraint: Member must satisfy enum value set: [ALL_OLD, NONE]',
+    }
+  }
 }
 
-// Helper to extract key from item
-function extractKey(schema: TableSchema, item: DynamoDBItem): DynamoDBItem {
-  const key: DynamoDBItem = {} as DynamoDBItem
-  for (const keySchema of schema.keySchema) {
-    const attrName = keySchema.AttributeName
-    if (!attrName) {
-      throw new Error('Key schema entry missing AttributeName')
+// A Query or Scan Limit counts items, so it must be at least 1
+function assertLimit(limit: number | undefined): void {
+  if (limit !== undefined && limit < 1) {
+    throw {
+      name: 'ValidationException',
+      message:
+        `1 validation error detected: Value '${limit}' at 'limit' ` +
+        'failed to satisfy constraint: Member must have value greater than or equal to 1',
     }
-    const value = item[attrName]
-    if (value === undefined) {
-      throw new Error(`Key attribute missing from item: ${attrName}`)
+  }
+}
+
+// Segment and TotalSegments come as a pair, with 0 <= Segment < TotalSegments
+function assertScanSegment(
+  segment: number | undefined,
+  totalSegments: number | undefined
+): void {
+  if (segment === undefined && totalSegments === undefined) return
+
+  if (totalSegments === undefined) {
+    throw {
+      name: 'ValidationException',
+      message:
+        'The TotalSegments parameter is required but was not present in the request when Segment parameter is present',
     }
-    key[attrName] = value
   }
-  return key
+  if (segment === undefined) {
+    throw {
+      name: 'ValidationException',
+      message:
+        'The Segment parameter is required but was not present in the request when parameter TotalSegments is present',
+    }
+  }
+  if (totalSegments < 1 || totalSegments > MAX_SCAN_SEGMENTS) {
+    throw {
+      name: 'ValidationException',
+      message:
+        `1 validation error detected: Value '${totalSegments}' at 'totalSegments' ` +
+        `failed to satisfy constraint: Member must have value between 1 and ${MAX_SCAN_SEGMENTS}`,
+    }
+  }
+  if (segment < 0) {
+    throw {
+      name: 'ValidationException',
+      message:
+        `1 validation error detected: Value '${segment}' at 'segment' ` +
+        'failed to satisfy constraint: Member must have value greater than or equal to 0',
+    }
+  }
+  if (segment >= totalSegments) {
+    throw {
+      name: 'ValidationException',
+      message: `The Segment parameter is zero-based and must be less than parameter TotalSegments: Segment: ${segment} is not less than TotalSegments: ${totalSegments}`,
+    }
+  }
+}
+
+// Orders items by the table's partition key, then its sort key
+function compareTableKeys(
+  schema: TableSchema,
+  a: DynamoDBItem,
+  b: DynamoDBItem
+): number {
+  for (const { AttributeName } of schema.keySchema) {
+    const aVal = a[AttributeName!]
+    const bVal = b[AttributeName!]
+    const comparison = aVal && bVal ? compareScalars(aVal, bVal) : undefined
+    if (comparison) return comparison
+  }
+  return 0
+}
+
+// Query returns items by sort key, the index's for index queries. Index
+// keys need not be unique, so ties fall back to the table's primary key,
+// keeping the order (and so every page boundary) the same on every call.
+function compareQueryOrder(
+  schema: TableSchema,
+  index: SecondaryIndexSchema | undefined,
+  a: DynamoDBItem,
+  b: DynamoDBItem
+): number {
+  const keySchema = index?.keySchema ?? schema.keySchema
+  const sortKeyName = keySchema.find((k) => k.KeyType === 'RANGE')
+    ?.AttributeName
+  const aVal = sortKeyName ? a[sortKeyName] : undefined
+  const bVal = sortKeyName ? b[sortKeyName] : undefined
+  const comparison = aVal && bVal ? compareScalars(aVal, bVal) : undefined
+  return comparison || compareTableKeys(schema, a, b)
+}
+
+// Scan reads partitions in the order of their key's hash, as DynamoDB lays
+// them out, and each partition's items by sort key. Index scans order by
+// the index's keys, with the table's key breaking ties.
+function compareScanOrder(
+  schema: TableSchema,
+  index: SecondaryIndexSchema | undefined,
+  a: DynamoDBItem,
+  b: DynamoDBItem
+): number {
+  const keySchema = index?.keySchema ?? schema.keySchema
+  for (const { AttributeName, KeyType } of keySchema) {
+    const aVal = a[AttributeName!]
+    const bVal = b[AttributeName!]
+    if (!aVal || !bVal) continue
+    const comparison =
+      (KeyType === 'HASH' ? partitionHash(aVal) - partitionHash(bVal) : 0) ||
+      (compareScalars(aVal, bVal) ?? 0)
+    if (comparison) return comparison
+  }
+  return compareTableKeys(schema, a, b)
+}
+
+function partitionHash(value: AttributeValue): number {
+  return CRC32.str(JSON.stringify(value)) >>> 0
+}
+
+// Each segment of a parallel scan takes a contiguous slice of the partition
+// key hashes, as DynamoDB gives each segment a share of the partitions, so
+// reading the segments in order reads the items in full scan order
+function scanSegment(
+  schema: TableSchema,
+  index: SecondaryIndexSchema | undefined,
+  item: DynamoDBItem,
+  totalSegments: number
+): number {
+  const keySchema = index?.keySchema ?? schema.keySchema
+  const hashKey = keySchema.find((key) => key.KeyType === 'HASH')!
+  const hash = partitionHash(item[hashKey.AttributeName!]!)
+  return Math.floor((hash * totalSegments) / 2 ** 32)
+}
+
+// ExclusiveStartKey must be a key the table or index could have returned:
+// the table's key attributes, and the index's for index reads
+function assertStartKey(
+  schema: TableSchema,
+  index: SecondaryIndexSchema | undefined,
+  key: DynamoDBItem
+): void {
+  const names = new Set(
+    [...schema.keySchema, ...(index?.keySchema ?? [])].map(
+      (k) => k.AttributeName!
+    )
+  )
+  const invalid = validationError(
+    'SCHEMA_MISMATCH',
+    'The provided starting key is invalid: The provided key element does not match the schema'
+  )
+  if (Object.keys(key).length !== names.size) throw invalid
+  for (const name of names) {
+    const value = key[name]
+    const type = schema.attributeDefinitions.find(
+      (def) => def.AttributeName === name
+    )?.AttributeType
+    if (!value || (type && !(type in value))) throw invalid
+  }
 }
 
 function getKeyString(key: DynamoDBItem): string {
@@ -750,11 +5278,14 @@ function getKeyString(key: DynamoDBItem): string {
   return keyAttrs.map((attr) => JSON.stringify(key[attr])).join('#')
 }
 
+// With ReturnValuesOnConditionCheckFailure ALL_OLD, a failed check returns
+// the item that failed it, if there is one
 function assertConditionExpression(
   currentItem: DynamoDBItem | null,
   conditionExpression?: string,
   expressionAttributeNames?: Record<string, string>,
-  expressionAttributeValues?: Record<string, AttributeValue>
+  expressionAttributeValues?: Record<string, AttributeValue>,
+  returnValuesOnConditionCheckFailure?: string
 ): void {
   const passed = evaluateConditionExpression(
     currentItem,
@@ -766,10 +5297,25 @@ function assertConditionExpression(
     throw {
       name: 'ConditionalCheckFailedException',
       message: 'The conditional request failed',
+      ...(returnValuesOnConditionCheckFailure === 'ALL_OLD' &&
+        currentItem && { Item: currentItem }),
     }
   }
 }
 
+// JSON.stringify replacer that emits object keys in sorted order
+function sortObjectKeys(_key: string, value: unknown): unknown {
+  if (!value || typeof value !== 'object' || Array.isArray(value)) {
+    return value
+  }
+  const record = value as Record<string, unknown>
+  return Object.fromEntries(
+    Object.keys(record)
+      .sort()
+      .map((key) => [key, record[key]])
+  )
+}
+
 function serializeError(error: unknown): Record<string, any> {
   if (error instanceof Error) {
     const payload: Record<string, any> = {
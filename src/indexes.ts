@@ -0,0 +1,181 @@
+// Secondary index helpers: lookup, sparse membership, and projection
+
+import type {
+  KeySchemaElement,
+  Projection,
+  Select,
+} from '@aws-sdk/client-dynamodb'
+import type {
+  DynamoDBItem,
+  SecondaryIndexSchema,
+  TableSchema,
+} from './types.ts'
+
+// Converts a CreateTable index definition (global or local) for storage
+export function toIndexSchema(index: {
+  IndexName?: string
+  KeySchema?: KeySchemaElement[]
+  Projection?: Projection
+}): SecondaryIndexSchema {
+  return {
+    indexName: index.IndexName!,
+    keySchema: index.KeySchema!,
+    projection: index.Projection ?? { ProjectionType: 'ALL' },
+  }
+}
+
+export function findIndex(
+  schema: TableSchema,
+  indexName: string
+): SecondaryIndexSchema | undefined {
+  return [
+    ...(schema.globalSecondaryIndexes ?? []),
+    ...(schema.localSecondaryIndexes ?? []),
+  ].find((index) => index.indexName === indexName)
+}
+
+// Like findIndex, but a missing index is a ValidationException
+export function requireIndex(
+  schema: TableSchema,
+  indexName: string
+): SecondaryIndexSchema {
+  const index = findIndex(schema, indexName)
+  if (!index) {
+    throw {
+      name: 'ValidationException',
+      message: `The table does not have the specified index: ${indexName}`,
+    }
+  }
+  if (isBackfilling(index)) {
+    throw {
+      name: 'ValidationException',
+      message: `Cannot read from backfilling global secondary index: ${indexName}`,
+    }
+  }
+  return index
+}
+
+// A GSI added by UpdateTable is CREATING until its simulated backfill ends
+export function isBackfilling(index: SecondaryIndexSchema): boolean {
+  return index.backfillUntil !== undefined && Date.now() < index.backfillUntil
+}
+
+export function isGlobalIndex(schema: TableSchema, indexName: string): boolean {
+  return (
+    schema.globalSecondaryIndexes?.some(
+      (index) => index.indexName === indexName
+    ) ?? false
+  )
+}
+
+// Items only appear in an index when they carry every index key attribute
+export function hasIndexKeys(
+  index: SecondaryIndexSchema,
+  item: DynamoDBItem
+): boolean {
+  return index.keySchema.every(
+    (key) => key.AttributeName !== undefined && key.AttributeName in item
+  )
+}
+
+// Reduces a base item to what the index stores: table keys, index keys, and
+// the projected non-key attributes
+export function projectToIndex(
+  schema: TableSchema,
+  index: SecondaryIndexSchema,
+  item: DynamoDBItem
+): DynamoDBItem {
+  if (index.projection.ProjectionType === 'ALL') {
+    return item
+  }
+
+  const attributeNames = new Set<string>()
+  for (const key of [...schema.keySchema, ...index.keySchema]) {
+    if (key.AttributeName) attributeNames.add(key.AttributeName)
+  }
+  if (index.projection.ProjectionType === 'INCLUDE') {
+    for (const name of index.projection.NonKeyAttributes ?? []) {
+      attributeNames.add(name)
+    }
+  }
+
+  const projected: DynamoDBItem = {}
+  for (const name of attributeNames) {
+    const value = item[name]
+    if (value !== undefined) {
+      projected[name] = value
+    }
+  }
+  return projected
+}
+
+function invalidSelect(detail: string) {
+  return {
+    name: 'ValidationException',
+    message: `One or more parameter values were invalid: ${detail}`,
+  }
+}
+
+const SELECT_VALUES = [
+  'ALL_ATTRIBUTES',
+  'ALL_PROJECTED_ATTRIBUTES',
+  'SPECIFIC_ATTRIBUTES',
+  'COUNT',
+]
+
+/**
+ * Validate Select against the read target. ALL_ATTRIBUTES needs the full
+ * item, which a GSI only has with an ALL projection (LSI reads fetch from
+ * the table); ALL_PROJECTED_ATTRIBUTES needs an index; and
+ * ProjectionExpression goes with SPECIFIC_ATTRIBUTES only. COUNT reads
+ * like any other Select but returns no items.
+ */
+export function assertSelectSupported(
+  schema: TableSchema,
+  indexName: string | undefined,
+  select: Select | undefined,
+  projectionExpression: string | undefined
+): void {
+  if (select === undefined) return
+  if (!SELECT_VALUES.includes(select)) {
+    throw {
+      name: 'ValidationException',
+      message:
+        `1 validation error detected: Value '${select}' at 'select' ` +
+        `failed to satisfy constraint: Member must satisfy enum value set: [${SELECT_VALUES.join(', ')}]`,
+    }
+  }
+
+  if (select === 'SPECIFIC_ATTRIBUTES') {
+    if (!projectionExpression) {
+      throw invalidSelect(
+        'Select type SPECIFIC_ATTRIBUTES requires a ProjectionExpression'
+      )
+    }
+    return
+  }
+  if (projectionExpression) {
+    throw invalidSelect(
+      `Cannot specify a ProjectionExpression when Select is ${select}`
+    )
+  }
+
+  if (select === 'ALL_PROJECTED_ATTRIBUTES' && !indexName) {
+    throw invalidSelect(
+      'Select type ALL_PROJECTED_ATTRIBUTES can only be used when querying an index'
+    )
+  }
+
+  if (select === 'ALL_ATTRIBUTES' && indexName) {
+    const index = findIndex(schema, indexName)
+    if (
+      index &&
+      isGlobalIndex(schema, indexName) &&
+      index.projection.ProjectionType !== 'ALL'
+    ) {
+      throw invalidSelect(
+        `Select type ALL_ATTRIBUTES is not supported for global secondary index ${indexName} because its projection type is not ALL`
+      )
+    }
+  }
+}
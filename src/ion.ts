@@ -0,0 +1,335 @@
+// A reader for the Ion text format, as far as DynamoDB's Ion exports use it:
+// structs, lists, strings, symbols, numbers, booleans, nulls and blobs, with
+// type annotations. Timestamps, clobs and s-expressions are rejected.
+
+export type IonValue = (
+  | { type: 'null' }
+  | { type: 'bool'; value: boolean }
+  // Numbers are kept as DynamoDB number text, so no precision is lost
+  | { type: 'number'; value: string }
+  | { type: 'string'; value: string }
+  | { type: 'symbol'; value: string }
+  // Base64
+  | { type: 'blob'; value: string }
+  | { type: 'list'; values: IonValue[] }
+  | { type: 'struct'; fields: Map<string, IonValue> }
+) & { annotations: string[] }
+
+/**
+ * Parses a stream of top-level Ion values. The $ion_1_0 version marker is
+ * skipped. Any syntax error throws, naming the offset it was found at.
+ */
+export function parseIon(text: string): IonValue[] {
+  const reader = new IonReader(text)
+  const values: IonValue[] = []
+  for (;;) {
+    reader.skipWhitespace()
+    if (reader.done()) return values
+    const value = reader.readValue()
+    if (
+      value.type === 'symbol' &&
+      value.value === '$ion_1_0' &&
+      value.annotations.length === 0
+    ) {
+      continue
+    }
+    values.push(value)
+  }
+}
+
+const IDENTIFIER_START = /[A-Za-z_$]/
+const IDENTIFIER_PART = /[A-Za-z0-9_$]/
+// Timestamps share a first character with numbers and are read alike, so
+// that they can be rejected whole
+const NUMBER_PART = /[0-9A-Za-z_.+\-:]/
+const TIMESTAMP = /^\d{4}(-\d\d)?(-\d\d)?T|^\d{4}-\d\d-\d\d$/
+const BASE64 = /^[A-Za-z0-9+/]*={0,2}$/
+
+class IonReader {
+  private pos = 0
+
+  constructor(private text: string) {}
+
+  done(): boolean {
+    return this.pos >= this.text.length
+  }
+
+  skipWhitespace(): void {
+    for (;;) {
+      const char = this.text[this.pos]
+      if (char === undefined) return
+      if (/\s/.test(char)) {
+        this.pos++
+      } else if (this.text.startsWith('//', this.pos)) {
+        const end = this.text.indexOf('\n', this.pos)
+        this.pos = end === -1 ? this.text.length : end + 1
+      } else if (this.text.startsWith('/*', this.pos)) {
+        const end = this.text.indexOf('*/', this.pos + 2)
+        if (end === -1) this.fail('unterminated comment')
+        this.pos = end + 2
+      } else {
+        return
+      }
+    }
+  }
+
+  // A value and the annotations before it
+  readValue(): IonValue {
+    const annotations: string[] = []
+    for (;;) {
+      this.skipWhitespace()
+      const symbol = this.readSymbol()
+      if (!symbol) {
+        return { ...this.readUnannotatedValue(), annotations }
+      }
+      this.skipWhitespace()
+      if (this.text.startsWith('::', this.pos)) {
+        this.pos += 2
+        annotations.push(symbol.text)
+        continue
+      }
+      return { ...this.symbolValue(symbol), annotations }
+    }
+  }
+
+  // Unquoted symbols double as the keywords null, true and false
+  private symbolValue(symbol: { text: string; quoted: boolean }) {
+    if (symbol.quoted) {
+      return { type: 'symbol' as const, value: symbol.text }
+    }
+    switch (symbol.text) {
+      case 'true':
+      case 'false':
+        return { type: 'bool' as const, value: symbol.text === 'true' }
+      case 'null':
+        // Typed nulls such as null.string are all null to DynamoDB
+        if (this.text[this.pos] === '.') {
+          this.pos++
+          if (!this.readSymbol()) this.fail('invalid typed null')
+        }
+        return { type: 'null' as const }
+      case 'nan':
+        this.fail('DynamoDB numbers must be finite')
+    }
+    return { type: 'symbol' as const, value: symbol.text }
+  }
+
+  private readUnannotatedValue() {
+    const char = this.text[this.pos]
+    if (char === undefined) this.fail('expected a value')
+    if (this.text.startsWith('{{', this.pos)) {
+      return { type: 'blob' as const, value: this.readBlob() }
+    }
+    switch (char) {
+      case '{':
+        return { type: 'struct' as const, fields: this.readStruct() }
+      case '[':
+        return { type: 'list' as const, values: this.readList() }
+      case '(':
+        this.fail('s-expressions are not supported')
+      case '"':
+        return { type: 'string' as const, value: this.readQuoted('"') }
+    }
+    if (this.text.startsWith("'''", this.pos)) {
+      return { type: 'string' as const, value: this.readLongStrings() }
+    }
+    if (/[0-9+-]/.test(char)) {
+      return { type: 'number' as const, value: this.readNumber() }
+    }
+    this.fail(`unexpected ${JSON.stringify(char)}`)
+  }
+
+  // An identifier or a 'quoted' symbol, or undefined if neither is next
+  private readSymbol(): { text: string; quoted: boolean } | undefined {
+    const char = this.text[this.pos]
+    if (char === "'" && !this.text.startsWith("'''", this.pos)) {
+      return { text: this.readQuoted("'"), quoted: true }
+    }
+    if (char === undefined || !IDENTIFIER_START.test(char)) return undefined
+    const start = this.pos
+    while (
+      this.pos < this.text.length &&
+      IDENTIFIER_PART.test(this.text[this.pos]!)
+    ) {
+      this.pos++
+    }
+    return { text: this.text.slice(start, this.pos), quoted: false }
+  }
+
+  private readStruct(): Map<string, IonValue> {
+    const fields = new Map<string, IonValue>()
+    this.pos++
+    for (;;) {
+      this.skipWhitespace()
+      if (this.text[this.pos] === '}') {
+        this.pos++
+        return fields
+      }
+      const name = this.readFieldName()
+      this.skipWhitespace()
+      if (this.text[this.pos] !== ':') this.fail("expected ':'")
+      this.pos++
+      fields.set(name, this.readValue())
+      this.skipSeparator('}')
+    }
+  }
+
+  private readFieldName(): string {
+    if (this.text[this.pos] === '"') return this.readQuoted('"')
+    if (this.text.startsWith("'''", this.pos)) return this.readLongStrings()
+    const symbol = this.readSymbol()
+    if (!symbol) this.fail('expected a field name')
+    return symbol.text
+  }
+
+  private readList(): IonValue[] {
+    const values: IonValue[] = []
+    this.pos++
+    for (;;) {
+      this.skipWhitespace()
+      if (this.text[this.pos] === ']') {
+        this.pos++
+        return values
+      }
+      values.push(this.readValue())
+      this.skipSeparator(']')
+    }
+  }
+
+  // Container members are separated by commas, and may have one trailing
+  private skipSeparator(close: string): void {
+    this.skipWhitespace()
+    if (this.text[this.pos] === ',') {
+      this.pos++
+    } else if (this.text[this.pos] !== close) {
+      this.fail(`expected ',' or '${close}'`)
+    }
+  }
+
+  private readBlob(): string {
+    this.pos += 2
+    this.skipWhitespace()
+    if (this.text[this.pos] === '"' || this.text[this.pos] === "'") {
+      this.fail('clobs are not supported')
+    }
+    const end = this.text.indexOf('}}', this.pos)
+    if (end === -1) this.fail('unterminated blob')
+    const base64 = this.text.slice(this.pos, end).replace(/\s+/g, '')
+    if (!BASE64.test(base64)) this.fail('invalid base64 in blob')
+    this.pos = end + 2
+    return base64
+  }
+
+  // Adjacent '''long strings''' are one string
+  private readLongStrings(): string {
+    let value = ''
+    do {
+      value += this.readQuoted("'''")
+      this.skipWhitespace()
+    } while (this.text.startsWith("'''", this.pos))
+    return value
+  }
+
+  private readQuoted(quote: string): string {
+    let value = ''
+    this.pos += quote.length
+    for (;;) {
+      if (this.text.startsWith(quote, this.pos)) {
+        this.pos += quote.length
+        return value
+      }
+      const char = this.text[this.pos++]
+      if (char === undefined || (char === '\n' && quote.length === 1)) {
+        this.fail('unterminated string')
+      }
+      value += char === '\\' ? this.readEscape() : char
+    }
+  }
+
+  private readEscape(): string {
+    const char = this.text[this.pos++]
+    switch (char) {
+      case 'a':
+        return '\x07'
+      case 'b':
+        return '\b'
+      case 't':
+        return '\t'
+      case 'n':
+        return '\n'
+      case 'f':
+        return '\f'
+      case 'r':
+        return '\r'
+      case 'v':
+        return '\v'
+      case '0':
+        return '\0'
+      case '?':
+      case '/':
+      case "'":
+      case '"':
+      case '\\':
+        return char
+      case 'x':
+        return this.readCodePoint(2)
+      case 'u':
+        return this.readCodePoint(4)
+      case 'U':
+        return this.readCodePoint(8)
+      // A backslash before a newline continues the string on the next line
+      case '\r':
+        if (this.text[this.pos] === '\n') this.pos++
+        return ''
+      case '\n':
+        return ''
+    }
+    this.fail(`invalid escape \\${char ?? ''}`)
+  }
+
+  private readCodePoint(digits: number): string {
+    const hex = this.text.slice(this.pos, this.pos + digits)
+    if (hex.length !== digits || !/^[0-9A-Fa-f]+$/.test(hex)) {
+      this.fail('invalid escape')
+    }
+    this.pos += digits
+    return String.fromCodePoint(parseInt(hex, 16))
+  }
+
+  private readNumber(): string {
+    const start = this.pos
+    while (
+      this.pos < this.text.length &&
+      NUMBER_PART.test(this.text[this.pos]!)
+    ) {
+      this.pos++
+    }
+    const token = this.text.slice(start, this.pos)
+    if (token === '+inf' || token === '-inf') {
+      this.fail('DynamoDB numbers must be finite')
+    }
+    if (TIMESTAMP.test(token)) this.fail('timestamps are not supported')
+    const number = ionNumber(token.replaceAll('_', ''))
+    if (number === undefined) this.fail(`invalid number ${token}`)
+    return number
+  }
+
+  private fail(message: string): never {
+    throw new Error(`Invalid Ion at offset ${this.pos}: ${message}`)
+  }
+}
+
+// Ion ints, decimals and floats as DynamoDB number text: hex and binary ints
+// in decimal, and the d exponent of decimals as E
+function ionNumber(token: string): string | undefined {
+  if (/^-?0([xX][0-9a-fA-F]+|[bB][01]+)$/.test(token)) {
+    const negative = token.startsWith('-')
+    const value = BigInt(negative ? token.slice(1) : token)
+    return (negative ? -value : value).toString()
+  }
+  const match = /^(-?(?:0|[1-9]\d*))(\.\d*)?(?:[dDeE]([+-]?\d+))?$/.exec(token)
+  if (!match) return undefined
+  const [, whole = '', fraction = '', exponent] = match
+  const mantissa = fraction === '.' ? whole : `${whole}${fraction}`
+  return exponent === undefined ? mantissa : `${mantissa}E${exponent}`
+}
@@ -2,14 +2,30 @@
 // In DO architecture, this would be a single Durable Object
 
 import { Database } from 'bun:sqlite'
-import type { KeySchemaElement } from '@aws-sdk/client-dynamodb'
-import type { DynamoDBItem, TableSchema } from './types.ts'
+import type { BillingMode, KeySchemaElement } from '@aws-sdk/client-dynamodb'
+import type {
+  ContributorInsightsSetting,
+  DynamoDBItem,
+  KinesisDestination,
+  TableSchema,
+} from './types.ts'
 import * as fs from 'fs'
 
 interface TableSchemaRow {
   table_name: string
   key_schema: string
   attribute_definitions: string
+  global_secondary_indexes: string | null
+  local_secondary_indexes: string | null
+  sse_specification: string | null
+  billing_mode: string | null
+  ttl_attribute: string | null
+  stream_specification: string | null
+  stream_label: string | null
+  pitr_enabled_at: number | null
+  tags: string | null
+  kinesis_destinations: string | null
+  contributor_insights: string | null
   created_at: number
 }
 
@@ -26,8 +42,12 @@ function ensureAttributeName(
 export class MetadataStore {
   private db: Database
   private cache: Map<string, TableSchema> = new Map()
+  private tableLocks: Map<string, Promise<unknown>> = new Map()
+  private maxTables: number
+
+  constructor(dataDir: string, maxTables: number = Infinity) {
+    this.maxTables = maxTables
 
-  constructor(dataDir: string) {
     // Create data directory if it doesn't exist
     if (!fs.existsSync(dataDir)) {
       fs.mkdirSync(dataDir, { recursive: true })
@@ -44,11 +64,42 @@ export class MetadataStore {
         created_at INTEGER NOT NULL
       )
     `)
+    this.addColumnIfMissing('global_secondary_indexes', 'TEXT')
+    this.addColumnIfMissing('local_secondary_indexes', 'TEXT')
+    this.addColumnIfMissing('sse_specification', 'TEXT')
+    this.addColumnIfMissing('billing_mode', 'TEXT')
+    this.addColumnIfMissing('ttl_attribute', 'TEXT')
+    this.addColumnIfMissing('stream_specification', 'TEXT')
+    this.addColumnIfMissing('stream_label', 'TEXT')
+    this.addColumnIfMissing('pitr_enabled_at', 'INTEGER')
+    this.addColumnIfMissing('tags', 'TEXT')
+    this.addColumnIfMissing('kinesis_destinations', 'TEXT')
+    this.addColumnIfMissing('contributor_insights', 'TEXT')
+
+    // Storage settings that must not change between restarts
+    this.db.run(`
+      CREATE TABLE IF NOT EXISTS settings (
+        key TEXT PRIMARY KEY,
+        value TEXT NOT NULL
+      )
+    `)
 
     // Load all schemas into cache
     this.loadSchemas()
   }
 
+  // Upgrades metadata files written by older versions in place
+  private addColumnIfMissing(column: string, definition: string) {
+    const columns = this.db
+      .query<{ name: string }, []>('PRAGMA table_info(table_schemas)')
+      .all()
+    if (!columns.some((c) => c.name === column)) {
+      this.db.run(
+        `ALTER TABLE table_schemas ADD COLUMN ${column} ${definition}`
+      )
+    }
+  }
+
   private loadSchemas() {
     const schemas = this.db
       .query<TableSchemaRow, []>('SELECT * FROM table_schemas')
@@ -59,37 +110,285 @@ export class MetadataStore {
         tableName: schema.table_name,
         keySchema: JSON.parse(schema.key_schema),
         attributeDefinitions: JSON.parse(schema.attribute_definitions),
+        globalSecondaryIndexes: schema.global_secondary_indexes
+          ? JSON.parse(schema.global_secondary_indexes)
+          : undefined,
+        localSecondaryIndexes: schema.local_secondary_indexes
+          ? JSON.parse(schema.local_secondary_indexes)
+          : undefined,
+        sseSpecification: schema.sse_specification
+          ? JSON.parse(schema.sse_specification)
+          : undefined,
+        billingMode: (schema.billing_mode as BillingMode | null) ?? undefined,
+        timeToLiveAttribute: schema.ttl_attribute ?? undefined,
+        streamSpecification: schema.stream_specification
+          ? JSON.parse(schema.stream_specification)
+          : undefined,
+        latestStreamLabel: schema.stream_label ?? undefined,
+        pointInTimeRecoveryEnabledAt: schema.pitr_enabled_at ?? undefined,
+        tags: schema.tags ? JSON.parse(schema.tags) : undefined,
+        kinesisDestinations: schema.kinesis_destinations
+          ? JSON.parse(schema.kinesis_destinations)
+          : undefined,
+        contributorInsights: schema.contributor_insights
+          ? JSON.parse(schema.contributor_insights)
+          : undefined,
+        createdAt: schema.created_at,
       })
     }
   }
 
-  async createTable(schema: TableSchema): Promise<void> {
-    if (this.cache.has(schema.tableName)) {
-      throw new Error(`Table already exists: ${schema.tableName}`)
+  // Serializes table lifecycle operations (create/delete) per table name so
+  // concurrent callers observe them strictly before or after each other
+  async withTableLock<T>(tableName: string, fn: () => Promise<T>): Promise<T> {
+    const previous = this.tableLocks.get(tableName) ?? Promise.resolve()
+    const current = previous.catch(() => {}).then(fn)
+    this.tableLocks.set(tableName, current)
+    try {
+      return await current
+    } finally {
+      if (this.tableLocks.get(tableName) === current) {
+        this.tableLocks.delete(tableName)
+      }
+    }
+  }
+
+  // Throws the error createTable would for a table of this name
+  assertCanCreateTable(tableName: string): void {
+    if (this.cache.has(tableName)) {
+      throw {
+        name: 'ResourceInUseException',
+        message: `Table already exists: ${tableName}`,
+      }
+    }
+    if (this.cache.size >= this.maxTables) {
+      throw {
+        name: 'LimitExceededException',
+        message: `Subscriber limit exceeded: only ${this.maxTables} tables can be created`,
+      }
     }
+  }
+
+  async createTable(schema: TableSchema): Promise<void> {
+    this.assertCanCreateTable(schema.tableName)
 
     const keySchemaJson = JSON.stringify(schema.keySchema)
     const attrDefsJson = JSON.stringify(schema.attributeDefinitions)
+    const gsiJson = schema.globalSecondaryIndexes
+      ? JSON.stringify(schema.globalSecondaryIndexes)
+      : null
+    const lsiJson = schema.localSecondaryIndexes
+      ? JSON.stringify(schema.localSecondaryIndexes)
+      : null
+    const sseJson = schema.sseSpecification
+      ? JSON.stringify(schema.sseSpecification)
+      : null
+    const streamJson = schema.streamSpecification
+      ? JSON.stringify(schema.streamSpecification)
+      : null
+    const tagsJson = schema.tags ? JSON.stringify(schema.tags) : null
+
+    const createdAt = Date.now()
 
     this.db.run(
       `INSERT INTO table_schemas
-       (table_name, key_schema, attribute_definitions, created_at)
-       VALUES (?, ?, ?, ?)`,
-      [schema.tableName, keySchemaJson, attrDefsJson, Date.now()]
+       (table_name, key_schema, attribute_definitions, global_secondary_indexes,
+        local_secondary_indexes, sse_specification, billing_mode,
+        stream_specification, stream_label, tags, created_at)
+       VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+      [
+        schema.tableName,
+        keySchemaJson,
+        attrDefsJson,
+        gsiJson,
+        lsiJson,
+        sseJson,
+        schema.billingMode ?? null,
+        streamJson,
+        schema.latestStreamLabel ?? null,
+        tagsJson,
+        createdAt,
+      ]
     )
 
-    this.cache.set(schema.tableName, schema)
+    this.cache.set(schema.tableName, { ...schema, createdAt })
+  }
+
+  // Replaces the attribute definitions, GSIs, and stream settings of an
+  // existing table
+  async updateTable(schema: TableSchema): Promise<void> {
+    const existing = this.cache.get(schema.tableName)
+    if (!existing) {
+      throw {
+        name: 'ResourceNotFoundException',
+        message: `Requested resource not found: Table: ${schema.tableName} not found`,
+      }
+    }
+    const globalSecondaryIndexes = schema.globalSecondaryIndexes?.length
+      ? schema.globalSecondaryIndexes
+      : undefined
+
+    this.db.run(
+      `UPDATE table_schemas
+       SET attribute_definitions = ?, global_secondary_indexes = ?,
+           stream_specification = ?, stream_label = ?
+       WHERE table_name = ?`,
+      [
+        JSON.stringify(schema.attributeDefinitions),
+        globalSecondaryIndexes ? JSON.stringify(globalSecondaryIndexes) : null,
+        schema.streamSpecification
+          ? JSON.stringify(schema.streamSpecification)
+          : null,
+        schema.latestStreamLabel ?? null,
+        schema.tableName,
+      ]
+    )
+    this.cache.set(schema.tableName, {
+      ...existing,
+      attributeDefinitions: schema.attributeDefinitions,
+      globalSecondaryIndexes,
+      streamSpecification: schema.streamSpecification,
+      latestStreamLabel: schema.latestStreamLabel,
+    })
+  }
+
+  // Enables TTL on attributeName, or disables it when undefined
+  async setTimeToLive(
+    tableName: string,
+    attributeName: string | undefined
+  ): Promise<void> {
+    const existing = this.cache.get(tableName)
+    if (!existing) {
+      throw {
+        name: 'ResourceNotFoundException',
+        message: `Requested resource not found: Table: ${tableName} not found`,
+      }
+    }
+    this.db.run(
+      'UPDATE table_schemas SET ttl_attribute = ? WHERE table_name = ?',
+      [attributeName ?? null, tableName]
+    )
+    this.cache.set(tableName, {
+      ...existing,
+      timeToLiveAttribute: attributeName,
+    })
+  }
+
+  // Records when point-in-time recovery was enabled, or disables it when
+  // undefined
+  async setPointInTimeRecovery(
+    tableName: string,
+    enabledAt: number | undefined
+  ): Promise<void> {
+    const existing = this.cache.get(tableName)
+    if (!existing) {
+      throw {
+        name: 'ResourceNotFoundException',
+        message: `Requested resource not found: Table: ${tableName} not found`,
+      }
+    }
+    this.db.run(
+      'UPDATE table_schemas SET pitr_enabled_at = ? WHERE table_name = ?',
+      [enabledAt ?? null, tableName]
+    )
+    this.cache.set(tableName, {
+      ...existing,
+      pointInTimeRecoveryEnabledAt: enabledAt,
+    })
+  }
+
+  // Replaces the table's tags
+  async setTags(tableName: string, tags: Record<string, string>) {
+    const existing = this.cache.get(tableName)
+    if (!existing) {
+      throw {
+        name: 'ResourceNotFoundException',
+        message: `Requested resource not found: Table: ${tableName} not found`,
+      }
+    }
+    this.db.run('UPDATE table_schemas SET tags = ? WHERE table_name = ?', [
+      JSON.stringify(tags),
+      tableName,
+    ])
+    this.cache.set(tableName, { ...existing, tags })
+  }
+
+  // Replaces the table's Kinesis streaming destinations
+  async setKinesisDestinations(
+    tableName: string,
+    destinations: KinesisDestination[]
+  ) {
+    const existing = this.cache.get(tableName)
+    if (!existing) {
+      throw {
+        name: 'ResourceNotFoundException',
+        message: `Requested resource not found: Table: ${tableName} not found`,
+      }
+    }
+    this.db.run(
+      'UPDATE table_schemas SET kinesis_destinations = ? WHERE table_name = ?',
+      [JSON.stringify(destinations), tableName]
+    )
+    this.cache.set(tableName, {
+      ...existing,
+      kinesisDestinations: destinations,
+    })
+  }
+
+  // Replaces the table's Contributor Insights settings
+  async setContributorInsights(
+    tableName: string,
+    settings: ContributorInsightsSetting[]
+  ) {
+    const existing = this.cache.get(tableName)
+    if (!existing) {
+      throw {
+        name: 'ResourceNotFoundException',
+        message: `Requested resource not found: Table: ${tableName} not found`,
+      }
+    }
+    this.db.run(
+      'UPDATE table_schemas SET contributor_insights = ? WHERE table_name = ?',
+      [JSON.stringify(settings), tableName]
+    )
+    this.cache.set(tableName, { ...existing, contributorInsights: settings })
+  }
+
+  // Number of shards items in this data directory are hashed across, or
+  // undefined if no shard count has been recorded yet
+  getShardCount(): number | undefined {
+    const row = this.db
+      .query<
+        { value: string },
+        []
+      >(`SELECT value FROM settings WHERE key = 'shard_count'`)
+      .get()
+    return row ? parseInt(row.value) : undefined
+  }
+
+  setShardCount(shardCount: number): void {
+    this.db.run(
+      `INSERT OR REPLACE INTO settings (key, value) VALUES ('shard_count', ?)`,
+      [String(shardCount)]
+    )
   }
 
   async describeTable(tableName: string): Promise<TableSchema | null> {
     return this.cache.get(tableName) || null
   }
 
+  // Sorted, so ListTables pages are stable across creation order and restarts
   async listTables(): Promise<string[]> {
-    return Array.from(this.cache.keys())
+    return Array.from(this.cache.keys()).sort()
   }
 
   async deleteTable(tableName: string): Promise<void> {
+    if (!this.cache.has(tableName)) {
+      throw {
+        name: 'ResourceNotFoundException',
+        message: `Requested resource not found: Table: ${tableName} not found`,
+      }
+    }
     this.db.run('DELETE FROM table_schemas WHERE table_name = ?', [tableName])
     this.cache.delete(tableName)
   }
@@ -0,0 +1,1065 @@
+// PartiQL statements for ExecuteStatement
+// Statements compile to the equivalent item operation (Query, Scan, PutItem,
+// UpdateItem or DeleteItem), whose expressions the expression parser
+// evaluates, so PartiQL and the item APIs share one set of semantics
+
+import { createHash } from 'crypto'
+import type {
+  AttributeValue,
+  DeleteItemCommandInput,
+  KeySchemaElement,
+  PutItemCommandInput,
+  QueryCommandInput,
+  ReturnValue,
+  ScanCommandInput,
+  TransactGetItem,
+  TransactWriteItem,
+  UpdateItemCommandInput,
+} from '@aws-sdk/client-dynamodb'
+import { findIndex } from './indexes.ts'
+import type { DynamoDBItem, TableSchema } from './types.ts'
+
+type TokenType =
+  | 'identifier'
+  | 'quoted' // "double quoted" identifier
+  | 'string'
+  | 'number'
+  | 'parameter'
+  | 'symbol'
+  | 'end'
+
+interface Token {
+  type: TokenType
+  text: string
+  // The bound value of a ? parameter
+  value?: AttributeValue
+}
+
+export type Statement =
+  | {
+      kind: 'select'
+      tableName: string
+      indexName?: string
+      projection: Token[][] // Empty for SELECT *
+      where: Token[]
+      orderBy?: { path: Token[]; descending: boolean }
+    }
+  | { kind: 'insert'; tableName: string; value: Token[] }
+  | {
+      kind: 'update'
+      tableName: string
+      set: Array<{ path: Token[]; value: Token[] }>
+      remove: Token[][]
+      where: Token[]
+      returnValues?: ReturnValue
+    }
+  | {
+      kind: 'delete'
+      tableName: string
+      where: Token[]
+      returnValues?: ReturnValue
+    }
+  // EXISTS(SELECT ...) checks a condition inside ExecuteTransaction
+  | { kind: 'exists'; tableName: string; select: SelectStatement }
+
+type SelectStatement = Extract<Statement, { kind: 'select' }>
+
+// The item operation a statement runs as, with its request
+export type CompiledStatement =
+  | { operation: 'Query'; input: QueryCommandInput }
+  | { operation: 'Scan'; input: ScanCommandInput }
+  | { operation: 'PutItem'; input: PutItemCommandInput }
+  | { operation: 'UpdateItem'; input: UpdateItemCommandInput }
+  | { operation: 'DeleteItem'; input: DeleteItemCommandInput }
+
+function malformed(detail: string) {
+  return {
+    name: 'ValidationException',
+    message: `Statement wasn't well formed, can't be processed: ${detail}`,
+  }
+}
+
+const END: Token = { type: 'end', text: '<end>' }
+
+const SYMBOLS = [
+  '<<',
+  '>>',
+  '<=',
+  '>=',
+  '<>',
+  '!=',
+  '=',
+  '<',
+  '>',
+  '(',
+  ')',
+  '[',
+  ']',
+  '{',
+  '}',
+  ',',
+  '.',
+  ':',
+  '*',
+  '+',
+  '-',
+  ';',
+]
+
+/**
+ * Split a statement into tokens, binding each ? to the next parameter.
+ * A parameter count that does not match the placeholders is rejected.
+ */
+function tokenize(statement: string, parameters: AttributeValue[]): Token[] {
+  const tokens: Token[] = []
+  let parameterCount = 0
+  let i = 0
+
+  while (i < statement.length) {
+    const char = statement[i]!
+    if (/\s/.test(char)) {
+      i++
+      continue
+    }
+
+    if (char === "'" || char === '"') {
+      // Quotes are escaped by doubling them, as in SQL
+      let text = ''
+      let j = i + 1
+      for (;;) {
+        if (j >= statement.length) {
+          throw malformed(`unterminated quote at position ${i}`)
+        }
+        if (statement[j] === char) {
+          if (statement[j + 1] !== char) break
+          j++
+        }
+        text += statement[j]
+        j++
+      }
+      tokens.push({ type: char === "'" ? 'string' : 'quoted', text })
+      i = j + 1
+      continue
+    }
+
+    const number = /^\d+(\.\d+)?([eE][+-]?\d+)?/.exec(statement.slice(i))
+    if (number) {
+      tokens.push({ type: 'number', text: number[0] })
+      i += number[0].length
+      continue
+    }
+
+    const identifier = /^[A-Za-z_][A-Za-z0-9_]*/.exec(statement.slice(i))
+    if (identifier) {
+      tokens.push({ type: 'identifier', text: identifier[0] })
+      i += identifier[0].length
+      continue
+    }
+
+    if (char === '?') {
+      tokens.push({
+        type: 'parameter',
+        text: '?',
+        value: parameters[parameterCount++],
+      })
+      i++
+      continue
+    }
+
+    const symbol = SYMBOLS.find((s) => statement.startsWith(s, i))
+    if (!symbol) {
+      throw malformed(`unexpected character '${char}' at position ${i}`)
+    }
+    tokens.push({ type: 'symbol', text: symbol })
+    i += symbol.length
+  }
+
+  if (parameterCount !== parameters.length) {
+    throw {
+      name: 'ValidationException',
+      message: "Number of parameters in request and statement don't match.",
+    }
+  }
+  // A trailing semicolon is allowed
+  if (tokens[tokens.length - 1]?.text === ';') tokens.pop()
+  tokens.push(END)
+  return tokens
+}
+
+function isKeyword(token: Token | undefined, ...words: string[]): boolean {
+  return (
+    token?.type === 'identifier' && words.includes(token.text.toUpperCase())
+  )
+}
+
+function isSymbol(token: Token | undefined, ...symbols: string[]): boolean {
+  return token?.type === 'symbol' && symbols.includes(token.text)
+}
+
+const OPENERS = ['(', '[', '{', '<<']
+const CLOSERS = [')', ']', '}', '>>']
+// Symbols that carry over into DynamoDB expressions; '-' is also a sign
+const OPERATORS = ['(', ')', ',', '=', '<', '<=', '>', '>=', '<>', '!=', '+']
+
+class Cursor {
+  private position = 0
+
+  constructor(private tokens: Token[]) {}
+
+  peek(offset = 0): Token {
+    return this.tokens[
+      Math.min(this.position + offset, this.tokens.length - 1)
+    ]!
+  }
+
+  next(): Token {
+    const token = this.peek()
+    if (token.type !== 'end') this.position++
+    return token
+  }
+
+  atEnd(): boolean {
+    return this.peek().type === 'end'
+  }
+
+  expectKeyword(word: string): void {
+    const token = this.next()
+    if (!isKeyword(token, word)) {
+      throw malformed(`expected ${word} but found '${token.text}'`)
+    }
+  }
+
+  expectSymbol(symbol: string): void {
+    const token = this.next()
+    if (!isSymbol(token, symbol)) {
+      throw malformed(`expected '${symbol}' but found '${token.text}'`)
+    }
+  }
+
+  // Tokens up to, not including, a keyword or symbol at nesting depth 0
+  takeUntil(keywords: string[], symbols: string[] = []): Token[] {
+    const taken: Token[] = []
+    let depth = 0
+    while (!this.atEnd()) {
+      const token = this.peek()
+      if (
+        depth === 0 &&
+        (isKeyword(token, ...keywords) || isSymbol(token, ...symbols))
+      ) {
+        break
+      }
+      if (isSymbol(token, ...OPENERS)) depth++
+      if (isSymbol(token, ...CLOSERS)) depth--
+      taken.push(this.next())
+    }
+    return taken
+  }
+}
+
+// A table or index name, bare or double quoted
+function parseName(cursor: Cursor): string {
+  const token = cursor.next()
+  if (token.type !== 'identifier' && token.type !== 'quoted') {
+    throw malformed(`expected a name but found '${token.text}'`)
+  }
+  return token.text
+}
+
+function parseTableRef(cursor: Cursor): {
+  tableName: string
+  indexName?: string
+} {
+  const tableName = parseName(cursor)
+  if (!isSymbol(cursor.peek(), '.')) return { tableName }
+  cursor.next()
+  return { tableName, indexName: parseName(cursor) }
+}
+
+function nonEmpty(tokens: Token[], clause: string): Token[] {
+  if (tokens.length === 0) {
+    throw malformed(`${clause} must not be empty`)
+  }
+  return tokens
+}
+
+// RETURNING (ALL | MODIFIED) (OLD | NEW) *
+function parseReturning(cursor: Cursor): ReturnValue | undefined {
+  if (!isKeyword(cursor.peek(), 'RETURNING')) return undefined
+  cursor.next()
+  const scope = cursor.next()
+  const image = cursor.next()
+  if (
+    !isKeyword(scope, 'ALL', 'MODIFIED') ||
+    !isKeyword(image, 'OLD', 'NEW')
+  ) {
+    throw malformed(
+      'RETURNING must be ALL OLD, ALL NEW, MODIFIED OLD or MODIFIED NEW'
+    )
+  }
+  cursor.expectSymbol('*')
+  const prefix = isKeyword(scope, 'ALL') ? 'ALL' : 'UPDATED'
+  return `${prefix}_${image.text.toUpperCase()}` as ReturnValue
+}
+
+function expectEnd(cursor: Cursor): void {
+  if (!cursor.atEnd()) {
+    throw malformed(`unexpected '${cursor.peek().text}'`)
+  }
+}
+
+// The rest of a SELECT, after the SELECT keyword
+function parseSelect(cursor: Cursor): SelectStatement {
+  const projection: Token[][] = []
+  if (isSymbol(cursor.peek(), '*')) {
+    cursor.next()
+  } else {
+    do {
+      projection.push(nonEmpty(cursor.takeUntil(['FROM'], [',']), 'SELECT'))
+    } while (isSymbol(cursor.peek(), ',') && cursor.next())
+  }
+  cursor.expectKeyword('FROM')
+  const tableRef = parseTableRef(cursor)
+  let where: Token[] = []
+  if (isKeyword(cursor.peek(), 'WHERE')) {
+    cursor.next()
+    where = nonEmpty(cursor.takeUntil(['ORDER']), 'WHERE')
+  }
+  let orderBy: { path: Token[]; descending: boolean } | undefined
+  if (isKeyword(cursor.peek(), 'ORDER')) {
+    cursor.next()
+    cursor.expectKeyword('BY')
+    const path = nonEmpty(cursor.takeUntil(['ASC', 'DESC']), 'ORDER BY')
+    const descending = isKeyword(cursor.peek(), 'DESC')
+    if (isKeyword(cursor.peek(), 'ASC', 'DESC')) cursor.next()
+    orderBy = { path, descending }
+  }
+  expectEnd(cursor)
+  return { kind: 'select', ...tableRef, projection, where, orderBy }
+}
+
+/**
+ * Parse a SELECT, INSERT, UPDATE, DELETE or EXISTS statement, binding its ?
+ * placeholders to parameters in order.
+ */
+export function parseStatement(
+  statement: string,
+  parameters: AttributeValue[] = []
+): Statement {
+  const cursor = new Cursor(tokenize(statement, parameters))
+  const verb = cursor.next()
+
+  if (isKeyword(verb, 'SELECT')) return parseSelect(cursor)
+
+  if (isKeyword(verb, 'EXISTS')) {
+    cursor.expectSymbol('(')
+    const inner = new Cursor([...cursor.takeUntil([], [')']), END])
+    cursor.expectSymbol(')')
+    expectEnd(cursor)
+    inner.expectKeyword('SELECT')
+    const select = parseSelect(inner)
+    return { kind: 'exists', tableName: select.tableName, select }
+  }
+
+  if (isKeyword(verb, 'INSERT')) {
+    cursor.expectKeyword('INTO')
+    const tableName = parseName(cursor)
+    cursor.expectKeyword('VALUE')
+    const value = nonEmpty(cursor.takeUntil([]), 'VALUE')
+    return { kind: 'insert', tableName, value }
+  }
+
+  if (isKeyword(verb, 'UPDATE')) {
+    const tableName = parseName(cursor)
+    const set: Array<{ path: Token[]; value: Token[] }> = []
+    const remove: Token[][] = []
+    const clauses = ['SET', 'REMOVE', 'WHERE']
+    while (isKeyword(cursor.peek(), 'SET', 'REMOVE')) {
+      const clause = cursor.next()
+      do {
+        if (isKeyword(clause, 'SET')) {
+          const path = nonEmpty(cursor.takeUntil(clauses, ['=']), 'SET')
+          cursor.expectSymbol('=')
+          const value = nonEmpty(cursor.takeUntil(clauses, [',']), 'SET')
+          set.push({ path, value })
+        } else {
+          remove.push(nonEmpty(cursor.takeUntil(clauses, [',']), 'REMOVE'))
+        }
+      } while (isSymbol(cursor.peek(), ',') && cursor.next())
+    }
+    if (set.length === 0 && remove.length === 0) {
+      throw malformed('UPDATE requires a SET or REMOVE clause')
+    }
+    cursor.expectKeyword('WHERE')
+    const where = nonEmpty(cursor.takeUntil(['RETURNING']), 'WHERE')
+    const returnValues = parseReturning(cursor)
+    expectEnd(cursor)
+    return { kind: 'update', tableName, set, remove, where, returnValues }
+  }
+
+  if (isKeyword(verb, 'DELETE')) {
+    cursor.expectKeyword('FROM')
+    const tableName = parseName(cursor)
+    cursor.expectKeyword('WHERE')
+    const where = nonEmpty(cursor.takeUntil(['RETURNING']), 'WHERE')
+    const returnValues = parseReturning(cursor)
+    if (returnValues && returnValues !== 'ALL_OLD') {
+      throw malformed('DELETE only supports RETURNING ALL OLD *')
+    }
+    expectEnd(cursor)
+    return { kind: 'delete', tableName, where, returnValues }
+  }
+
+  throw malformed(`unsupported statement '${verb.text}'`)
+}
+
+// Parse a literal or bound parameter into an AttributeValue
+function parseValue(cursor: Cursor): AttributeValue {
+  const token = cursor.next()
+  switch (token.type) {
+    case 'string':
+      return { S: token.text }
+    case 'number':
+      return { N: token.text }
+    case 'parameter':
+      return token.value!
+  }
+
+  if (isKeyword(token, 'TRUE', 'FALSE')) {
+    return { BOOL: token.text.toUpperCase() === 'TRUE' }
+  }
+  if (isKeyword(token, 'NULL')) {
+    return { NULL: true }
+  }
+  if (isSymbol(token, '-') && cursor.peek().type === 'number') {
+    return { N: `-${cursor.next().text}` }
+  }
+  if (isSymbol(token, '[')) {
+    return { L: parseValueList(cursor, ']') }
+  }
+  if (isSymbol(token, '<<')) {
+    return toSet(parseValueList(cursor, '>>'))
+  }
+  if (isSymbol(token, '{')) {
+    const map: Record<string, AttributeValue> = {}
+    if (!isSymbol(cursor.peek(), '}')) {
+      do {
+        const key = cursor.next()
+        if (key.type !== 'string' && key.type !== 'quoted') {
+          throw malformed(`expected a map key but found '${key.text}'`)
+        }
+        cursor.expectSymbol(':')
+        map[key.text] = parseValue(cursor)
+      } while (isSymbol(cursor.peek(), ',') && cursor.next())
+    }
+    cursor.expectSymbol('}')
+    return { M: map }
+  }
+  throw malformed(`expected a value but found '${token.text}'`)
+}
+
+function parseValueList(cursor: Cursor, closer: string): AttributeValue[] {
+  const values: AttributeValue[] = []
+  if (!isSymbol(cursor.peek(), closer)) {
+    do {
+      values.push(parseValue(cursor))
+    } while (isSymbol(cursor.peek(), ',') && cursor.next())
+  }
+  cursor.expectSymbol(closer)
+  return values
+}
+
+// Set literals take their type from their elements, which must agree
+function toSet(values: AttributeValue[]): AttributeValue {
+  if (values.length > 0 && values.every((value) => value.S !== undefined)) {
+    return { SS: values.map((value) => value.S!) }
+  }
+  if (values.length > 0 && values.every((value) => value.N !== undefined)) {
+    return { NS: values.map((value) => value.N!) }
+  }
+  if (values.length > 0 && values.every((value) => value.B !== undefined)) {
+    return { BS: values.map((value) => value.B!) }
+  }
+  throw {
+    name: 'ValidationException',
+    message:
+      'A set must have at least one element, and every element must be a string, number or binary of the same type',
+  }
+}
+
+function parseSingleValue(tokens: Token[]): AttributeValue {
+  const cursor = new Cursor([...tokens, END])
+  const value = parseValue(cursor)
+  expectEnd(cursor)
+  return value
+}
+
+/**
+ * Accumulates the ExpressionAttributeNames and ExpressionAttributeValues
+ * of the expressions a statement compiles to, and translates PartiQL
+ * expressions into DynamoDB expression syntax.
+ */
+class ExpressionBuilder {
+  names: Record<string, string> = {}
+  values: Record<string, AttributeValue> = {}
+
+  name(attributeName: string): string {
+    const existing = Object.entries(this.names).find(
+      ([, name]) => name === attributeName
+    )
+    if (existing) return existing[0]
+    const alias = `#n${Object.keys(this.names).length}`
+    this.names[alias] = attributeName
+    return alias
+  }
+
+  value(value: AttributeValue): string {
+    const placeholder = `:v${Object.keys(this.values).length}`
+    this.values[placeholder] = value
+    return placeholder
+  }
+
+  // a.b[2]."c d", with every segment aliased
+  path(cursor: Cursor): string {
+    let path = this.name(parseName(cursor))
+    for (;;) {
+      if (isSymbol(cursor.peek(), '.')) {
+        cursor.next()
+        path += `.${this.name(parseName(cursor))}`
+      } else if (isSymbol(cursor.peek(), '[')) {
+        cursor.next()
+        const index = cursor.next()
+        if (index.type !== 'number' || !/^\d+$/.test(index.text)) {
+          throw malformed(`expected a list index but found '${index.text}'`)
+        }
+        cursor.expectSymbol(']')
+        path += `[${index.text}]`
+      } else {
+        return path
+      }
+    }
+  }
+
+  pathOnly(tokens: Token[]): string {
+    const cursor = new Cursor([...tokens, END])
+    const path = this.path(cursor)
+    expectEnd(cursor)
+    return path
+  }
+
+  // Translate a condition or SET operand; comparisons, AND/OR/NOT, BETWEEN,
+  // IN and function calls carry over, and IS [NOT] MISSING or NULL become
+  // attribute_exists and attribute_type checks
+  expression(tokens: Token[]): string {
+    const cursor = new Cursor([...tokens, END])
+    const parts: string[] = []
+    let expectOperand = true
+
+    while (!cursor.atEnd()) {
+      const token = cursor.peek()
+
+      if (isKeyword(token, 'AND', 'OR', 'NOT', 'BETWEEN')) {
+        parts.push(cursor.next().text.toUpperCase())
+        expectOperand = true
+      } else if (isKeyword(token, 'IN')) {
+        cursor.next()
+        const opener = cursor.next()
+        if (!isSymbol(opener, '[', '(')) {
+          throw malformed(`expected a list after IN, found '${opener.text}'`)
+        }
+        const values = parseValueList(cursor, opener.text === '[' ? ']' : ')')
+        parts.push(`IN (${values.map((v) => this.value(v)).join(', ')})`)
+        expectOperand = false
+      } else if (
+        isSymbol(token, ...OPERATORS) ||
+        (isSymbol(token, '-') && !expectOperand)
+      ) {
+        cursor.next()
+        parts.push(token.text === '!=' ? '<>' : token.text)
+        expectOperand = !isSymbol(token, ')')
+      } else if (
+        (token.type === 'identifier' || token.type === 'quoted') &&
+        !isKeyword(token, 'TRUE', 'FALSE', 'NULL')
+      ) {
+        if (token.type === 'identifier' && isSymbol(cursor.peek(1), '(')) {
+          // A function call; its arguments are translated as they come.
+          // PartiQL function names are case-insensitive, DynamoDB's are not.
+          parts.push(`${cursor.next().text.toLowerCase()}(`)
+          cursor.next()
+          expectOperand = true
+          continue
+        }
+        parts.push(this.isCheck(cursor, this.path(cursor)))
+        expectOperand = false
+      } else {
+        parts.push(this.value(parseValue(cursor)))
+        expectOperand = false
+      }
+    }
+    return parts.join(' ')
+  }
+
+  private isCheck(cursor: Cursor, path: string): string {
+    if (!isKeyword(cursor.peek(), 'IS')) return path
+    cursor.next()
+    const negated = isKeyword(cursor.peek(), 'NOT')
+    if (negated) cursor.next()
+    const kind = cursor.next()
+    if (isKeyword(kind, 'MISSING')) {
+      return negated
+        ? `attribute_exists(${path})`
+        : `attribute_not_exists(${path})`
+    }
+    if (isKeyword(kind, 'NULL')) {
+      const check = `attribute_type(${path}, ${this.value({ S: 'NULL' })})`
+      return negated ? `NOT ${check}` : check
+    }
+    throw malformed(`expected MISSING or NULL after IS, found '${kind.text}'`)
+  }
+}
+
+// The top-level conjuncts of a WHERE clause, or undefined when it has a
+// top-level OR and cannot be split
+function splitConjuncts(where: Token[]): Token[][] | undefined {
+  const conjuncts: Token[][] = [[]]
+  let depth = 0
+  let inBetween = false
+  for (const token of where) {
+    if (isSymbol(token, ...OPENERS)) depth++
+    if (isSymbol(token, ...CLOSERS)) depth--
+    if (depth === 0 && isKeyword(token, 'OR')) return undefined
+    if (depth === 0 && isKeyword(token, 'BETWEEN')) inBetween = true
+    if (depth === 0 && isKeyword(token, 'AND')) {
+      // The AND of BETWEEN x AND y belongs to the BETWEEN
+      if (inBetween) {
+        inBetween = false
+      } else {
+        conjuncts.push([])
+        continue
+      }
+    }
+    conjuncts[conjuncts.length - 1]!.push(token)
+  }
+  return conjuncts
+}
+
+// The value of `attributeName = value`, if that is the whole conjunct
+function equalityValue(
+  conjunct: Token[],
+  attributeName: string
+): AttributeValue | undefined {
+  const [name, operator, ...value] = conjunct
+  if (
+    (name?.type !== 'identifier' && name?.type !== 'quoted') ||
+    name.text !== attributeName ||
+    !isSymbol(operator, '=')
+  ) {
+    return undefined
+  }
+  try {
+    return parseSingleValue(value)
+  } catch {
+    return undefined
+  }
+}
+
+// Whether a conjunct is a key condition on the sort key
+function isSortKeyCondition(conjunct: Token[], attributeName: string) {
+  const [first, second, third] = conjunct
+  const names = (token: Token | undefined) =>
+    (token?.type === 'identifier' || token?.type === 'quoted') &&
+    token.text === attributeName
+  if (names(first)) {
+    return (
+      isSymbol(second, '=', '<', '<=', '>', '>=') ||
+      isKeyword(second, 'BETWEEN')
+    )
+  }
+  return (
+    first?.type === 'identifier' &&
+    first.text === 'begins_with' &&
+    isSymbol(second, '(') &&
+    names(third)
+  )
+}
+
+function keyAttribute(keySchema: KeySchemaElement[], type: 'HASH' | 'RANGE') {
+  return keySchema.find((key) => key.KeyType === type)?.AttributeName
+}
+
+/**
+ * Pick out the full primary key from a WHERE clause. UPDATE and DELETE
+ * write one item, so every key attribute needs an equality; the remaining
+ * conjuncts become the write's condition.
+ */
+function compileKey(
+  where: Token[],
+  schema: TableSchema,
+  builder: ExpressionBuilder
+): { key: DynamoDBItem; condition: string[] } {
+  const conjuncts = splitConjuncts(where) ?? []
+  const key: DynamoDBItem = {}
+  for (const { AttributeName } of schema.keySchema) {
+    const index = conjuncts.findIndex(
+      (conjunct) => equalityValue(conjunct, AttributeName!) !== undefined
+    )
+    if (index === -1) {
+      throw {
+        name: 'ValidationException',
+        message:
+          'Where clause does not contain a mandatory equality on all key attributes',
+      }
+    }
+    key[AttributeName!] = equalityValue(conjuncts[index]!, AttributeName!)!
+    conjuncts.splice(index, 1)
+  }
+  return {
+    key,
+    condition: conjuncts.map((c) => `(${builder.expression(c)})`),
+  }
+}
+
+function withExpressionMaps<T>(input: T, builder: ExpressionBuilder): T {
+  return {
+    ...input,
+    ...(Object.keys(builder.names).length > 0 && {
+      ExpressionAttributeNames: builder.names,
+    }),
+    ...(Object.keys(builder.values).length > 0 && {
+      ExpressionAttributeValues: builder.values,
+    }),
+  }
+}
+
+// Whether a SELECT reads one item: from the base table, with an equality
+// on every key attribute
+export function selectsOneItem(
+  statement: SelectStatement,
+  schema: TableSchema
+): boolean {
+  const conjuncts = splitConjuncts(statement.where)
+  return (
+    !statement.indexName &&
+    schema.keySchema.every(({ AttributeName }) =>
+      conjuncts?.some((c) => equalityValue(c, AttributeName!) !== undefined)
+    )
+  )
+}
+
+/**
+ * Compile a parsed statement into the item operation that runs it. A
+ * SELECT whose WHERE pins the partition key with an equality runs as a
+ * Query; any other SELECT runs as a Scan.
+ */
+export function compileStatement(
+  statement: Statement,
+  schema: TableSchema
+): CompiledStatement {
+  const builder = new ExpressionBuilder()
+  const hashKey = keyAttribute(schema.keySchema, 'HASH')!
+
+  switch (statement.kind) {
+    case 'select': {
+      const { tableName, indexName, where, orderBy } = statement
+      const index = indexName ? findIndex(schema, indexName) : undefined
+      const keySchema = index?.keySchema ?? schema.keySchema
+      const partitionKey = keyAttribute(keySchema, 'HASH')!
+      const sortKey = keyAttribute(keySchema, 'RANGE')
+      const conjuncts = where.length ? splitConjuncts(where) : undefined
+
+      const projection = statement.projection.length
+        ? statement.projection.map((path) => builder.pathOnly(path)).join(', ')
+        : undefined
+      const read = {
+        TableName: tableName,
+        ...(indexName && { IndexName: indexName }),
+        ...(projection && { ProjectionExpression: projection }),
+      }
+
+      const hashIndex =
+        conjuncts?.findIndex(
+          (conjunct) => equalityValue(conjunct, partitionKey) !== undefined
+        ) ?? -1
+      if (hashIndex === -1) {
+        if (orderBy) {
+          throw {
+            name: 'ValidationException',
+            message:
+              'Must have WHERE clause in the statement with an equality on the partition key when using ORDER BY clause',
+          }
+        }
+        const filter = where.length ? builder.expression(where) : undefined
+        return {
+          operation: 'Scan',
+          input: withExpressionMaps(
+            { ...read, ...(filter && { FilterExpression: filter }) },
+            builder
+          ),
+        }
+      }
+
+      const remaining = [...conjuncts!]
+      const keyConditions = remaining.splice(hashIndex, 1)
+      const sortIndex = sortKey
+        ? remaining.findIndex((c) => isSortKeyCondition(c, sortKey))
+        : -1
+      if (sortIndex !== -1) {
+        keyConditions.push(...remaining.splice(sortIndex, 1))
+      }
+      const [orderKey, ...rest] = orderBy?.path ?? []
+      if (orderBy && (rest.length > 0 || orderKey?.text !== sortKey)) {
+        throw {
+          name: 'ValidationException',
+          message: 'ORDER BY is only supported on the sort key',
+        }
+      }
+
+      const keyCondition = keyConditions
+        .map((c) => builder.expression(c))
+        .join(' AND ')
+      const filter = remaining
+        .map((c) => `(${builder.expression(c)})`)
+        .join(' AND ')
+      return {
+        operation: 'Query',
+        input: withExpressionMaps(
+          {
+            ...read,
+            KeyConditionExpression: keyCondition,
+            ...(filter && { FilterExpression: filter }),
+            ...(orderBy?.descending && { ScanIndexForward: false }),
+          },
+          builder
+        ),
+      }
+    }
+
+    case 'insert': {
+      const value = parseSingleValue(statement.value)
+      if (!value.M) {
+        throw {
+          name: 'ValidationException',
+          message: 'INSERT VALUE must be a map of attribute names to values',
+        }
+      }
+      return {
+        operation: 'PutItem',
+        input: withExpressionMaps(
+          {
+            TableName: statement.tableName,
+            Item: value.M,
+            // INSERT never overwrites; the caller maps this failure
+            ConditionExpression: `attribute_not_exists(${builder.name(
+              hashKey
+            )})`,
+          },
+          builder
+        ),
+      }
+    }
+
+    case 'update': {
+      const actions: Record<'SET' | 'REMOVE' | 'ADD' | 'DELETE', string[]> = {
+        SET: [],
+        REMOVE: [],
+        ADD: [],
+        DELETE: [],
+      }
+      for (const { path, value } of statement.set) {
+        const target = builder.pathOnly(path)
+        const [fn, open] = value
+        // set_add and set_delete are PartiQL's ADD and DELETE
+        if (
+          fn?.type === 'identifier' &&
+          ['set_add', 'set_delete'].includes(fn.text.toLowerCase()) &&
+          isSymbol(open, '(') &&
+          isSymbol(value[value.length - 1], ')')
+        ) {
+          const args = new Cursor([...value.slice(2, -1), END])
+          builder.path(args)
+          args.expectSymbol(',')
+          const operand = builder.value(parseValue(args))
+          expectEnd(args)
+          const action = fn.text.toLowerCase() === 'set_add' ? 'ADD' : 'DELETE'
+          actions[action].push(`${target} ${operand}`)
+        } else {
+          actions.SET.push(`${target} = ${builder.expression(value)}`)
+        }
+      }
+      for (const path of statement.remove) {
+        actions.REMOVE.push(builder.pathOnly(path))
+      }
+
+      const { key, condition } = compileKey(statement.where, schema, builder)
+      const updateExpression = Object.entries(actions)
+        .filter(([, list]) => list.length > 0)
+        .map(([clause, list]) => `${clause} ${list.join(', ')}`)
+        .join(' ')
+      return {
+        operation: 'UpdateItem',
+        input: withExpressionMaps(
+          {
+            TableName: statement.tableName,
+            Key: key,
+            UpdateExpression: updateExpression,
+            // UPDATE only modifies an item that exists
+            ConditionExpression: [
+              `attribute_exists(${builder.name(hashKey)})`,
+              ...condition,
+            ].join(' AND '),
+            ...(statement.returnValues && {
+              ReturnValues: statement.returnValues,
+            }),
+          },
+          builder
+        ),
+      }
+    }
+
+    case 'delete': {
+      const { key, condition } = compileKey(statement.where, schema, builder)
+      return {
+        operation: 'DeleteItem',
+        input: withExpressionMaps(
+          {
+            TableName: statement.tableName,
+            Key: key,
+            ...(condition.length > 0 && {
+              ConditionExpression: condition.join(' AND '),
+            }),
+            ...(statement.returnValues && {
+              ReturnValues: statement.returnValues,
+            }),
+          },
+          builder
+        ),
+      }
+    }
+
+    case 'exists':
+      throw {
+        name: 'ValidationException',
+        message: 'EXISTS is only supported in ExecuteTransaction',
+      }
+  }
+}
+
+/**
+ * Compile a statement into a TransactGetItems or TransactWriteItems entry.
+ * Every statement names one item: a SELECT becomes a Get, and EXISTS
+ * becomes a ConditionCheck that the item exists and matches the rest of
+ * its WHERE clause.
+ */
+export function compileTransactItem(
+  statement: Statement,
+  schema: TableSchema
+): TransactGetItem | TransactWriteItem {
+  const mustNameOneItem = {
+    name: 'ValidationException',
+    message:
+      'Where clause does not contain a mandatory equality on all key attributes',
+  }
+
+  switch (statement.kind) {
+    case 'select': {
+      const builder = new ExpressionBuilder()
+      const { key, condition } = compileKey(statement.where, schema, builder)
+      if (statement.indexName || condition.length > 0) throw mustNameOneItem
+      const projection = statement.projection
+        .map((path) => builder.pathOnly(path))
+        .join(', ')
+      return {
+        Get: {
+          TableName: statement.tableName,
+          Key: key,
+          ...(projection && { ProjectionExpression: projection }),
+          ...(Object.keys(builder.names).length > 0 && {
+            ExpressionAttributeNames: builder.names,
+          }),
+        },
+      }
+    }
+
+    case 'exists': {
+      const { select } = statement
+      if (select.indexName) throw mustNameOneItem
+      const builder = new ExpressionBuilder()
+      const { key, condition } = compileKey(select.where, schema, builder)
+      const hashKey = keyAttribute(schema.keySchema, 'HASH')!
+      return {
+        ConditionCheck: withExpressionMaps(
+          {
+            TableName: select.tableName,
+            Key: key,
+            ConditionExpression: [
+              `attribute_exists(${builder.name(hashKey)})`,
+              ...condition,
+            ].join(' AND '),
+          },
+          builder
+        ),
+      }
+    }
+  }
+
+  if (statement.kind !== 'insert' && statement.returnValues) {
+    throw {
+      name: 'ValidationException',
+      message: 'RETURNING is not supported in ExecuteTransaction',
+    }
+  }
+  const compiled = compileStatement(statement, schema)
+  switch (compiled.operation) {
+    case 'PutItem':
+      return { Put: compiled.input as TransactWriteItem['Put'] }
+    case 'UpdateItem':
+      return { Update: compiled.input as TransactWriteItem['Update'] }
+    case 'DeleteItem':
+      return { Delete: compiled.input as TransactWriteItem['Delete'] }
+  }
+  throw malformed(`unsupported statement '${statement.kind}'`)
+}
+
+// Scopes a NextToken to the statement and parameters that produced it
+function statementHash(statement: string, parameters: AttributeValue[]) {
+  return createHash('sha256')
+    .update(statement + JSON.stringify(parameters))
+    .digest('hex')
+}
+
+export function encodeNextToken(
+  statement: string,
+  parameters: AttributeValue[],
+  lastEvaluatedKey: DynamoDBItem
+): string {
+  return Buffer.from(
+    JSON.stringify({
+      v: 1,
+      statement: statementHash(statement, parameters),
+      lastEvaluatedKey,
+    })
+  ).toString('base64url')
+}
+
+// The ExclusiveStartKey a NextToken resumes from
+export function decodeNextToken(
+  token: string,
+  statement: string,
+  parameters: AttributeValue[]
+): DynamoDBItem {
+  let decoded: { v?: number; statement?: string; lastEvaluatedKey?: unknown }
+  try {
+    decoded = JSON.parse(Buffer.from(token, 'base64url').toString())
+  } catch {
+    decoded = {}
+  }
+  if (decoded?.v !== 1 || typeof decoded.lastEvaluatedKey !== 'object') {
+    throw { name: 'ValidationException', message: 'Invalid NextToken' }
+  }
+  if (decoded.statement !== statementHash(statement, parameters)) {
+    throw {
+      name: 'ValidationException',
+      message: 'The NextToken does not match the statement',
+    }
+  }
+  return decoded.lastEvaluatedKey as DynamoDBItem
+}
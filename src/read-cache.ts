@@ -0,0 +1,54 @@
+// LRU cache of serialized items, keyed by table and primary key
+
+/**
+ * Holds the stored JSON of recently read items so hot keys skip SQLite.
+ * Entries are strings, so every hit parses a fresh copy that the caller
+ * is free to mutate. A Map iterates in insertion order, so re-inserting
+ * on each hit keeps the least recently used entry first.
+ */
+export class ReadCache {
+  private entries = new Map<string, string>()
+
+  constructor(private capacity: number) {}
+
+  get(tableName: string, partitionKey: string, sortKey: string) {
+    const key = cacheKey(tableName, partitionKey, sortKey)
+    const itemData = this.entries.get(key)
+    if (itemData !== undefined) {
+      this.entries.delete(key)
+      this.entries.set(key, itemData)
+    }
+    return itemData
+  }
+
+  set(
+    tableName: string,
+    partitionKey: string,
+    sortKey: string,
+    itemData: string
+  ) {
+    const key = cacheKey(tableName, partitionKey, sortKey)
+    this.entries.delete(key)
+    this.entries.set(key, itemData)
+    if (this.entries.size > this.capacity) {
+      const oldest = this.entries.keys().next().value!
+      this.entries.delete(oldest)
+    }
+  }
+
+  invalidate(tableName: string, partitionKey: string, sortKey: string) {
+    this.entries.delete(cacheKey(tableName, partitionKey, sortKey))
+  }
+
+  clear() {
+    this.entries.clear()
+  }
+
+  get size(): number {
+    return this.entries.size
+  }
+}
+
+function cacheKey(tableName: string, partitionKey: string, sortKey: string) {
+  return JSON.stringify([tableName, partitionKey, sortKey])
+}
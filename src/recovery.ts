@@ -0,0 +1,167 @@
+// RecoveryLog: point-in-time recovery for tables that enable it. Each table
+// has a base copy of its items plus a log of the item writes made since;
+// replaying the log onto the base up to a time gives the table as of then.
+
+import { Database } from 'bun:sqlite'
+import type { DynamoDBItem } from './types.ts'
+import * as fs from 'fs'
+
+export class RecoveryLog {
+  private db: Database
+
+  constructor(dataDir: string) {
+    if (!fs.existsSync(dataDir)) {
+      fs.mkdirSync(dataDir, { recursive: true })
+    }
+    this.db = new Database(`${dataDir}/recovery.db`)
+
+    this.db.run(`
+      CREATE TABLE IF NOT EXISTS recovery_base (
+        table_name TEXT NOT NULL,
+        item_key TEXT NOT NULL,
+        item_data TEXT NOT NULL,
+        PRIMARY KEY (table_name, item_key)
+      )
+    `)
+    // item_data is NULL for a delete
+    this.db.run(`
+      CREATE TABLE IF NOT EXISTS recovery_changes (
+        sequence INTEGER PRIMARY KEY AUTOINCREMENT,
+        table_name TEXT NOT NULL,
+        item_key TEXT NOT NULL,
+        item_data TEXT,
+        changed_at INTEGER NOT NULL
+      )
+    `)
+    this.db.run(`
+      CREATE INDEX IF NOT EXISTS idx_recovery_changes_table
+      ON recovery_changes(table_name, changed_at)
+    `)
+  }
+
+  /**
+   * Starts recovery for a table from a copy of its items. Writes already
+   * logged for the table are kept: a write that lands while the copy is
+   * taken may be in both, and replaying it onto the copy changes nothing.
+   */
+  start(
+    tableName: string,
+    items: Array<{ key: string; item: DynamoDBItem }>
+  ): void {
+    const insert = this.db.prepare(
+      `INSERT OR REPLACE INTO recovery_base (table_name, item_key, item_data)
+       VALUES (?, ?, ?)`
+    )
+    this.db.transaction(() => {
+      this.db.run('DELETE FROM recovery_base WHERE table_name = ?', [
+        tableName,
+      ])
+      for (const { key, item } of items) {
+        insert.run(tableName, key, JSON.stringify(item))
+      }
+    })()
+  }
+
+  // Forgets a table's base copy and log, when recovery is disabled or the
+  // table is deleted
+  drop(tableName: string): void {
+    this.db.transaction(() => {
+      this.db.run('DELETE FROM recovery_base WHERE table_name = ?', [
+        tableName,
+      ])
+      this.db.run('DELETE FROM recovery_changes WHERE table_name = ?', [
+        tableName,
+      ])
+    })()
+  }
+
+  // Logs the item now stored under key, or null for a delete
+  append(
+    tableName: string,
+    key: string,
+    item: DynamoDBItem | null,
+    changedAt: number
+  ): void {
+    this.db.run(
+      `INSERT INTO recovery_changes
+       (table_name, item_key, item_data, changed_at)
+       VALUES (?, ?, ?, ?)`,
+      [tableName, key, item && JSON.stringify(item), changedAt]
+    )
+  }
+
+  /**
+   * Folds the changes made before `before` into the base copy, so the log
+   * only holds changes inside the retention window. Restores to a time
+   * before `before` are no longer possible.
+   */
+  trim(tableName: string, before: number): void {
+    const changes = this.changes(tableName, 'changed_at < ?', before)
+    if (changes.length === 0) return
+
+    this.db.transaction(() => {
+      for (const { item_key, item_data } of changes) {
+        if (item_data === null) {
+          this.db.run(
+            'DELETE FROM recovery_base WHERE table_name = ? AND item_key = ?',
+            [tableName, item_key]
+          )
+        } else {
+          this.db.run(
+            `INSERT OR REPLACE INTO recovery_base
+             (table_name, item_key, item_data) VALUES (?, ?, ?)`,
+            [tableName, item_key, item_data]
+          )
+        }
+      }
+      this.db.run(
+        'DELETE FROM recovery_changes WHERE table_name = ? AND changed_at < ?',
+        [tableName, before]
+      )
+    })()
+  }
+
+  // The table's items as of `at`, in milliseconds since epoch
+  itemsAt(tableName: string, at: number): DynamoDBItem[] {
+    const items = new Map<string, string>()
+    const base = this.db
+      .query<{ item_key: string; item_data: string }, [string]>(
+        'SELECT item_key, item_data FROM recovery_base WHERE table_name = ?'
+      )
+      .all(tableName)
+    for (const { item_key, item_data } of base) {
+      items.set(item_key, item_data)
+    }
+    for (const { item_key, item_data } of this.changes(
+      tableName,
+      'changed_at <= ?',
+      at
+    )) {
+      if (item_data === null) {
+        items.delete(item_key)
+      } else {
+        items.set(item_key, item_data)
+      }
+    }
+    return Array.from(items.values(), (data) => JSON.parse(data))
+  }
+
+  // A table's logged changes matching a condition on changed_at, oldest
+  // first
+  private changes(tableName: string, condition: string, time: number) {
+    return this.db
+      .query<
+        { item_key: string; item_data: string | null },
+        [string, number]
+      >(
+        `SELECT item_key, item_data FROM recovery_changes
+         WHERE table_name = ? AND ${condition}
+         ORDER BY sequence`
+      )
+      .all(tableName, time)
+  }
+
+  close() {
+    this.db.close()
+  }
+}
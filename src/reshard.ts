@@ -0,0 +1,197 @@
+// Shard count detection and redistribution for an existing data directory
+
+import { Database } from 'bun:sqlite'
+import * as fs from 'fs'
+import * as path from 'path'
+import { getShardIndex } from './hash-utils.ts'
+import type { MetadataStore } from './metadata-store.ts'
+import { Shard } from './shard.ts'
+
+interface StoredItemRow {
+  table_name: string
+  partition_key: string
+  sort_key: string
+  item_data: string
+  ongoing_transaction_id: string | null
+  last_update_timestamp: number
+  lsn: number
+}
+
+export function shardPath(dataDir: string, shardIndex: number): string {
+  return `${dataDir}/shard_${shardIndex}.db`
+}
+
+/**
+ * The shard count items in dataDir were written with: the recorded count,
+ * or for data directories from before it was recorded, the number of
+ * shard files. Undefined for a new data directory.
+ */
+export function detectShardCount(
+  dataDir: string,
+  metadataStore: MetadataStore
+): number | undefined {
+  const recorded = metadataStore.getShardCount()
+  if (recorded !== undefined) return recorded
+
+  let files = 0
+  while (fs.existsSync(shardPath(dataDir, files))) files++
+  return files > 0 ? files : undefined
+}
+
+// Shard files are moved aside here during the swap, and deleted once the
+// new shard count is recorded
+function retiredDir(dataDir: string): string {
+  return path.join(dataDir, 'reshard-old')
+}
+
+function stagingDir(dataDir: string): string {
+  return path.join(dataDir, 'reshard')
+}
+
+// Written once every staged shard is complete; its presence means the swap
+// may go ahead, and must be finished if it was interrupted
+function readyMarker(dataDir: string): string {
+  return path.join(stagingDir(dataDir), 'ready.json')
+}
+
+interface ReshardPlan {
+  fromCount: number
+  toCount: number
+}
+
+// Renames are only durable once the directory holding them is synced
+function syncDir(dir: string): void {
+  const fd = fs.openSync(dir, 'r')
+  try {
+    fs.fsyncSync(fd)
+  } finally {
+    fs.closeSync(fd)
+  }
+}
+
+/**
+ * Rehash every stored item from fromCount shards into toCount shards.
+ * The new shard files are built in a staging directory and only replace
+ * the old ones once every item has been copied.
+ */
+export function reshard(
+  dataDir: string,
+  fromCount: number,
+  toCount: number,
+  metadataStore: MetadataStore
+): void {
+  stageShards(dataDir, fromCount, toCount)
+  finishReshard(dataDir, metadataStore)
+}
+
+/**
+ * Completes or discards a reshard a crash interrupted, before the shard
+ * count is read. Staging without its ready marker was never swapped in, so
+ * the old shards are intact; a ready staging directory is swapped in.
+ */
+export function recoverReshard(
+  dataDir: string,
+  metadataStore: MetadataStore
+): void {
+  if (fs.existsSync(readyMarker(dataDir))) {
+    finishReshard(dataDir, metadataStore)
+  } else {
+    fs.rmSync(stagingDir(dataDir), { recursive: true, force: true })
+  }
+}
+
+// Builds toCount shards holding every item of the fromCount shards in
+// dataDir, then marks them ready
+export function stageShards(
+  dataDir: string,
+  fromCount: number,
+  toCount: number
+): void {
+  const rows: StoredItemRow[] = []
+  for (let i = 0; i < fromCount; i++) {
+    const db = new Database(shardPath(dataDir, i))
+    rows.push(...db.query<StoredItemRow, []>('SELECT * FROM items').all())
+    db.close()
+  }
+
+  const staging = stagingDir(dataDir)
+  fs.mkdirSync(staging)
+  for (let i = 0; i < toCount; i++) {
+    // Constructing a shard creates its schema and indexes
+    new Shard(shardPath(staging, i), i).close()
+    const db = new Database(shardPath(staging, i))
+    const insert = db.prepare(
+      `INSERT INTO items
+       (table_name, partition_key, sort_key, item_data, ongoing_transaction_id, last_update_timestamp, lsn)
+       VALUES (?, ?, ?, ?, ?, ?, ?)`
+    )
+    db.transaction(() => {
+      for (const row of rows) {
+        if (getShardIndex(row.partition_key, toCount) !== i) continue
+        insert.run(
+          row.table_name,
+          row.partition_key,
+          row.sort_key,
+          row.item_data,
+          row.ongoing_transaction_id,
+          row.last_update_timestamp,
+          row.lsn
+        )
+      }
+    })()
+    db.close()
+  }
+
+  const plan: ReshardPlan = { fromCount, toCount }
+  const fd = fs.openSync(readyMarker(dataDir), 'w')
+  try {
+    fs.writeSync(fd, JSON.stringify(plan))
+    fs.fsyncSync(fd)
+  } finally {
+    fs.closeSync(fd)
+  }
+  syncDir(staging)
+  syncDir(dataDir)
+}
+
+/**
+ * Swaps ready staged shards in. Every step can be repeated, so a swap
+ * interrupted at any point is finished by running this again:
+ * 1. The old shard files, with their -wal and -shm files, move aside.
+ * 2. The staged files move into dataDir. Once any has, step 1 is done.
+ * 3. The new shard count is recorded.
+ * 4. The old files, then the staging directory, are deleted.
+ */
+function finishReshard(dataDir: string, metadataStore: MetadataStore): void {
+  const staging = stagingDir(dataDir)
+  const retired = retiredDir(dataDir)
+  const { fromCount, toCount } = JSON.parse(
+    fs.readFileSync(readyMarker(dataDir), 'utf8')
+  ) as ReshardPlan
+
+  const staged = Array.from({ length: toCount }, (_, i) => i).filter((i) =>
+    fs.existsSync(shardPath(staging, i))
+  )
+  if (staged.length === toCount) {
+    fs.mkdirSync(retired, { recursive: true })
+    for (let i = 0; i < fromCount; i++) {
+      for (const suffix of ['', '-wal', '-shm']) {
+        const file = shardPath(dataDir, i) + suffix
+        if (fs.existsSync(file)) {
+          fs.renameSync(file, shardPath(retired, i) + suffix)
+        }
+      }
+    }
+    syncDir(retired)
+    syncDir(dataDir)
+  }
+
+  for (const i of staged) {
+    fs.renameSync(shardPath(staging, i), shardPath(dataDir, i))
+  }
+  syncDir(dataDir)
+
+  metadataStore.setShardCount(toCount)
+  fs.rmSync(retired, { recursive: true, force: true })
+  fs.rmSync(staging, { recursive: true, force: true })
+}
@@ -3,6 +3,7 @@
 
 import type {
   DynamoDBItem,
+  ItemChange,
   QueryRequest,
   QueryResponse,
   TableSchema,
@@ -321,7 +322,7 @@ export class Router {
   async transactWrite(
     items: TransactWriteItem[],
     clientRequestToken?: string
-  ): Promise<void> {
+  ): Promise<ItemChange[]> {
     // Check if all items are on the same shard (single-partition optimization)
     const shardIndexes = new Set<number>()
 
@@ -393,7 +394,7 @@ export class Router {
 
     // TODO: Implement single-partition optimization
     // For now, always use coordinator
-    await this.#coordinator.transactWrite(
+    return await this.#coordinator.transactWrite(
       items,
       this.#shards,
       this.#metadataStore,
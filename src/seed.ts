@@ -0,0 +1,53 @@
+// Seed files: tables and items loaded at startup from SEED_FILE
+
+import * as nodeFs from 'fs'
+import type { CreateTableCommandInput } from '@aws-sdk/client-dynamodb'
+import type { DynamoDBItem } from './types.ts'
+
+/**
+ * A seed table is a CreateTable request plus its items. Items use the
+ * DynamoDB JSON import format, one { "Item": {...} } object per item.
+ */
+export interface SeedTable extends CreateTableCommandInput {
+  Items?: Array<{ Item: DynamoDBItem }>
+}
+
+export interface Seed {
+  Tables: SeedTable[]
+}
+
+/**
+ * Read and shape-check a seed file. Any problem throws, so a bad seed
+ * stops the server from starting instead of leaving a partial baseline.
+ */
+export function readSeedFile(path: string): Seed {
+  let seed: unknown
+  try {
+    seed = JSON.parse(nodeFs.readFileSync(path, 'utf8'))
+  } catch (error: unknown) {
+    const message = error instanceof Error ? error.message : String(error)
+    throw new Error(`Invalid seed file ${path}: ${message}`)
+  }
+
+  const tables = (seed as Partial<Seed> | null)?.Tables
+  if (!Array.isArray(tables)) {
+    throw new Error(`Invalid seed file ${path}: Tables must be an array`)
+  }
+  for (const [i, table] of tables.entries()) {
+    if (typeof table?.TableName !== 'string') {
+      throw new Error(
+        `Invalid seed file ${path}: Tables[${i}] has no TableName`
+      )
+    }
+    const items = table.Items ?? []
+    if (
+      !Array.isArray(items) ||
+      items.some((entry) => typeof entry?.Item !== 'object' || !entry.Item)
+    ) {
+      throw new Error(
+        `Invalid seed file ${path}: Items of ${table.TableName} must be { "Item": {...} } objects`
+      )
+    }
+  }
+  return seed as Seed
+}
@@ -8,12 +8,15 @@ import type {
   PrepareRequest,
   PrepareResponse,
   CommitRequest,
+  ItemChange,
   ReleaseRequest,
 } from './types.ts'
 import {
   evaluateConditionExpression,
   applyUpdateExpressionToItem,
 } from './expression-parser/index.ts'
+import type { FsyncPolicy, IsolationLevel } from './config.ts'
+import { ReadCache } from './read-cache.ts'
 
 interface ItemMetadataRow {
   item_data: string
@@ -42,10 +45,23 @@ interface QueryRow {
 export class Shard {
   private db: Database
   private shardIndex: number
-
-  constructor(dbPath: string, shardIndex: number) {
+  private isolationLevel: IsolationLevel
+  // Recently read items; every write to a key invalidates its entry
+  private readCache: ReadCache | null
+  private checkpointTimer: ReturnType<typeof setInterval> | null = null
+
+  constructor(
+    dbPath: string,
+    shardIndex: number,
+    fsyncPolicy: FsyncPolicy = { mode: 'always' },
+    isolationLevel: IsolationLevel = 'serializable',
+    readCacheSize: number = 0
+  ) {
     this.db = new Database(dbPath)
     this.shardIndex = shardIndex
+    this.isolationLevel = isolationLevel
+    this.readCache = readCacheSize > 0 ? new ReadCache(readCacheSize) : null
+    this.applyFsyncPolicy(fsyncPolicy)
 
     // Create items table with transaction metadata fields
     this.db.run(`
@@ -95,14 +111,20 @@ export class Shard {
     let ongoingTxId: string | null = null
 
     if (result) {
-      currentItem = JSON.parse(result.item_data)
+      // lsn 0 rows are lock placeholders for items that do not exist yet
+      currentItem = result.lsn > 0 ? JSON.parse(result.item_data) : null
       currentLsn = result.lsn
       currentTimestamp = result.last_update_timestamp
       ongoingTxId = result.ongoing_transaction_id
     }
 
+    // Under snapshot isolation a ConditionCheck only reads the committed
+    // item: it neither conflicts with other transactions' locks nor takes one
+    const snapshotRead =
+      this.isolationLevel === 'snapshot' && req.operation === 'ConditionCheck'
+
     // Validate timestamp ordering (DynamoDB's serialization mechanism)
-    if (req.timestamp <= currentTimestamp) {
+    if (!snapshotRead && req.timestamp <= currentTimestamp) {
       return {
         accepted: false,
         reason: 'TimestampConflict',
@@ -111,7 +133,7 @@ export class Shard {
     }
 
     // Check for conflicting transaction
-    if (ongoingTxId && ongoingTxId !== req.transactionId) {
+    if (!snapshotRead && ongoingTxId && ongoingTxId !== req.transactionId) {
       return {
         accepted: false,
         reason: 'TransactionConflict',
@@ -142,8 +164,12 @@ export class Shard {
       return response
     }
 
+    if (snapshotRead) {
+      return { accepted: true, lsn: currentLsn }
+    }
+
     // Lock the item for this transaction
-    if (currentItem) {
+    if (result) {
       // Update existing item's lock
       this.db.run(
         `UPDATE items
@@ -177,7 +203,8 @@ export class Shard {
   }
 
   // Phase 2 of 2PC: Commit
-  async commit(req: CommitRequest): Promise<void> {
+  // Returns the change a write made, or undefined for a ConditionCheck
+  async commit(req: CommitRequest): Promise<ItemChange | undefined> {
     // Serialize request to simulate DO boundary
     req = JSON.parse(JSON.stringify(req))
 
@@ -185,16 +212,29 @@ export class Shard {
     const sortKey = req.sortKeyValue
 
     if (req.operation === 'ConditionCheck') {
-      // Just release the lock, no actual write
-      this.db.run(
-        `UPDATE items
-         SET ongoing_transaction_id = NULL
-         WHERE table_name = ? AND partition_key = ? AND sort_key = ? AND ongoing_transaction_id = ?`,
-        [req.tableName, partitionKey, sortKey, req.transactionId]
-      )
-      return
+      // No actual write: release the lock, dropping the placeholder if the
+      // checked item did not exist
+      await this.release({
+        transactionId: req.transactionId,
+        tableName: req.tableName,
+        keys: [req.key],
+        keyValues: [{ partitionKeyValue: partitionKey, sortKeyValue: sortKey }],
+      })
+      return undefined
     }
 
+    // lsn 0 rows are lock placeholders for items that do not exist yet
+    const previous = this.db
+      .query<
+        { item_data: string; lsn: number },
+        [string, string, string]
+      >(`SELECT item_data, lsn FROM items WHERE table_name = ? AND partition_key = ? AND sort_key = ?`)
+      .get(req.tableName, partitionKey, sortKey)
+    const oldItem: DynamoDBItem | null =
+      previous && previous.lsn > 0 ? JSON.parse(previous.item_data) : null
+
+    this.readCache?.invalidate(req.tableName, partitionKey, sortKey)
+
     if (req.operation === 'Delete') {
       // Delete the item
       this.db.run(
@@ -202,7 +242,7 @@ export class Shard {
          WHERE table_name = ? AND partition_key = ? AND sort_key = ? AND ongoing_transaction_id = ?`,
         [req.tableName, partitionKey, sortKey, req.transactionId]
       )
-      return
+      return { tableName: req.tableName, oldItem, newItem: null }
     }
 
     // For Put and Update operations
@@ -255,6 +295,7 @@ export class Shard {
         newLsn,
       ]
     )
+    return { tableName: req.tableName, oldItem, newItem: finalItem }
   }
 
   // Release: Clean up transaction lock on abort
@@ -317,6 +358,7 @@ export class Shard {
       .get(tableName, partitionKey, sortKey)
     const newLsn = currentLsnResult ? currentLsnResult.lsn + 1 : 1
 
+    this.readCache?.invalidate(tableName, partitionKey, sortKey)
     this.db.run(
       `INSERT OR REPLACE INTO items
        (table_name, partition_key, sort_key, item_data, ongoing_transaction_id, last_update_timestamp, lsn)
@@ -330,6 +372,11 @@ export class Shard {
     partitionKey: string,
     sortKey: string
   ): Promise<DynamoDBItem | null> {
+    const cached = this.readCache?.get(tableName, partitionKey, sortKey)
+    if (cached !== undefined) {
+      return JSON.parse(cached)
+    }
+
     const result = this.db
       .query<
         ItemRow,
@@ -337,7 +384,10 @@ export class Shard {
       >(`SELECT item_data FROM items WHERE table_name = ? AND partition_key = ? AND sort_key = ? AND lsn > 0`)
       .get(tableName, partitionKey, sortKey)
 
-    return result ? JSON.parse(result.item_data) : null
+    // Only items that exist are cached; a miss is always read again
+    if (!result) return null
+    this.readCache?.set(tableName, partitionKey, sortKey, result.item_data)
+    return JSON.parse(result.item_data)
   }
 
   async deleteItem(
@@ -348,6 +398,7 @@ export class Shard {
     const item = await this.getItem(tableName, partitionKey, sortKey)
     if (!item) return null
 
+    this.readCache?.invalidate(tableName, partitionKey, sortKey)
     this.db.run(
       'DELETE FROM items WHERE table_name = ? AND partition_key = ? AND sort_key = ?',
       [tableName, partitionKey, sortKey]
@@ -379,6 +430,7 @@ export class Shard {
   }
 
   async deleteAllTableItems(tableName: string): Promise<void> {
+    this.readCache?.clear()
     this.db.run('DELETE FROM items WHERE table_name = ?', [tableName])
   }
 
@@ -514,6 +566,30 @@ export class Shard {
   }
 
   // Helper methods
+
+  // always: SQLite default, every commit is fsynced before returning
+  // interval: WAL commits are not fsynced, a periodic checkpoint flushes them
+  // never: no fsync at all; WAL still keeps the file consistent after a crash
+  private applyFsyncPolicy(policy: FsyncPolicy) {
+    switch (policy.mode) {
+      case 'always':
+        this.db.run('PRAGMA synchronous = FULL')
+        break
+      case 'interval':
+        this.db.run('PRAGMA journal_mode = WAL')
+        this.db.run('PRAGMA synchronous = NORMAL')
+        this.checkpointTimer = setInterval(
+          () => this.db.run('PRAGMA wal_checkpoint(PASSIVE)'),
+          policy.intervalMs
+        )
+        break
+      case 'never':
+        this.db.run('PRAGMA journal_mode = WAL')
+        this.db.run('PRAGMA synchronous = OFF')
+        break
+    }
+  }
+
   private applyUpdateExpression(
     item: DynamoDBItem,
     updateExpression: string,
@@ -529,6 +605,10 @@ export class Shard {
   }
 
   close() {
+    if (this.checkpointTimer) {
+      clearInterval(this.checkpointTimer)
+      this.checkpointTimer = null
+    }
     this.db.close()
   }
 }
@@ -0,0 +1,118 @@
+// Stale reads: with STALE_READ_MS set, eventually consistent reads see each
+// item as it was that long ago, as a read from a lagging DynamoDB replica
+// would
+
+import type { DynamoDBItem } from './types.ts'
+
+interface Write {
+  time: number
+  // The item before this write, or null if the write created it
+  oldItem: DynamoDBItem | null
+}
+
+/**
+ * Remembers the writes of the last windowMs, so reads can be rewound to
+ * before them. Only the earliest write inside the window matters to a read:
+ * its old image is the item as it was windowMs ago.
+ */
+export class StaleReadLog {
+  // By table name, then item key: writes inside the window, oldest first
+  private writes = new Map<string, Map<string, Write[]>>()
+  // Every write inside the window, oldest first, so expired ones are
+  // forgotten without walking every key
+  private expiry: { tableName: string; keyString: string; write: Write }[] =
+    []
+
+  constructor(private windowMs: number) {}
+
+  record(
+    tableName: string,
+    keyString: string,
+    oldItem: DynamoDBItem | null,
+    now: number = Date.now()
+  ): void {
+    this.prune(now)
+    let table = this.writes.get(tableName)
+    if (!table) {
+      table = new Map()
+      this.writes.set(tableName, table)
+    }
+    let writes = table.get(keyString)
+    if (!writes) {
+      writes = []
+      table.set(keyString, writes)
+    }
+    const write = { time: now, oldItem: oldItem && structuredClone(oldItem) }
+    writes.push(write)
+    this.expiry.push({ tableName, keyString, write })
+  }
+
+  // The item with this key as it was windowMs ago, given its current state
+  item(
+    tableName: string,
+    keyString: string,
+    current: DynamoDBItem | null
+  ): DynamoDBItem | null {
+    this.prune(Date.now())
+    return rewind(this.writes.get(tableName), keyString, current)
+  }
+
+  /**
+   * Rewinds every item a Query or Scan read to how it was windowMs ago.
+   * Items written since are replaced by their old image or left out, and
+   * items deleted since come back, so callers must reapply any key
+   * condition.
+   */
+  items(
+    tableName: string,
+    current: DynamoDBItem[],
+    keyOf: (item: DynamoDBItem) => string
+  ): DynamoDBItem[] {
+    this.prune(Date.now())
+    const table = this.writes.get(tableName)
+    if (!table) return current
+
+    const rewound: DynamoDBItem[] = []
+    const seen = new Set<string>()
+    for (const item of current) {
+      const keyString = keyOf(item)
+      seen.add(keyString)
+      const visible = rewind(table, keyString, item)
+      if (visible) rewound.push(visible)
+    }
+    for (const [keyString, [first]] of table) {
+      if (!seen.has(keyString) && first?.oldItem) {
+        rewound.push(structuredClone(first.oldItem))
+      }
+    }
+    return rewound
+  }
+
+  // Forgets the writes of a deleted table
+  drop(tableName: string): void {
+    this.writes.delete(tableName)
+  }
+
+  private prune(now: number): void {
+    const cutoff = now - this.windowMs
+    while (this.expiry[0] && this.expiry[0].write.time <= cutoff) {
+      const { tableName, keyString, write } = this.expiry.shift()!
+      const table = this.writes.get(tableName)
+      const writes = table?.get(keyString)
+      // A dropped table's writes are already gone
+      if (!writes || writes[0] !== write) continue
+      writes.shift()
+      if (writes.length === 0) table!.delete(keyString)
+    }
+  }
+}
+
+function rewind(
+  table: Map<string, Write[]> | undefined,
+  keyString: string,
+  current: DynamoDBItem | null
+): DynamoDBItem | null {
+  const first = table?.get(keyString)?.[0]
+  if (!first) return current
+  return first.oldItem && structuredClone(first.oldItem)
+}
@@ -0,0 +1,37 @@
+// StatsD metrics sent over UDP to STATSD_ADDR
+
+type UdpSocket = Awaited<ReturnType<typeof Bun.udpSocket>>
+
+/**
+ * Fire-and-forget StatsD client. Metric names are prefixed with
+ * "dynado.", and send failures are dropped so metrics can never fail or
+ * slow down the request being measured.
+ */
+export class StatsdClient {
+  private socket: Promise<UdpSocket>
+
+  constructor(
+    private host: string,
+    private port: number
+  ) {
+    this.socket = Bun.udpSocket({})
+  }
+
+  increment(name: string): void {
+    this.send(`dynado.${name}:1|c`)
+  }
+
+  timing(name: string, ms: number): void {
+    this.send(`dynado.${name}:${Math.round(ms)}|ms`)
+  }
+
+  close(): void {
+    this.socket.then((socket) => socket.close()).catch(() => {})
+  }
+
+  private send(line: string): void {
+    this.socket
+      .then((socket) => socket.send(line, this.port, this.host))
+      .catch(() => {})
+  }
+}
@@ -0,0 +1,262 @@
+// StreamLog: DynamoDB Streams change records, kept apart from item storage
+// Records of every stream share one SQLite sequence, so sequence numbers
+// increase in the order writes were recorded, whichever shard stored them
+
+import { Database } from 'bun:sqlite'
+import type { KeySchemaElement, StreamViewType } from '@aws-sdk/client-dynamodb'
+import * as fs from 'fs'
+import type { DynamoDBItem } from './types.ts'
+
+// Wire shapes of the Streams API, which @aws-sdk/client-dynamodb does not
+// model. Timestamps are epoch seconds, as the JSON protocol encodes them.
+
+export interface StreamRecord {
+  eventID: string
+  eventName: 'INSERT' | 'MODIFY' | 'REMOVE'
+  eventVersion: string
+  eventSource: string
+  awsRegion: string
+  dynamodb: {
+    ApproximateCreationDateTime: number
+    Keys: DynamoDBItem
+    NewImage?: DynamoDBItem
+    OldImage?: DynamoDBItem
+    SequenceNumber?: string // Filled in when the record is read
+    SizeBytes: number
+    StreamViewType: StreamViewType
+  }
+  userIdentity?: { Type: string; PrincipalId: string }
+}
+
+export interface ListStreamsInput {
+  TableName?: string
+  Limit?: number
+  ExclusiveStartStreamArn?: string
+}
+
+export interface DescribeStreamInput {
+  StreamArn?: string
+}
+
+export interface GetShardIteratorInput {
+  StreamArn?: string
+  ShardId?: string
+  ShardIteratorType?: string
+  SequenceNumber?: string
+}
+
+export interface GetRecordsInput {
+  ShardIterator?: string
+  Limit?: number
+}
+
+// Each stream has a single shard, open until the stream is disabled
+export const STREAM_SHARD_ID = 'shardId-00000000000000000001-00000001'
+
+export interface StreamInfo {
+  streamArn: string
+  tableName: string
+  streamLabel: string
+  viewType: StreamViewType
+  keySchema: KeySchemaElement[]
+  enabled: boolean
+  createdAt: number // Milliseconds since epoch
+  startSequence: number
+}
+
+interface StreamRow {
+  stream_arn: string
+  table_name: string
+  stream_label: string
+  view_type: string
+  key_schema: string
+  enabled: number
+  created_at: number
+  start_sequence: number
+}
+
+// Shard iterators are opaque to clients; this is what they encode
+export interface ShardIteratorState {
+  streamArn: string
+  shardId: string
+  // The first sequence the next GetRecords may return
+  next: number
+}
+
+// Sequence numbers are zero-padded to DynamoDB's 21 digits, so they sort
+// the same as strings and as numbers
+export function formatSequenceNumber(sequence: number): string {
+  return String(sequence).padStart(21, '0')
+}
+
+export function parseSequenceNumber(value: string): number | undefined {
+  return /^\d{1,21}$/.test(value) ? Number(value) : undefined
+}
+
+export function encodeShardIterator(state: ShardIteratorState): string {
+  return Buffer.from(JSON.stringify(state)).toString('base64')
+}
+
+export function decodeShardIterator(
+  iterator: string
+): ShardIteratorState | undefined {
+  try {
+    const state = JSON.parse(Buffer.from(iterator, 'base64').toString())
+    if (
+      typeof state?.streamArn === 'string' &&
+      typeof state.shardId === 'string' &&
+      Number.isInteger(state.next)
+    ) {
+      return state
+    }
+  } catch {
+    // Fall through to undefined
+  }
+  return undefined
+}
+
+export class StreamLog {
+  private db: Database
+
+  constructor(dataDir: string) {
+    if (!fs.existsSync(dataDir)) {
+      fs.mkdirSync(dataDir, { recursive: true })
+    }
+    this.db = new Database(`${dataDir}/streams.db`)
+
+    this.db.run(`
+      CREATE TABLE IF NOT EXISTS streams (
+        stream_arn TEXT PRIMARY KEY,
+        table_name TEXT NOT NULL,
+        stream_label TEXT NOT NULL,
+        view_type TEXT NOT NULL,
+        key_schema TEXT NOT NULL,
+        enabled INTEGER NOT NULL,
+        created_at INTEGER NOT NULL,
+        start_sequence INTEGER NOT NULL
+      )
+    `)
+    // AUTOINCREMENT never reuses a sequence, even once records are trimmed
+    this.db.run(`
+      CREATE TABLE IF NOT EXISTS stream_records (
+        sequence INTEGER PRIMARY KEY AUTOINCREMENT,
+        stream_arn TEXT NOT NULL,
+        record TEXT NOT NULL
+      )
+    `)
+    this.db.run(`
+      CREATE INDEX IF NOT EXISTS idx_stream_records_arn
+      ON stream_records(stream_arn, sequence)
+    `)
+  }
+
+  createStream(stream: Omit<StreamInfo, 'enabled' | 'startSequence'>): void {
+    this.db.run(
+      `INSERT INTO streams
+       (stream_arn, table_name, stream_label, view_type, key_schema, enabled,
+        created_at, start_sequence)
+       VALUES (?, ?, ?, ?, ?, 1, ?, ?)`,
+      [
+        stream.streamArn,
+        stream.tableName,
+        stream.streamLabel,
+        stream.viewType,
+        JSON.stringify(stream.keySchema),
+        stream.createdAt,
+        this.lastSequence() + 1,
+      ]
+    )
+  }
+
+  // Disabled streams stop taking records but stay readable
+  disableStream(streamArn: string): void {
+    this.db.run('UPDATE streams SET enabled = 0 WHERE stream_arn = ?', [
+      streamArn,
+    ])
+  }
+
+  getStream(streamArn: string): StreamInfo | null {
+    const row = this.db
+      .query<StreamRow, [string]>('SELECT * FROM streams WHERE stream_arn = ?')
+      .get(streamArn)
+    return row ? toStreamInfo(row) : null
+  }
+
+  // Sorted by ARN, so ListStreams pages are stable
+  listStreams(tableName?: string): StreamInfo[] {
+    const rows = tableName
+      ? this.db
+          .query<StreamRow, [string]>(
+            'SELECT * FROM streams WHERE table_name = ? ORDER BY stream_arn'
+          )
+          .all(tableName)
+      : this.db
+          .query<StreamRow, []>('SELECT * FROM streams ORDER BY stream_arn')
+          .all()
+    return rows.map(toStreamInfo)
+  }
+
+  // Appends a record and returns its sequence; SequenceNumber is filled in
+  // on read
+  append(streamArn: string, record: StreamRecord): number {
+    const result = this.db.run(
+      'INSERT INTO stream_records (stream_arn, record) VALUES (?, ?)',
+      [streamArn, JSON.stringify(record)]
+    )
+    return Number(result.lastInsertRowid)
+  }
+
+  // Records of one stream from sequence `from` on, in order
+  read(
+    streamArn: string,
+    from: number,
+    limit: number
+  ): Array<{ sequence: number; record: StreamRecord }> {
+    return this.db
+      .query<{ sequence: number; record: string }, [string, number, number]>(
+        `SELECT sequence, record FROM stream_records
+         WHERE stream_arn = ? AND sequence >= ?
+         ORDER BY sequence LIMIT ?`
+      )
+      .all(streamArn, from, limit)
+      .map((row) => ({
+        sequence: row.sequence,
+        record: JSON.parse(row.record),
+      }))
+  }
+
+  // The highest sequence recorded by any stream, or 0
+  lastSequence(streamArn?: string): number {
+    const row = streamArn
+      ? this.db
+          .query<{ last: number | null }, [string]>(
+            `SELECT MAX(sequence) AS last FROM stream_records
+             WHERE stream_arn = ?`
+          )
+          .get(streamArn)
+      : this.db
+          .query<{ last: number | null }, []>(
+            `SELECT seq AS last FROM sqlite_sequence
+             WHERE name = 'stream_records'`
+          )
+          .get()
+    return row?.last ?? 0
+  }
+
+  close() {
+    this.db.close()
+  }
+}
+
+function toStreamInfo(row: StreamRow): StreamInfo {
+  return {
+    streamArn: row.stream_arn,
+    tableName: row.table_name,
+    streamLabel: row.stream_label,
+    viewType: row.view_type as StreamViewType,
+    keySchema: JSON.parse(row.key_schema),
+    enabled: row.enabled === 1,
+    createdAt: row.created_at,
+    startSequence: row.start_sequence,
+  }
+}
@@ -0,0 +1,19 @@
+// Time to Live: items expire once their TTL attribute is in the past
+
+import type { DynamoDBItem } from './types.ts'
+
+/**
+ * Only a number of epoch seconds marks an item for expiry, as in
+ * DynamoDB. Items without the attribute, or with another type, never
+ * expire.
+ */
+export function isExpired(
+  item: DynamoDBItem,
+  attributeName: string,
+  nowMs: number = Date.now()
+): boolean {
+  const value = item[attributeName]?.N
+  if (value === undefined) return false
+  const expiresAt = Number(value)
+  return Number.isFinite(expiresAt) && expiresAt * 1000 <= nowMs
+}
@@ -1,19 +1,65 @@
 // Shared types for DO-compatible architecture
 
 import type {
+  ApproximateCreationDateTimePrecision,
   AttributeDefinition,
   AttributeValue,
+  BillingMode,
   CancellationReason,
   KeySchemaElement,
+  Projection,
+  SSESpecification,
+  StreamSpecification,
   TransactWriteItem,
 } from '@aws-sdk/client-dynamodb'
 
 export type DynamoDBItem = Record<string, AttributeValue>
 
+export interface SecondaryIndexSchema {
+  indexName: string
+  keySchema: KeySchemaElement[]
+  projection: Projection
+  // Milliseconds since epoch until which a GSI added by UpdateTable is
+  // still backfilling
+  backfillUntil?: number
+}
+
 export interface TableSchema {
   tableName: string
   keySchema: KeySchemaElement[]
   attributeDefinitions: AttributeDefinition[]
+  globalSecondaryIndexes?: SecondaryIndexSchema[]
+  localSecondaryIndexes?: SecondaryIndexSchema[]
+  sseSpecification?: SSESpecification
+  billingMode?: BillingMode
+  // Number attribute holding each item's expiry in epoch seconds
+  timeToLiveAttribute?: string
+  streamSpecification?: StreamSpecification
+  // Label of the table's current or most recent stream
+  latestStreamLabel?: string
+  // Milliseconds since epoch when point-in-time recovery was enabled
+  pointInTimeRecoveryEnabledAt?: number
+  // Tags by key, from CreateTable and TagResource
+  tags?: Record<string, string>
+  // Kinesis data streams the table's changes are sent to, including
+  // disabled ones, as DescribeKinesisStreamingDestination lists them
+  kinesisDestinations?: KinesisDestination[]
+  // The table and indexes with Contributor Insights enabled
+  contributorInsights?: ContributorInsightsSetting[]
+  createdAt?: number // Milliseconds since epoch, set by the metadata store
+}
+
+export interface KinesisDestination {
+  streamArn: string
+  status: 'ACTIVE' | 'DISABLED'
+  // Unit of ApproximateCreationDateTime in the records sent to the stream
+  precision: ApproximateCreationDateTimePrecision
+}
+
+export interface ContributorInsightsSetting {
+  // Unset for the table itself
+  indexName?: string
+  enabledAt: number // Milliseconds since epoch
 }
 
 // Transaction states following DynamoDB's 2PC protocol
@@ -78,6 +124,14 @@ export interface CommitRequest {
   expressionAttributeValues?: Record<string, AttributeValue>
 }
 
+// An item write as committed, for stream records; null images mean the
+// item did not exist before or after the write
+export interface ItemChange {
+  tableName: string
+  oldItem: DynamoDBItem | null
+  newItem: DynamoDBItem | null
+}
+
 export interface ReleaseRequest {
   transactionId: string
   tableName: string
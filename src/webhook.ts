@@ -0,0 +1,60 @@
+// Stream webhook sink: an emulator convenience that POSTs each stream
+// record to STREAM_WEBHOOK_URL, so a service under test receives changes
+// without polling GetRecords
+
+import type { StreamRecord } from './streams.ts'
+
+// Retries wait 100ms, doubling up to 10s
+const FIRST_RETRY_MS = 100
+const MAX_RETRY_MS = 10000
+
+// A record as it is posted: the GetRecords shape, plus the stream it came
+// from, as in a Lambda event
+export type WebhookRecord = StreamRecord & { eventSourceARN: string }
+
+/**
+ * Posts records to the webhook one at a time, in the order they were
+ * written, as `{ "Records": [record] }`. A non-2xx response or network error
+ * is retried with exponential backoff; after the last attempt the record is
+ * logged and dropped, so a failing sink never fails or slows down writes.
+ */
+export class StreamWebhookSink {
+  private queue: Promise<void> = Promise.resolve()
+
+  constructor(
+    private url: string,
+    private maxAttempts: number
+  ) {}
+
+  send(record: WebhookRecord): void {
+    this.queue = this.queue
+      .then(() => this.deliver(record))
+      .catch((error) =>
+        console.error(`Failed to send a record to ${this.url}:`, error)
+      )
+  }
+
+  // Settles once every record sent so far has been delivered or dropped
+  flush(): Promise<void> {
+    return this.queue
+  }
+
+  private async deliver(record: WebhookRecord) {
+    let delayMs = FIRST_RETRY_MS
+    for (let attempt = 1; ; attempt++) {
+      try {
+        const response = await fetch(this.url, {
+          method: 'POST',
+          headers: { 'Content-Type': 'application/json' },
+          body: JSON.stringify({ Records: [record] }),
+        })
+        if (response.ok) return
+        throw new Error(`${response.status} ${await response.text()}`)
+      } catch (error) {
+        if (attempt >= this.maxAttempts) throw error
+      }
+      await Bun.sleep(delayMs)
+      delayMs = Math.min(delayMs * 2, MAX_RETRY_MS)
+    }
+  }
+}
@@ -0,0 +1,69 @@
+// Write gate: writes to a table run concurrently with each other, but a
+// backup waits for those in flight and holds off new ones while it reads
+// every shard, so it is a point-in-time copy even of transactions that
+// commit shard by shard
+
+/**
+ * A readers-writer lock per table. Writers share it; an exclusive holder
+ * waits for every writer inside to leave, and writers arriving meanwhile
+ * wait for it to finish. A writer must not wait for anything an exclusive
+ * holder might hold, so callers take it innermost, after item locks.
+ */
+export class WriteGate {
+  // Writers inside the gate, by table name
+  private writers = new Map<string, number>()
+  // Settles when the table's exclusive holder finishes
+  private closed = new Map<string, Promise<void>>()
+  // Resolves the exclusive holder waiting for the table's writers to leave
+  private drained = new Map<string, () => void>()
+
+  async write<T>(tableNames: string[], fn: () => Promise<T>): Promise<T> {
+    const tables = [...new Set(tableNames)]
+    for (;;) {
+      const pending = tables.find((table) => this.closed.has(table))
+      if (pending === undefined) break
+      await this.closed.get(pending)
+    }
+    for (const table of tables) {
+      this.writers.set(table, (this.writers.get(table) ?? 0) + 1)
+    }
+    try {
+      return await fn()
+    } finally {
+      for (const table of tables) {
+        const remaining = this.writers.get(table)! - 1
+        if (remaining > 0) {
+          this.writers.set(table, remaining)
+          continue
+        }
+        this.writers.delete(table)
+        this.drained.get(table)?.()
+      }
+    }
+  }
+
+  async exclusive<T>(tableName: string, fn: () => Promise<T>): Promise<T> {
+    while (this.closed.has(tableName)) {
+      await this.closed.get(tableName)
+    }
+    let open!: () => void
+    this.closed.set(
+      tableName,
+      new Promise<void>((resolve) => {
+        open = resolve
+      })
+    )
+    try {
+      if (this.writers.has(tableName)) {
+        await new Promise<void>((resolve) =>
+          this.drained.set(tableName, resolve)
+        )
+        this.drained.delete(tableName)
+      }
+      return await fn()
+    } finally {
+      this.closed.delete(tableName)
+      open()
+    }
+  }
+}
@@ -0,0 +1,246 @@
+// Tests for on-demand backups
+// Uses HTTP API via AWS SDK
+
+import { test, expect, beforeAll, afterEach, describe } from 'bun:test'
+import {
+  CreateBackupCommand,
+  DeleteBackupCommand,
+  DescribeBackupCommand,
+  DynamoDBClient,
+  ListBackupsCommand,
+  PutItemCommand,
+  QueryCommand,
+  RestoreTableFromBackupCommand,
+  ScanCommand,
+  TransactWriteItemsCommand,
+} from '@aws-sdk/client-dynamodb'
+import {
+  getGlobalTestDB,
+  createTable,
+  createTableWithItems,
+  cleanupTables,
+  uniqueTableName,
+  trackTable,
+} from './helpers.ts'
+
+describe('Backups', () => {
+  // DynamoDB Local does not implement backups
+  if (process.env.TEST_DYNAMODB_LOCAL === 'true') {
+    return
+  }
+
+  let client: DynamoDBClient
+  const createdTables: string[] = []
+
+  beforeAll(async () => {
+    const testDB = await getGlobalTestDB()
+    client = testDB.client
+  })
+
+  afterEach(async () => {
+    await cleanupTables(client, createdTables)
+  })
+
+  async function backup(TableName: string, BackupName: string) {
+    const { BackupDetails } = await client.send(
+      new CreateBackupCommand({ TableName, BackupName })
+    )
+    return BackupDetails!
+  }
+
+  test('a restored table holds the items as of the backup', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('Source'))
+    await createTableWithItems(
+      client,
+      tableName,
+      [
+        { id: 'a', group: 'x' },
+        { id: 'b', group: 'y' },
+      ],
+      {
+        attributeDefinitions: [
+          { AttributeName: 'id', AttributeType: 'S' },
+          { AttributeName: 'group', AttributeType: 'S' },
+        ],
+        GlobalSecondaryIndexes: [
+          {
+            IndexName: 'ByGroup',
+            KeySchema: [{ AttributeName: 'group', KeyType: 'HASH' }],
+            Projection: { ProjectionType: 'ALL' },
+          },
+        ],
+      }
+    )
+
+    const details = await backup(tableName, 'nightly')
+    expect(details.BackupStatus).toBe('AVAILABLE')
+    expect(details.BackupType).toBe('USER')
+    expect(details.BackupArn).toStartWith(
+      `arn:aws:dynamodb:local:000000000000:table/${tableName}/backup/`
+    )
+
+    // Writes after the backup are not in it
+    await client.send(
+      new PutItemCommand({
+        TableName: tableName,
+        Item: { id: { S: 'c' }, group: { S: 'x' } },
+      })
+    )
+
+    const targetName = trackTable(createdTables, uniqueTableName('Restored'))
+    const { TableDescription } = await client.send(
+      new RestoreTableFromBackupCommand({
+        TargetTableName: targetName,
+        BackupArn: details.BackupArn,
+      })
+    )
+    expect(TableDescription?.TableStatus).toBe('ACTIVE')
+    expect(TableDescription?.RestoreSummary?.SourceBackupArn).toBe(
+      details.BackupArn
+    )
+
+    const { Items } = await client.send(
+      new ScanCommand({ TableName: targetName })
+    )
+    expect(Items?.map((item) => item.id?.S).sort()).toEqual(['a', 'b'])
+    const byGroup = await client.send(
+      new QueryCommand({
+        TableName: targetName,
+        IndexName: 'ByGroup',
+        KeyConditionExpression: '#g = :g',
+        ExpressionAttributeNames: { '#g': 'group' },
+        ExpressionAttributeValues: { ':g': { S: 'x' } },
+      })
+    )
+    expect(byGroup.Items?.map((item) => item.id?.S)).toEqual(['a'])
+
+    await expect(
+      client.send(
+        new RestoreTableFromBackupCommand({
+          TargetTableName: targetName,
+          BackupArn: details.BackupArn,
+        })
+      )
+    ).rejects.toHaveProperty('name', 'TableAlreadyExistsException')
+  })
+
+  test('backups taken during transactions hold all of each or none', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('Concurrent'))
+    // Enough items that every transaction spans several shards
+    const ids = ['a', 'b', 'c', 'd', 'e', 'f', 'g', 'h']
+    await createTableWithItems(
+      client,
+      tableName,
+      ids.map((id) => ({ id, version: 0 }))
+    )
+
+    // Each transaction writes the same version to every item
+    let writing = true
+    const writer = (async () => {
+      for (let version = 1; writing; version++) {
+        await client.send(
+          new TransactWriteItemsCommand({
+            TransactItems: ids.map((id) => ({
+              Update: {
+                TableName: tableName,
+                Key: { id: { S: id } },
+                UpdateExpression: 'SET version = :v',
+                ExpressionAttributeValues: { ':v': { N: String(version) } },
+              },
+            })),
+          })
+        )
+      }
+    })()
+    const backups = []
+    try {
+      for (let i = 0; i < 5; i++) {
+        backups.push(await backup(tableName, `during-${i}`))
+        await Bun.sleep(5)
+      }
+    } finally {
+      writing = false
+      await writer
+    }
+
+    for (const [i, details] of backups.entries()) {
+      const targetName = trackTable(
+        createdTables,
+        uniqueTableName(`Restored${i}`)
+      )
+      await client.send(
+        new RestoreTableFromBackupCommand({
+          TargetTableName: targetName,
+          BackupArn: details.BackupArn,
+        })
+      )
+      const { Items } = await client.send(
+        new ScanCommand({ TableName: targetName })
+      )
+      expect(Items).toHaveLength(ids.length)
+      const versions = new Set(Items!.map((item) => item.version!.N))
+      expect(versions.size).toBe(1)
+    }
+  })
+
+  test('ListBackups pages through the backups of a table', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('Listed'))
+    await createTable(client, tableName)
+    const arns = []
+    for (const name of ['first', 'second', 'third']) {
+      arns.push((await backup(tableName, name)).BackupArn)
+    }
+
+    const first = await client.send(
+      new ListBackupsCommand({ TableName: tableName, Limit: 2 })
+    )
+    expect(first.BackupSummaries?.map((s) => s.BackupName)).toEqual([
+      'first',
+      'second',
+    ])
+    expect(first.LastEvaluatedBackupArn).toBe(arns[1])
+    const second = await client.send(
+      new ListBackupsCommand({
+        TableName: tableName,
+        ExclusiveStartBackupArn: first.LastEvaluatedBackupArn,
+      })
+    )
+    expect(second.BackupSummaries?.map((s) => s.BackupArn)).toEqual([arns[2]])
+    expect(second.LastEvaluatedBackupArn).toBeUndefined()
+    expect(second.BackupSummaries?.[0]?.TableName).toBe(tableName)
+  })
+
+  test('DeleteBackup removes a backup', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('Deleted'))
+    await createTableWithItems(client, tableName, [{ id: 'a' }])
+    const { BackupArn } = await backup(tableName, 'temporary')
+
+    const { BackupDescription } = await client.send(
+      new DescribeBackupCommand({ BackupArn })
+    )
+    expect(BackupDescription?.SourceTableDetails?.TableName).toBe(tableName)
+    expect(BackupDescription?.SourceTableDetails?.ItemCount).toBe(1)
+
+    const deleted = await client.send(new DeleteBackupCommand({ BackupArn }))
+    expect(deleted.BackupDescription?.BackupDetails?.BackupStatus).toBe(
+      'DELETED'
+    )
+    await expect(
+      client.send(new DescribeBackupCommand({ BackupArn }))
+    ).rejects.toHaveProperty('name', 'BackupNotFoundException')
+    await expect(
+      client.send(
+        new RestoreTableFromBackupCommand({
+          TargetTableName: uniqueTableName('Never'),
+          BackupArn,
+        })
+      )
+    ).rejects.toHaveProperty('name', 'BackupNotFoundException')
+  })
+
+  test('CreateBackup of a missing table fails', async () => {
+    await expect(
+      backup(uniqueTableName('Missing'), 'orphan')
+    ).rejects.toHaveProperty('name', 'TableNotFoundException')
+  })
+})
@@ -0,0 +1,251 @@
+// Tests for ReturnConsumedCapacity on item, batch and transaction operations
+// Uses HTTP API via AWS SDK
+
+import { test, expect, beforeAll, afterEach, describe } from 'bun:test'
+import {
+  BatchGetItemCommand,
+  BatchWriteItemCommand,
+  DeleteItemCommand,
+  DynamoDBClient,
+  GetItemCommand,
+  PutItemCommand,
+  TransactGetItemsCommand,
+  TransactWriteItemsCommand,
+  UpdateItemCommand,
+} from '@aws-sdk/client-dynamodb'
+import {
+  getGlobalTestDB,
+  createTable,
+  cleanupTables,
+  uniqueTableName,
+  trackTable,
+} from './helpers.ts'
+
+describe('Consumed capacity', () => {
+  // DynamoDB Local only approximates DynamoDB's accounting
+  if (process.env.TEST_DYNAMODB_LOCAL === 'true') {
+    return
+  }
+
+  let client: DynamoDBClient
+  const createdTables: string[] = []
+
+  beforeAll(async () => {
+    const testDB = await getGlobalTestDB()
+    client = testDB.client
+  })
+
+  afterEach(async () => {
+    await cleanupTables(client, createdTables)
+  })
+
+  test('item reads and writes are charged by item size', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('ItemUnits'))
+    await createTable(client, tableName)
+    const Key = { id: { S: 'a' } }
+    // About 2.5KB: three write units, one read unit
+    const large = { ...Key, data: { S: 'x'.repeat(2500) } }
+
+    const put = await client.send(
+      new PutItemCommand({
+        TableName: tableName,
+        Item: large,
+        ReturnConsumedCapacity: 'TOTAL',
+      })
+    )
+    expect(put.ConsumedCapacity).toEqual({
+      TableName: tableName,
+      CapacityUnits: 3,
+    })
+
+    // Replacing an item pays for the larger of the two
+    const shrink = await client.send(
+      new PutItemCommand({
+        TableName: tableName,
+        Item: { ...Key, data: { S: 'small' } },
+        ReturnConsumedCapacity: 'TOTAL',
+      })
+    )
+    expect(shrink.ConsumedCapacity!.CapacityUnits).toBe(3)
+
+    const update = await client.send(
+      new UpdateItemCommand({
+        TableName: tableName,
+        Key,
+        UpdateExpression: 'SET #d = :d',
+        ExpressionAttributeNames: { '#d': 'data' },
+        ExpressionAttributeValues: { ':d': { S: 'y'.repeat(1500) } },
+        ReturnConsumedCapacity: 'TOTAL',
+      })
+    )
+    expect(update.ConsumedCapacity!.CapacityUnits).toBe(2)
+
+    const get = (id: string, ConsistentRead?: boolean) =>
+      client.send(
+        new GetItemCommand({
+          TableName: tableName,
+          Key: { id: { S: id } },
+          ConsistentRead,
+          ReturnConsumedCapacity: 'TOTAL',
+        })
+      )
+    expect((await get('a')).ConsumedCapacity!.CapacityUnits).toBe(0.5)
+    expect((await get('a', true)).ConsumedCapacity!.CapacityUnits).toBe(1)
+    // A missing item still costs the smallest read
+    const missing = await get('missing')
+    expect(missing.Item).toBeUndefined()
+    expect(missing.ConsumedCapacity!.CapacityUnits).toBe(0.5)
+
+    const deleted = await client.send(
+      new DeleteItemCommand({
+        TableName: tableName,
+        Key,
+        ReturnConsumedCapacity: 'TOTAL',
+      })
+    )
+    expect(deleted.ConsumedCapacity!.CapacityUnits).toBe(2)
+
+    // NONE, the default, reports nothing
+    const quiet = await client.send(
+      new PutItemCommand({ TableName: tableName, Item: large })
+    )
+    expect(quiet.ConsumedCapacity).toBeUndefined()
+  })
+
+  test('INDEXES charges each index the entries a write changes', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('IndexUnits'))
+    await createTable(client, tableName, {
+      attributeDefinitions: [
+        { AttributeName: 'id', AttributeType: 'S' },
+        { AttributeName: 'category', AttributeType: 'S' },
+      ],
+      GlobalSecondaryIndexes: [
+        {
+          IndexName: 'ByCategory',
+          KeySchema: [{ AttributeName: 'category', KeyType: 'HASH' }],
+          Projection: { ProjectionType: 'KEYS_ONLY' },
+        },
+      ],
+    })
+    const Key = { id: { S: 'a' } }
+    const update = async (UpdateExpression: string, value: string) =>
+      (
+        await client.send(
+          new UpdateItemCommand({
+            TableName: tableName,
+            Key,
+            UpdateExpression,
+            ExpressionAttributeValues: { ':v': { S: value } },
+            ReturnConsumedCapacity: 'INDEXES',
+          })
+        )
+      ).ConsumedCapacity
+
+    // The new item gains an index entry
+    expect(await update('SET category = :v', 'books')).toEqual({
+      TableName: tableName,
+      CapacityUnits: 2,
+      Table: { CapacityUnits: 1 },
+      GlobalSecondaryIndexes: { ByCategory: { CapacityUnits: 1 } },
+    })
+    // An attribute the index does not project leaves its entry alone
+    expect(await update('SET title = :v', 'Dune')).toEqual({
+      TableName: tableName,
+      CapacityUnits: 1,
+      Table: { CapacityUnits: 1 },
+    })
+    // A new index key deletes the old entry and puts a new one
+    expect(await update('SET category = :v', 'films')).toEqual({
+      TableName: tableName,
+      CapacityUnits: 3,
+      Table: { CapacityUnits: 1 },
+      GlobalSecondaryIndexes: { ByCategory: { CapacityUnits: 2 } },
+    })
+    // Removing the index key removes the entry
+    expect(await update('REMOVE category SET title = :v', 'Alien')).toEqual({
+      TableName: tableName,
+      CapacityUnits: 2,
+      Table: { CapacityUnits: 1 },
+      GlobalSecondaryIndexes: { ByCategory: { CapacityUnits: 1 } },
+    })
+  })
+
+  test('batches and transactions report each table', async () => {
+    const first = trackTable(createdTables, uniqueTableName('BatchUnitsA'))
+    const second = trackTable(createdTables, uniqueTableName('BatchUnitsB'))
+    await createTable(client, first)
+    await createTable(client, second)
+    const item = (id: string) => ({ id: { S: id } })
+
+    const written = await client.send(
+      new BatchWriteItemCommand({
+        RequestItems: {
+          [first]: [
+            { PutRequest: { Item: item('a') } },
+            { PutRequest: { Item: item('b') } },
+          ],
+          [second]: [{ DeleteRequest: { Key: item('missing') } }],
+        },
+        ReturnConsumedCapacity: 'TOTAL',
+      })
+    )
+    expect(written.ConsumedCapacity).toEqual([
+      { TableName: first, CapacityUnits: 2 },
+      { TableName: second, CapacityUnits: 1 },
+    ])
+
+    const read = await client.send(
+      new BatchGetItemCommand({
+        RequestItems: {
+          [first]: {
+            Keys: [item('a'), item('b'), item('missing')],
+            ConsistentRead: true,
+          },
+          [second]: { Keys: [item('a')] },
+        },
+        ReturnConsumedCapacity: 'TOTAL',
+      })
+    )
+    expect(read.ConsumedCapacity).toEqual([
+      { TableName: first, CapacityUnits: 3 },
+      { TableName: second, CapacityUnits: 0.5 },
+    ])
+
+    // Transactions cost twice as much, and a ConditionCheck costs the
+    // smallest write
+    const transacted = await client.send(
+      new TransactWriteItemsCommand({
+        TransactItems: [
+          { Put: { TableName: first, Item: item('c') } },
+          { Delete: { TableName: first, Key: item('a') } },
+          {
+            ConditionCheck: {
+              TableName: second,
+              Key: item('a'),
+              ConditionExpression: 'attribute_not_exists(id)',
+            },
+          },
+        ],
+        ReturnConsumedCapacity: 'TOTAL',
+      })
+    )
+    expect(transacted.ConsumedCapacity).toEqual([
+      { TableName: first, CapacityUnits: 4 },
+      { TableName: second, CapacityUnits: 2 },
+    ])
+
+    const got = await client.send(
+      new TransactGetItemsCommand({
+        TransactItems: [
+          { Get: { TableName: first, Key: item('b') } },
+          { Get: { TableName: second, Key: item('a') } },
+        ],
+        ReturnConsumedCapacity: 'TOTAL',
+      })
+    )
+    expect(got.ConsumedCapacity).toEqual([
+      { TableName: first, CapacityUnits: 2 },
+      { TableName: second, CapacityUnits: 2 },
+    ])
+  })
+})
@@ -0,0 +1,348 @@
+// Tests for condition and filter expression semantics
+// Uses HTTP API via AWS SDK
+
+import { test, expect, beforeAll, afterEach, describe } from 'bun:test'
+import {
+  type AttributeValue,
+  DeleteItemCommand,
+  DynamoDBClient,
+  PutItemCommand,
+  ScanCommand,
+  UpdateItemCommand,
+} from '@aws-sdk/client-dynamodb'
+import {
+  getGlobalTestDB,
+  createTableWithItems,
+  cleanupTables,
+  uniqueTableName,
+  trackTable,
+} from './helpers.ts'
+
+describe('Condition expressions', () => {
+  let client: DynamoDBClient
+  const createdTables: string[] = []
+
+  beforeAll(async () => {
+    const testDB = await getGlobalTestDB()
+    client = testDB.client
+  })
+
+  afterEach(async () => {
+    await cleanupTables(client, createdTables)
+  })
+
+  test('NULL attributes exist for conditions and filters', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('Nulls'))
+    await createTableWithItems(client, tableName, [
+      { id: 'tombstoned', x: null },
+      { id: 'live' },
+    ])
+
+    await expect(
+      client.send(
+        new PutItemCommand({
+          TableName: tableName,
+          Item: { id: { S: 'tombstoned' }, x: { S: 'revived' } },
+          ConditionExpression: 'attribute_not_exists(x)',
+        })
+      )
+    ).rejects.toHaveProperty('name', 'ConditionalCheckFailedException')
+
+    await client.send(
+      new PutItemCommand({
+        TableName: tableName,
+        Item: { id: { S: 'tombstoned' }, x: { NULL: true } },
+        ConditionExpression: 'attribute_exists(x)',
+      })
+    )
+
+    const response = await client.send(
+      new ScanCommand({
+        TableName: tableName,
+        FilterExpression: 'attribute_exists(x)',
+      })
+    )
+    expect(response.Items).toEqual([
+      { id: { S: 'tombstoned' }, x: { NULL: true } },
+    ])
+  })
+
+  test('NOT composes with function calls', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('Not'))
+    await createTableWithItems(client, tableName, [
+      { id: 'item-1', tags: { SS: ['red', 'blue'] } },
+    ])
+    const update = (
+      conditionExpression: string,
+      values: Record<string, AttributeValue> = {}
+    ) =>
+      client.send(
+        new UpdateItemCommand({
+          TableName: tableName,
+          Key: { id: { S: 'item-1' } },
+          UpdateExpression: 'SET checked = :true',
+          ConditionExpression: conditionExpression,
+          ExpressionAttributeValues: { ':true': { BOOL: true }, ...values },
+        })
+      )
+
+    await update('NOT attribute_exists(archived)')
+    await expect(update('NOT attribute_exists(tags)')).rejects.toHaveProperty(
+      'name',
+      'ConditionalCheckFailedException'
+    )
+
+    await update('NOT contains(tags, :t)', { ':t': { S: 'green' } })
+    await expect(
+      update('NOT contains(tags, :t)', { ':t': { S: 'red' } })
+    ).rejects.toHaveProperty('name', 'ConditionalCheckFailedException')
+  })
+
+  test('binary comparisons use unsigned byte order', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('Binary'))
+    await createTableWithItems(client, tableName, [
+      { id: 'item-1', marker: { B: new Uint8Array([0x80, 0x00]) } },
+    ])
+    const update = (threshold: number[]) =>
+      client.send(
+        new UpdateItemCommand({
+          TableName: tableName,
+          Key: { id: { S: 'item-1' } },
+          UpdateExpression: 'SET checked = :true',
+          ConditionExpression: 'marker >= :threshold',
+          ExpressionAttributeValues: {
+            ':true': { BOOL: true },
+            ':threshold': { B: new Uint8Array(threshold) },
+          },
+        })
+      )
+
+    // 0x80 is above 0x7f only when bytes are compared unsigned
+    await update([0x7f, 0xff])
+    await update([0x80, 0x00])
+    await expect(update([0x80, 0x01])).rejects.toHaveProperty(
+      'name',
+      'ConditionalCheckFailedException'
+    )
+  })
+
+  test('filters on a nested path skip items without that structure', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('Nested'))
+    await createTableWithItems(client, tableName, [
+      { id: 'oslo', address: { M: { city: { S: 'Oslo' } } } },
+      {
+        id: 'oslo-zip',
+        address: { M: { city: { S: 'Oslo' }, zip: { S: '0150' } } },
+      },
+      { id: 'bergen', address: { M: { city: { S: 'Bergen' } } } },
+      { id: 'no-city', address: { M: { zip: { S: '5003' } } } },
+      { id: 'flat', address: 'Oslo' },
+      { id: 'list', address: { L: [{ M: { city: { S: 'Oslo' } } }] } },
+      { id: 'missing' },
+    ])
+
+    const response = await client.send(
+      new ScanCommand({
+        TableName: tableName,
+        FilterExpression: 'address.city = :c',
+        ExpressionAttributeValues: { ':c': { S: 'Oslo' } },
+      })
+    )
+    expect(response.Items!.map((item) => item.id!.S).sort()).toEqual([
+      'oslo',
+      'oslo-zip',
+    ])
+    expect(response.ScannedCount).toBe(7)
+  })
+
+  test('begins_with tests the value at a nested path', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('Prefix'))
+    await createTableWithItems(client, tableName, [
+      {
+        id: 'item-1',
+        profile: {
+          M: {
+            username: { S: 'ada_lovelace' },
+            avatar: { B: new Uint8Array([0x89, 0x50, 0x4e, 0x47]) },
+            age: { N: '36' },
+          },
+        },
+      },
+    ])
+    const update = (conditionExpression: string, prefix: AttributeValue) =>
+      client.send(
+        new UpdateItemCommand({
+          TableName: tableName,
+          Key: { id: { S: 'item-1' } },
+          UpdateExpression: 'SET checked = :true',
+          ConditionExpression: conditionExpression,
+          ExpressionAttributeValues: { ':true': { BOOL: true }, ':p': prefix },
+        })
+      )
+
+    await update('begins_with(profile.username, :p)', { S: 'ada_' })
+    await expect(
+      update('begins_with(profile.username, :p)', { S: 'grace' })
+    ).rejects.toHaveProperty('name', 'ConditionalCheckFailedException')
+
+    await update('begins_with(profile.avatar, :p)', {
+      B: new Uint8Array([0x89, 0x50]),
+    })
+    await expect(
+      update('begins_with(profile.avatar, :p)', { B: new Uint8Array([0x50]) })
+    ).rejects.toHaveProperty('name', 'ConditionalCheckFailedException')
+
+    // A number target never matches; a number prefix is rejected outright
+    await expect(
+      update('begins_with(profile.age, :p)', { S: '3' })
+    ).rejects.toHaveProperty('name', 'ConditionalCheckFailedException')
+    await expect(
+      update('begins_with(profile.username, :p)', { N: '3' })
+    ).rejects.toMatchObject({
+      name: 'ValidationException',
+      message: expect.stringContaining(
+        'Incorrect operand type for operator or function; operator or function: begins_with'
+      ),
+    })
+  })
+
+  test('filters compare attributes, sizes and values on either side', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('Operands'))
+    await createTableWithItems(client, tableName, [
+      { id: 'over', spent: 120, budget: 100, tags: { SS: ['a', 'b', 'c'] } },
+      { id: 'under', spent: 80, budget: 100, tags: { SS: ['a'] } },
+      { id: 'unbudgeted', spent: 50 },
+    ])
+    const filter = async (
+      FilterExpression: string,
+      ExpressionAttributeValues?: Record<string, AttributeValue>
+    ) => {
+      const response = await client.send(
+        new ScanCommand({
+          TableName: tableName,
+          FilterExpression,
+          ExpressionAttributeValues,
+        })
+      )
+      return response.Items!.map((item) => item.id!.S).sort()
+    }
+
+    expect(await filter('spent > budget')).toEqual(['over'])
+    expect(await filter(':limit < spent', { ':limit': { N: '100' } })).toEqual([
+      'over',
+    ])
+    expect(
+      await filter('size(tags) BETWEEN :low AND :high', {
+        ':low': { N: '2' },
+        ':high': { N: '3' },
+      })
+    ).toEqual(['over'])
+    expect(await filter('size(tags) < size(id)')).toEqual(['over', 'under'])
+    expect(
+      await filter('budget IN (spent, :b)', { ':b': { N: '100.0' } })
+    ).toEqual(['over', 'under'])
+    // Keywords are case-insensitive, and <> holds for a missing attribute
+    expect(
+      await filter('not (spent > budget) and budget <> :b', {
+        ':b': { N: '100' },
+      })
+    ).toEqual(['unbudgeted'])
+  })
+
+  test('Limit caps the items read before the filter runs', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('LimitFilter'))
+    const ids = Array.from({ length: 6 }, (_, i) => `item-${i}`)
+    await createTableWithItems(
+      client,
+      tableName,
+      ids.map((id, i) => ({ id, even: i % 2 === 0 }))
+    )
+
+    const matched: string[] = []
+    let startKey: Record<string, AttributeValue> | undefined
+    let pages = 0
+    do {
+      const page = await client.send(
+        new ScanCommand({
+          TableName: tableName,
+          FilterExpression: 'even = :true',
+          ExpressionAttributeValues: { ':true': { BOOL: true } },
+          Limit: 2,
+          ExclusiveStartKey: startKey,
+        })
+      )
+      pages++
+      expect(page.ScannedCount).toBeLessThanOrEqual(2)
+      expect(page.Count).toBeLessThanOrEqual(page.ScannedCount!)
+      matched.push(...page.Items!.map((item) => item.id!.S!))
+      startKey = page.LastEvaluatedKey
+    } while (startKey)
+
+    // Three pages of two items read, not two pages of two matches
+    expect(pages).toBeGreaterThanOrEqual(3)
+    expect(matched.sort()).toEqual(['item-0', 'item-2', 'item-4'])
+  })
+
+  test('a failed check returns the item with ALL_OLD', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('FailedOld'))
+    await createTableWithItems(client, tableName, [{ id: 'a', v: 1 }])
+    const Key = { id: { S: 'a' } }
+    const failure = (request: Promise<unknown>) => request.catch((e) => e)
+
+    const put = await failure(
+      client.send(
+        new PutItemCommand({
+          TableName: tableName,
+          Item: { ...Key, v: { N: '2' } },
+          ConditionExpression: 'attribute_not_exists(id)',
+          ReturnValuesOnConditionCheckFailure: 'ALL_OLD',
+        })
+      )
+    )
+    expect(put.name).toBe('ConditionalCheckFailedException')
+    expect(put.Item).toEqual({ ...Key, v: { N: '1' } })
+
+    const update = await failure(
+      client.send(
+        new UpdateItemCommand({
+          TableName: tableName,
+          Key,
+          UpdateExpression: 'SET v = :v',
+          ConditionExpression: 'v > :v',
+          ExpressionAttributeValues: { ':v': { N: '5' } },
+          ReturnValuesOnConditionCheckFailure: 'ALL_OLD',
+        })
+      )
+    )
+    expect(update.Item).toEqual({ ...Key, v: { N: '1' } })
+
+    // NONE, the default, leaves the item out
+    const deleted = await failure(
+      client.send(
+        new DeleteItemCommand({
+          TableName: tableName,
+          Key,
+          ConditionExpression: 'v = :v',
+          ExpressionAttributeValues: { ':v': { N: '5' } },
+          ReturnValuesOnConditionCheckFailure: 'NONE',
+        })
+      )
+    )
+    expect(deleted.name).toBe('ConditionalCheckFailedException')
+    expect(deleted.Item).toBeUndefined()
+
+    // There is no item to return when the check failed on a missing one
+    const missing = await failure(
+      client.send(
+        new DeleteItemCommand({
+          TableName: tableName,
+          Key: { id: { S: 'missing' } },
+          ConditionExpression: 'attribute_exists(id)',
+          ReturnValuesOnConditionCheckFailure: 'ALL_OLD',
+        })
+      )
+    )
+    expect(missing.name).toBe('ConditionalCheckFailedException')
+    expect(missing.Item).toBeUndefined()
+  })
+})
@@ -0,0 +1,233 @@
+// Tests for Contributor Insights
+// Reads TopContributors with raw requests, since the SDK drops the field
+
+import { test, expect, describe } from 'bun:test'
+import {
+  BatchGetItemCommand,
+  CreateTableCommand,
+  DescribeContributorInsightsCommand,
+  GetItemCommand,
+  ListContributorInsightsCommand,
+  PutItemCommand,
+  QueryCommand,
+  UpdateContributorInsightsCommand,
+} from '@aws-sdk/client-dynamodb'
+import type { DB } from '../src/index.ts'
+import { startDynado, uniqueTableName } from './helpers.ts'
+
+describe('Contributor Insights', () => {
+  // DynamoDB Local does not implement Contributor Insights
+  if (process.env.TEST_DYNAMODB_LOCAL === 'true') {
+    return
+  }
+
+  async function describeRaw(db: DB, TableName: string, IndexName?: string) {
+    const response = await fetch(`http://localhost:${db.server.port}/`, {
+      method: 'POST',
+      headers: {
+        'x-amz-target': 'DynamoDB_20120810.DescribeContributorInsights',
+        'Content-Type': 'application/x-amz-json-1.0',
+      },
+      body: JSON.stringify({ TableName, IndexName }),
+    })
+    return (await response.json()) as any
+  }
+
+  test('counts the most accessed partition keys and items', async () => {
+    const { db, client, cleanup } = await startDynado()
+    try {
+      const tableName = uniqueTableName('Insights')
+      await client.send(
+        new CreateTableCommand({
+          TableName: tableName,
+          KeySchema: [
+            { AttributeName: 'pk', KeyType: 'HASH' },
+            { AttributeName: 'sk', KeyType: 'RANGE' },
+          ],
+          AttributeDefinitions: [
+            { AttributeName: 'pk', AttributeType: 'S' },
+            { AttributeName: 'sk', AttributeType: 'N' },
+          ],
+          BillingMode: 'PAY_PER_REQUEST',
+        })
+      )
+      // Accesses before insights are enabled are not counted
+      await client.send(
+        new PutItemCommand({
+          TableName: tableName,
+          Item: { pk: { S: 'cold' }, sk: { N: '1' } },
+        })
+      )
+
+      const updated = await client.send(
+        new UpdateContributorInsightsCommand({
+          TableName: tableName,
+          ContributorInsightsAction: 'ENABLE',
+        })
+      )
+      expect(updated.ContributorInsightsStatus).toBe('ENABLED')
+
+      for (const sk of ['1', '2']) {
+        await client.send(
+          new PutItemCommand({
+            TableName: tableName,
+            Item: { pk: { S: 'hot' }, sk: { N: sk } },
+          })
+        )
+      }
+      await client.send(
+        new GetItemCommand({
+          TableName: tableName,
+          Key: { pk: { S: 'hot' }, sk: { N: '1' } },
+        })
+      )
+      await client.send(
+        new BatchGetItemCommand({
+          RequestItems: {
+            [tableName]: {
+              Keys: [
+                { pk: { S: 'hot' }, sk: { N: '1' } },
+                { pk: { S: 'cold' }, sk: { N: '1' } },
+              ],
+            },
+          },
+        })
+      )
+      // A query counts each item it reads
+      await client.send(
+        new QueryCommand({
+          TableName: tableName,
+          KeyConditionExpression: 'pk = :pk',
+          ExpressionAttributeValues: { ':pk': { S: 'hot' } },
+        })
+      )
+
+      const described = await client.send(
+        new DescribeContributorInsightsCommand({ TableName: tableName })
+      )
+      expect(described.ContributorInsightsStatus).toBe('ENABLED')
+      expect(described.ContributorInsightsRuleList).toHaveLength(4)
+
+      const raw = await describeRaw(db, tableName)
+      expect(raw.TopContributors).toEqual([
+        {
+          RuleName: described.ContributorInsightsRuleList![0],
+          Contributors: [
+            { Keys: ['hot'], ApproximateAggregateValue: 6 },
+            { Keys: ['cold'], ApproximateAggregateValue: 1 },
+          ],
+        },
+        {
+          RuleName: described.ContributorInsightsRuleList![2],
+          Contributors: [
+            { Keys: ['hot', '1'], ApproximateAggregateValue: 4 },
+            { Keys: ['hot', '2'], ApproximateAggregateValue: 2 },
+            { Keys: ['cold', '1'], ApproximateAggregateValue: 1 },
+          ],
+        },
+      ])
+
+      // Disabling forgets the counts
+      await client.send(
+        new UpdateContributorInsightsCommand({
+          TableName: tableName,
+          ContributorInsightsAction: 'DISABLE',
+        })
+      )
+      await client.send(
+        new UpdateContributorInsightsCommand({
+          TableName: tableName,
+          ContributorInsightsAction: 'ENABLE',
+        })
+      )
+      const reenabled = await describeRaw(db, tableName)
+      expect(reenabled.TopContributors[0].Contributors).toEqual([])
+    } finally {
+      await cleanup()
+    }
+  })
+
+  test('tracks indexes separately and lists every target', async () => {
+    const { db, client, cleanup } = await startDynado()
+    try {
+      const tableName = uniqueTableName('IndexInsights')
+      await client.send(
+        new CreateTableCommand({
+          TableName: tableName,
+          KeySchema: [{ AttributeName: 'id', KeyType: 'HASH' }],
+          AttributeDefinitions: [
+            { AttributeName: 'id', AttributeType: 'S' },
+            { AttributeName: 'owner', AttributeType: 'S' },
+          ],
+          GlobalSecondaryIndexes: [
+            {
+              IndexName: 'byOwner',
+              KeySchema: [{ AttributeName: 'owner', KeyType: 'HASH' }],
+              Projection: { ProjectionType: 'ALL' },
+            },
+          ],
+          BillingMode: 'PAY_PER_REQUEST',
+        })
+      )
+      await client.send(
+        new UpdateContributorInsightsCommand({
+          TableName: tableName,
+          IndexName: 'byOwner',
+          ContributorInsightsAction: 'ENABLE',
+        })
+      )
+      await client.send(
+        new PutItemCommand({
+          TableName: tableName,
+          Item: { id: { S: 'a' }, owner: { S: 'ann' } },
+        })
+      )
+      await client.send(
+        new QueryCommand({
+          TableName: tableName,
+          IndexName: 'byOwner',
+          KeyConditionExpression: '#owner = :owner',
+          ExpressionAttributeNames: { '#owner': 'owner' },
+          ExpressionAttributeValues: { ':owner': { S: 'ann' } },
+        })
+      )
+
+      const raw = await describeRaw(db, tableName, 'byOwner')
+      expect(raw.ContributorInsightsRuleList).toHaveLength(2)
+      expect(raw.TopContributors).toEqual([
+        {
+          RuleName: raw.ContributorInsightsRuleList[0],
+          Contributors: [{ Keys: ['ann'], ApproximateAggregateValue: 1 }],
+        },
+      ])
+      const table = await client.send(
+        new DescribeContributorInsightsCommand({ TableName: tableName })
+      )
+      expect(table.ContributorInsightsStatus).toBe('DISABLED')
+
+      const { ContributorInsightsSummaries } = await client.send(
+        new ListContributorInsightsCommand({ TableName: tableName })
+      )
+      expect(ContributorInsightsSummaries).toEqual([
+        { TableName: tableName, ContributorInsightsStatus: 'DISABLED' },
+        {
+          TableName: tableName,
+          IndexName: 'byOwner',
+          ContributorInsightsStatus: 'ENABLED',
+        },
+      ])
+
+      await expect(
+        client.send(
+          new UpdateContributorInsightsCommand({
+            TableName: tableName,
+            IndexName: 'missing',
+            ContributorInsightsAction: 'ENABLE',
+          })
+        )
+      ).rejects.toHaveProperty('name', 'ResourceNotFoundException')
+    } finally {
+      await cleanup()
+    }
+  })
+})
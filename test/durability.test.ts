@@ -0,0 +1,164 @@
+// Tests for FSYNC_POLICY
+// A killed process leaves the OS page cache intact, so it never exercises
+// fsync; the policies are checked by the SQLite settings each one applies,
+// and process kills only check that recovery loads every acknowledged write
+
+import { test, expect, describe, afterEach } from 'bun:test'
+import { DB } from '../src/index.ts'
+import { Shard } from '../src/shard.ts'
+import { createConfig } from '../src/config.ts'
+import type { FsyncPolicy } from '../src/config.ts'
+import type { DynamoDBItem } from '../src/types.ts'
+import * as fs from 'fs/promises'
+import * as os from 'os'
+import * as path from 'path'
+
+const WRITER = path.join(import.meta.dir, 'fixtures', 'durability-writer.ts')
+
+describe('Fsync policies', () => {
+  const dataDirs: string[] = []
+
+  afterEach(async () => {
+    for (const dir of dataDirs) {
+      await fs.rm(dir, { recursive: true, force: true })
+    }
+    dataDirs.length = 0
+  })
+
+  async function openShard(policy: FsyncPolicy): Promise<Shard> {
+    const dataDir = await fs.mkdtemp(path.join(os.tmpdir(), 'dynado-fsync-'))
+    dataDirs.push(dataDir)
+    return new Shard(path.join(dataDir, 'shard.db'), 0, policy)
+  }
+
+  function pragma(shard: Shard, name: string): unknown {
+    const row = shard['db'].query(`PRAGMA ${name}`).get() as any
+    return row[name]
+  }
+
+  test('always: every commit is synced', async () => {
+    const shard = await openShard({ mode: 'always' })
+    try {
+      // 2 is FULL
+      expect(pragma(shard, 'synchronous')).toBe(2)
+    } finally {
+      shard.close()
+    }
+  })
+
+  test('interval: WAL commits are checkpointed on a timer', async () => {
+    const shard = await openShard({ mode: 'interval', intervalMs: 10 })
+    const db = shard['db']
+    const run = db.run.bind(db)
+    let checkpoints = 0
+    db.run = ((sql: string) => {
+      if (sql.includes('wal_checkpoint')) {
+        checkpoints++
+      }
+      return run(sql)
+    }) as any
+    try {
+      expect(pragma(shard, 'journal_mode')).toBe('wal')
+      // 1 is NORMAL
+      expect(pragma(shard, 'synchronous')).toBe(1)
+
+      await Bun.sleep(50)
+      expect(checkpoints).toBeGreaterThan(0)
+    } finally {
+      shard.close()
+    }
+
+    const afterClose = checkpoints
+    await Bun.sleep(50)
+    expect(checkpoints).toBe(afterClose)
+  })
+
+  test('never: commits are not synced', async () => {
+    const shard = await openShard({ mode: 'never' })
+    try {
+      expect(pragma(shard, 'journal_mode')).toBe('wal')
+      // 0 is OFF
+      expect(pragma(shard, 'synchronous')).toBe(0)
+    } finally {
+      shard.close()
+    }
+  })
+})
+
+describe('Process crashes', () => {
+  const dataDirs: string[] = []
+
+  afterEach(async () => {
+    for (const dir of dataDirs) {
+      await fs.rm(dir, { recursive: true, force: true })
+    }
+    dataDirs.length = 0
+  })
+
+  // Runs the writer until it has acknowledged minWrites items, then SIGKILLs it
+  async function writeThenKill(
+    policy: string,
+    minWrites: number
+  ): Promise<{ dataDir: string; acknowledged: number }> {
+    const dataDir = await fs.mkdtemp(path.join(os.tmpdir(), 'dynado-fsync-'))
+    dataDirs.push(dataDir)
+
+    const proc = Bun.spawn([process.execPath, 'run', WRITER, dataDir, policy], {
+      stdout: 'pipe',
+      stderr: 'inherit',
+    })
+    const reader = proc.stdout.getReader()
+    const decoder = new TextDecoder()
+    let buffered = ''
+    let acknowledged = 0
+
+    while (acknowledged < minWrites) {
+      const { value, done } = await reader.read()
+      if (done) {
+        throw new Error('durability writer exited before being killed')
+      }
+      buffered += decoder.decode(value, { stream: true })
+      const lines = buffered.split('\n')
+      buffered = lines.pop() ?? ''
+      for (const line of lines) {
+        if (line.trim()) {
+          acknowledged = parseInt(line) + 1
+        }
+      }
+    }
+
+    proc.kill(9)
+    await proc.exited
+    return { dataDir, acknowledged }
+  }
+
+  async function recoverSequenceNumbers(dataDir: string): Promise<number[]> {
+    const db = new DB(createConfig({ shardCount: 1, dataDir, port: 0 }))
+    try {
+      const schema = await db.metadataStore.describeTable('Durability')
+      expect(schema).not.toBeNull()
+      const { items } = await db.router.scan(schema!)
+      return items
+        .map((item: DynamoDBItem) => parseInt(item.seq!.N!))
+        .sort((a, b) => a - b)
+    } finally {
+      await db.stop()
+    }
+  }
+
+  for (const policy of ['always', 'interval:10', 'never']) {
+    test(
+      `${policy}: a killed process loses no acknowledged writes`,
+      async () => {
+        const { dataDir, acknowledged } = await writeThenKill(policy, 50)
+        const seqs = await recoverSequenceNumbers(dataDir)
+
+        // Writes after the last acknowledgement may also have landed
+        expect(seqs.length).toBeGreaterThanOrEqual(acknowledged)
+        seqs.forEach((seq, index) => {
+          expect(seq).toBe(index)
+        })
+      }
+    )
+  }
+})
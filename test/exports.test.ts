@@ -0,0 +1,215 @@
+// Tests for ExportTableToPointInTime
+// Starts dedicated servers, so exports can be written to a temporary directory
+
+import { test, expect, describe } from 'bun:test'
+import {
+  DescribeExportCommand,
+  ExportTableToPointInTimeCommand,
+  ListExportsCommand,
+  PutItemCommand,
+  UpdateContinuousBackupsCommand,
+  type DynamoDBClient,
+} from '@aws-sdk/client-dynamodb'
+import * as fs from 'fs/promises'
+import * as os from 'os'
+import * as path from 'path'
+import {
+  createTableWithItems,
+  startDynado,
+  startS3Stub,
+  uniqueTableName,
+} from './helpers.ts'
+
+describe('Exports', () => {
+  // DynamoDB Local does not implement exports
+  if (process.env.TEST_DYNAMODB_LOCAL === 'true') {
+    return
+  }
+
+  async function withExportDir(
+    run: (client: DynamoDBClient, exportDir: string) => Promise<void>
+  ) {
+    const exportDir = await fs.mkdtemp(path.join(os.tmpdir(), 'dynado-export-'))
+    const { client, cleanup } = await startDynado({ exportDir })
+    try {
+      await run(client, exportDir)
+    } finally {
+      await cleanup()
+      await fs.rm(exportDir, { recursive: true })
+    }
+  }
+
+  function enableRecovery(client: DynamoDBClient, TableName: string) {
+    return client.send(
+      new UpdateContinuousBackupsCommand({
+        TableName,
+        PointInTimeRecoverySpecification: { PointInTimeRecoveryEnabled: true },
+      })
+    )
+  }
+
+  const tableArn = (tableName: string) =>
+    `arn:aws:dynamodb:local:000000000000:table/${tableName}`
+
+  test('writes the table in the AWS export layout', async () => {
+    await withExportDir(async (client, exportDir) => {
+      const tableName = uniqueTableName('Exported')
+      await createTableWithItems(client, tableName, [{ id: 'a', n: 1 }])
+      await enableRecovery(client, tableName)
+      await client.send(
+        new PutItemCommand({
+          TableName: tableName,
+          Item: { id: { S: 'b' }, n: { N: '2' } },
+        })
+      )
+
+      const { ExportDescription } = await client.send(
+        new ExportTableToPointInTimeCommand({
+          TableArn: tableArn(tableName),
+          S3Bucket: 'exports',
+          S3Prefix: 'nightly',
+        })
+      )
+      expect(ExportDescription?.ExportStatus).toBe('COMPLETED')
+      expect(ExportDescription?.ItemCount).toBe(2)
+      expect(ExportDescription?.ExportManifest).toMatch(
+        /^nightly\/AWSDynamoDB\/[^/]+\/manifest-summary\.json$/
+      )
+
+      const bucket = path.join(exportDir, 'exports')
+      const summary = JSON.parse(
+        await fs.readFile(
+          path.join(bucket, ExportDescription!.ExportManifest!),
+          'utf8'
+        )
+      )
+      expect(summary.exportArn).toBe(ExportDescription?.ExportArn)
+      expect(summary.itemCount).toBe(2)
+      expect(summary.outputFormat).toBe('DYNAMODB_JSON')
+
+      const manifestFiles = await fs.readFile(
+        path.join(bucket, summary.manifestFilesS3Key),
+        'utf8'
+      )
+      const [dataFile] = manifestFiles.trim().split('\n').map(JSON.parse)
+      expect(dataFile.itemCount).toBe(2)
+      const data = Bun.gunzipSync(
+        await fs.readFile(path.join(bucket, dataFile.dataFileS3Key))
+      )
+      const items = new TextDecoder()
+        .decode(data)
+        .trim()
+        .split('\n')
+        .map((line) => JSON.parse(line).Item)
+      expect(items.map((item) => item.id.S).sort()).toEqual(['a', 'b'])
+
+      const described = await client.send(
+        new DescribeExportCommand({ ExportArn: ExportDescription?.ExportArn })
+      )
+      expect(described.ExportDescription?.S3Prefix).toBe('nightly')
+      const { ExportSummaries } = await client.send(
+        new ListExportsCommand({ TableArn: tableArn(tableName) })
+      )
+      expect(ExportSummaries).toEqual([
+        {
+          ExportArn: ExportDescription?.ExportArn,
+          ExportStatus: 'COMPLETED',
+          ExportType: 'FULL_EXPORT',
+        },
+      ])
+    })
+  })
+
+  test('a retried ClientToken returns the same export', async () => {
+    await withExportDir(async (client) => {
+      const tableName = uniqueTableName('Retried')
+      await createTableWithItems(client, tableName, [{ id: 'a' }])
+      await enableRecovery(client, tableName)
+      const request = {
+        TableArn: tableArn(tableName),
+        S3Bucket: 'exports',
+        ClientToken: 'retry-me',
+      }
+
+      const first = await client.send(
+        new ExportTableToPointInTimeCommand(request)
+      )
+      const second = await client.send(
+        new ExportTableToPointInTimeCommand(request)
+      )
+      expect(second.ExportDescription?.ExportArn).toBe(
+        first.ExportDescription?.ExportArn
+      )
+      await expect(
+        client.send(
+          new ExportTableToPointInTimeCommand({
+            ...request,
+            S3Bucket: 'elsewhere',
+          })
+        )
+      ).rejects.toHaveProperty('name', 'ExportConflictException')
+    })
+  })
+
+  test('a table without recovery enabled cannot be exported', async () => {
+    await withExportDir(async (client) => {
+      const tableName = uniqueTableName('Unexported')
+      await createTableWithItems(client, tableName, [{ id: 'a' }])
+      await expect(
+        client.send(
+          new ExportTableToPointInTimeCommand({
+            TableArn: tableArn(tableName),
+            S3Bucket: 'exports',
+          })
+        )
+      ).rejects.toHaveProperty(
+        'name',
+        'PointInTimeRecoveryUnavailableException'
+      )
+    })
+  })
+
+  test('writes to EXPORT_S3_ENDPOINT when it is set', async () => {
+    const s3 = startS3Stub()
+    const { client, cleanup } = await startDynado({
+      exportS3Endpoint: s3.endpoint,
+    })
+    try {
+      const tableName = uniqueTableName('ExportedToS3')
+      await createTableWithItems(client, tableName, [{ id: 'a' }, { id: 'b' }])
+      await enableRecovery(client, tableName)
+
+      const { ExportDescription } = await client.send(
+        new ExportTableToPointInTimeCommand({
+          TableArn: tableArn(tableName),
+          S3Bucket: 'exports',
+          S3Prefix: 'nightly',
+        })
+      )
+      expect(ExportDescription?.ExportStatus).toBe('COMPLETED')
+
+      const read = (key: string) => {
+        const data = s3.objects.get(`exports/${key}`)
+        expect(data).toBeDefined()
+        return data!
+      }
+      const summary = JSON.parse(
+        new TextDecoder().decode(read(ExportDescription!.ExportManifest!))
+      )
+      expect(summary.itemCount).toBe(2)
+      const manifestFiles = new TextDecoder().decode(
+        read(summary.manifestFilesS3Key)
+      )
+      const [dataFile] = manifestFiles.trim().split('\n').map(JSON.parse)
+      const items = new TextDecoder()
+        .decode(Bun.gunzipSync(read(dataFile.dataFileS3Key)))
+        .trim()
+        .split('\n')
+        .map((line) => JSON.parse(line).Item)
+      expect(items.map((item) => item.id.S).sort()).toEqual(['a', 'b'])
+    } finally {
+      await cleanup()
+      s3.stop()
+    }
+  })
+})
@@ -0,0 +1,33 @@
+// Child process for durability tests: writes sequential items through the
+// router and reports each acknowledged write on stdout until it is killed.
+
+import { DB } from '../../src/index.ts'
+import { createConfig, parseFsyncPolicy } from '../../src/config.ts'
+
+const [dataDir, policy] = process.argv.slice(2)
+if (!dataDir || !policy) {
+  throw new Error('usage: durability-writer.ts <dataDir> <fsyncPolicy>')
+}
+
+const db = new DB(
+  createConfig({
+    shardCount: 1,
+    dataDir,
+    port: 0,
+    fsyncPolicy: parseFsyncPolicy(policy),
+  })
+)
+
+await db.metadataStore.createTable({
+  tableName: 'Durability',
+  keySchema: [{ AttributeName: 'id', KeyType: 'HASH' }],
+  attributeDefinitions: [{ AttributeName: 'id', AttributeType: 'S' }],
+})
+
+for (let seq = 0; ; seq++) {
+  await db.router.putItem('Durability', {
+    id: { S: `item-${seq}` },
+    seq: { N: String(seq) },
+  })
+  console.log(seq)
+}
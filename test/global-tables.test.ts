@@ -0,0 +1,180 @@
+// Tests for global tables
+// Starts dedicated servers, so replica regions can be configured per test
+
+import { test, expect, describe } from 'bun:test'
+import {
+  CreateGlobalTableCommand,
+  CreateTableCommand,
+  DescribeGlobalTableCommand,
+  DynamoDBClient,
+  GetItemCommand,
+  ListTablesCommand,
+  PutItemCommand,
+  UpdateGlobalTableCommand,
+} from '@aws-sdk/client-dynamodb'
+import type { DB } from '../src/index.ts'
+import { startDynado, uniqueTableName } from './helpers.ts'
+
+describe('Global tables', () => {
+  // DynamoDB Local does not implement global tables
+  if (process.env.TEST_DYNAMODB_LOCAL === 'true') {
+    return
+  }
+
+  const LAG_MS = 100
+
+  // A client for one region of the server, as an application in that
+  // region would have
+  function regionClient(db: DB, region: string) {
+    return new DynamoDBClient({
+      endpoint: `http://localhost:${db.server.port}`,
+      region,
+      credentials: { accessKeyId: 'test', secretAccessKey: 'test' },
+      maxAttempts: 1,
+    })
+  }
+
+  function createReplicaTable(client: DynamoDBClient, TableName: string) {
+    return client.send(
+      new CreateTableCommand({
+        TableName,
+        KeySchema: [{ AttributeName: 'id', KeyType: 'HASH' }],
+        AttributeDefinitions: [{ AttributeName: 'id', AttributeType: 'S' }],
+        BillingMode: 'PAY_PER_REQUEST',
+        StreamSpecification: {
+          StreamEnabled: true,
+          StreamViewType: 'NEW_AND_OLD_IMAGES',
+        },
+      })
+    )
+  }
+
+  async function withRegions(
+    run: (east: DynamoDBClient, west: DynamoDBClient) => Promise<void>
+  ) {
+    const { db, client, cleanup } = await startDynado({
+      replicaRegions: ['us-west-2'],
+      replicationLagMs: LAG_MS,
+    })
+    const west = regionClient(db, 'us-west-2')
+    try {
+      await run(client, west)
+    } finally {
+      west.destroy()
+      await cleanup()
+    }
+  }
+
+  async function getValue(
+    client: DynamoDBClient,
+    TableName: string,
+    id: string
+  ) {
+    const { Item } = await client.send(
+      new GetItemCommand({ TableName, Key: { id: { S: id } } })
+    )
+    return Item?.value?.S
+  }
+
+  function putValue(
+    client: DynamoDBClient,
+    TableName: string,
+    id: string,
+    value: string
+  ) {
+    return client.send(
+      new PutItemCommand({
+        TableName,
+        Item: { id: { S: id }, value: { S: value } },
+      })
+    )
+  }
+
+  test('each replica region has its own tables', async () => {
+    await withRegions(async (east, west) => {
+      const tableName = uniqueTableName('Regional')
+      await createReplicaTable(west, tableName)
+
+      const eastTables = await east.send(new ListTablesCommand({}))
+      expect(eastTables.TableNames).not.toContain(tableName)
+      const westTables = await west.send(new ListTablesCommand({}))
+      expect(westTables.TableNames).toContain(tableName)
+    })
+  })
+
+  test('writes reach the other replica after the lag', async () => {
+    await withRegions(async (east, west) => {
+      const tableName = uniqueTableName('Replicated')
+      await createReplicaTable(east, tableName)
+      await createReplicaTable(west, tableName)
+      const { GlobalTableDescription } = await east.send(
+        new CreateGlobalTableCommand({
+          GlobalTableName: tableName,
+          ReplicationGroup: [
+            { RegionName: 'local' },
+            { RegionName: 'us-west-2' },
+          ],
+        })
+      )
+      expect(GlobalTableDescription?.GlobalTableStatus).toBe('ACTIVE')
+
+      await putValue(east, tableName, 'a', 'from-east')
+      expect(await getValue(west, tableName, 'a')).toBeUndefined()
+      await Bun.sleep(LAG_MS * 3)
+      expect(await getValue(west, tableName, 'a')).toBe('from-east')
+
+      // Concurrent writes settle on the later one in both regions
+      await putValue(west, tableName, 'b', 'first')
+      await Bun.sleep(5)
+      await putValue(east, tableName, 'b', 'second')
+      await Bun.sleep(LAG_MS * 3)
+      expect(await getValue(east, tableName, 'b')).toBe('second')
+      expect(await getValue(west, tableName, 'b')).toBe('second')
+    })
+  })
+
+  test('replicas must have streams and may be removed', async () => {
+    await withRegions(async (east, west) => {
+      const tableName = uniqueTableName('Grouped')
+      await createReplicaTable(east, tableName)
+      await west.send(
+        new CreateTableCommand({
+          TableName: tableName,
+          KeySchema: [{ AttributeName: 'id', KeyType: 'HASH' }],
+          AttributeDefinitions: [{ AttributeName: 'id', AttributeType: 'S' }],
+          BillingMode: 'PAY_PER_REQUEST',
+        })
+      )
+      await expect(
+        east.send(
+          new CreateGlobalTableCommand({
+            GlobalTableName: tableName,
+            ReplicationGroup: [
+              { RegionName: 'local' },
+              { RegionName: 'us-west-2' },
+            ],
+          })
+        )
+      ).rejects.toHaveProperty('name', 'ValidationException')
+
+      await east.send(
+        new CreateGlobalTableCommand({
+          GlobalTableName: tableName,
+          ReplicationGroup: [{ RegionName: 'local' }],
+        })
+      )
+      const { GlobalTableDescription } = await west.send(
+        new UpdateGlobalTableCommand({
+          GlobalTableName: tableName,
+          ReplicaUpdates: [{ Delete: { RegionName: 'local' } }],
+        })
+      )
+      expect(GlobalTableDescription?.ReplicationGroup).toEqual([])
+      await expect(
+        east.send(
+          new DescribeGlobalTableCommand({ GlobalTableName: 'missing' })
+        )
+      ).rejects.toHaveProperty('name', 'GlobalTableNotFoundException')
+    })
+  })
+})
@@ -137,13 +137,116 @@ export async function startTestDB(): Promise<TestDBSetup> {
     return {
       endpoint: `http://localhost:${port}`,
       cleanup: async () => {
-        await db.server.stop()
+        await db.stop()
         await fs.rm(tmpDir, { recursive: true })
       },
     }
   }
 }
 
+/**
+ * Starts a dedicated dynado server with config overrides, for tests that
+ * need non-default settings or direct access to the DB instance.
+ */
+export async function startDynado(
+  params: Parameters<typeof createConfig>[0] = {}
+): Promise<{
+  db: DB
+  client: DynamoDBClient
+  cleanup: () => Promise<void>
+}> {
+  const tmpDir = await fs.mkdtemp(path.join(os.tmpdir(), 'dynado-test-'))
+  const db = new DB(createConfig({ port: 0, dataDir: tmpDir, ...params }))
+  const client = new DynamoDBClient({
+    endpoint: `http://localhost:${db.server.port}`,
+    region: 'local',
+    credentials: {
+      accessKeyId: 'test',
+      secretAccessKey: 'test',
+    },
+    maxAttempts: 1,
+  })
+
+  return {
+    db,
+    client,
+    cleanup: async () => {
+      client.destroy()
+      await db.stop()
+      await fs.rm(tmpDir, { recursive: true })
+    },
+  }
+}
+
+/**
+ * Starts an in-memory S3-compatible endpoint that serves PutObject,
+ * GetObject and ListObjectsV2 with path-style URLs, for tests of
+ * EXPORT_S3_ENDPOINT. Objects are keyed by `<bucket>/<key>`. Requests are
+ * not authenticated, but Bun's S3 client needs credentials to sign them,
+ * so placeholders are set until the stub stops.
+ */
+export function startS3Stub(): {
+  endpoint: string
+  objects: Map<string, Uint8Array>
+  stop: () => void
+} {
+  const objects = new Map<string, Uint8Array>()
+  const server = Bun.serve({
+    port: 0,
+    async fetch(req) {
+      const url = new URL(req.url)
+      const [bucket = '', ...rest] = url.pathname.slice(1).split('/')
+      const key = decodeURIComponent(rest.join('/'))
+      if (req.method === 'PUT') {
+        objects.set(`${bucket}/${key}`, new Uint8Array(await req.arrayBuffer()))
+        return new Response(null, { headers: { ETag: '"stub"' } })
+      }
+      if (req.method === 'GET' && url.searchParams.has('list-type')) {
+        const prefix = `${bucket}/${url.searchParams.get('prefix') ?? ''}`
+        const contents = [...objects]
+          .filter(([name]) => name.startsWith(prefix))
+          .map(
+            ([name, data]) =>
+              `<Contents><Key>${name.slice(bucket.length + 1)}</Key>` +
+              `<Size>${data.length}</Size></Contents>`
+          )
+        return new Response(
+          '<?xml version="1.0" encoding="UTF-8"?>' +
+            `<ListBucketResult><Name>${bucket}</Name>` +
+            `<KeyCount>${contents.length}</KeyCount>` +
+            `<IsTruncated>false</IsTruncated>${contents.join('')}` +
+            '</ListBucketResult>',
+          { headers: { 'Content-Type': 'application/xml' } }
+        )
+      }
+      const data = objects.get(`${bucket}/${key}`)
+      if (req.method === 'GET' && data) return new Response(data)
+      return new Response(
+        '<Error><Code>NoSuchKey</Code><Message>Not found</Message></Error>',
+        { status: 404, headers: { 'Content-Type': 'application/xml' } }
+      )
+    },
+  })
+
+  const credentials = {
+    S3_ACCESS_KEY_ID: process.env.S3_ACCESS_KEY_ID,
+    S3_SECRET_ACCESS_KEY: process.env.S3_SECRET_ACCESS_KEY,
+  }
+  process.env.S3_ACCESS_KEY_ID ??= 'test'
+  process.env.S3_SECRET_ACCESS_KEY ??= 'test'
+
+  return {
+    endpoint: `http://localhost:${server.port}`,
+    objects,
+    stop: () => {
+      server.stop()
+      for (const [name, value] of Object.entries(credentials)) {
+        if (value === undefined) delete process.env[name]
+      }
+    },
+  }
+}
+
 /**
  * Generates a globally unique table name using a shared counter.
  */
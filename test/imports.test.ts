@@ -0,0 +1,228 @@
+// Tests for ImportTable
+// Starts dedicated servers, so imports can be read from a temporary directory
+
+import { test, expect, describe } from 'bun:test'
+import {
+  CreateTableCommand,
+  DescribeImportCommand,
+  ImportTableCommand,
+  ListImportsCommand,
+  ScanCommand,
+  type DynamoDBClient,
+  type ImportTableCommandInput,
+} from '@aws-sdk/client-dynamodb'
+import * as fs from 'fs/promises'
+import * as os from 'os'
+import * as path from 'path'
+import { startDynado, startS3Stub, uniqueTableName } from './helpers.ts'
+
+describe('Imports', () => {
+  // DynamoDB Local does not implement imports
+  if (process.env.TEST_DYNAMODB_LOCAL === 'true') {
+    return
+  }
+
+  async function withBucket(
+    files: Record<string, string | Uint8Array>,
+    run: (client: DynamoDBClient) => Promise<void>
+  ) {
+    const exportDir = await fs.mkdtemp(path.join(os.tmpdir(), 'dynado-import-'))
+    for (const [key, data] of Object.entries(files)) {
+      const file = path.join(exportDir, 'seeds', key)
+      await fs.mkdir(path.dirname(file), { recursive: true })
+      await fs.writeFile(file, data)
+    }
+    const { client, cleanup } = await startDynado({ exportDir })
+    try {
+      await run(client)
+    } finally {
+      await cleanup()
+      await fs.rm(exportDir, { recursive: true })
+    }
+  }
+
+  function importTable(
+    client: DynamoDBClient,
+    TableName: string,
+    request: Partial<ImportTableCommandInput>
+  ) {
+    return client.send(
+      new ImportTableCommand({
+        S3BucketSource: { S3Bucket: 'seeds', S3KeyPrefix: 'items/' },
+        InputFormat: 'DYNAMODB_JSON',
+        TableCreationParameters: {
+          TableName,
+          KeySchema: [{ AttributeName: 'id', KeyType: 'HASH' }],
+          AttributeDefinitions: [{ AttributeName: 'id', AttributeType: 'S' }],
+          BillingMode: 'PAY_PER_REQUEST',
+        },
+        ...request,
+      })
+    )
+  }
+
+  async function scan(client: DynamoDBClient, TableName: string) {
+    const { Items } = await client.send(new ScanCommand({ TableName }))
+    return Items!.sort((a, b) =>
+      JSON.stringify(a.id).localeCompare(JSON.stringify(b.id))
+    )
+  }
+
+  test('imports gzipped DynamoDB JSON, skipping bad items', async () => {
+    const lines = [
+      '{"Item":{"id":{"S":"a"},"n":{"N":"1"}}}',
+      'not json',
+      '{"Item":{"n":{"N":"2"}}}',
+      '{"Item":{"id":{"S":"b"},"tags":{"SS":["x","y"]}}}',
+    ]
+    const files = {
+      'items/part-1.json.gz': Bun.gzipSync(lines.slice(0, 2).join('\n')),
+      'items/part-2.json.gz': Bun.gzipSync(lines.slice(2).join('\n')),
+      'other/ignored.json.gz': Bun.gzipSync(lines[0]!),
+    }
+    await withBucket(files, async (client) => {
+      const tableName = uniqueTableName('Imported')
+      const { ImportTableDescription } = await importTable(client, tableName, {
+        InputCompressionType: 'GZIP',
+      })
+      expect(ImportTableDescription?.ImportStatus).toBe('COMPLETED')
+      expect(ImportTableDescription?.ProcessedItemCount).toBe(4)
+      expect(ImportTableDescription?.ImportedItemCount).toBe(2)
+      expect(ImportTableDescription?.ErrorCount).toBe(2)
+      expect(ImportTableDescription?.TableArn).toBe(
+        `arn:aws:dynamodb:local:000000000000:table/${tableName}`
+      )
+
+      expect(await scan(client, tableName)).toEqual([
+        { id: { S: 'a' }, n: { N: '1' } },
+        { id: { S: 'b' }, tags: { SS: ['x', 'y'] } },
+      ])
+
+      const described = await client.send(
+        new DescribeImportCommand({
+          ImportArn: ImportTableDescription?.ImportArn,
+        })
+      )
+      expect(described.ImportTableDescription?.ImportedItemCount).toBe(2)
+      const { ImportSummaryList } = await client.send(
+        new ListImportsCommand({ TableArn: ImportTableDescription?.TableArn })
+      )
+      expect(ImportSummaryList?.map((s) => s.ImportArn)).toEqual([
+        ImportTableDescription?.ImportArn,
+      ])
+    })
+  })
+
+  test('imports CSV with key attributes typed by the table', async () => {
+    const files = {
+      'items/rows.csv': 'id;name;note\n1;"Smith; J";\n2;Jones;"said ""hi"""\n',
+    }
+    await withBucket(files, async (client) => {
+      const tableName = uniqueTableName('FromCsv')
+      const { ImportTableDescription } = await importTable(client, tableName, {
+        InputFormat: 'CSV',
+        InputFormatOptions: { Csv: { Delimiter: ';' } },
+        TableCreationParameters: {
+          TableName: tableName,
+          KeySchema: [{ AttributeName: 'id', KeyType: 'HASH' }],
+          AttributeDefinitions: [{ AttributeName: 'id', AttributeType: 'N' }],
+          BillingMode: 'PAY_PER_REQUEST',
+        },
+      })
+      expect(ImportTableDescription?.ImportedItemCount).toBe(2)
+      expect(await scan(client, tableName)).toEqual([
+        { id: { N: '1' }, name: { S: 'Smith; J' } },
+        { id: { N: '2' }, name: { S: 'Jones' }, note: { S: 'said "hi"' } },
+      ])
+    })
+  })
+
+  test('imports Ion in the layout DynamoDB exports it', async () => {
+    const files = {
+      'items/data.ion': [
+        '$ion_1_0 {Item:{id:"a",n:1.5d1,ok:true,gone:null.string}}',
+        "$ion_1_0 {Item:{id:\"b\",tags:$dynamodb_NS::[1.,2.],'nested':{l:[\"x\"]}}}",
+      ].join('\n'),
+    }
+    await withBucket(files, async (client) => {
+      const tableName = uniqueTableName('FromIon')
+      const { ImportTableDescription } = await importTable(client, tableName, {
+        InputFormat: 'ION',
+      })
+      expect(ImportTableDescription?.ImportedItemCount).toBe(2)
+      expect(await scan(client, tableName)).toEqual([
+        {
+          id: { S: 'a' },
+          n: { N: '1.5E1' },
+          ok: { BOOL: true },
+          gone: { NULL: true },
+        },
+        {
+          id: { S: 'b' },
+          tags: { NS: ['1', '2'] },
+          nested: { M: { l: { L: [{ S: 'x' }] } } },
+        },
+      ])
+    })
+  })
+
+  test('an import without source objects fails without a table', async () => {
+    await withBucket({}, async (client) => {
+      const tableName = uniqueTableName('Unimported')
+      const { ImportTableDescription } = await importTable(client, tableName, {
+        ClientToken: 'once',
+      })
+      expect(ImportTableDescription?.ImportStatus).toBe('FAILED')
+      expect(ImportTableDescription?.FailureMessage).toContain('items/')
+      await expect(
+        client.send(new ScanCommand({ TableName: tableName }))
+      ).rejects.toHaveProperty('name', 'ResourceNotFoundException')
+
+      await expect(
+        importTable(client, uniqueTableName('Other'), { ClientToken: 'once' })
+      ).rejects.toHaveProperty('name', 'ImportConflictException')
+
+      const existing = uniqueTableName('Existing')
+      await client.send(
+        new CreateTableCommand({
+          TableName: existing,
+          KeySchema: [{ AttributeName: 'id', KeyType: 'HASH' }],
+          AttributeDefinitions: [{ AttributeName: 'id', AttributeType: 'S' }],
+          BillingMode: 'PAY_PER_REQUEST',
+        })
+      )
+      await expect(importTable(client, existing, {})).rejects.toHaveProperty(
+        'name',
+        'ResourceInUseException'
+      )
+    })
+  })
+
+  test('reads from EXPORT_S3_ENDPOINT when it is set', async () => {
+    const s3 = startS3Stub()
+    const files = {
+      'items/part-1.json': '{"Item":{"id":{"S":"a"}}}',
+      'items/part-2.json': '{"Item":{"id":{"S":"b"}}}',
+      'other/ignored.json': '{"Item":{"id":{"S":"c"}}}',
+    }
+    for (const [key, data] of Object.entries(files)) {
+      s3.objects.set(`seeds/${key}`, new TextEncoder().encode(data))
+    }
+    const { client, cleanup } = await startDynado({
+      exportS3Endpoint: s3.endpoint,
+    })
+    try {
+      const tableName = uniqueTableName('ImportedFromS3')
+      const response = await importTable(client, tableName, {})
+      expect(response.ImportTableDescription?.ImportStatus).toBe('COMPLETED')
+      expect(response.ImportTableDescription?.ImportedItemCount).toBe(2)
+      expect(await scan(client, tableName)).toEqual([
+        { id: { S: 'a' } },
+        { id: { S: 'b' } },
+      ])
+    } finally {
+      await cleanup()
+      s3.stop()
+    }
+  })
+})
@@ -0,0 +1,973 @@
+// Tests for secondary index reads
+// Uses HTTP API via AWS SDK
+
+import { test, expect, beforeAll, afterEach, describe } from 'bun:test'
+import {
+  DynamoDBClient,
+  BatchWriteItemCommand,
+  CreateTableCommand,
+  DeleteItemCommand,
+  DescribeTableCommand,
+  PutItemCommand,
+  UpdateItemCommand,
+  QueryCommand,
+  ScanCommand,
+  UpdateTableCommand,
+} from '@aws-sdk/client-dynamodb'
+import type { AttributeValue, Select } from '@aws-sdk/client-dynamodb'
+import {
+  getGlobalTestDB,
+  createTable,
+  cleanupTables,
+  startDynado,
+  uniqueTableName,
+  trackTable,
+} from './helpers.ts'
+
+describe('Secondary indexes', () => {
+  let client: DynamoDBClient
+  let endpoint: string
+  const createdTables: string[] = []
+
+  beforeAll(async () => {
+    const testDB = await getGlobalTestDB()
+    client = testDB.client
+    endpoint = testDB.endpoint
+  })
+
+  afterEach(async () => {
+    await cleanupTables(client, createdTables)
+  })
+
+  test('INCLUDE GSI queries return only projected attributes', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('IncludeGsi'))
+    await createTable(client, tableName, {
+      attributeDefinitions: [
+        { AttributeName: 'id', AttributeType: 'S' },
+        { AttributeName: 'category', AttributeType: 'S' },
+      ],
+      GlobalSecondaryIndexes: [
+        {
+          IndexName: 'ByCategory',
+          KeySchema: [{ AttributeName: 'category', KeyType: 'HASH' }],
+          Projection: {
+            ProjectionType: 'INCLUDE',
+            NonKeyAttributes: ['title'],
+          },
+        },
+      ],
+    })
+
+    await client.send(
+      new PutItemCommand({
+        TableName: tableName,
+        Item: {
+          id: { S: 'item-1' },
+          category: { S: 'books' },
+          title: { S: 'Dune' },
+        },
+      })
+    )
+    // Sparse: no index key, so never visible through the index
+    await client.send(
+      new PutItemCommand({
+        TableName: tableName,
+        Item: { id: { S: 'item-2' }, title: { S: 'Uncategorized' } },
+      })
+    )
+    // Attribute added later is not part of the projection
+    await client.send(
+      new UpdateItemCommand({
+        TableName: tableName,
+        Key: { id: { S: 'item-1' } },
+        UpdateExpression: 'SET secret = :s',
+        ExpressionAttributeValues: { ':s': { S: 'hidden' } },
+      })
+    )
+
+    const response = await client.send(
+      new QueryCommand({
+        TableName: tableName,
+        IndexName: 'ByCategory',
+        KeyConditionExpression: 'category = :c',
+        ExpressionAttributeValues: { ':c': { S: 'books' } },
+      })
+    )
+
+    expect(response.Items).toEqual([
+      {
+        id: { S: 'item-1' },
+        category: { S: 'books' },
+        title: { S: 'Dune' },
+      },
+    ])
+  })
+
+  test('ScanIndexForward=false orders by the index sort key', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('GsiOrder'))
+    await createTable(client, tableName, {
+      attributeDefinitions: [
+        { AttributeName: 'id', AttributeType: 'S' },
+        { AttributeName: 'player', AttributeType: 'S' },
+        { AttributeName: 'score', AttributeType: 'N' },
+      ],
+      GlobalSecondaryIndexes: [
+        {
+          IndexName: 'ByScore',
+          KeySchema: [
+            { AttributeName: 'player', KeyType: 'HASH' },
+            { AttributeName: 'score', KeyType: 'RANGE' },
+          ],
+          Projection: { ProjectionType: 'ALL' },
+        },
+      ],
+    })
+
+    for (const [id, score] of [
+      ['game-a', '7'],
+      ['game-b', '42'],
+      ['game-c', '9'],
+    ] as const) {
+      await client.send(
+        new PutItemCommand({
+          TableName: tableName,
+          Item: {
+            id: { S: id },
+            player: { S: 'alice' },
+            score: { N: score },
+          },
+        })
+      )
+    }
+
+    const response = await client.send(
+      new QueryCommand({
+        TableName: tableName,
+        IndexName: 'ByScore',
+        KeyConditionExpression: 'player = :p',
+        ExpressionAttributeValues: { ':p': { S: 'alice' } },
+        ScanIndexForward: false,
+      })
+    )
+
+    expect(response.Items!.map((item) => item.score!.N)).toEqual([
+      '42',
+      '9',
+      '7',
+    ])
+  })
+
+  test('GSI items with equal sort keys page in a stable order', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('GsiTies'))
+    await createTable(client, tableName, {
+      attributeDefinitions: [
+        { AttributeName: 'id', AttributeType: 'S' },
+        { AttributeName: 'queue', AttributeType: 'S' },
+        { AttributeName: 'priority', AttributeType: 'N' },
+      ],
+      GlobalSecondaryIndexes: [
+        {
+          IndexName: 'ByPriority',
+          KeySchema: [
+            { AttributeName: 'queue', KeyType: 'HASH' },
+            { AttributeName: 'priority', KeyType: 'RANGE' },
+          ],
+          Projection: { ProjectionType: 'ALL' },
+        },
+      ],
+    })
+
+    const ids = Array.from({ length: 9 }, (_, i) => `job-${i}`)
+    for (const [i, id] of ids.entries()) {
+      await client.send(
+        new PutItemCommand({
+          TableName: tableName,
+          Item: {
+            id: { S: id },
+            queue: { S: 'default' },
+            // Three jobs share each priority
+            priority: { N: String(Math.floor(i / 3)) },
+          },
+        })
+      )
+    }
+
+    const pagedIds = async () => {
+      const seen: string[] = []
+      let startKey: Record<string, AttributeValue> | undefined
+      do {
+        const page = await client.send(
+          new QueryCommand({
+            TableName: tableName,
+            IndexName: 'ByPriority',
+            KeyConditionExpression: 'queue = :q',
+            ExpressionAttributeValues: { ':q': { S: 'default' } },
+            Limit: 2,
+            ExclusiveStartKey: startKey,
+          })
+        )
+        seen.push(...page.Items!.map((item) => item.id!.S!))
+        startKey = page.LastEvaluatedKey
+      } while (startKey)
+      return seen
+    }
+
+    const first = await pagedIds()
+    expect([...first].sort()).toEqual(ids)
+    expect(await pagedIds()).toEqual(first)
+    // Dynado breaks ties by the table key; DynamoDB's tie order is its own
+    if (process.env.TEST_DYNAMODB_LOCAL !== 'true') {
+      expect(first).toEqual(ids)
+    }
+  })
+
+  test('GSI pages are keyed by the index keys and the table keys', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('GsiPageKey'))
+    await createTable(client, tableName, {
+      attributeDefinitions: [
+        { AttributeName: 'id', AttributeType: 'S' },
+        { AttributeName: 'owner', AttributeType: 'S' },
+        { AttributeName: 'createdAt', AttributeType: 'N' },
+      ],
+      GlobalSecondaryIndexes: [
+        {
+          IndexName: 'ByOwner',
+          KeySchema: [
+            { AttributeName: 'owner', KeyType: 'HASH' },
+            { AttributeName: 'createdAt', KeyType: 'RANGE' },
+          ],
+          Projection: { ProjectionType: 'KEYS_ONLY' },
+        },
+      ],
+    })
+    for (const [id, createdAt] of [
+      ['doc-1', '10'],
+      ['doc-2', '20'],
+    ] as const) {
+      await client.send(
+        new PutItemCommand({
+          TableName: tableName,
+          Item: {
+            id: { S: id },
+            owner: { S: 'ada' },
+            createdAt: { N: createdAt },
+            body: { S: 'text' },
+          },
+        })
+      )
+    }
+
+    const query = (startKey?: Record<string, AttributeValue>) =>
+      client.send(
+        new QueryCommand({
+          TableName: tableName,
+          IndexName: 'ByOwner',
+          KeyConditionExpression: '#owner = :owner',
+          ExpressionAttributeNames: { '#owner': 'owner' },
+          ExpressionAttributeValues: { ':owner': { S: 'ada' } },
+          Limit: 1,
+          ExclusiveStartKey: startKey,
+        })
+      )
+
+    const first = await query()
+    expect(first.LastEvaluatedKey).toEqual({
+      id: { S: 'doc-1' },
+      owner: { S: 'ada' },
+      createdAt: { N: '10' },
+    })
+    const second = await query(first.LastEvaluatedKey)
+    expect(second.Items).toEqual([
+      { id: { S: 'doc-2' }, owner: { S: 'ada' }, createdAt: { N: '20' } },
+    ])
+  })
+
+  test('INDEXES capacity of a GSI query is charged to the index', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('GsiCapacity'))
+    await createTable(client, tableName, {
+      attributeDefinitions: [
+        { AttributeName: 'id', AttributeType: 'S' },
+        { AttributeName: 'category', AttributeType: 'S' },
+      ],
+      GlobalSecondaryIndexes: [
+        {
+          IndexName: 'ByCategory',
+          KeySchema: [{ AttributeName: 'category', KeyType: 'HASH' }],
+          Projection: { ProjectionType: 'ALL' },
+        },
+      ],
+    })
+    await client.send(
+      new PutItemCommand({
+        TableName: tableName,
+        Item: { id: { S: 'item-1' }, category: { S: 'books' } },
+      })
+    )
+
+    const byIndex = await client.send(
+      new QueryCommand({
+        TableName: tableName,
+        IndexName: 'ByCategory',
+        KeyConditionExpression: 'category = :c',
+        ExpressionAttributeValues: { ':c': { S: 'books' } },
+        ReturnConsumedCapacity: 'INDEXES',
+      })
+    )
+    const indexCapacity = byIndex.ConsumedCapacity!
+    expect(indexCapacity.TableName).toBe(tableName)
+    expect(indexCapacity.CapacityUnits).toBeGreaterThan(0)
+    expect(indexCapacity.GlobalSecondaryIndexes).toEqual({
+      ByCategory: expect.objectContaining({
+        CapacityUnits: indexCapacity.CapacityUnits,
+      }),
+    })
+    expect(indexCapacity.Table?.CapacityUnits ?? 0).toBe(0)
+
+    const byTable = await client.send(
+      new QueryCommand({
+        TableName: tableName,
+        KeyConditionExpression: 'id = :id',
+        ExpressionAttributeValues: { ':id': { S: 'item-1' } },
+        ReturnConsumedCapacity: 'INDEXES',
+      })
+    )
+    const tableCapacity = byTable.ConsumedCapacity!
+    expect(tableCapacity.Table?.CapacityUnits).toBe(
+      tableCapacity.CapacityUnits
+    )
+    expect(tableCapacity.GlobalSecondaryIndexes).toBeUndefined()
+  })
+
+  test('CreateTable rejects more than 20 GSIs', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('TooMany'))
+    const indexes = Array.from({ length: 21 }, (_, i) => ({
+      IndexName: `Index${i}`,
+      KeySchema: [{ AttributeName: 'category', KeyType: 'HASH' as const }],
+      Projection: { ProjectionType: 'KEYS_ONLY' as const },
+    }))
+
+    await expect(
+      createTable(client, tableName, {
+        attributeDefinitions: [
+          { AttributeName: 'id', AttributeType: 'S' },
+          { AttributeName: 'category', AttributeType: 'S' },
+        ],
+        GlobalSecondaryIndexes: indexes,
+      })
+    ).rejects.toHaveProperty('name', 'LimitExceededException')
+  })
+
+  test('CreateTable rejects more than 5 LSIs', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('TooManyLsi'))
+    const indexes = Array.from({ length: 6 }, (_, i) => ({
+      IndexName: `Index${i}`,
+      KeySchema: [
+        { AttributeName: 'pk', KeyType: 'HASH' as const },
+        { AttributeName: 'other', KeyType: 'RANGE' as const },
+      ],
+      Projection: { ProjectionType: 'KEYS_ONLY' as const },
+    }))
+
+    const error = await createTable(client, tableName, {
+      keySchema: [
+        { AttributeName: 'pk', KeyType: 'HASH' },
+        { AttributeName: 'sk', KeyType: 'RANGE' },
+      ],
+      attributeDefinitions: [
+        { AttributeName: 'pk', AttributeType: 'S' },
+        { AttributeName: 'sk', AttributeType: 'S' },
+        { AttributeName: 'other', AttributeType: 'S' },
+      ],
+      LocalSecondaryIndexes: indexes,
+    }).catch((e) => e)
+    expect(error.name).toBe('LimitExceededException')
+    expect(error.message).toContain('per-table limit of 5')
+  })
+
+  test('an LSI cannot be added after the table is created', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('AddLsi'))
+    await createTable(client, tableName)
+
+    // The SDK drops LocalSecondaryIndexes from UpdateTable, so send it raw
+    const response = await fetch(endpoint, {
+      method: 'POST',
+      headers: {
+        'x-amz-target': 'DynamoDB_20120810.UpdateTable',
+        'Content-Type': 'application/x-amz-json-1.0',
+      },
+      body: JSON.stringify({
+        TableName: tableName,
+        LocalSecondaryIndexes: [
+          {
+            IndexName: 'ByCategory',
+            KeySchema: [
+              { AttributeName: 'id', KeyType: 'HASH' },
+              { AttributeName: 'category', KeyType: 'RANGE' },
+            ],
+            Projection: { ProjectionType: 'ALL' },
+          },
+        ],
+      }),
+    })
+    const body = (await response.json()) as { __type: string }
+    expect(response.status).toBe(400)
+    expect(body.__type).toContain('ValidationException')
+
+    const { Table } = await client.send(
+      new DescribeTableCommand({ TableName: tableName })
+    )
+    expect(Table!.LocalSecondaryIndexes).toBeUndefined()
+  })
+
+  describe('ConsistentRead on index scans', () => {
+    async function createIndexedTable(): Promise<string> {
+      const tableName = trackTable(createdTables, uniqueTableName('Consistent'))
+      return await createTable(client, tableName, {
+        keySchema: [
+          { AttributeName: 'pk', KeyType: 'HASH' },
+          { AttributeName: 'sk', KeyType: 'RANGE' },
+        ],
+        attributeDefinitions: [
+          { AttributeName: 'pk', AttributeType: 'S' },
+          { AttributeName: 'sk', AttributeType: 'S' },
+          { AttributeName: 'createdAt', AttributeType: 'N' },
+        ],
+        LocalSecondaryIndexes: [
+          {
+            IndexName: 'ByCreatedLocal',
+            KeySchema: [
+              { AttributeName: 'pk', KeyType: 'HASH' },
+              { AttributeName: 'createdAt', KeyType: 'RANGE' },
+            ],
+            Projection: { ProjectionType: 'ALL' },
+          },
+        ],
+        GlobalSecondaryIndexes: [
+          {
+            IndexName: 'ByCreatedGlobal',
+            KeySchema: [{ AttributeName: 'createdAt', KeyType: 'HASH' }],
+            Projection: { ProjectionType: 'ALL' },
+          },
+        ],
+      })
+    }
+
+    test('consistent scans of an LSI succeed', async () => {
+      const tableName = await createIndexedTable()
+      await client.send(
+        new PutItemCommand({
+          TableName: tableName,
+          Item: { pk: { S: 'p' }, sk: { S: 's' }, createdAt: { N: '1' } },
+        })
+      )
+
+      const response = await client.send(
+        new ScanCommand({
+          TableName: tableName,
+          IndexName: 'ByCreatedLocal',
+          ConsistentRead: true,
+        })
+      )
+      expect(response.Count).toBe(1)
+    })
+
+    test('consistent scans of a GSI fail', async () => {
+      const tableName = await createIndexedTable()
+
+      await expect(
+        client.send(
+          new ScanCommand({
+            TableName: tableName,
+            IndexName: 'ByCreatedGlobal',
+            ConsistentRead: true,
+          })
+        )
+      ).rejects.toHaveProperty('name', 'ValidationException')
+    })
+  })
+
+  test('LSI queries order one partition by the index sort key', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('Lsi'))
+    await createTable(client, tableName, {
+      keySchema: [
+        { AttributeName: 'pk', KeyType: 'HASH' },
+        { AttributeName: 'sk', KeyType: 'RANGE' },
+      ],
+      attributeDefinitions: [
+        { AttributeName: 'pk', AttributeType: 'S' },
+        { AttributeName: 'sk', AttributeType: 'S' },
+        { AttributeName: 'score', AttributeType: 'N' },
+      ],
+      LocalSecondaryIndexes: [
+        {
+          IndexName: 'ByScore',
+          KeySchema: [
+            { AttributeName: 'pk', KeyType: 'HASH' },
+            { AttributeName: 'score', KeyType: 'RANGE' },
+          ],
+          Projection: {
+            ProjectionType: 'INCLUDE',
+            NonKeyAttributes: ['label'],
+          },
+        },
+      ],
+    })
+    for (const [sk, score] of [
+      ['a', '30'],
+      ['b', '10'],
+      ['c', '20'],
+    ] as const) {
+      await client.send(
+        new PutItemCommand({
+          TableName: tableName,
+          Item: {
+            pk: { S: 'p' },
+            sk: { S: sk },
+            score: { N: score },
+            label: { S: `label-${sk}` },
+            extra: { S: 'not projected' },
+          },
+        })
+      )
+    }
+    // Items without the index sort key are left out of the index
+    await client.send(
+      new PutItemCommand({
+        TableName: tableName,
+        Item: { pk: { S: 'p' }, sk: { S: 'd' } },
+      })
+    )
+
+    const response = await client.send(
+      new QueryCommand({
+        TableName: tableName,
+        IndexName: 'ByScore',
+        KeyConditionExpression: 'pk = :pk AND score > :min',
+        ExpressionAttributeValues: { ':pk': { S: 'p' }, ':min': { N: '15' } },
+      })
+    )
+    expect(response.Items).toEqual([
+      {
+        pk: { S: 'p' },
+        sk: { S: 'c' },
+        score: { N: '20' },
+        label: { S: 'label-c' },
+      },
+      {
+        pk: { S: 'p' },
+        sk: { S: 'a' },
+        score: { N: '30' },
+        label: { S: 'label-a' },
+      },
+    ])
+  })
+
+  test('CreateTable rejects an LSI with another partition key', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('LsiHash'))
+
+    const error = await createTable(client, tableName, {
+      keySchema: [
+        { AttributeName: 'pk', KeyType: 'HASH' },
+        { AttributeName: 'sk', KeyType: 'RANGE' },
+      ],
+      attributeDefinitions: [
+        { AttributeName: 'pk', AttributeType: 'S' },
+        { AttributeName: 'sk', AttributeType: 'S' },
+        { AttributeName: 'other', AttributeType: 'S' },
+      ],
+      LocalSecondaryIndexes: [
+        {
+          IndexName: 'ByOther',
+          KeySchema: [
+            { AttributeName: 'other', KeyType: 'HASH' },
+            { AttributeName: 'sk', KeyType: 'RANGE' },
+          ],
+          Projection: { ProjectionType: 'ALL' },
+        },
+      ],
+    }).catch((e) => e)
+    expect(error.name).toBe('ValidationException')
+    expect(error.message).toContain('same leading hash key')
+  })
+
+  test('CreateTable returns the full TableDescription', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('Described'))
+    const response = await client.send(
+      new CreateTableCommand({
+        TableName: tableName,
+        KeySchema: [{ AttributeName: 'id', KeyType: 'HASH' }],
+        AttributeDefinitions: [
+          { AttributeName: 'id', AttributeType: 'S' },
+          { AttributeName: 'category', AttributeType: 'S' },
+        ],
+        BillingMode: 'PAY_PER_REQUEST',
+        GlobalSecondaryIndexes: [
+          {
+            IndexName: 'ByCategory',
+            KeySchema: [{ AttributeName: 'category', KeyType: 'HASH' }],
+            Projection: { ProjectionType: 'KEYS_ONLY' },
+          },
+        ],
+      })
+    )
+
+    const description = response.TableDescription!
+    expect(description.TableArn).toEndWith(`:table/${tableName}`)
+    expect(description.KeySchema).toEqual([
+      { AttributeName: 'id', KeyType: 'HASH' },
+    ])
+    expect(description.BillingModeSummary?.BillingMode).toBe('PAY_PER_REQUEST')
+    expect(description.CreationDateTime).toBeInstanceOf(Date)
+    expect(description.GlobalSecondaryIndexes).toHaveLength(1)
+    const index = description.GlobalSecondaryIndexes![0]!
+    expect(index.IndexName).toBe('ByCategory')
+    expect(index.IndexArn).toEndWith(`:table/${tableName}/index/ByCategory`)
+    expect(index.Projection).toEqual({ ProjectionType: 'KEYS_ONLY' })
+  })
+
+  describe('Select validation', () => {
+    async function createSelectTable(): Promise<string> {
+      const tableName = trackTable(createdTables, uniqueTableName('Select'))
+      return await createTable(client, tableName, {
+        keySchema: [
+          { AttributeName: 'pk', KeyType: 'HASH' },
+          { AttributeName: 'sk', KeyType: 'RANGE' },
+        ],
+        attributeDefinitions: [
+          { AttributeName: 'pk', AttributeType: 'S' },
+          { AttributeName: 'sk', AttributeType: 'S' },
+          { AttributeName: 'category', AttributeType: 'S' },
+        ],
+        GlobalSecondaryIndexes: [
+          {
+            IndexName: 'AllGsi',
+            KeySchema: [{ AttributeName: 'category', KeyType: 'HASH' }],
+            Projection: { ProjectionType: 'ALL' },
+          },
+          {
+            IndexName: 'KeysGsi',
+            KeySchema: [{ AttributeName: 'category', KeyType: 'HASH' }],
+            Projection: { ProjectionType: 'KEYS_ONLY' },
+          },
+          {
+            IndexName: 'IncludeGsi',
+            KeySchema: [{ AttributeName: 'category', KeyType: 'HASH' }],
+            Projection: {
+              ProjectionType: 'INCLUDE',
+              NonKeyAttributes: ['title'],
+            },
+          },
+        ],
+      })
+    }
+
+    const cases: Array<{
+      name: string
+      indexName?: string
+      select: Select
+      projection?: string
+      valid: boolean
+    }> = [
+      {
+        name: 'ALL_ATTRIBUTES on table',
+        select: 'ALL_ATTRIBUTES',
+        valid: true,
+      },
+      {
+        name: 'ALL_ATTRIBUTES on ALL index',
+        indexName: 'AllGsi',
+        select: 'ALL_ATTRIBUTES',
+        valid: true,
+      },
+      {
+        name: 'ALL_ATTRIBUTES on KEYS_ONLY index',
+        indexName: 'KeysGsi',
+        select: 'ALL_ATTRIBUTES',
+        valid: false,
+      },
+      {
+        name: 'ALL_ATTRIBUTES on INCLUDE index',
+        indexName: 'IncludeGsi',
+        select: 'ALL_ATTRIBUTES',
+        valid: false,
+      },
+      {
+        name: 'ALL_PROJECTED_ATTRIBUTES on index',
+        indexName: 'KeysGsi',
+        select: 'ALL_PROJECTED_ATTRIBUTES',
+        valid: true,
+      },
+      {
+        name: 'ALL_PROJECTED_ATTRIBUTES on table',
+        select: 'ALL_PROJECTED_ATTRIBUTES',
+        valid: false,
+      },
+      {
+        name: 'SPECIFIC_ATTRIBUTES with ProjectionExpression',
+        select: 'SPECIFIC_ATTRIBUTES',
+        projection: 'title',
+        valid: true,
+      },
+      {
+        name: 'SPECIFIC_ATTRIBUTES without ProjectionExpression',
+        select: 'SPECIFIC_ATTRIBUTES',
+        valid: false,
+      },
+    ]
+
+    for (const { name, indexName, select, projection, valid } of cases) {
+      test(`${name} is ${valid ? 'accepted' : 'rejected'}`, async () => {
+        const tableName = await createSelectTable()
+        const request = client.send(
+          new QueryCommand({
+            TableName: tableName,
+            IndexName: indexName,
+            KeyConditionExpression: indexName ? 'category = :v' : 'pk = :v',
+            ExpressionAttributeValues: { ':v': { S: 'books' } },
+            Select: select,
+            ProjectionExpression: projection,
+          })
+        )
+
+        if (valid) {
+          await request
+        } else {
+          await expect(request).rejects.toHaveProperty(
+            'name',
+            'ValidationException'
+          )
+        }
+      })
+    }
+  })
+
+  test('querying an undeclared index fails with ValidationException', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('NoIndex'))
+    await createTable(client, tableName)
+
+    const error = await client
+      .send(
+        new QueryCommand({
+          TableName: tableName,
+          IndexName: 'Missing',
+          KeyConditionExpression: 'category = :c',
+          ExpressionAttributeValues: { ':c': { S: 'books' } },
+        })
+      )
+      .catch((e) => e)
+    expect(error.name).toBe('ValidationException')
+    expect(error.message).toContain(
+      'The table does not have the specified index'
+    )
+  })
+})
+
+describe('UpdateTable GSI updates', () => {
+  // Runs on dedicated servers so the backfill delay can be configured
+  if (process.env.TEST_DYNAMODB_LOCAL === 'true') {
+    return
+  }
+
+  const byCategory = {
+    IndexName: 'ByCategory',
+    KeySchema: [{ AttributeName: 'category', KeyType: 'HASH' as const }],
+    Projection: { ProjectionType: 'ALL' as const },
+  }
+
+  async function queryByCategory(client: DynamoDBClient, tableName: string) {
+    return await client.send(
+      new QueryCommand({
+        TableName: tableName,
+        IndexName: 'ByCategory',
+        KeyConditionExpression: 'category = :c',
+        ExpressionAttributeValues: { ':c': { S: 'books' } },
+      })
+    )
+  }
+
+  test('an added GSI covers existing items and can be deleted', async () => {
+    const { client, cleanup } = await startDynado()
+    try {
+      const tableName = await createTable(client, uniqueTableName('AddGsi'))
+      await client.send(
+        new PutItemCommand({
+          TableName: tableName,
+          Item: { id: { S: 'item-1' }, category: { S: 'books' } },
+        })
+      )
+
+      const created = await client.send(
+        new UpdateTableCommand({
+          TableName: tableName,
+          AttributeDefinitions: [
+            { AttributeName: 'category', AttributeType: 'S' },
+          ],
+          GlobalSecondaryIndexUpdates: [{ Create: byCategory }],
+        })
+      )
+      expect(
+        created.TableDescription!.GlobalSecondaryIndexes![0]!.IndexStatus
+      ).toBe('ACTIVE')
+      expect((await queryByCategory(client, tableName)).Items).toEqual([
+        { id: { S: 'item-1' }, category: { S: 'books' } },
+      ])
+
+      await client.send(
+        new UpdateTableCommand({
+          TableName: tableName,
+          GlobalSecondaryIndexUpdates: [
+            { Delete: { IndexName: 'ByCategory' } },
+          ],
+        })
+      )
+      const described = await client.send(
+        new DescribeTableCommand({ TableName: tableName })
+      )
+      expect(described.Table!.GlobalSecondaryIndexes).toBeUndefined()
+      await expect(queryByCategory(client, tableName)).rejects.toHaveProperty(
+        'name',
+        'ValidationException'
+      )
+    } finally {
+      await cleanup()
+    }
+  })
+
+  test('a new GSI reports CREATING until its backfill ends', async () => {
+    const { client, cleanup } = await startDynado({ indexBackfillMs: 200 })
+    try {
+      const tableName = await createTable(client, uniqueTableName('Backfill'))
+      await client.send(
+        new UpdateTableCommand({
+          TableName: tableName,
+          AttributeDefinitions: [
+            { AttributeName: 'category', AttributeType: 'S' },
+          ],
+          GlobalSecondaryIndexUpdates: [{ Create: byCategory }],
+        })
+      )
+
+      const indexStatus = async () => {
+        const { Table } = await client.send(
+          new DescribeTableCommand({ TableName: tableName })
+        )
+        const [index] = Table!.GlobalSecondaryIndexes!
+        return { status: index!.IndexStatus, backfilling: index!.Backfilling }
+      }
+
+      expect(await indexStatus()).toEqual({
+        status: 'CREATING',
+        backfilling: true,
+      })
+      await expect(queryByCategory(client, tableName)).rejects.toHaveProperty(
+        'name',
+        'ValidationException'
+      )
+
+      await Bun.sleep(250)
+      expect(await indexStatus()).toEqual({
+        status: 'ACTIVE',
+        backfilling: undefined,
+      })
+      expect((await queryByCategory(client, tableName)).Count).toBe(0)
+    } finally {
+      await cleanup()
+    }
+  })
+
+  test('an index key needs an attribute definition', async () => {
+    const { client, cleanup } = await startDynado()
+    try {
+      const tableName = await createTable(client, uniqueTableName('NoDef'))
+
+      const error = await client
+        .send(
+          new UpdateTableCommand({
+            TableName: tableName,
+            GlobalSecondaryIndexUpdates: [{ Create: byCategory }],
+          })
+        )
+        .catch((e) => e)
+      expect(error.name).toBe('ValidationException')
+      expect(error.message).toContain('Keys: [category]')
+    } finally {
+      await cleanup()
+    }
+  })
+
+  test('writes to a table with an LSI report item collection metrics', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('Collections'))
+    await createTable(client, tableName, {
+      keySchema: [
+        { AttributeName: 'pk', KeyType: 'HASH' },
+        { AttributeName: 'sk', KeyType: 'RANGE' },
+      ],
+      attributeDefinitions: [
+        { AttributeName: 'pk', AttributeType: 'S' },
+        { AttributeName: 'sk', AttributeType: 'S' },
+        { AttributeName: 'score', AttributeType: 'N' },
+      ],
+      LocalSecondaryIndexes: [
+        {
+          IndexName: 'ByScore',
+          KeySchema: [
+            { AttributeName: 'pk', KeyType: 'HASH' },
+            { AttributeName: 'score', KeyType: 'RANGE' },
+          ],
+          Projection: { ProjectionType: 'ALL' },
+        },
+      ],
+    })
+    const collection = {
+      ItemCollectionKey: { pk: { S: 'p' } },
+      SizeEstimateRangeGB: [0, 1],
+    }
+    const Item = { pk: { S: 'p' }, sk: { S: 'a' }, score: { N: '1' } }
+
+    const put = await client.send(
+      new PutItemCommand({
+        TableName: tableName,
+        Item,
+        ReturnItemCollectionMetrics: 'SIZE',
+      })
+    )
+    expect(put.ItemCollectionMetrics).toEqual(collection)
+
+    const batch = await client.send(
+      new BatchWriteItemCommand({
+        RequestItems: {
+          [tableName]: [{ PutRequest: { Item: { ...Item, sk: { S: 'b' } } } }],
+        },
+        ReturnItemCollectionMetrics: 'SIZE',
+      })
+    )
+    expect(batch.ItemCollectionMetrics).toEqual({ [tableName]: [collection] })
+
+    const deleted = await client.send(
+      new DeleteItemCommand({
+        TableName: tableName,
+        Key: { pk: { S: 'p' }, sk: { S: 'a' } },
+        ReturnItemCollectionMetrics: 'SIZE',
+      })
+    )
+    expect(deleted.ItemCollectionMetrics).toEqual(collection)
+
+    // NONE, the default, reports nothing
+    const quiet = await client.send(
+      new PutItemCommand({ TableName: tableName, Item })
+    )
+    expect(quiet.ItemCollectionMetrics).toBeUndefined()
+
+    // Tables without an LSI have no item collections
+    const plain = trackTable(createdTables, uniqueTableName('NoCollections'))
+    await createTable(client, plain)
+    const unindexed = await client.send(
+      new PutItemCommand({
+        TableName: plain,
+        Item: { id: { S: 'a' } },
+        ReturnItemCollectionMetrics: 'SIZE',
+      })
+    )
+    expect(unindexed.ItemCollectionMetrics).toBeUndefined()
+  })
+})
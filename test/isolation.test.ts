@@ -0,0 +1,131 @@
+// Tests for ISOLATION_LEVEL
+// Holds one transaction between prepare and commit to force an interleaving
+
+import { test, expect, describe } from 'bun:test'
+import {
+  type DynamoDBClient,
+  GetItemCommand,
+  PutItemCommand,
+  TransactionCanceledException,
+  TransactWriteItemsCommand,
+} from '@aws-sdk/client-dynamodb'
+import type { IsolationLevel } from '../src/config.ts'
+import { Shard } from '../src/shard.ts'
+import { createTable, startDynado, uniqueTableName } from './helpers.ts'
+
+describe('Isolation level', () => {
+  // DynamoDB Local is always serializable; snapshot mode cannot be chosen
+  if (process.env.TEST_DYNAMODB_LOCAL === 'true') {
+    return
+  }
+
+  // Takes doctor `self` off call if `other` is still on call
+  function goOffCall(tableName: string, self: string, other: string) {
+    return new TransactWriteItemsCommand({
+      TransactItems: [
+        {
+          ConditionCheck: {
+            TableName: tableName,
+            Key: { id: { S: other } },
+            ConditionExpression: 'onCall = :yes',
+            ExpressionAttributeValues: { ':yes': { BOOL: true } },
+          },
+        },
+        {
+          Update: {
+            TableName: tableName,
+            Key: { id: { S: self } },
+            UpdateExpression: 'SET onCall = :no',
+            ExpressionAttributeValues: { ':no': { BOOL: false } },
+          },
+        },
+      ],
+    })
+  }
+
+  /**
+   * Starts alice's transaction, holds it after prepare, runs bob's to
+   * completion, then lets alice's commit. Returns both outcomes and the
+   * number of doctors left on call.
+   */
+  async function runWriteSkew(isolationLevel: IsolationLevel) {
+    const { client, cleanup } = await startDynado({ isolationLevel })
+    const originalCommit = Shard.prototype.commit
+    try {
+      const tableName = await createTable(client, uniqueTableName('Skew'))
+      for (const id of ['alice', 'bob']) {
+        await client.send(
+          new PutItemCommand({
+            TableName: tableName,
+            Item: { id: { S: id }, onCall: { BOOL: true } },
+          })
+        )
+      }
+
+      let reachedCommit!: () => void
+      const prepared = new Promise<void>((resolve) => (reachedCommit = resolve))
+      let releaseCommit!: () => void
+      const gate = new Promise<void>((resolve) => (releaseCommit = resolve))
+      let held = false
+      Shard.prototype.commit = async function (req) {
+        if (!held) {
+          held = true
+          reachedCommit()
+          await gate
+        }
+        return originalCommit.call(this, req)
+      }
+
+      const alice = send(client, goOffCall(tableName, 'alice', 'bob'))
+      await prepared
+      const bob = await send(client, goOffCall(tableName, 'bob', 'alice'))
+      releaseCommit()
+      const aliceOutcome = await alice
+
+      let onCall = 0
+      for (const id of ['alice', 'bob']) {
+        const { Item } = await client.send(
+          new GetItemCommand({ TableName: tableName, Key: { id: { S: id } } })
+        )
+        if (Item?.onCall?.BOOL) onCall++
+      }
+      return { alice: aliceOutcome, bob, onCall }
+    } finally {
+      Shard.prototype.commit = originalCommit
+      await cleanup()
+    }
+  }
+
+  async function send(
+    client: DynamoDBClient,
+    command: TransactWriteItemsCommand
+  ): Promise<'committed' | 'cancelled'> {
+    try {
+      await client.send(command)
+      return 'committed'
+    } catch (error) {
+      expect(error).toBeInstanceOf(TransactionCanceledException)
+      return 'cancelled'
+    }
+  }
+
+  test('serializable cancels a transaction that read a pending write', async () => {
+    const result = await runWriteSkew('serializable')
+
+    expect(result).toEqual({
+      alice: 'committed',
+      bob: 'cancelled',
+      onCall: 1,
+    })
+  })
+
+  test('snapshot allows write skew between the same transactions', async () => {
+    const result = await runWriteSkew('snapshot')
+
+    expect(result).toEqual({
+      alice: 'committed',
+      bob: 'committed',
+      onCall: 0,
+    })
+  })
+})
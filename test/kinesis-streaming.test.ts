@@ -0,0 +1,205 @@
+// Tests for Kinesis streaming destinations
+// Starts dedicated servers, so records can be sent to a fake Kinesis endpoint
+
+import { test, expect, describe } from 'bun:test'
+import {
+  CreateTableCommand,
+  DeleteItemCommand,
+  DescribeKinesisStreamingDestinationCommand,
+  DisableKinesisStreamingDestinationCommand,
+  EnableKinesisStreamingDestinationCommand,
+  PutItemCommand,
+  UpdateItemCommand,
+  type DynamoDBClient,
+} from '@aws-sdk/client-dynamodb'
+import { startDynado, uniqueTableName } from './helpers.ts'
+
+describe('Kinesis streaming destinations', () => {
+  // DynamoDB Local does not send records to Kinesis
+  if (process.env.TEST_DYNAMODB_LOCAL === 'true') {
+    return
+  }
+
+  const STREAM_ARN = 'arn:aws:kinesis:local:000000000000:stream/changes'
+
+  function createTable(client: DynamoDBClient, TableName: string) {
+    return client.send(
+      new CreateTableCommand({
+        TableName,
+        KeySchema: [{ AttributeName: 'id', KeyType: 'HASH' }],
+        AttributeDefinitions: [{ AttributeName: 'id', AttributeType: 'S' }],
+        BillingMode: 'PAY_PER_REQUEST',
+      })
+    )
+  }
+
+  test('enables, describes and disables destinations', async () => {
+    const { client, cleanup } = await startDynado()
+    try {
+      const tableName = uniqueTableName('KinesisDestinations')
+      await createTable(client, tableName)
+
+      const enabled = await client.send(
+        new EnableKinesisStreamingDestinationCommand({
+          TableName: tableName,
+          StreamArn: STREAM_ARN,
+        })
+      )
+      expect(enabled.DestinationStatus).toBe('ACTIVE')
+      expect(
+        enabled.EnableKinesisStreamingConfiguration
+          ?.ApproximateCreationDateTimePrecision
+      ).toBe('MILLISECOND')
+      await expect(
+        client.send(
+          new EnableKinesisStreamingDestinationCommand({
+            TableName: tableName,
+            StreamArn: STREAM_ARN,
+          })
+        )
+      ).rejects.toHaveProperty('name', 'ResourceInUseException')
+
+      const disabled = await client.send(
+        new DisableKinesisStreamingDestinationCommand({
+          TableName: tableName,
+          StreamArn: STREAM_ARN,
+        })
+      )
+      expect(disabled.DestinationStatus).toBe('DISABLED')
+      const described = await client.send(
+        new DescribeKinesisStreamingDestinationCommand({
+          TableName: tableName,
+        })
+      )
+      expect(described.KinesisDataStreamDestinations).toEqual([
+        {
+          StreamArn: STREAM_ARN,
+          DestinationStatus: 'DISABLED',
+          ApproximateCreationDateTimePrecision: 'MILLISECOND',
+        },
+      ])
+
+      await expect(
+        client.send(
+          new DisableKinesisStreamingDestinationCommand({
+            TableName: tableName,
+            StreamArn: STREAM_ARN,
+          })
+        )
+      ).rejects.toHaveProperty('name', 'ValidationException')
+      await expect(
+        client.send(
+          new EnableKinesisStreamingDestinationCommand({
+            TableName: tableName,
+            StreamArn: 'arn:aws:sqs:local:000000000000:changes',
+          })
+        )
+      ).rejects.toHaveProperty('name', 'ValidationException')
+    } finally {
+      await cleanup()
+    }
+  })
+
+  test('sends change records to the Kinesis endpoint', async () => {
+    const requests: { target: string | null; body: any }[] = []
+    const kinesis = Bun.serve({
+      port: 0,
+      async fetch(req) {
+        requests.push({
+          target: req.headers.get('x-amz-target'),
+          body: await req.json(),
+        })
+        return Response.json({ ShardId: 'shardId-000000000000' })
+      },
+    })
+    const { db, client, cleanup } = await startDynado({
+      kinesisEndpoint: `http://localhost:${kinesis.port}`,
+    })
+    try {
+      const tableName = uniqueTableName('KinesisRecords')
+      await createTable(client, tableName)
+      await client.send(
+        new PutItemCommand({
+          TableName: tableName,
+          Item: { id: { S: 'before' } },
+        })
+      )
+      await client.send(
+        new EnableKinesisStreamingDestinationCommand({
+          TableName: tableName,
+          StreamArn: STREAM_ARN,
+        })
+      )
+
+      await client.send(
+        new PutItemCommand({
+          TableName: tableName,
+          Item: { id: { S: 'a' }, n: { N: '1' } },
+        })
+      )
+      await client.send(
+        new UpdateItemCommand({
+          TableName: tableName,
+          Key: { id: { S: 'a' } },
+          UpdateExpression: 'SET n = :n',
+          ExpressionAttributeValues: { ':n': { N: '2' } },
+        })
+      )
+      await client.send(
+        new DeleteItemCommand({ TableName: tableName, Key: { id: { S: 'a' } } })
+      )
+      await db.kinesis!.flush()
+
+      expect(requests.map((r) => r.target)).toEqual([
+        'Kinesis_20131202.PutRecord',
+        'Kinesis_20131202.PutRecord',
+        'Kinesis_20131202.PutRecord',
+      ])
+      expect(requests.map((r) => r.body.StreamName)).toEqual([
+        'changes',
+        'changes',
+        'changes',
+      ])
+      // Records of one item share a partition key
+      expect(new Set(requests.map((r) => r.body.PartitionKey)).size).toBe(1)
+
+      const records = requests.map((r) =>
+        JSON.parse(Buffer.from(r.body.Data, 'base64').toString())
+      )
+      expect(records.map((r) => r.eventName)).toEqual([
+        'INSERT',
+        'MODIFY',
+        'REMOVE',
+      ])
+      expect(records[1]).toMatchObject({
+        tableName,
+        eventSource: 'aws:dynamodb',
+        recordFormat: 'application/json',
+        dynamodb: {
+          ApproximateCreationDateTimePrecision: 'MILLISECOND',
+          Keys: { id: { S: 'a' } },
+          NewImage: { id: { S: 'a' }, n: { N: '2' } },
+          OldImage: { id: { S: 'a' }, n: { N: '1' } },
+        },
+      })
+      expect(records[1].dynamodb.ApproximateCreationDateTime).toBeGreaterThan(
+        Date.now() - 60000
+      )
+
+      await client.send(
+        new DisableKinesisStreamingDestinationCommand({
+          TableName: tableName,
+          StreamArn: STREAM_ARN,
+        })
+      )
+      await client.send(
+        new PutItemCommand({ TableName: tableName, Item: { id: { S: 'b' } } })
+      )
+      await db.kinesis!.flush()
+      expect(requests).toHaveLength(3)
+    } finally {
+      await cleanup()
+      kinesis.stop()
+    }
+  })
+})
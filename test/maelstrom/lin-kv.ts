@@ -121,7 +121,7 @@ rl.on('close', () => {
       )
     })
     .finally(() => {
-      db.server.stop().catch(() => {})
+      db.stop().catch(() => {})
       fs.rm(nodeDataDir, { recursive: true, force: true }).catch(() => {})
       process.exit(0)
     })
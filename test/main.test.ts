@@ -7,10 +7,12 @@ import {
   afterAll,
 } from 'bun:test'
 import {
+  type AttributeValue,
   DynamoDBClient,
   ListTablesCommand,
   CreateTableCommand,
   DescribeTableCommand,
+  DescribeEndpointsCommand,
   PutItemCommand,
   GetItemCommand,
   UpdateItemCommand,
@@ -27,6 +29,7 @@ import {
   createTable,
   createTableWithItems,
   cleanupTables,
+  startDynado,
   uniqueTableName,
   trackTable,
 } from './helpers.ts'
@@ -120,6 +123,42 @@ describe('DynamoDB Implementation', () => {
     expect(response.Item).toBeUndefined()
   })
 
+  test('should round-trip every attribute type inside lists and maps', async () => {
+    const tableName = await createTable(client, getUniqueTableName())
+    const bytes = new Uint8Array([0, 1, 127, 128, 255])
+    const scalars: Record<string, AttributeValue> = {
+      s: { S: 'text' },
+      n: { N: '-12.5' },
+      b: { B: bytes },
+      bool: { BOOL: false },
+      null: { NULL: true },
+      ss: { SS: ['a', 'b'] },
+      ns: { NS: ['1', '2.5'] },
+      bs: { BS: [bytes, new Uint8Array([9])] },
+    }
+    const nested: AttributeValue[] = [
+      { M: { inner: { S: 'x' }, b: { B: bytes } } },
+      { L: [{ N: '1' }, { B: bytes }, { NULL: true }] },
+    ]
+    const item: Record<string, AttributeValue> = {
+      id: { S: 'item-1' },
+      list: { L: [...Object.values(scalars), ...nested] },
+      map: {
+        M: { ...scalars, m: nested[0]!, l: nested[1]! },
+      },
+    }
+
+    await client.send(new PutItemCommand({ TableName: tableName, Item: item }))
+    const response = await client.send(
+      new GetItemCommand({
+        TableName: tableName,
+        Key: { id: { S: 'item-1' } },
+      })
+    )
+
+    expect(response.Item).toEqual(item)
+  })
+
   test('should update an item with SET', async () => {
     const tableName = await createTableWithItems(client, getUniqueTableName(), [
       { id: 'item-1', name: 'Original', count: 10 },
@@ -180,6 +219,25 @@ describe('DynamoDB Implementation', () => {
     expect(updateResponse.Attributes!.counter!.N).toBe('8')
   })
 
+  test('should return the old item with its original types on overwrite', async () => {
+    const tableName = await createTableWithItems(client, getUniqueTableName(), [
+      { id: 'item-1', name: 42 },
+    ])
+
+    const putResponse = await client.send(
+      new PutItemCommand({
+        TableName: tableName,
+        Item: { id: { S: 'item-1' }, name: { S: 'forty-two' } },
+        ReturnValues: 'ALL_OLD',
+      })
+    )
+
+    expect(putResponse.Attributes).toEqual({
+      id: { S: 'item-1' },
+      name: { N: '42' },
+    })
+  })
+
   test('should delete an item', async () => {
     const tableName = await createTableWithItems(client, getUniqueTableName(), [
       { id: 'item-1', name: 'To Delete' },
@@ -263,6 +321,64 @@ describe('DynamoDB Implementation', () => {
     expect(secondScan.Items!.length).toBeGreaterThan(0)
   })
 
+  test('should resume a scan after the last evaluated item is deleted', async () => {
+    const ids = Array.from({ length: 6 }, (_, i) => `item-${i}`)
+    const tableName = await createTableWithItems(
+      client,
+      getUniqueTableName(),
+      ids.map((id) => ({ id }))
+    )
+
+    const first = await client.send(
+      new ScanCommand({ TableName: tableName, Limit: 2 })
+    )
+    expect(first.LastEvaluatedKey).toBeDefined()
+    // Neither deleting the boundary item nor rewriting a read one moves
+    // the page boundary
+    await client.send(
+      new DeleteItemCommand({
+        TableName: tableName,
+        Key: first.LastEvaluatedKey,
+      })
+    )
+    await client.send(
+      new PutItemCommand({
+        TableName: tableName,
+        Item: { ...first.Items![0], name: { S: 'rewritten' } },
+      })
+    )
+
+    const seen = first.Items!.map((item) => item.id!.S!)
+    let startKey = first.LastEvaluatedKey
+    while (startKey) {
+      const page = await client.send(
+        new ScanCommand({
+          TableName: tableName,
+          Limit: 2,
+          ExclusiveStartKey: startKey,
+        })
+      )
+      seen.push(...page.Items!.map((item) => item.id!.S!))
+      startKey = page.LastEvaluatedKey
+    }
+    expect(seen.sort()).toEqual(ids)
+  })
+
+  test('should reject a scan start key that does not match the schema', async () => {
+    const tableName = await createTableWithItems(client, getUniqueTableName(), [
+      { id: 'item-1' },
+    ])
+
+    await expect(
+      client.send(
+        new ScanCommand({
+          TableName: tableName,
+          ExclusiveStartKey: { other: { S: 'item-1' } },
+        })
+      )
+    ).rejects.toHaveProperty('name', 'ValidationException')
+  })
+
   test('should filter scan results', async () => {
     const tableName = await createTableWithItems(client, getUniqueTableName(), [
       { id: 'item-1', name: 'Match', count: 10 },
@@ -285,6 +401,79 @@ describe('DynamoDB Implementation', () => {
     )
   })
 
+  test('should accept ConsistentRead on a base table scan', async () => {
+    const tableName = await createTableWithItems(client, getUniqueTableName(), [
+      { id: 'item-1', count: 1 },
+    ])
+    await client.send(
+      new UpdateItemCommand({
+        TableName: tableName,
+        Key: { id: { S: 'item-1' } },
+        UpdateExpression: 'SET #c = :c',
+        ExpressionAttributeNames: { '#c': 'count' },
+        ExpressionAttributeValues: { ':c': { N: '2' } },
+      })
+    )
+
+    const scan = (ConsistentRead: boolean) =>
+      client.send(
+        new ScanCommand({
+          TableName: tableName,
+          ConsistentRead,
+          ReturnConsumedCapacity: 'TOTAL',
+        })
+      )
+    const consistent = await scan(true)
+    const eventual = await scan(false)
+
+    expect(consistent.Items).toEqual([
+      { id: { S: 'item-1' }, count: { N: '2' } },
+    ])
+    expect(consistent.ConsumedCapacity!.CapacityUnits).toBe(
+      2 * eventual.ConsumedCapacity!.CapacityUnits!
+    )
+  })
+
+  test('should sum per-page scan capacity to a single scan', async () => {
+    // DynamoDB Local rounds each page up on its own
+    if (process.env.TEST_DYNAMODB_LOCAL === 'true') {
+      return
+    }
+    // About 1.5KB each, so pages end partway through a 4KB read unit
+    const tableName = await createTableWithItems(
+      client,
+      getUniqueTableName(),
+      Array.from({ length: 7 }, (_, i) => ({
+        id: `item-${i}`,
+        body: 'x'.repeat(1500),
+      }))
+    )
+
+    const single = await client.send(
+      new ScanCommand({ TableName: tableName, ReturnConsumedCapacity: 'TOTAL' })
+    )
+
+    let paged = 0
+    let pages = 0
+    let startKey: Record<string, AttributeValue> | undefined
+    do {
+      const page = await client.send(
+        new ScanCommand({
+          TableName: tableName,
+          Limit: 2,
+          ExclusiveStartKey: startKey,
+          ReturnConsumedCapacity: 'TOTAL',
+        })
+      )
+      paged += page.ConsumedCapacity!.CapacityUnits!
+      pages++
+      startKey = page.LastEvaluatedKey
+    } while (startKey)
+
+    expect(pages).toBeGreaterThan(1)
+    expect(paged).toBe(single.ConsumedCapacity!.CapacityUnits!)
+  })
+
   test('should query items by key', async () => {
     const tableName = await createTableWithItems(client, getUniqueTableName(), [
       { id: 'key-1', name: 'First' },
@@ -357,6 +546,60 @@ describe('DynamoDB Implementation', () => {
     expect(getResponse.Item!.name!.S).toBe('First')
   })
 
+  test('should group batch responses by the requested table names', async () => {
+    const users = await createTableWithItems(client, getUniqueTableName(), [
+      { id: 'user-1', name: 'Ada' },
+      { id: 'user-2', name: 'Grace' },
+    ])
+    const orders = await createTableWithItems(client, getUniqueTableName(), [
+      { id: 'order-1', total: 10 },
+    ])
+
+    const batchGetResponse = await client.send(
+      new BatchGetItemCommand({
+        RequestItems: {
+          [users]: { Keys: [{ id: { S: 'user-1' } }, { id: { S: 'user-2' } }] },
+          [orders]: { Keys: [{ id: { S: 'order-missing' } }] },
+        },
+      })
+    )
+    expect(Object.keys(batchGetResponse.Responses!).sort()).toEqual(
+      [users, orders].sort()
+    )
+    expect(
+      batchGetResponse.Responses![users]!.map((item) => item.id!.S).sort()
+    ).toEqual(['user-1', 'user-2'])
+    expect(batchGetResponse.Responses![orders]).toEqual([])
+    expect(batchGetResponse.UnprocessedKeys).toEqual({})
+
+    const batchWriteResponse = await client.send(
+      new BatchWriteItemCommand({
+        RequestItems: {
+          [users]: [{ DeleteRequest: { Key: { id: { S: 'user-2' } } } }],
+          [orders]: [{ PutRequest: { Item: { id: { S: 'order-2' } } } }],
+        },
+      })
+    )
+    expect(batchWriteResponse.UnprocessedItems).toEqual({})
+  })
+
+  test('should reject duplicate keys within a batch', async () => {
+    const tableName = await createTable(client, getUniqueTableName())
+
+    await expect(
+      client.send(
+        new BatchWriteItemCommand({
+          RequestItems: {
+            [tableName]: [
+              { PutRequest: { Item: { id: { S: 'dup' } } } },
+              { DeleteRequest: { Key: { id: { S: 'dup' } } } },
+            ],
+          },
+        })
+      )
+    ).rejects.toHaveProperty('name', 'ValidationException')
+  })
+
   test('should delete a table', async () => {
     const tableName = await createTable(client, getUniqueTableName())
 
@@ -367,6 +610,18 @@ describe('DynamoDB Implementation', () => {
     expect(deleteResponse.TableDescription?.TableName).toBe(tableName)
   })
 
+  test('should describe the endpoint it was reached at', async () => {
+    // DynamoDB Local's answer names AWS's regional endpoint
+    if (process.env.TEST_DYNAMODB_LOCAL === 'true') {
+      return
+    }
+
+    const { Endpoints } = await client.send(new DescribeEndpointsCommand({}))
+    expect(Endpoints).toEqual([
+      { Address: new URL(endpoint).host, CachePeriodInMinutes: 1440 },
+    ])
+  })
+
   test('should include valid X-Amz-Crc32 header in responses', async () => {
     // Skip this test when testing against DynamoDB Local (it doesn't include this header)
     if (process.env.TEST_DYNAMODB_LOCAL === 'true') {
@@ -396,4 +651,137 @@ describe('DynamoDB Implementation', () => {
     // Verify the checksum in the header matches the computed checksum
     expect(checksumHeader).toBe(String(computedChecksum))
   })
+
+  test('should include a unique x-amzn-RequestId header in responses', async () => {
+    const send = (target: string, body: unknown) =>
+      fetch(endpoint + '/', {
+        method: 'POST',
+        headers: {
+          'x-amz-target': `DynamoDB_20120810.${target}`,
+          'Content-Type': 'application/x-amz-json-1.0',
+        },
+        body: JSON.stringify(body),
+      })
+
+    const first = await send('ListTables', {})
+    const second = await send('ListTables', {})
+    const failed = await send('DescribeTable', { TableName: 'missing-table' })
+    expect(failed.status).toBe(400)
+
+    const requestIds = [first, second, failed].map((response) =>
+      response.headers.get('x-amzn-RequestId')
+    )
+    for (const requestId of requestIds) {
+      expect(requestId).toBeTruthy()
+    }
+    expect(new Set(requestIds).size).toBe(3)
+
+    // Error bodies are covered by the checksum too
+    if (process.env.TEST_DYNAMODB_LOCAL !== 'true') {
+      const errorBody = await failed.text()
+      expect(failed.headers.get('X-Amz-Crc32')).toBe(
+        String(CRC32.str(errorBody) >>> 0)
+      )
+    }
+  })
+})
+
+describe('SORTED_KEYS', () => {
+  // DynamoDB Local cannot sort the keys of its responses
+  if (process.env.TEST_DYNAMODB_LOCAL === 'true') {
+    return
+  }
+
+  test('response bodies are byte-stable regardless of attribute order', async () => {
+    const { db, client, cleanup } = await startDynado({ sortedKeys: true })
+    try {
+      const tableName = await createTable(client, uniqueTableName('Sorted'))
+      const getItemBody = async () => {
+        const response = await fetch(`http://localhost:${db.server.port}/`, {
+          method: 'POST',
+          headers: {
+            'x-amz-target': 'DynamoDB_20120810.GetItem',
+            'Content-Type': 'application/x-amz-json-1.0',
+          },
+          body: JSON.stringify({
+            TableName: tableName,
+            Key: { id: { S: 'item-1' } },
+          }),
+        })
+        return await response.text()
+      }
+
+      await client.send(
+        new PutItemCommand({
+          TableName: tableName,
+          Item: {
+            zeta: { M: { y: { N: '1' }, x: { N: '2' } } },
+            id: { S: 'item-1' },
+            alpha: { S: 'a' },
+          },
+        })
+      )
+      const first = await getItemBody()
+      expect(await getItemBody()).toBe(first)
+
+      // Rewriting the same attributes in another order serializes the same
+      await client.send(
+        new PutItemCommand({
+          TableName: tableName,
+          Item: {
+            alpha: { S: 'a' },
+            id: { S: 'item-1' },
+            zeta: { M: { x: { N: '2' }, y: { N: '1' } } },
+          },
+        })
+      )
+      expect(await getItemBody()).toBe(first)
+      expect(first).toBe(
+        '{"Item":{"alpha":{"S":"a"},"id":{"S":"item-1"},' +
+          '"zeta":{"M":{"x":{"N":"2"},"y":{"N":"1"}}}}}'
+      )
+    } finally {
+      await cleanup()
+    }
+  })
+})
+
+describe('MAX_PAGE_ITEMS', () => {
+  // DynamoDB Local pages only at 1MB and cannot cap items per page
+  if (process.env.TEST_DYNAMODB_LOCAL === 'true') {
+    return
+  }
+
+  test('scans stop each page after the configured item count', async () => {
+    const { client, cleanup } = await startDynado({ maxPageItems: 3 })
+    try {
+      const tableName = await createTable(client, uniqueTableName('PageCap'))
+      for (let i = 0; i < 10; i++) {
+        await client.send(
+          new PutItemCommand({
+            TableName: tableName,
+            Item: { id: { S: `item-${i}` } },
+          })
+        )
+      }
+
+      const pages: string[][] = []
+      let startKey: Record<string, AttributeValue> | undefined
+      do {
+        const page = await client.send(
+          new ScanCommand({ TableName: tableName, ExclusiveStartKey: startKey })
+        )
+        pages.push(page.Items!.map((item) => item.id!.S!))
+        startKey = page.LastEvaluatedKey
+      } while (startKey)
+
+      expect(pages.map((page) => page.length)).toEqual([3, 3, 3, 1])
+      const ids = pages.flat().sort()
+      expect(ids).toEqual(
+        Array.from({ length: 10 }, (_, i) => `item-${i}`).sort()
+      )
+    } finally {
+      await cleanup()
+    }
+  })
 })
@@ -0,0 +1,345 @@
+// Tests for PartiQL ExecuteStatement, BatchExecuteStatement and
+// ExecuteTransaction
+// Uses HTTP API via AWS SDK
+
+import { test, expect, beforeAll, afterEach, describe } from 'bun:test'
+import {
+  BatchExecuteStatementCommand,
+  DynamoDBClient,
+  ExecuteStatementCommand,
+  ExecuteTransactionCommand,
+  GetItemCommand,
+  PutItemCommand,
+  ScanCommand,
+  type AttributeValue,
+} from '@aws-sdk/client-dynamodb'
+import {
+  getGlobalTestDB,
+  createTable,
+  createTableWithItems,
+  cleanupTables,
+  uniqueTableName,
+  trackTable,
+} from './helpers.ts'
+
+describe('ExecuteStatement', () => {
+  let client: DynamoDBClient
+  const createdTables: string[] = []
+
+  beforeAll(async () => {
+    const testDB = await getGlobalTestDB()
+    client = testDB.client
+  })
+
+  afterEach(async () => {
+    await cleanupTables(client, createdTables)
+  })
+
+  function execute(
+    Statement: string,
+    Parameters?: AttributeValue[],
+    options: { Limit?: number; NextToken?: string } = {}
+  ) {
+    return client.send(
+      new ExecuteStatementCommand({ Statement, Parameters, ...options })
+    )
+  }
+
+  // Items with a composite key: pk 'a' holds sk 1..5, pk 'b' holds sk 1
+  async function createEvents(): Promise<string> {
+    const tableName = trackTable(createdTables, uniqueTableName('Events'))
+    await createTableWithItems(
+      client,
+      tableName,
+      [
+        ...[1, 2, 3, 4, 5].map((sk) => ({ pk: 'a', sk, kind: sk % 2 })),
+        { pk: 'b', sk: 1, kind: 1 },
+      ],
+      {
+        keySchema: [
+          { AttributeName: 'pk', KeyType: 'HASH' },
+          { AttributeName: 'sk', KeyType: 'RANGE' },
+        ],
+        attributeDefinitions: [
+          { AttributeName: 'pk', AttributeType: 'S' },
+          { AttributeName: 'sk', AttributeType: 'N' },
+        ],
+      }
+    )
+    return tableName
+  }
+
+  test('INSERT adds an item and SELECT reads it back by key', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('Insert'))
+    await createTable(client, tableName)
+
+    await execute(
+      `INSERT INTO "${tableName}" VALUE {'id': ?, 'tags': <<'x', 'y'>>, 'n': 1}`,
+      [{ S: 'item-1' }]
+    )
+    const { Items } = await execute(
+      `SELECT * FROM "${tableName}" WHERE id = ?`,
+      [{ S: 'item-1' }]
+    )
+    expect(Items).toEqual([
+      { id: { S: 'item-1' }, tags: { SS: ['x', 'y'] }, n: { N: '1' } },
+    ])
+
+    // INSERT never overwrites an existing item
+    await expect(
+      execute(`INSERT INTO "${tableName}" VALUE {'id': 'item-1'}`)
+    ).rejects.toHaveProperty('name', 'DuplicateItemException')
+  })
+
+  test('UPDATE sets and removes attributes of an existing item', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('Update'))
+    await createTableWithItems(client, tableName, [
+      { id: 'item-1', count: 1, stale: true },
+    ])
+
+    const { Items } = await execute(
+      `UPDATE "${tableName}" SET "count" = "count" + ? SET label = 'one' ` +
+        `REMOVE stale WHERE id = 'item-1' RETURNING ALL NEW *`,
+      [{ N: '2' }]
+    )
+    expect(Items).toEqual([
+      { id: { S: 'item-1' }, count: { N: '3' }, label: { S: 'one' } },
+    ])
+
+    // UPDATE does not create items
+    await expect(
+      execute(`UPDATE "${tableName}" SET label = 'x' WHERE id = 'missing'`)
+    ).rejects.toHaveProperty('name', 'ConditionalCheckFailedException')
+    // The WHERE clause must name the whole key
+    await expect(
+      execute(`UPDATE "${tableName}" SET label = 'x' WHERE label = 'one'`)
+    ).rejects.toHaveProperty('name', 'ValidationException')
+  })
+
+  test('DELETE checks the rest of its WHERE clause as a condition', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('Delete'))
+    await createTableWithItems(client, tableName, [{ id: 'item-1', n: 1 }])
+
+    await expect(
+      execute(`DELETE FROM "${tableName}" WHERE id = 'item-1' AND n = 2`)
+    ).rejects.toHaveProperty('name', 'ConditionalCheckFailedException')
+
+    await execute(`DELETE FROM "${tableName}" WHERE id = 'item-1' AND n = 1`)
+    const { Item } = await client.send(
+      new GetItemCommand({
+        TableName: tableName,
+        Key: { id: { S: 'item-1' } },
+      })
+    )
+    expect(Item).toBeUndefined()
+  })
+
+  test('SELECT applies sort key conditions, filters, and projections', async () => {
+    const tableName = await createEvents()
+
+    const { Items } = await execute(
+      `SELECT sk FROM "${tableName}" ` +
+        `WHERE pk = ? AND sk BETWEEN 2 AND 5 AND kind = 1 ORDER BY sk DESC`,
+      [{ S: 'a' }]
+    )
+    expect(Items).toEqual([{ sk: { N: '5' } }, { sk: { N: '3' } }])
+
+    const { Items: missing } = await execute(
+      `SELECT * FROM "${tableName}" WHERE pk IN ['a', 'b'] AND label IS MISSING AND sk = 1`
+    )
+    expect(missing?.map((item) => item.pk?.S).sort()).toEqual(['a', 'b'])
+  })
+
+  test('SELECT pages with Limit and NextToken', async () => {
+    const tableName = await createEvents()
+    const statement = `SELECT * FROM "${tableName}" WHERE pk = 'a'`
+
+    const pages: number[][] = []
+    let NextToken: string | undefined
+    do {
+      const page = await execute(statement, undefined, {
+        Limit: 2,
+        NextToken,
+      })
+      pages.push(page.Items!.map((item) => Number(item.sk!.N)))
+      NextToken = page.NextToken
+    } while (NextToken)
+
+    expect(pages.flat()).toEqual([1, 2, 3, 4, 5])
+    expect(pages[0]).toEqual([1, 2])
+  })
+
+  test('SELECT without Limit pages at 1MB', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('Large'))
+    await createTable(client, tableName)
+    // 12 items of 100KB are more than one 1MB page
+    const ids = Array.from({ length: 12 }, (_, i) => `item-${i}`)
+    for (const id of ids) {
+      await client.send(
+        new PutItemCommand({
+          TableName: tableName,
+          Item: { id: { S: id }, payload: { S: 'x'.repeat(100 * 1024) } },
+        })
+      )
+    }
+
+    const scanned = await client.send(new ScanCommand({ TableName: tableName }))
+    expect(scanned.LastEvaluatedKey).toBeDefined()
+
+    const pages: string[][] = []
+    let NextToken: string | undefined
+    do {
+      const page = await execute(`SELECT * FROM "${tableName}"`, undefined, {
+        NextToken,
+      })
+      pages.push(page.Items!.map((item) => item.id!.S!))
+      NextToken = page.NextToken
+    } while (NextToken)
+
+    expect(pages.length).toBeGreaterThan(1)
+    expect(pages.flat().sort()).toEqual([...ids].sort())
+  })
+
+  test('BatchExecuteStatement reports failures per statement', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('Batch'))
+    await createTableWithItems(client, tableName, [{ id: 'existing' }])
+
+    const { Responses } = await client.send(
+      new BatchExecuteStatementCommand({
+        Statements: [
+          { Statement: `INSERT INTO "${tableName}" VALUE {'id': 'new'}` },
+          { Statement: `INSERT INTO "${tableName}" VALUE {'id': 'existing'}` },
+          {
+            Statement: `UPDATE "${tableName}" SET n = 1 WHERE id = ?`,
+            Parameters: [{ S: 'missing' }],
+          },
+        ],
+      })
+    )
+    expect(Responses?.map((response) => response.Error?.Code)).toEqual([
+      undefined,
+      'DuplicateItem',
+      'ConditionalCheckFailed',
+    ])
+    expect(Responses?.[0]?.TableName).toBe(tableName)
+
+    // The first INSERT applied despite the failures after it
+    const reads = await client.send(
+      new BatchExecuteStatementCommand({
+        Statements: ['new', 'missing'].map((id) => ({
+          Statement: `SELECT * FROM "${tableName}" WHERE id = ?`,
+          Parameters: [{ S: id }],
+        })),
+      })
+    )
+    expect(reads.Responses?.map((response) => response.Item)).toEqual([
+      { id: { S: 'new' } },
+      undefined,
+    ])
+  })
+
+  test('BatchExecuteStatement rejects a batch of reads and writes', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('Mixed'))
+    await createTable(client, tableName)
+
+    await expect(
+      client.send(
+        new BatchExecuteStatementCommand({
+          Statements: [
+            { Statement: `SELECT * FROM "${tableName}" WHERE id = 'a'` },
+            { Statement: `DELETE FROM "${tableName}" WHERE id = 'a'` },
+          ],
+        })
+      )
+    ).rejects.toHaveProperty('name', 'ValidationException')
+  })
+
+  test('a parameter count that does not match the statement is rejected', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('Params'))
+    await createTable(client, tableName)
+
+    await expect(
+      execute(`SELECT * FROM "${tableName}" WHERE id = ?`, [
+        { S: 'a' },
+        { S: 'b' },
+      ])
+    ).rejects.toHaveProperty('name', 'ValidationException')
+  })
+
+  test('ExecuteTransaction applies every write or none', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('Transact'))
+    await createTableWithItems(client, tableName, [
+      { id: 'existing', n: 1 },
+      { id: 'checked', status: 'open' },
+    ])
+
+    await client.send(
+      new ExecuteTransactionCommand({
+        TransactStatements: [
+          { Statement: `INSERT INTO "${tableName}" VALUE {'id': 'new'}` },
+          {
+            Statement: `UPDATE "${tableName}" SET n = n + 1 WHERE id = ?`,
+            Parameters: [{ S: 'existing' }],
+          },
+          {
+            Statement: `EXISTS(SELECT * FROM "${tableName}" WHERE id = 'checked' AND status = 'open')`,
+          },
+        ],
+      })
+    )
+
+    // The duplicate INSERT and the failed EXISTS cancel the transaction,
+    // so the DELETE between them is not applied
+    const error = await client
+      .send(
+        new ExecuteTransactionCommand({
+          TransactStatements: [
+            { Statement: `INSERT INTO "${tableName}" VALUE {'id': 'new'}` },
+            { Statement: `DELETE FROM "${tableName}" WHERE id = 'existing'` },
+            {
+              Statement: `EXISTS(SELECT * FROM "${tableName}" WHERE id = 'checked' AND status = 'closed')`,
+            },
+          ],
+        })
+      )
+      .catch((error) => error)
+    expect(error.name).toBe('TransactionCanceledException')
+    expect(
+      error.CancellationReasons.map((reason: { Code: string }) => reason.Code)
+    ).toEqual(['DuplicateItem', 'None', 'ConditionalCheckFailed'])
+
+    const { Responses } = await client.send(
+      new ExecuteTransactionCommand({
+        TransactStatements: ['new', 'existing', 'missing'].map((id) => ({
+          Statement: `SELECT id, n FROM "${tableName}" WHERE id = ?`,
+          Parameters: [{ S: id }],
+        })),
+      })
+    )
+    expect(Responses?.map((response) => response.Item)).toEqual([
+      { id: { S: 'new' } },
+      { id: { S: 'existing' }, n: { N: '2' } },
+      undefined,
+    ])
+  })
+
+  test('ExecuteTransaction rejects reads mixed with writes', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('TxMixed'))
+    await createTable(client, tableName)
+
+    await expect(
+      client.send(
+        new ExecuteTransactionCommand({
+          TransactStatements: [
+            { Statement: `SELECT * FROM "${tableName}" WHERE id = 'a'` },
+            { Statement: `INSERT INTO "${tableName}" VALUE {'id': 'b'}` },
+          ],
+        })
+      )
+    ).rejects.toHaveProperty('name', 'ValidationException')
+    // EXISTS only makes sense as part of a transaction
+    await expect(
+      execute(`EXISTS(SELECT * FROM "${tableName}" WHERE id = 'a')`)
+    ).rejects.toHaveProperty('name', 'ValidationException')
+  })
+})
@@ -0,0 +1,187 @@
+// Tests for point-in-time recovery
+// Starts dedicated servers, so retention can be configured per test
+
+import { test, expect, describe } from 'bun:test'
+import {
+  BatchWriteItemCommand,
+  DescribeContinuousBackupsCommand,
+  PutItemCommand,
+  RestoreTableToPointInTimeCommand,
+  ScanCommand,
+  UpdateContinuousBackupsCommand,
+  UpdateItemCommand,
+  type DynamoDBClient,
+} from '@aws-sdk/client-dynamodb'
+import {
+  createTableWithItems,
+  startDynado,
+  uniqueTableName,
+} from './helpers.ts'
+
+describe('Point-in-time recovery', () => {
+  // DynamoDB Local does not implement point-in-time recovery
+  if (process.env.TEST_DYNAMODB_LOCAL === 'true') {
+    return
+  }
+
+  function setRecovery(
+    client: DynamoDBClient,
+    TableName: string,
+    PointInTimeRecoveryEnabled: boolean
+  ) {
+    return client.send(
+      new UpdateContinuousBackupsCommand({
+        TableName,
+        PointInTimeRecoverySpecification: { PointInTimeRecoveryEnabled },
+      })
+    )
+  }
+
+  async function scanIds(client: DynamoDBClient, TableName: string) {
+    const { Items } = await client.send(new ScanCommand({ TableName }))
+    return Items!.map((item) => `${item.id?.S}=${item.n?.N}`).sort()
+  }
+
+  // RestoreDateTime may be sent in whole seconds, so changes that must fall
+  // on either side of a restore time are more than a second apart
+  const pause = () => Bun.sleep(1100)
+
+  test('restores a table as of an earlier time', async () => {
+    const { client, cleanup } = await startDynado()
+    try {
+      const tableName = uniqueTableName('Recovered')
+      await createTableWithItems(client, tableName, [{ id: 'a', n: 1 }])
+      const { ContinuousBackupsDescription } = await setRecovery(
+        client,
+        tableName,
+        true
+      )
+      expect(
+        ContinuousBackupsDescription?.PointInTimeRecoveryDescription
+          ?.PointInTimeRecoveryStatus
+      ).toBe('ENABLED')
+
+      await pause()
+      const restoreTime = new Date()
+      await pause()
+      await client.send(
+        new UpdateItemCommand({
+          TableName: tableName,
+          Key: { id: { S: 'a' } },
+          UpdateExpression: 'SET n = :n',
+          ExpressionAttributeValues: { ':n': { N: '2' } },
+        })
+      )
+      await client.send(
+        new BatchWriteItemCommand({
+          RequestItems: {
+            [tableName]: [
+              { PutRequest: { Item: { id: { S: 'b' }, n: { N: '1' } } } },
+            ],
+          },
+        })
+      )
+
+      const earlier = uniqueTableName('Earlier')
+      const { TableDescription } = await client.send(
+        new RestoreTableToPointInTimeCommand({
+          SourceTableName: tableName,
+          TargetTableName: earlier,
+          RestoreDateTime: restoreTime,
+        })
+      )
+      expect(TableDescription?.TableStatus).toBe('ACTIVE')
+      expect(await scanIds(client, earlier)).toEqual(['a=1'])
+
+      const latest = uniqueTableName('Latest')
+      await client.send(
+        new RestoreTableToPointInTimeCommand({
+          SourceTableName: tableName,
+          TargetTableName: latest,
+          UseLatestRestorableTime: true,
+        })
+      )
+      expect(await scanIds(client, latest)).toEqual(['a=2', 'b=1'])
+    } finally {
+      await cleanup()
+    }
+  })
+
+  test('restores only within the retention window', async () => {
+    const { client, cleanup } = await startDynado({ pitrRetentionMs: 1000 })
+    try {
+      const tableName = uniqueTableName('Retained')
+      await createTableWithItems(client, tableName, [{ id: 'a', n: 1 }])
+      const enabledAt = new Date()
+      await setRecovery(client, tableName, true)
+      const put = (id: string) =>
+        client.send(
+          new PutItemCommand({
+            TableName: tableName,
+            Item: { id: { S: id }, n: { N: '1' } },
+          })
+        )
+      await put('b')
+      await pause()
+      await pause()
+      // Logging this write folds the aged-out write of b into the base copy
+      await put('c')
+
+      await expect(
+        client.send(
+          new RestoreTableToPointInTimeCommand({
+            SourceTableName: tableName,
+            TargetTableName: uniqueTableName('TooOld'),
+            RestoreDateTime: enabledAt,
+          })
+        )
+      ).rejects.toHaveProperty('name', 'InvalidRestoreTimeException')
+
+      const latest = uniqueTableName('Latest')
+      await client.send(
+        new RestoreTableToPointInTimeCommand({
+          SourceTableName: tableName,
+          TargetTableName: latest,
+          UseLatestRestorableTime: true,
+        })
+      )
+      expect(await scanIds(client, latest)).toEqual(['a=1', 'b=1', 'c=1'])
+    } finally {
+      await cleanup()
+    }
+  })
+
+  test('a table without recovery enabled cannot be restored', async () => {
+    const { client, cleanup } = await startDynado()
+    try {
+      const tableName = uniqueTableName('Unrecoverable')
+      await createTableWithItems(client, tableName, [{ id: 'a' }])
+      await setRecovery(client, tableName, true)
+      await setRecovery(client, tableName, false)
+
+      const { ContinuousBackupsDescription } = await client.send(
+        new DescribeContinuousBackupsCommand({ TableName: tableName })
+      )
+      expect(ContinuousBackupsDescription).toEqual({
+        ContinuousBackupsStatus: 'ENABLED',
+        PointInTimeRecoveryDescription: {
+          PointInTimeRecoveryStatus: 'DISABLED',
+        },
+      })
+      await expect(
+        client.send(
+          new RestoreTableToPointInTimeCommand({
+            SourceTableName: tableName,
+            TargetTableName: uniqueTableName('Never'),
+            UseLatestRestorableTime: true,
+          })
+        )
+      ).rejects.toHaveProperty(
+        'name',
+        'PointInTimeRecoveryUnavailableException'
+      )
+    } finally {
+      await cleanup()
+    }
+  })
+})
@@ -0,0 +1,266 @@
+// Tests for ProjectionExpression semantics
+// Uses HTTP API via AWS SDK
+
+import { test, expect, beforeAll, afterEach, describe } from 'bun:test'
+import {
+  DynamoDBClient,
+  BatchGetItemCommand,
+  GetItemCommand,
+  QueryCommand,
+  ScanCommand,
+} from '@aws-sdk/client-dynamodb'
+import {
+  getGlobalTestDB,
+  createTableWithItems,
+  cleanupTables,
+  uniqueTableName,
+  trackTable,
+} from './helpers.ts'
+
+describe('ProjectionExpression', () => {
+  let client: DynamoDBClient
+  const createdTables: string[] = []
+
+  beforeAll(async () => {
+    const testDB = await getGlobalTestDB()
+    client = testDB.client
+  })
+
+  afterEach(async () => {
+    await cleanupTables(client, createdTables)
+  })
+
+  async function createProjectionTable(): Promise<string> {
+    const tableName = trackTable(createdTables, uniqueTableName('Projection'))
+    return await createTableWithItems(client, tableName, [
+      { id: 'item-1', name: 'First', count: 1 },
+    ])
+  }
+
+  test('GetItem does not implicitly return key attributes', async () => {
+    const tableName = await createProjectionTable()
+
+    const response = await client.send(
+      new GetItemCommand({
+        TableName: tableName,
+        Key: { id: { S: 'item-1' } },
+        ProjectionExpression: '#n',
+        ExpressionAttributeNames: { '#n': 'name' },
+      })
+    )
+
+    expect(response.Item).toEqual({ name: { S: 'First' } })
+    expect(response.Item!.id).toBeUndefined()
+  })
+
+  test('Query does not implicitly return key attributes', async () => {
+    const tableName = await createProjectionTable()
+
+    const response = await client.send(
+      new QueryCommand({
+        TableName: tableName,
+        KeyConditionExpression: 'id = :id',
+        ExpressionAttributeValues: { ':id': { S: 'item-1' } },
+        ProjectionExpression: '#c',
+        ExpressionAttributeNames: { '#c': 'count' },
+      })
+    )
+
+    expect(response.Items).toEqual([{ count: { N: '1' } }])
+  })
+
+  test('paths through a missing intermediate are omitted', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('Projection'))
+    await createTableWithItems(client, tableName, [
+      {
+        id: 'item-1',
+        name: 'First',
+        profile: { M: { address: { M: { city: { S: 'Oslo' } } } } },
+      },
+    ])
+
+    const response = await client.send(
+      new GetItemCommand({
+        TableName: tableName,
+        Key: { id: { S: 'item-1' } },
+        ProjectionExpression: '#n, profile.phone.mobile, profile.address.city',
+        ExpressionAttributeNames: { '#n': 'name' },
+      })
+    )
+
+    expect(response.Item).toEqual({
+      name: { S: 'First' },
+      profile: { M: { address: { M: { city: { S: 'Oslo' } } } } },
+    })
+  })
+
+  test('BatchGetItem projects each table with its own aliases', async () => {
+    const users = await createProjectionTable()
+    const orders = trackTable(createdTables, uniqueTableName('Projection'))
+    await createTableWithItems(client, orders, [
+      { id: 'order-1', status: 'shipped', total: 42 },
+    ])
+
+    const response = await client.send(
+      new BatchGetItemCommand({
+        RequestItems: {
+          [users]: {
+            Keys: [{ id: { S: 'item-1' } }],
+            ProjectionExpression: '#n',
+            ExpressionAttributeNames: { '#n': 'name' },
+          },
+          [orders]: {
+            Keys: [{ id: { S: 'order-1' } }],
+            ProjectionExpression: 'id, #s',
+            ExpressionAttributeNames: { '#s': 'status' },
+          },
+        },
+      })
+    )
+
+    expect(response.Responses![users]).toEqual([{ name: { S: 'First' } }])
+    expect(response.Responses![orders]).toEqual([
+      { id: { S: 'order-1' }, status: { S: 'shipped' } },
+    ])
+  })
+
+  test('list elements keep their list order and share their parents', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('Projection'))
+    await createTableWithItems(client, tableName, [
+      {
+        id: 'item-1',
+        steps: {
+          L: [
+            {
+              M: {
+                name: { S: 'fetch' },
+                ms: { N: '12' },
+                ok: { BOOL: true },
+              },
+            },
+            { S: 'skipped' },
+            { S: 'done' },
+          ],
+        },
+      },
+    ])
+
+    const response = await client.send(
+      new ScanCommand({
+        TableName: tableName,
+        ProjectionExpression: 'steps[2], steps[0].ms, steps[0].#n, steps[7]',
+        ExpressionAttributeNames: { '#n': 'name' },
+      })
+    )
+
+    expect(response.Items).toEqual([
+      {
+        steps: {
+          L: [{ M: { ms: { N: '12' }, name: { S: 'fetch' } } }, { S: 'done' }],
+        },
+      },
+    ])
+  })
+
+  test('overlapping, conflicting and empty projections are rejected', async () => {
+    const tableName = await createProjectionTable()
+    const get = (ProjectionExpression: string) =>
+      client.send(
+        new GetItemCommand({
+          TableName: tableName,
+          // A key that matches nothing: projections fail before the read
+          Key: { id: { S: 'missing' } },
+          ProjectionExpression,
+        })
+      )
+
+    await expect(get('profile, profile.address')).rejects.toMatchObject({
+      name: 'ValidationException',
+      message: expect.stringContaining('Two document paths overlap'),
+    })
+    await expect(get('id, id')).rejects.toMatchObject({
+      name: 'ValidationException',
+      message: expect.stringContaining('Two document paths overlap'),
+    })
+    await expect(get('profile.address, profile[0]')).rejects.toMatchObject({
+      name: 'ValidationException',
+      message: expect.stringContaining('Two document paths conflict'),
+    })
+    await expect(get('')).rejects.toHaveProperty('name', 'ValidationException')
+    await expect(get('id,')).rejects.toHaveProperty(
+      'name',
+      'ValidationException'
+    )
+  })
+
+  describe('with AttributesToGet', () => {
+    const requests: Array<{
+      operation: string
+      send: (tableName: string) => Promise<unknown>
+    }> = [
+      {
+        operation: 'GetItem',
+        send: (tableName) =>
+          client.send(
+            new GetItemCommand({
+              TableName: tableName,
+              Key: { id: { S: 'item-1' } },
+              AttributesToGet: ['id'],
+              ProjectionExpression: 'id',
+            })
+          ),
+      },
+      {
+        operation: 'Query',
+        send: (tableName) =>
+          client.send(
+            new QueryCommand({
+              TableName: tableName,
+              KeyConditionExpression: 'id = :id',
+              ExpressionAttributeValues: { ':id': { S: 'item-1' } },
+              AttributesToGet: ['id'],
+              ProjectionExpression: 'id',
+            })
+          ),
+      },
+      {
+        operation: 'Scan',
+        send: (tableName) =>
+          client.send(
+            new ScanCommand({
+              TableName: tableName,
+              AttributesToGet: ['id'],
+              ProjectionExpression: 'id',
+            })
+          ),
+      },
+      {
+        operation: 'BatchGetItem',
+        send: (tableName) =>
+          client.send(
+            new BatchGetItemCommand({
+              RequestItems: {
+                [tableName]: {
+                  Keys: [{ id: { S: 'item-1' } }],
+                  AttributesToGet: ['id'],
+                  ProjectionExpression: 'id',
+                },
+              },
+            })
+          ),
+      },
+    ]
+
+    for (const { operation, send } of requests) {
+      test(`${operation} rejects both projection forms`, async () => {
+        const tableName = await createProjectionTable()
+
+        const error = await send(tableName).catch((e) => e)
+        expect(error.name).toBe('ValidationException')
+        expect(error.message).toContain(
+          'Can not use both expression and non-expression parameters'
+        )
+      })
+    }
+  })
+})
@@ -11,9 +11,12 @@ import {
   describe,
 } from 'bun:test'
 import {
+  type AttributeValue,
+  DeleteItemCommand,
   DynamoDBClient,
   PutItemCommand,
   QueryCommand,
+  ScanCommand,
 } from '@aws-sdk/client-dynamodb'
 import {
   getGlobalTestDB,
@@ -195,6 +198,44 @@ describe('Range Queries', () => {
     expect(result.Items![2]!.timestamp!.N).toBe('500')
   })
 
+  test('should reject legacy filters beside expressions', async () => {
+    const filter = {
+      data: {
+        ComparisonOperator: 'EQ' as const,
+        AttributeValueList: [{ S: 'a' }],
+      },
+    }
+
+    const scan = await client
+      .send(
+        new ScanCommand({
+          TableName: getTableName(),
+          ScanFilter: filter,
+          FilterExpression: 'attribute_exists(userId)',
+        })
+      )
+      .catch((e) => e)
+    expect(scan.name).toBe('ValidationException')
+    expect(scan.message).toBe(
+      'Can not use both expression and non-expression parameters in the same request: Non-expression parameters: {ScanFilter} Expression parameters: {FilterExpression}'
+    )
+
+    const query = await client
+      .send(
+        new QueryCommand({
+          TableName: getTableName(),
+          KeyConditionExpression: 'userId = :userId',
+          ExpressionAttributeValues: { ':userId': { S: 'user1' } },
+          QueryFilter: filter,
+        })
+      )
+      .catch((e) => e)
+    expect(query.name).toBe('ValidationException')
+    expect(query.message).toContain(
+      'Non-expression parameters: {QueryFilter} Expression parameters: {KeyConditionExpression}'
+    )
+  })
+
   test('should query with BETWEEN operator', async () => {
     const result = await client.send(
       new QueryCommand({
@@ -218,6 +259,29 @@ describe('Range Queries', () => {
     expect(result.Items![2]!.timestamp!.N).toBe('400')
   })
 
+  test('should reject two ANDed sort key conditions', async () => {
+    const error = await client
+      .send(
+        new QueryCommand({
+          TableName: getTableName(),
+          KeyConditionExpression:
+            'userId = :userId AND #ts >= :start AND #ts <= :end',
+          ExpressionAttributeNames: {
+            '#ts': 'timestamp',
+          },
+          ExpressionAttributeValues: {
+            ':userId': { S: 'user1' },
+            ':start': { N: '200' },
+            ':end': { N: '400' },
+          },
+        })
+      )
+      .catch((e) => e)
+
+    expect(error.name).toBe('ValidationException')
+    expect(error.message).toContain('one condition per key')
+  })
+
   test('should query with begins_with operator', async () => {
     // Create a table with string sort keys for begins_with testing
     const tableName = trackTable(createdTables, uniqueTableName('BeginsWith'))
@@ -307,6 +371,32 @@ describe('Range Queries', () => {
     expect(result.Items![4]!.timestamp!.N).toBe('100')
   })
 
+  test('should page through a descending query in sort key order', async () => {
+    const timestamps: string[] = []
+    let startKey: Record<string, AttributeValue> | undefined
+    do {
+      const page = await client.send(
+        new QueryCommand({
+          TableName: getTableName(),
+          KeyConditionExpression: 'userId = :userId AND #ts < :before',
+          ExpressionAttributeNames: { '#ts': 'timestamp' },
+          ExpressionAttributeValues: {
+            ':userId': { S: 'user1' },
+            ':before': { N: '500' },
+          },
+          ScanIndexForward: false,
+          Limit: 3,
+          ExclusiveStartKey: startKey,
+        })
+      )
+      timestamps.push(...page.Items!.map((item) => item.timestamp!.N!))
+      startKey = page.LastEvaluatedKey
+    } while (startKey)
+
+    // The second page starts below the last key of the first
+    expect(timestamps).toEqual(['400', '300', '200', '100'])
+  })
+
   test('should support pagination with Limit', async () => {
     const result = await client.send(
       new QueryCommand({
@@ -358,6 +448,130 @@ describe('Range Queries', () => {
     expect(result2.Items![1]!.timestamp!.N).toBe('400')
   })
 
+  test('should not return LastEvaluatedKey when Limit matches the remaining items', async () => {
+    // DynamoDB may hand back a key that leads to an empty page here; dynado
+    // only returns one when items remain
+    if (process.env.TEST_DYNAMODB_LOCAL === 'true') {
+      return
+    }
+
+    const firstPage = await client.send(
+      new QueryCommand({
+        TableName: getTableName(),
+        KeyConditionExpression: 'userId = :userId',
+        ExpressionAttributeValues: { ':userId': { S: 'user1' } },
+        Limit: 2,
+      })
+    )
+    expect(firstPage.ScannedCount).toBe(2)
+    expect(firstPage.LastEvaluatedKey).toBeDefined()
+
+    const lastPage = await client.send(
+      new QueryCommand({
+        TableName: getTableName(),
+        KeyConditionExpression: 'userId = :userId',
+        ExpressionAttributeValues: { ':userId': { S: 'user1' } },
+        Limit: 3,
+        ExclusiveStartKey: firstPage.LastEvaluatedKey,
+      })
+    )
+    expect(lastPage.Count).toBe(3)
+    expect(lastPage.ScannedCount).toBe(3)
+    expect(lastPage.LastEvaluatedKey).toBeUndefined()
+
+    const scan = await client.send(
+      new ScanCommand({ TableName: getTableName(), Limit: 7 })
+    )
+    expect(scan.Count).toBe(7)
+    expect(scan.ScannedCount).toBe(7)
+    expect(scan.LastEvaluatedKey).toBeUndefined()
+  })
+
+  test('should resume a query after the last evaluated item is deleted', async () => {
+    const query = (
+      ScanIndexForward: boolean,
+      ExclusiveStartKey?: Record<string, AttributeValue>
+    ) =>
+      client.send(
+        new QueryCommand({
+          TableName: getTableName(),
+          KeyConditionExpression: 'userId = :userId',
+          ExpressionAttributeValues: { ':userId': { S: 'user1' } },
+          ScanIndexForward,
+          ExclusiveStartKey,
+          Limit: 2,
+        })
+      )
+    const timestamps = (items?: Record<string, AttributeValue>[]) =>
+      items!.map((item) => item.timestamp!.N)
+
+    for (const [forward, expected] of [
+      [true, ['300', '400']],
+      [false, ['300', '100']],
+    ] as const) {
+      const first = await query(forward)
+      await client.send(
+        new DeleteItemCommand({
+          TableName: getTableName(),
+          Key: first.LastEvaluatedKey,
+        })
+      )
+      const second = await query(forward, first.LastEvaluatedKey)
+      expect(timestamps(second.Items)).toEqual([...expected])
+    }
+  })
+
+  test('should order string sort keys by their bytes', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('ByteOrder'))
+    await createTable(client, tableName, {
+      keySchema: [
+        { AttributeName: 'pk', KeyType: 'HASH' },
+        { AttributeName: 'sk', KeyType: 'RANGE' },
+      ],
+      attributeDefinitions: [
+        { AttributeName: 'pk', AttributeType: 'S' },
+        { AttributeName: 'sk', AttributeType: 'S' },
+      ],
+    })
+    for (const sk of ['b', 'B', '_', 'a', 'A', 'é']) {
+      await client.send(
+        new PutItemCommand({
+          TableName: tableName,
+          Item: { pk: { S: 'p' }, sk: { S: sk } },
+        })
+      )
+    }
+
+    const result = await client.send(
+      new QueryCommand({
+        TableName: tableName,
+        KeyConditionExpression: 'pk = :pk',
+        ExpressionAttributeValues: { ':pk': { S: 'p' } },
+      })
+    )
+    expect(result.Items!.map((item) => item.sk!.S)).toEqual([
+      'A',
+      'B',
+      '_',
+      'a',
+      'b',
+      'é',
+    ])
+  })
+
+  test('should reject a Limit below 1', async () => {
+    await expect(
+      client.send(
+        new QueryCommand({
+          TableName: getTableName(),
+          KeyConditionExpression: 'userId = :userId',
+          ExpressionAttributeValues: { ':userId': { S: 'user1' } },
+          Limit: 0,
+        })
+      )
+    ).rejects.toHaveProperty('name', 'ValidationException')
+  })
+
   test('should isolate queries by partition key', async () => {
     const result1 = await client.send(
       new QueryCommand({
@@ -432,4 +646,113 @@ describe('Range Queries', () => {
     expect(result.Items![1]!.timestamp!.N).toBe('300')
     expect(result.LastEvaluatedKey).toBeDefined()
   })
+
+  test('should count items without returning them with Select COUNT', async () => {
+    const count = await client.send(
+      new QueryCommand({
+        TableName: getTableName(),
+        KeyConditionExpression: 'userId = :userId',
+        FilterExpression: '#data <> :data',
+        ExpressionAttributeNames: { '#data': 'data' },
+        ExpressionAttributeValues: {
+          ':userId': { S: 'user1' },
+          ':data': { S: 'c' },
+        },
+        Select: 'COUNT',
+      })
+    )
+    expect(count.Items).toBeUndefined()
+    expect(count.Count).toBe(4)
+    expect(count.ScannedCount).toBe(5)
+
+    // Counts paginate like items, so a count can be summed across pages
+    let total = 0
+    let startKey: Record<string, AttributeValue> | undefined
+    do {
+      const page = await client.send(
+        new ScanCommand({
+          TableName: getTableName(),
+          Select: 'COUNT',
+          Limit: 3,
+          ExclusiveStartKey: startKey,
+        })
+      )
+      expect(page.Items).toBeUndefined()
+      total += page.Count!
+      startKey = page.LastEvaluatedKey
+    } while (startKey)
+    expect(total).toBe(7)
+
+    const error = await client
+      .send(
+        new QueryCommand({
+          TableName: getTableName(),
+          KeyConditionExpression: 'userId = :userId',
+          ExpressionAttributeValues: { ':userId': { S: 'user1' } },
+          Select: 'COUNT',
+          ProjectionExpression: '#data',
+          ExpressionAttributeNames: { '#data': 'data' },
+        })
+      )
+      .catch((e) => e)
+    expect(error.name).toBe('ValidationException')
+  })
+
+  test('should order and match binary sort keys by their bytes', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('BinaryKeys'))
+    await createTable(client, tableName, {
+      keySchema: [
+        { AttributeName: 'pk', KeyType: 'HASH' },
+        { AttributeName: 'sk', KeyType: 'RANGE' },
+      ],
+      attributeDefinitions: [
+        { AttributeName: 'pk', AttributeType: 'B' },
+        { AttributeName: 'sk', AttributeType: 'B' },
+      ],
+    })
+    const pk = { B: new Uint8Array([0xff, 0x00]) }
+    // Byte order, which differs from the order of their base64 encodings
+    const keys = [[0x01], [0x01, 0x02], [0x7f], [0x80], [0xfe, 0x00]]
+    for (const bytes of [...keys].reverse()) {
+      await client.send(
+        new PutItemCommand({
+          TableName: tableName,
+          Item: { pk, sk: { B: new Uint8Array(bytes) } },
+        })
+      )
+    }
+
+    const query = async (
+      condition: string,
+      values: Record<string, AttributeValue> = {},
+      ScanIndexForward?: boolean
+    ) => {
+      const result = await client.send(
+        new QueryCommand({
+          TableName: tableName,
+          KeyConditionExpression: `pk = :pk${condition}`,
+          ExpressionAttributeValues: { ':pk': pk, ...values },
+          ScanIndexForward,
+        })
+      )
+      return result.Items!.map((item) => [...item.sk!.B!])
+    }
+    const b = (...bytes: number[]) => ({ B: new Uint8Array(bytes) })
+
+    expect(await query('')).toEqual(keys)
+    expect(await query('', {}, false)).toEqual([...keys].reverse())
+    expect(await query(' AND sk < :v', { ':v': b(0x7f) })).toEqual([
+      [0x01],
+      [0x01, 0x02],
+    ])
+    expect(
+      await query(' AND sk BETWEEN :lo AND :hi', {
+        ':lo': b(0x01, 0x02),
+        ':hi': b(0x80),
+      })
+    ).toEqual([[0x01, 0x02], [0x7f], [0x80]])
+    expect(
+      await query(' AND begins_with(sk, :prefix)', { ':prefix': b(0x01) })
+    ).toEqual([[0x01], [0x01, 0x02]])
+  })
 })
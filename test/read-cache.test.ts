@@ -0,0 +1,125 @@
+// Tests for READ_CACHE_SIZE
+// Every write path must invalidate the cached item it replaces
+
+import { test, expect, describe } from 'bun:test'
+import {
+  BatchWriteItemCommand,
+  DeleteItemCommand,
+  GetItemCommand,
+  PutItemCommand,
+  TransactWriteItemsCommand,
+  UpdateItemCommand,
+} from '@aws-sdk/client-dynamodb'
+import { ReadCache } from '../src/read-cache.ts'
+import { Shard } from '../src/shard.ts'
+import { createTable, startDynado, uniqueTableName } from './helpers.ts'
+import * as fs from 'fs/promises'
+import * as os from 'os'
+import * as path from 'path'
+
+describe('ReadCache', () => {
+  test('evicts the least recently used item', () => {
+    const cache = new ReadCache(2)
+    cache.set('T', 'a', '', '{"id":{"S":"a"}}')
+    cache.set('T', 'b', '', '{"id":{"S":"b"}}')
+    cache.get('T', 'a', '')
+    cache.set('T', 'c', '', '{"id":{"S":"c"}}')
+
+    expect(cache.size).toBe(2)
+    expect(cache.get('T', 'a', '')).toBe('{"id":{"S":"a"}}')
+    expect(cache.get('T', 'b', '')).toBeUndefined()
+    expect(cache.get('T', 'c', '')).toBe('{"id":{"S":"c"}}')
+  })
+})
+
+describe('Read cache', () => {
+  // DynamoDB Local has no item cache to invalidate
+  if (process.env.TEST_DYNAMODB_LOCAL === 'true') {
+    return
+  }
+
+  test('reads after every kind of write see the new item', async () => {
+    const { client, cleanup } = await startDynado({ readCacheSize: 16 })
+    try {
+      const tableName = await createTable(client, uniqueTableName('Cache'))
+      const Key = { id: { S: 'hot' } }
+      const read = async () => {
+        const { Item } = await client.send(
+          new GetItemCommand({ TableName: tableName, Key })
+        )
+        return Item?.version?.N
+      }
+
+      await client.send(
+        new PutItemCommand({
+          TableName: tableName,
+          Item: { ...Key, version: { N: '1' } },
+        })
+      )
+      expect(await read()).toBe('1')
+
+      await client.send(
+        new UpdateItemCommand({
+          TableName: tableName,
+          Key,
+          UpdateExpression: 'SET version = :v',
+          ExpressionAttributeValues: { ':v': { N: '2' } },
+        })
+      )
+      expect(await read()).toBe('2')
+
+      await client.send(
+        new TransactWriteItemsCommand({
+          TransactItems: [
+            {
+              Update: {
+                TableName: tableName,
+                Key,
+                UpdateExpression: 'SET version = :v',
+                ExpressionAttributeValues: { ':v': { N: '3' } },
+              },
+            },
+          ],
+        })
+      )
+      expect(await read()).toBe('3')
+
+      await client.send(
+        new BatchWriteItemCommand({
+          RequestItems: {
+            [tableName]: [
+              { PutRequest: { Item: { ...Key, version: { N: '4' } } } },
+            ],
+          },
+        })
+      )
+      expect(await read()).toBe('4')
+
+      await client.send(new DeleteItemCommand({ TableName: tableName, Key }))
+      expect(await read()).toBeUndefined()
+    } finally {
+      await cleanup()
+    }
+  })
+
+  test('a cached item can be mutated by the caller', async () => {
+    const dir = await fs.mkdtemp(path.join(os.tmpdir(), 'dynado-cache-'))
+    const shard = new Shard(
+      path.join(dir, 'shard.db'),
+      0,
+      { mode: 'never' },
+      'serializable',
+      16
+    )
+    try {
+      await shard.putItem('T', 'a', '', { id: { S: 'a' } })
+      const first = await shard.getItem('T', 'a', '')
+      first!.extra = { S: 'local change' }
+
+      expect(await shard.getItem('T', 'a', '')).toEqual({ id: { S: 'a' } })
+    } finally {
+      shard.close()
+      await fs.rm(dir, { recursive: true })
+    }
+  })
+})
@@ -0,0 +1,108 @@
+// Tests for SEED_FILE startup loading
+// Starts dedicated servers, since seeding happens at construction
+
+import { test, expect, describe, afterEach } from 'bun:test'
+import {
+  DescribeTableCommand,
+  GetItemCommand,
+  ScanCommand,
+} from '@aws-sdk/client-dynamodb'
+import { DB } from '../src/index.ts'
+import { createConfig } from '../src/config.ts'
+import type { Seed } from '../src/seed.ts'
+import { startDynado } from './helpers.ts'
+import * as fs from 'fs/promises'
+import * as os from 'os'
+import * as path from 'path'
+
+describe('Seed file', () => {
+  // DynamoDB Local cannot load tables from a file at startup
+  if (process.env.TEST_DYNAMODB_LOCAL === 'true') {
+    return
+  }
+
+  const seedDirs: string[] = []
+
+  afterEach(async () => {
+    for (const dir of seedDirs) {
+      await fs.rm(dir, { recursive: true, force: true })
+    }
+    seedDirs.length = 0
+  })
+
+  async function writeSeed(contents: Seed | string): Promise<string> {
+    const dir = await fs.mkdtemp(path.join(os.tmpdir(), 'dynado-seed-'))
+    seedDirs.push(dir)
+    const seedFile = path.join(dir, 'seed.json')
+    await fs.writeFile(
+      seedFile,
+      typeof contents === 'string' ? contents : JSON.stringify(contents)
+    )
+    return seedFile
+  }
+
+  const usersTable = {
+    TableName: 'Users',
+    KeySchema: [{ AttributeName: 'id', KeyType: 'HASH' as const }],
+    AttributeDefinitions: [
+      { AttributeName: 'id', AttributeType: 'S' as const },
+    ],
+    BillingMode: 'PAY_PER_REQUEST' as const,
+  }
+
+  test('seeded tables and items exist on the first request', async () => {
+    const seedFile = await writeSeed({
+      Tables: [
+        {
+          ...usersTable,
+          Items: [
+            { Item: { id: { S: 'u1' }, name: { S: 'Ada' } } },
+            { Item: { id: { S: 'u2' }, name: { S: 'Grace' } } },
+          ],
+        },
+        {
+          ...usersTable,
+          TableName: 'Empty',
+        },
+      ],
+    })
+    const { client, cleanup } = await startDynado({ seedFile })
+    try {
+      const item = await client.send(
+        new GetItemCommand({ TableName: 'Users', Key: { id: { S: 'u1' } } })
+      )
+      expect(item.Item).toEqual({ id: { S: 'u1' }, name: { S: 'Ada' } })
+
+      const scan = await client.send(new ScanCommand({ TableName: 'Users' }))
+      expect(scan.Count).toBe(2)
+
+      const empty = await client.send(
+        new DescribeTableCommand({ TableName: 'Empty' })
+      )
+      expect(empty.Table?.TableName).toBe('Empty')
+    } finally {
+      await cleanup()
+    }
+  })
+
+  test('an item that does not match the key schema fails startup', async () => {
+    const seedFile = await writeSeed({
+      Tables: [{ ...usersTable, Items: [{ Item: { name: { S: 'nokey' } } }] }],
+    })
+    const { db, cleanup } = await startDynado({ seedFile })
+    try {
+      await expect(db.ready).rejects.toThrow('Failed to seed table Users')
+    } finally {
+      await cleanup()
+    }
+  })
+
+  test('a malformed seed file fails before the server starts', async () => {
+    const seedFile = await writeSeed('{ "Tables": [')
+    const dataDir = path.join(path.dirname(seedFile), 'data')
+
+    expect(
+      () => new DB(createConfig({ port: 0, dataDir, seedFile }))
+    ).toThrow('Invalid seed file')
+  })
+})
@@ -0,0 +1,116 @@
+// Tests for the shard count recorded in DATA_DIR
+// Restarts dedicated servers on the same data directory
+
+import { test, expect, describe, beforeEach, afterEach } from 'bun:test'
+import { GetItemCommand, PutItemCommand } from '@aws-sdk/client-dynamodb'
+import { DB } from '../src/index.ts'
+import { createConfig } from '../src/config.ts'
+import { shardPath, stageShards } from '../src/reshard.ts'
+import { createTable, startDynado } from './helpers.ts'
+import * as fs from 'fs/promises'
+import * as os from 'os'
+import * as path from 'path'
+
+describe('Shard count', () => {
+  // Restarts dedicated servers on one data directory, which DynamoDB Local
+  // does not shard
+  if (process.env.TEST_DYNAMODB_LOCAL === 'true') {
+    return
+  }
+
+  const ids = Array.from({ length: 20 }, (_, i) => `user-${i}`)
+  let dataDir: string
+
+  beforeEach(async () => {
+    dataDir = await fs.mkdtemp(path.join(os.tmpdir(), 'dynado-shards-'))
+    const { client, cleanup } = await startDynado({ dataDir, shardCount: 4 })
+    try {
+      await createTable(client, 'Users')
+      for (const id of ids) {
+        await client.send(
+          new PutItemCommand({ TableName: 'Users', Item: { id: { S: id } } })
+        )
+      }
+    } finally {
+      await cleanup()
+    }
+  })
+
+  afterEach(async () => {
+    await fs.rm(dataDir, { recursive: true, force: true })
+  })
+
+  // Ids of the seeded items a server on dataDir can still read
+  async function readableIds(shardCount?: number, reshard?: boolean) {
+    const { client, cleanup } = await startDynado({
+      dataDir,
+      shardCount,
+      reshard,
+    })
+    try {
+      const found: string[] = []
+      for (const id of ids) {
+        const { Item } = await client.send(
+          new GetItemCommand({ TableName: 'Users', Key: { id: { S: id } } })
+        )
+        if (Item) found.push(id)
+      }
+      return found
+    } finally {
+      await cleanup()
+    }
+  }
+
+  test('a different SHARD_COUNT fails startup instead of hiding items', () => {
+    expect(
+      () => new DB(createConfig({ port: 0, dataDir, shardCount: 8 }))
+    ).toThrow(
+      `DATA_DIR ${dataDir} was written with 4 shards but SHARD_COUNT is 8`
+    )
+  })
+
+  test('an unset SHARD_COUNT uses the recorded count', async () => {
+    expect(await readableIds()).toEqual(ids)
+  })
+
+  test('RESHARD moves every item to the new shard count', async () => {
+    expect(await readableIds(8, true)).toEqual(ids)
+    // The new count is recorded, so the next start needs no flag
+    expect(await readableIds(8)).toEqual(ids)
+    expect(
+      () => new DB(createConfig({ port: 0, dataDir, shardCount: 4 }))
+    ).toThrow('was written with 8 shards')
+  })
+
+  test('a reshard interrupted mid-swap is finished on the next start', async () => {
+    stageShards(dataDir, 4, 8)
+    // Crash after the old shards moved aside and some staged ones moved in
+    const staging = path.join(dataDir, 'reshard')
+    const retired = path.join(dataDir, 'reshard-old')
+    await fs.mkdir(retired)
+    for (let i = 0; i < 4; i++) {
+      await fs.rename(shardPath(dataDir, i), shardPath(retired, i))
+    }
+    for (let i = 0; i < 3; i++) {
+      await fs.rename(shardPath(staging, i), shardPath(dataDir, i))
+    }
+
+    expect(await readableIds()).toEqual(ids)
+    expect(
+      () => new DB(createConfig({ port: 0, dataDir, shardCount: 4 }))
+    ).toThrow('was written with 8 shards')
+    const files = await fs.readdir(dataDir)
+    expect(files).not.toContain('reshard')
+    expect(files).not.toContain('reshard-old')
+  })
+
+  test('an unfinished staging directory is discarded', async () => {
+    // Crash while the new shards were still being built
+    const staging = path.join(dataDir, 'reshard')
+    await fs.mkdir(staging)
+    await fs.writeFile(shardPath(staging, 0), 'partial')
+
+    expect(await readableIds()).toEqual(ids)
+    expect(await fs.readdir(dataDir)).not.toContain('reshard')
+  })
+})
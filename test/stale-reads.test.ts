@@ -0,0 +1,107 @@
+// Tests for STALE_READ_MS
+// Starts dedicated servers, since the setting applies to every table
+
+import { test, expect, describe } from 'bun:test'
+import {
+  BatchGetItemCommand,
+  CreateTableCommand,
+  DeleteItemCommand,
+  GetItemCommand,
+  PutItemCommand,
+  QueryCommand,
+  ScanCommand,
+  UpdateItemCommand,
+} from '@aws-sdk/client-dynamodb'
+import { startDynado, uniqueTableName } from './helpers.ts'
+
+describe('Stale reads', () => {
+  // DynamoDB Local reads are always consistent
+  if (process.env.TEST_DYNAMODB_LOCAL === 'true') {
+    return
+  }
+
+  const STALE_READ_MS = 300
+
+  test('eventually consistent reads lag behind writes', async () => {
+    const { client, cleanup } = await startDynado({
+      staleReadMs: STALE_READ_MS,
+    })
+    try {
+      const tableName = uniqueTableName('StaleReads')
+      await client.send(
+        new CreateTableCommand({
+          TableName: tableName,
+          KeySchema: [
+            { AttributeName: 'pk', KeyType: 'HASH' },
+            { AttributeName: 'sk', KeyType: 'RANGE' },
+          ],
+          AttributeDefinitions: [
+            { AttributeName: 'pk', AttributeType: 'S' },
+            { AttributeName: 'sk', AttributeType: 'S' },
+          ],
+          BillingMode: 'PAY_PER_REQUEST',
+        })
+      )
+      const Key = { pk: { S: 'p' }, sk: { S: 'a' } }
+      const get = async (ConsistentRead?: boolean) =>
+        (
+          await client.send(
+            new GetItemCommand({ TableName: tableName, Key, ConsistentRead })
+          )
+        ).Item
+      const query = async (ConsistentRead?: boolean) =>
+        (
+          await client.send(
+            new QueryCommand({
+              TableName: tableName,
+              KeyConditionExpression: 'pk = :pk',
+              ExpressionAttributeValues: { ':pk': { S: 'p' } },
+              ConsistentRead,
+            })
+          )
+        ).Items
+
+      await client.send(
+        new PutItemCommand({
+          TableName: tableName,
+          Item: { ...Key, v: { N: '1' } },
+        })
+      )
+      // A new item is only visible to consistent reads at first
+      expect(await get()).toBeUndefined()
+      expect(await get(true)).toEqual({ ...Key, v: { N: '1' } })
+      await Bun.sleep(STALE_READ_MS + 100)
+      expect(await get()).toEqual({ ...Key, v: { N: '1' } })
+
+      await client.send(
+        new UpdateItemCommand({
+          TableName: tableName,
+          Key,
+          UpdateExpression: 'SET v = :v',
+          ExpressionAttributeValues: { ':v': { N: '2' } },
+        })
+      )
+      await client.send(new DeleteItemCommand({ TableName: tableName, Key }))
+      // Reads see the item as it was before the first of the recent writes
+      expect(await get()).toEqual({ ...Key, v: { N: '1' } })
+      expect(await query()).toEqual([{ ...Key, v: { N: '1' } }])
+      const scan = await client.send(new ScanCommand({ TableName: tableName }))
+      expect(scan.Items).toEqual([{ ...Key, v: { N: '1' } }])
+      const batch = await client.send(
+        new BatchGetItemCommand({
+          RequestItems: { [tableName]: { Keys: [Key] } },
+        })
+      )
+      expect(batch.Responses![tableName]).toEqual([{ ...Key, v: { N: '1' } }])
+
+      expect(await get(true)).toBeUndefined()
+      expect(await query(true)).toEqual([])
+
+      await Bun.sleep(STALE_READ_MS + 100)
+      expect(await get()).toBeUndefined()
+      expect(await query()).toEqual([])
+    } finally {
+      await cleanup()
+    }
+  })
+})
@@ -0,0 +1,57 @@
+// Tests for STATSD_ADDR metrics
+// Listens on a local UDP socket for the packets a dedicated server sends
+
+import { test, expect, describe } from 'bun:test'
+import { GetItemCommand } from '@aws-sdk/client-dynamodb'
+import { createTable, startDynado, uniqueTableName } from './helpers.ts'
+
+describe('StatsD metrics', () => {
+  // DynamoDB Local does not send metrics anywhere
+  if (process.env.TEST_DYNAMODB_LOCAL === 'true') {
+    return
+  }
+
+  test('requests emit counters, timers, and error counters', async () => {
+    const packets: string[] = []
+    const listener = await Bun.udpSocket({
+      hostname: '127.0.0.1',
+      socket: {
+        data(_socket, data) {
+          packets.push(...data.toString().split('\n'))
+        },
+      },
+    })
+    const { client, cleanup } = await startDynado({
+      statsdAddr: { host: '127.0.0.1', port: listener.port },
+    })
+    try {
+      await createTable(client, uniqueTableName('Statsd'))
+      await client
+        .send(
+          new GetItemCommand({
+            TableName: uniqueTableName('Missing'),
+            Key: { id: { S: 'item-1' } },
+          })
+        )
+        .catch(() => {})
+
+      // UDP delivery is asynchronous, so wait for the last expected packet
+      const errorPacket = 'dynado.error.GetItem.ResourceNotFoundException:1|c'
+      for (let i = 0; i < 100 && !packets.includes(errorPacket); i++) {
+        await Bun.sleep(10)
+      }
+
+      expect(packets).toContain('dynado.request.CreateTable:1|c')
+      expect(packets).toContain('dynado.request.GetItem:1|c')
+      expect(packets).toContain(errorPacket)
+      const latency = /^dynado\.request\.GetItem\.latency:\d+\|ms$/
+      expect(packets.some((p) => latency.test(p))).toBe(true)
+      expect(
+        packets.some((p) => p.startsWith('dynado.error.CreateTable'))
+      ).toBe(false)
+    } finally {
+      listener.close()
+      await cleanup()
+    }
+  })
+})
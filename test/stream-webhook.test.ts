@@ -0,0 +1,184 @@
+// Tests for STREAM_WEBHOOK_URL
+// Starts dedicated servers, so records can be posted to a local sink
+
+import { test, expect, describe } from 'bun:test'
+import {
+  CreateTableCommand,
+  DeleteItemCommand,
+  PutItemCommand,
+  UpdateItemCommand,
+  type DynamoDBClient,
+  type StreamViewType,
+} from '@aws-sdk/client-dynamodb'
+import { startDynado, uniqueTableName } from './helpers.ts'
+
+describe('Stream webhook', () => {
+  // DynamoDB Local does not post stream records anywhere
+  if (process.env.TEST_DYNAMODB_LOCAL === 'true') {
+    return
+  }
+
+  // A sink that records each request body, failing the first `failures`
+  function startSink(failures: number = 0) {
+    const bodies: any[] = []
+    let requests = 0
+    const server = Bun.serve({
+      port: 0,
+      async fetch(req) {
+        requests++
+        if (requests <= failures) {
+          return new Response('unavailable', { status: 500 })
+        }
+        bodies.push(await req.json())
+        return new Response(null, { status: 204 })
+      },
+    })
+    return {
+      url: `http://localhost:${server.port}`,
+      bodies,
+      requests: () => requests,
+      stop: () => server.stop(),
+    }
+  }
+
+  async function createStreamTable(
+    client: DynamoDBClient,
+    StreamViewType: StreamViewType
+  ): Promise<{ tableName: string; streamArn: string }> {
+    const tableName = uniqueTableName('Webhook')
+    const { TableDescription } = await client.send(
+      new CreateTableCommand({
+        TableName: tableName,
+        KeySchema: [{ AttributeName: 'id', KeyType: 'HASH' }],
+        AttributeDefinitions: [{ AttributeName: 'id', AttributeType: 'S' }],
+        BillingMode: 'PAY_PER_REQUEST',
+        StreamSpecification: { StreamEnabled: true, StreamViewType },
+      })
+    )
+    return { tableName, streamArn: TableDescription!.LatestStreamArn! }
+  }
+
+  // Puts, updates and deletes item 'a'
+  async function writeItem(client: DynamoDBClient, tableName: string) {
+    await client.send(
+      new PutItemCommand({
+        TableName: tableName,
+        Item: { id: { S: 'a' }, n: { N: '1' } },
+      })
+    )
+    await client.send(
+      new UpdateItemCommand({
+        TableName: tableName,
+        Key: { id: { S: 'a' } },
+        UpdateExpression: 'SET n = :n',
+        ExpressionAttributeValues: { ':n': { N: '2' } },
+      })
+    )
+    await client.send(
+      new DeleteItemCommand({ TableName: tableName, Key: { id: { S: 'a' } } })
+    )
+  }
+
+  test('posts every record with the images of the view type', async () => {
+    const sink = startSink()
+    const { db, client, cleanup } = await startDynado({
+      streamWebhookUrl: sink.url,
+    })
+    try {
+      const { tableName, streamArn } = await createStreamTable(
+        client,
+        'NEW_AND_OLD_IMAGES'
+      )
+      await writeItem(client, tableName)
+      await db.streamWebhook!.flush()
+
+      const records = sink.bodies.map((body) => {
+        expect(body.Records).toHaveLength(1)
+        return body.Records[0]
+      })
+      expect(records.map((r) => r.eventName)).toEqual([
+        'INSERT',
+        'MODIFY',
+        'REMOVE',
+      ])
+      expect(records.map((r) => r.dynamodb)).toMatchObject([
+        {
+          Keys: { id: { S: 'a' } },
+          NewImage: { id: { S: 'a' }, n: { N: '1' } },
+          StreamViewType: 'NEW_AND_OLD_IMAGES',
+        },
+        {
+          Keys: { id: { S: 'a' } },
+          NewImage: { id: { S: 'a' }, n: { N: '2' } },
+          OldImage: { id: { S: 'a' }, n: { N: '1' } },
+        },
+        {
+          Keys: { id: { S: 'a' } },
+          OldImage: { id: { S: 'a' }, n: { N: '2' } },
+        },
+      ])
+      expect(records[0].dynamodb.OldImage).toBeUndefined()
+      expect(records[2].dynamodb.NewImage).toBeUndefined()
+      for (const record of records) {
+        expect(record.eventSourceARN).toBe(streamArn)
+      }
+      const sequences = records.map((r) => r.dynamodb.SequenceNumber)
+      expect([...sequences].sort()).toEqual(sequences)
+      expect(new Set(sequences).size).toBe(3)
+    } finally {
+      await cleanup()
+      sink.stop()
+    }
+  })
+
+  test('KEYS_ONLY records carry no images', async () => {
+    const sink = startSink()
+    const { db, client, cleanup } = await startDynado({
+      streamWebhookUrl: sink.url,
+    })
+    try {
+      const { tableName } = await createStreamTable(client, 'KEYS_ONLY')
+      await writeItem(client, tableName)
+      await db.streamWebhook!.flush()
+
+      const records = sink.bodies.map((body) => body.Records[0])
+      expect(records.map((r) => r.eventName)).toEqual([
+        'INSERT',
+        'MODIFY',
+        'REMOVE',
+      ])
+      for (const record of records) {
+        expect(record.dynamodb.Keys).toEqual({ id: { S: 'a' } })
+        expect(record.dynamodb.NewImage).toBeUndefined()
+        expect(record.dynamodb.OldImage).toBeUndefined()
+      }
+    } finally {
+      await cleanup()
+      sink.stop()
+    }
+  })
+
+  test('failed deliveries are retried', async () => {
+    const sink = startSink(2)
+    const { db, client, cleanup } = await startDynado({
+      streamWebhookUrl: sink.url,
+    })
+    try {
+      const { tableName } = await createStreamTable(client, 'NEW_IMAGE')
+      await client.send(
+        new PutItemCommand({ TableName: tableName, Item: { id: { S: 'a' } } })
+      )
+      await db.streamWebhook!.flush()
+
+      expect(sink.requests()).toBe(3)
+      expect(sink.bodies).toHaveLength(1)
+      expect(sink.bodies[0].Records[0]).toMatchObject({
+        eventName: 'INSERT',
+        dynamodb: { NewImage: { id: { S: 'a' } } },
+      })
+    } finally {
+      await cleanup()
+      sink.stop()
+    }
+  })
+})
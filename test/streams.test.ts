@@ -0,0 +1,351 @@
+// Tests for DynamoDB Streams
+// Calls the Streams API with raw requests, since the tests only depend on
+// the DynamoDB client
+
+import { test, expect, describe } from 'bun:test'
+import {
+  CreateTableCommand,
+  DeleteItemCommand,
+  DescribeTableCommand,
+  PutItemCommand,
+  TransactWriteItemsCommand,
+  UpdateItemCommand,
+  UpdateTableCommand,
+  type DynamoDBClient,
+  type StreamViewType,
+} from '@aws-sdk/client-dynamodb'
+import type { DB } from '../src/index.ts'
+import { getShardIndex } from '../src/hash-utils.ts'
+import { startDynado, uniqueTableName } from './helpers.ts'
+
+describe('Streams', () => {
+  // Uses a dedicated server; the data plane is exercised over raw requests
+  if (process.env.TEST_DYNAMODB_LOCAL === 'true') {
+    return
+  }
+
+  async function streams(db: DB, operation: string, body: unknown) {
+    const response = await fetch(`http://localhost:${db.server.port}/`, {
+      method: 'POST',
+      headers: {
+        'x-amz-target': `DynamoDBStreams_20120810.${operation}`,
+        'Content-Type': 'application/x-amz-json-1.0',
+      },
+      body: JSON.stringify(body),
+    })
+    return { status: response.status, body: (await response.json()) as any }
+  }
+
+  async function createStreamTable(
+    client: DynamoDBClient,
+    StreamViewType: StreamViewType
+  ): Promise<{ tableName: string; streamArn: string }> {
+    const tableName = uniqueTableName('Stream')
+    const { TableDescription } = await client.send(
+      new CreateTableCommand({
+        TableName: tableName,
+        KeySchema: [{ AttributeName: 'id', KeyType: 'HASH' }],
+        AttributeDefinitions: [{ AttributeName: 'id', AttributeType: 'S' }],
+        BillingMode: 'PAY_PER_REQUEST',
+        StreamSpecification: { StreamEnabled: true, StreamViewType },
+      })
+    )
+    return { tableName, streamArn: TableDescription!.LatestStreamArn! }
+  }
+
+  // The id of the stream's only shard, as DescribeStream reports it
+  async function shardId(db: DB, streamArn: string): Promise<string> {
+    const described = await streams(db, 'DescribeStream', {
+      StreamArn: streamArn,
+    })
+    return described.body.StreamDescription.Shards[0].ShardId
+  }
+
+  // Reads every record from the start of the stream
+  async function readAll(db: DB, streamArn: string) {
+    const iterator = await streams(db, 'GetShardIterator', {
+      StreamArn: streamArn,
+      ShardId: await shardId(db, streamArn),
+      ShardIteratorType: 'TRIM_HORIZON',
+    })
+    const records = await streams(db, 'GetRecords', {
+      ShardIterator: iterator.body.ShardIterator,
+    })
+    return records.body.Records as any[]
+  }
+
+  test('records INSERT, MODIFY, and REMOVE with both images', async () => {
+    const { db, client, cleanup } = await startDynado()
+    try {
+      const { tableName, streamArn } = await createStreamTable(
+        client,
+        'NEW_AND_OLD_IMAGES'
+      )
+      const key = { id: { S: 'a' } }
+      await client.send(
+        new PutItemCommand({
+          TableName: tableName,
+          Item: { ...key, n: { N: '1' } },
+        })
+      )
+      await client.send(
+        new UpdateItemCommand({
+          TableName: tableName,
+          Key: key,
+          UpdateExpression: 'SET n = :n',
+          ExpressionAttributeValues: { ':n': { N: '2' } },
+        })
+      )
+      const deleteItem = new DeleteItemCommand({
+        TableName: tableName,
+        Key: key,
+      })
+      await client.send(deleteItem)
+      // Deleting a missing item changes nothing, so it has no record
+      await client.send(deleteItem)
+
+      const records = await readAll(db, streamArn)
+      expect(records.map((record) => record.eventName)).toEqual([
+        'INSERT',
+        'MODIFY',
+        'REMOVE',
+      ])
+      expect(records.map((record) => record.dynamodb.Keys)).toEqual([
+        key,
+        key,
+        key,
+      ])
+      expect(records[0].dynamodb.OldImage).toBeUndefined()
+      expect(records[0].dynamodb.NewImage).toEqual({ ...key, n: { N: '1' } })
+      expect(records[1].dynamodb.OldImage).toEqual({ ...key, n: { N: '1' } })
+      expect(records[1].dynamodb.NewImage).toEqual({ ...key, n: { N: '2' } })
+      expect(records[2].dynamodb.OldImage).toEqual({ ...key, n: { N: '2' } })
+      expect(records[2].dynamodb.NewImage).toBeUndefined()
+
+      const sequenceNumbers = records.map(
+        (record) => record.dynamodb.SequenceNumber
+      )
+      expect([...sequenceNumbers].sort()).toEqual(sequenceNumbers)
+    } finally {
+      await cleanup()
+    }
+  })
+
+  test('KEYS_ONLY records carry no images', async () => {
+    const { db, client, cleanup } = await startDynado()
+    try {
+      const { tableName, streamArn } = await createStreamTable(
+        client,
+        'KEYS_ONLY'
+      )
+      await client.send(
+        new PutItemCommand({
+          TableName: tableName,
+          Item: { id: { S: 'a' }, n: { N: '1' } },
+        })
+      )
+
+      const [record] = await readAll(db, streamArn)
+      expect(record.dynamodb.Keys).toEqual({ id: { S: 'a' } })
+      expect(record.dynamodb.NewImage).toBeUndefined()
+      expect(record.dynamodb.StreamViewType).toBe('KEYS_ONLY')
+    } finally {
+      await cleanup()
+    }
+  })
+
+  test('a transaction records each item it writes', async () => {
+    const { db, client, cleanup } = await startDynado()
+    try {
+      const { tableName, streamArn } = await createStreamTable(
+        client,
+        'NEW_IMAGE'
+      )
+      await client.send(
+        new TransactWriteItemsCommand({
+          TransactItems: ['a', 'b', 'c', 'd'].map((id) => ({
+            Put: { TableName: tableName, Item: { id: { S: id } } },
+          })),
+        })
+      )
+
+      const records = await readAll(db, streamArn)
+      expect(
+        records.map((record) => record.dynamodb.NewImage.id.S).sort()
+      ).toEqual(['a', 'b', 'c', 'd'])
+      expect(records.every((record) => record.eventName === 'INSERT')).toBe(
+        true
+      )
+    } finally {
+      await cleanup()
+    }
+  })
+
+  test('sequence numbers increase across storage shards', async () => {
+    const { db, client, cleanup } = await startDynado({ shardCount: 4 })
+    try {
+      const { tableName, streamArn } = await createStreamTable(
+        client,
+        'KEYS_ONLY'
+      )
+      // One key on each storage shard
+      const ids: string[] = []
+      const shards = new Set<number>()
+      for (let i = 0; shards.size < db.shardCount; i++) {
+        const id = `item-${i}`
+        const { partitionKeyValue } = db.metadataStore.extractKeyValues(
+          tableName,
+          { id: { S: id } }
+        )
+        const shard = getShardIndex(partitionKeyValue, db.shardCount)
+        if (shards.has(shard)) continue
+        shards.add(shard)
+        ids.push(id)
+      }
+
+      for (const id of ids) {
+        await client.send(
+          new PutItemCommand({ TableName: tableName, Item: { id: { S: id } } })
+        )
+      }
+      // A transaction commits shard by shard, yet its records stay in order
+      await client.send(
+        new TransactWriteItemsCommand({
+          TransactItems: ids.map((id) => ({
+            Update: {
+              TableName: tableName,
+              Key: { id: { S: id } },
+              UpdateExpression: 'SET n = :n',
+              ExpressionAttributeValues: { ':n': { N: '1' } },
+            },
+          })),
+        })
+      )
+
+      const records = await readAll(db, streamArn)
+      expect(records).toHaveLength(ids.length * 2)
+      // Compared as numbers, not as the strings the API returns
+      const sequenceNumbers = records.map((record) =>
+        BigInt(record.dynamodb.SequenceNumber)
+      )
+      for (let i = 1; i < sequenceNumbers.length; i++) {
+        expect(sequenceNumbers[i]! > sequenceNumbers[i - 1]!).toBe(true)
+      }
+    } finally {
+      await cleanup()
+    }
+  })
+
+  test('GetRecords pages with Limit and resumes after a sequence number', async () => {
+    const { db, client, cleanup } = await startDynado()
+    try {
+      const { tableName, streamArn } = await createStreamTable(
+        client,
+        'KEYS_ONLY'
+      )
+      for (const id of ['a', 'b', 'c']) {
+        await client.send(
+          new PutItemCommand({ TableName: tableName, Item: { id: { S: id } } })
+        )
+      }
+
+      const ShardId = await shardId(db, streamArn)
+      const iterator = await streams(db, 'GetShardIterator', {
+        StreamArn: streamArn,
+        ShardId,
+        ShardIteratorType: 'TRIM_HORIZON',
+      })
+      const first = await streams(db, 'GetRecords', {
+        ShardIterator: iterator.body.ShardIterator,
+        Limit: 2,
+      })
+      expect(first.body.Records).toHaveLength(2)
+      const second = await streams(db, 'GetRecords', {
+        ShardIterator: first.body.NextShardIterator,
+      })
+      expect(
+        second.body.Records.map((r: any) => r.dynamodb.Keys.id.S)
+      ).toEqual(['c'])
+
+      const after = await streams(db, 'GetShardIterator', {
+        StreamArn: streamArn,
+        ShardId,
+        ShardIteratorType: 'AFTER_SEQUENCE_NUMBER',
+        SequenceNumber: first.body.Records[0].dynamodb.SequenceNumber,
+      })
+      const resumed = await streams(db, 'GetRecords', {
+        ShardIterator: after.body.ShardIterator,
+      })
+      expect(
+        resumed.body.Records.map((r: any) => r.dynamodb.Keys.id.S)
+      ).toEqual(['b', 'c'])
+
+      const invalid = await streams(db, 'GetRecords', {
+        ShardIterator: 'not-an-iterator',
+      })
+      expect(invalid.body.__type).toBe('ValidationException')
+    } finally {
+      await cleanup()
+    }
+  })
+
+  test('disabling a stream closes its shard', async () => {
+    const { db, client, cleanup } = await startDynado()
+    try {
+      const { tableName, streamArn } = await createStreamTable(
+        client,
+        'KEYS_ONLY'
+      )
+      await client.send(
+        new PutItemCommand({ TableName: tableName, Item: { id: { S: 'a' } } })
+      )
+      await client.send(
+        new UpdateTableCommand({
+          TableName: tableName,
+          StreamSpecification: { StreamEnabled: false },
+        })
+      )
+      // Writes after the stream is disabled are not recorded
+      await client.send(
+        new PutItemCommand({ TableName: tableName, Item: { id: { S: 'b' } } })
+      )
+
+      const table = await client.send(
+        new DescribeTableCommand({ TableName: tableName })
+      )
+      expect(table.Table?.StreamSpecification).toBeUndefined()
+      expect(table.Table?.LatestStreamArn).toBe(streamArn)
+
+      const described = await streams(db, 'DescribeStream', {
+        StreamArn: streamArn,
+      })
+      const description = described.body.StreamDescription
+      expect(description.StreamStatus).toBe('DISABLED')
+      expect(description.Shards[0].SequenceNumberRange).toHaveProperty(
+        'EndingSequenceNumber'
+      )
+
+      const iterator = await streams(db, 'GetShardIterator', {
+        StreamArn: streamArn,
+        ShardId: description.Shards[0].ShardId,
+        ShardIteratorType: 'TRIM_HORIZON',
+      })
+      const records = await streams(db, 'GetRecords', {
+        ShardIterator: iterator.body.ShardIterator,
+      })
+      expect(records.body.Records).toHaveLength(1)
+      expect(records.body.NextShardIterator).toBeUndefined()
+
+      const listed = await streams(db, 'ListStreams', { TableName: tableName })
+      expect(listed.body.Streams).toEqual([
+        {
+          StreamArn: streamArn,
+          TableName: tableName,
+          StreamLabel: description.StreamLabel,
+        },
+      ])
+    } finally {
+      await cleanup()
+    }
+  })
+})
@@ -0,0 +1,399 @@
+// Tests for table lifecycle operations
+// Uses HTTP API via AWS SDK
+
+import { test, expect, beforeAll, afterEach, describe } from 'bun:test'
+import {
+  DynamoDBClient,
+  CreateTableCommand,
+  DeleteTableCommand,
+  DescribeTableCommand,
+  ListTablesCommand,
+  ListTagsOfResourceCommand,
+  PutItemCommand,
+  GetItemCommand,
+  ScanCommand,
+  TagResourceCommand,
+  UntagResourceCommand,
+} from '@aws-sdk/client-dynamodb'
+import * as fs from 'fs/promises'
+import * as os from 'os'
+import * as path from 'path'
+import {
+  getGlobalTestDB,
+  cleanupTables,
+  createTable,
+  startDynado,
+  uniqueTableName,
+  trackTable,
+} from './helpers.ts'
+
+describe('Table lifecycle', () => {
+  let client: DynamoDBClient
+  const createdTables: string[] = []
+
+  beforeAll(async () => {
+    const testDB = await getGlobalTestDB()
+    client = testDB.client
+  })
+
+  afterEach(async () => {
+    await cleanupTables(client, createdTables)
+  })
+
+  test('creating an existing table fails with ResourceInUseException', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('Lifecycle'))
+    const input = {
+      TableName: tableName,
+      KeySchema: [{ AttributeName: 'id', KeyType: 'HASH' as const }],
+      AttributeDefinitions: [
+        { AttributeName: 'id', AttributeType: 'S' as const },
+      ],
+      BillingMode: 'PAY_PER_REQUEST' as const,
+    }
+    await client.send(new CreateTableCommand(input))
+
+    await expect(
+      client.send(new CreateTableCommand(input))
+    ).rejects.toHaveProperty('name', 'ResourceInUseException')
+  })
+
+  test('deleting a missing table fails with ResourceNotFoundException', async () => {
+    await expect(
+      client.send(
+        new DeleteTableCommand({ TableName: uniqueTableName('Missing') })
+      )
+    ).rejects.toHaveProperty('name', 'ResourceNotFoundException')
+  })
+
+  test('concurrent create/delete of the same name stays coherent', async () => {
+    // DynamoDB Local creates/deletes tables asynchronously
+    if (process.env.TEST_DYNAMODB_LOCAL === 'true') {
+      return
+    }
+
+    const tableName = trackTable(createdTables, uniqueTableName('Race'))
+    const expectedErrors = [
+      'ResourceInUseException',
+      'ResourceNotFoundException',
+    ]
+
+    const worker = async () => {
+      for (let i = 0; i < 20; i++) {
+        try {
+          if (Math.random() < 0.5) {
+            await client.send(
+              new CreateTableCommand({
+                TableName: tableName,
+                KeySchema: [{ AttributeName: 'id', KeyType: 'HASH' }],
+                AttributeDefinitions: [
+                  { AttributeName: 'id', AttributeType: 'S' },
+                ],
+                BillingMode: 'PAY_PER_REQUEST',
+              })
+            )
+          } else {
+            await client.send(new DeleteTableCommand({ TableName: tableName }))
+          }
+        } catch (error: any) {
+          expect(expectedErrors).toContain(error.name)
+        }
+      }
+    }
+
+    await Promise.all(Array.from({ length: 8 }, () => worker()))
+
+    const listResponse = await client.send(new ListTablesCommand({}))
+    const listed = listResponse.TableNames!.includes(tableName)
+
+    let described = true
+    try {
+      await client.send(new DescribeTableCommand({ TableName: tableName }))
+    } catch (error: any) {
+      expect(error.name).toBe('ResourceNotFoundException')
+      described = false
+    }
+    expect(described).toBe(listed)
+
+    if (described) {
+      // A surviving table must be fully usable and start out empty
+      const scan = await client.send(
+        new ScanCommand({ TableName: tableName, ConsistentRead: true })
+      )
+      expect(scan.Count).toBe(0)
+      await client.send(
+        new PutItemCommand({
+          TableName: tableName,
+          Item: { id: { S: 'after-race' } },
+        })
+      )
+      const response = await client.send(
+        new GetItemCommand({
+          TableName: tableName,
+          Key: { id: { S: 'after-race' } },
+        })
+      )
+      expect(response.Item).toEqual({ id: { S: 'after-race' } })
+    }
+  })
+
+  test('SSESpecification is echoed as SSEDescription', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('Encrypted'))
+    await client.send(
+      new CreateTableCommand({
+        TableName: tableName,
+        KeySchema: [{ AttributeName: 'id', KeyType: 'HASH' }],
+        AttributeDefinitions: [{ AttributeName: 'id', AttributeType: 'S' }],
+        BillingMode: 'PAY_PER_REQUEST',
+        SSESpecification: {
+          Enabled: true,
+          SSEType: 'KMS',
+          KMSMasterKeyId: 'my-table-key',
+        },
+      })
+    )
+
+    const response = await client.send(
+      new DescribeTableCommand({ TableName: tableName })
+    )
+    const sse = response.Table!.SSEDescription!
+    expect(sse.Status).toBe('ENABLED')
+    expect(sse.SSEType).toBe('KMS')
+    expect(sse.KMSMasterKeyArn).toEndWith('my-table-key')
+  })
+
+  test('tables without SSE enabled have no SSEDescription', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('Plain'))
+    await client.send(
+      new CreateTableCommand({
+        TableName: tableName,
+        KeySchema: [{ AttributeName: 'id', KeyType: 'HASH' }],
+        AttributeDefinitions: [{ AttributeName: 'id', AttributeType: 'S' }],
+        BillingMode: 'PAY_PER_REQUEST',
+        SSESpecification: { Enabled: false },
+      })
+    )
+
+    const response = await client.send(
+      new DescribeTableCommand({ TableName: tableName })
+    )
+    expect(response.Table!.SSEDescription).toBeUndefined()
+  })
+})
+
+describe('Table limits', () => {
+  // DynamoDB Local's table quota cannot be lowered to MAX_TABLES
+  if (process.env.TEST_DYNAMODB_LOCAL === 'true') {
+    return
+  }
+
+  test('CreateTable fails with LimitExceededException past MAX_TABLES', async () => {
+    const { client, cleanup } = await startDynado({ maxTables: 2 })
+    try {
+      await createTable(client, uniqueTableName('Limit'))
+      await createTable(client, uniqueTableName('Limit'))
+
+      await expect(
+        createTable(client, uniqueTableName('Limit'))
+      ).rejects.toHaveProperty('name', 'LimitExceededException')
+    } finally {
+      await cleanup()
+    }
+  })
+})
+
+describe('ListTables ordering', () => {
+  // Restarts a dedicated server on the same data directory
+  if (process.env.TEST_DYNAMODB_LOCAL === 'true') {
+    return
+  }
+
+  test('tables list sorted and paginate the same after a restart', async () => {
+    const dataDir = await fs.mkdtemp(path.join(os.tmpdir(), 'dynado-list-'))
+    try {
+      const first = await startDynado({ dataDir })
+      try {
+        for (const name of ['Charlie', 'Alpha', 'Echo', 'Bravo', 'Delta']) {
+          await createTable(first.client, name)
+        }
+      } finally {
+        await first.cleanup()
+      }
+
+      const second = await startDynado({ dataDir })
+      try {
+        const all = await second.client.send(new ListTablesCommand({}))
+        expect(all.TableNames).toEqual([
+          'Alpha',
+          'Bravo',
+          'Charlie',
+          'Delta',
+          'Echo',
+        ])
+        expect(all.LastEvaluatedTableName).toBeUndefined()
+
+        const pages: string[][] = []
+        let start: string | undefined
+        do {
+          const page = await second.client.send(
+            new ListTablesCommand({ Limit: 2, ExclusiveStartTableName: start })
+          )
+          pages.push(page.TableNames!)
+          start = page.LastEvaluatedTableName
+        } while (start)
+        expect(pages).toEqual([
+          ['Alpha', 'Bravo'],
+          ['Charlie', 'Delta'],
+          ['Echo'],
+        ])
+      } finally {
+        await second.cleanup()
+      }
+    } finally {
+      await fs.rm(dataDir, { recursive: true, force: true })
+    }
+  })
+})
+
+describe('CreateTable dry run', () => {
+  // The dry-run header is dynado-specific
+  if (process.env.TEST_DYNAMODB_LOCAL === 'true') {
+    return
+  }
+
+  async function dryRunCreateTable(port: number, body: unknown) {
+    const response = await fetch(`http://localhost:${port}/`, {
+      method: 'POST',
+      headers: {
+        'x-amz-target': 'DynamoDB_20120810.CreateTable',
+        'Content-Type': 'application/x-amz-json-1.0',
+        'x-dynado-dry-run': 'true',
+      },
+      body: JSON.stringify(body),
+    })
+    return {
+      status: response.status,
+      body: (await response.json()) as {
+        __type?: string
+        message?: string
+        TableDescription?: { TableName?: string }
+      },
+    }
+  }
+
+  test('validates CreateTable without creating the table', async () => {
+    const { db, client, cleanup } = await startDynado()
+    try {
+      const tableName = uniqueTableName('DryRun')
+      const valid = {
+        TableName: tableName,
+        KeySchema: [{ AttributeName: 'id', KeyType: 'HASH' }],
+        AttributeDefinitions: [{ AttributeName: 'id', AttributeType: 'S' }],
+        BillingMode: 'PAY_PER_REQUEST',
+      }
+
+      const malformed = await dryRunCreateTable(db.server.port, {
+        ...valid,
+        KeySchema: [
+          { AttributeName: 'id', KeyType: 'HASH' },
+          { AttributeName: 'sk', KeyType: 'RANGE' },
+        ],
+      })
+      expect(malformed.status).toBe(400)
+      expect(malformed.body.__type).toContain('ValidationException')
+      expect(malformed.body.message).toContain('Keys: [sk]')
+
+      const ok = await dryRunCreateTable(db.server.port, valid)
+      expect(ok.status).toBe(200)
+      expect(ok.body.TableDescription?.TableName).toBe(tableName)
+
+      const tables = await client.send(new ListTablesCommand({}))
+      expect(tables.TableNames).toEqual([])
+      await expect(
+        client.send(new DescribeTableCommand({ TableName: tableName }))
+      ).rejects.toHaveProperty('name', 'ResourceNotFoundException')
+    } finally {
+      await cleanup()
+    }
+  })
+})
+
+describe('Tags', () => {
+  // DynamoDB Local does not keep tags
+  if (process.env.TEST_DYNAMODB_LOCAL === 'true') {
+    return
+  }
+
+  let client: DynamoDBClient
+  const createdTables: string[] = []
+
+  beforeAll(async () => {
+    const testDB = await getGlobalTestDB()
+    client = testDB.client
+  })
+
+  afterEach(async () => {
+    await cleanupTables(client, createdTables)
+  })
+
+  async function listTags(ResourceArn: string) {
+    const { Tags } = await client.send(
+      new ListTagsOfResourceCommand({ ResourceArn })
+    )
+    return Tags
+  }
+
+  test('tags set at creation can be changed and removed', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('Tagged'))
+    const { TableDescription } = await client.send(
+      new CreateTableCommand({
+        TableName: tableName,
+        KeySchema: [{ AttributeName: 'id', KeyType: 'HASH' }],
+        AttributeDefinitions: [{ AttributeName: 'id', AttributeType: 'S' }],
+        BillingMode: 'PAY_PER_REQUEST',
+        Tags: [{ Key: 'team', Value: 'storage' }],
+      })
+    )
+    const arn = TableDescription!.TableArn!
+    expect(await listTags(arn)).toEqual([{ Key: 'team', Value: 'storage' }])
+
+    await client.send(
+      new TagResourceCommand({
+        ResourceArn: arn,
+        Tags: [
+          { Key: 'team', Value: 'platform' },
+          { Key: 'env', Value: 'test' },
+        ],
+      })
+    )
+    expect(await listTags(arn)).toEqual([
+      { Key: 'team', Value: 'platform' },
+      { Key: 'env', Value: 'test' },
+    ])
+
+    await client.send(
+      new UntagResourceCommand({ ResourceArn: arn, TagKeys: ['team'] })
+    )
+    // ARNs built for another region name the same table
+    expect(
+      await listTags(arn.replace(':local:', ':us-east-1:'))
+    ).toEqual([{ Key: 'env', Value: 'test' }])
+  })
+
+  test('tagging rejects reserved keys and missing tables', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('Tagged'))
+    await createTable(client, tableName)
+    const arn = `arn:aws:dynamodb:local:000000000000:table/${tableName}`
+
+    await expect(
+      client.send(
+        new TagResourceCommand({
+          ResourceArn: arn,
+          Tags: [{ Key: 'aws:owner', Value: 'me' }],
+        })
+      )
+    ).rejects.toHaveProperty('name', 'ValidationException')
+    await expect(
+      listTags(`arn:aws:dynamodb:local:000000000000:table/${tableName}-gone`)
+    ).rejects.toHaveProperty('name', 'ResourceNotFoundException')
+  })
+})
@@ -0,0 +1,126 @@
+// Tests for the server-side request timeout
+// Uses a dedicated dynado instance so the timeout can be configured
+
+import { test, expect, beforeAll, afterAll, describe } from 'bun:test'
+import {
+  CreateTableCommand,
+  DescribeTableCommand,
+  ScanCommand,
+  GetItemCommand,
+  UpdateItemCommand,
+} from '@aws-sdk/client-dynamodb'
+import type { DB } from '../src/index.ts'
+import { createTable, startDynado, uniqueTableName } from './helpers.ts'
+
+describe('Request timeout', () => {
+  // Slows requests down by stubbing the server's internals
+  if (process.env.TEST_DYNAMODB_LOCAL === 'true') {
+    return
+  }
+
+  let instance: Awaited<ReturnType<typeof startDynado>>
+  let db: DB
+  const tableName = uniqueTableName('Timeout')
+
+  beforeAll(async () => {
+    instance = await startDynado({ requestTimeoutMs: 50 })
+    db = instance.db
+    await createTable(instance.client, tableName)
+  })
+
+  afterAll(async () => {
+    await instance.cleanup()
+  })
+
+  test('slow requests fail with RequestLimitExceeded', async () => {
+    const originalScan = db.router.scan.bind(db.router)
+    db.router.scan = async (...args) => {
+      await new Promise((resolve) => setTimeout(resolve, 200))
+      return originalScan(...args)
+    }
+
+    try {
+      const error = await instance.client
+        .send(new ScanCommand({ TableName: tableName }))
+        .catch((e) => e)
+      expect(error.name).toBe('RequestLimitExceeded')
+      expect(error.$metadata.httpStatusCode).toBe(400)
+    } finally {
+      db.router.scan = originalScan
+    }
+  })
+
+  test('a timed out write is not applied by its retry and itself', async () => {
+    const Key = { id: { S: 'counter' } }
+    const increment = () =>
+      instance.client.send(
+        new UpdateItemCommand({
+          TableName: tableName,
+          Key,
+          UpdateExpression: 'ADD n :one',
+          ExpressionAttributeValues: { ':one': { N: '1' } },
+        })
+      )
+
+    // Stall the read the update makes before it writes
+    const originalGetItem = db.router.getItem.bind(db.router)
+    db.router.getItem = async (...args) => {
+      await new Promise((resolve) => setTimeout(resolve, 200))
+      return originalGetItem(...args)
+    }
+    try {
+      const error = await increment().catch((e) => e)
+      expect(error.name).toBe('RequestLimitExceeded')
+    } finally {
+      db.router.getItem = originalGetItem
+    }
+
+    // The retry a client makes, then time for the abandoned update to finish
+    await increment()
+    await new Promise((resolve) => setTimeout(resolve, 300))
+
+    const { Item } = await instance.client.send(
+      new GetItemCommand({ TableName: tableName, Key, ConsistentRead: true })
+    )
+    expect(Item?.n?.N).toBe('1')
+  })
+
+  test('a timed out CreateTable does not create the table', async () => {
+    const TableName = uniqueTableName('TimeoutCreate')
+    const originalLock = db.metadataStore.withTableLock.bind(db.metadataStore)
+    db.metadataStore.withTableLock = async (tableName, fn) => {
+      await new Promise((resolve) => setTimeout(resolve, 200))
+      return originalLock(tableName, fn)
+    }
+    try {
+      const error = await instance.client
+        .send(
+          new CreateTableCommand({
+            TableName,
+            KeySchema: [{ AttributeName: 'id', KeyType: 'HASH' }],
+            AttributeDefinitions: [{ AttributeName: 'id', AttributeType: 'S' }],
+            BillingMode: 'PAY_PER_REQUEST',
+          })
+        )
+        .catch((e) => e)
+      expect(error.name).toBe('RequestLimitExceeded')
+    } finally {
+      db.metadataStore.withTableLock = originalLock
+    }
+
+    // Time for the abandoned CreateTable to reach its commit
+    await new Promise((resolve) => setTimeout(resolve, 300))
+
+    const error = await instance.client
+      .send(new DescribeTableCommand({ TableName }))
+      .catch((e) => e)
+    expect(error.name).toBe('ResourceNotFoundException')
+  })
+
+  test('fast requests are unaffected', async () => {
+    const response = await instance.client.send(
+      new GetItemCommand({ TableName: tableName, Key: { id: { S: 'none' } } })
+    )
+    expect(response.Item).toBeUndefined()
+  })
+})
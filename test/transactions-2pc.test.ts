@@ -353,10 +353,6 @@ describe('Two-Phase Commit Protocol', () => {
 
   describe('ReturnValuesOnConditionCheckFailure', () => {
     test('should return old values on condition failure when requested', async () => {
-      // Skip this test when not using DynamoDB Local (feature not yet implemented in dynado)
-      if (process.env.TEST_DYNAMODB_LOCAL !== 'true') {
-        return
-      }
       const tableName = getTableName()
       await createTable(client, tableName)
 
@@ -401,10 +397,6 @@ describe('Two-Phase Commit Protocol', () => {
     })
 
     test('should not return values when returnValuesOnConditionCheckFailure is NONE', async () => {
-      // Skip this test when not using DynamoDB Local (feature not yet implemented in dynado)
-      if (process.env.TEST_DYNAMODB_LOCAL !== 'true') {
-        return
-      }
       const tableName = getTableName()
       await createTable(client, tableName)
 
@@ -442,10 +434,6 @@ describe('Two-Phase Commit Protocol', () => {
     })
 
     test('should return values on ConditionCheck failure', async () => {
-      // Skip this test when not using DynamoDB Local (feature not yet implemented in dynado)
-      if (process.env.TEST_DYNAMODB_LOCAL !== 'true') {
-        return
-      }
       const tableName = getTableName()
       await createTable(client, tableName)
 
@@ -487,6 +475,79 @@ describe('Two-Phase Commit Protocol', () => {
         expect(txError.CancellationReasons?.[0]?.Item?.data!.S).toBe('secret')
       }
     })
+
+    test('should return the blocking item in the failing slot only', async () => {
+      const tableName = getTableName()
+      await createTable(client, tableName)
+
+      await client.send(
+        new PutItemCommand({
+          TableName: tableName,
+          Item: { id: { S: 'item1' }, version: { N: '1' } },
+        })
+      )
+      await client.send(
+        new PutItemCommand({
+          TableName: tableName,
+          Item: { id: { S: 'item2' }, version: { N: '7' } },
+        })
+      )
+
+      const error = await client
+        .send(
+          new TransactWriteItemsCommand({
+            TransactItems: [
+              {
+                Update: {
+                  TableName: tableName,
+                  Key: { id: { S: 'item1' } },
+                  UpdateExpression: 'SET version = :next',
+                  ConditionExpression: 'version = :expected',
+                  ExpressionAttributeValues: {
+                    ':expected': { N: '1' },
+                    ':next': { N: '2' },
+                  },
+                  ReturnValuesOnConditionCheckFailure: 'ALL_OLD',
+                },
+              },
+              {
+                Update: {
+                  TableName: tableName,
+                  Key: { id: { S: 'item2' } },
+                  UpdateExpression: 'SET version = :next',
+                  ConditionExpression: 'version = :expected',
+                  ExpressionAttributeValues: {
+                    ':expected': { N: '1' },
+                    ':next': { N: '2' },
+                  },
+                  ReturnValuesOnConditionCheckFailure: 'ALL_OLD',
+                },
+              },
+            ],
+          })
+        )
+        .catch((e) => e)
+
+      expect(error).toBeInstanceOf(TransactionCanceledException)
+      const reasons = (error as TransactionCanceledException)
+        .CancellationReasons
+      expect(reasons?.[0]?.Code).toBe('None')
+      expect(reasons?.[0]?.Item).toBeUndefined()
+      expect(reasons?.[1]?.Code).toBe('ConditionalCheckFailed')
+      expect(reasons?.[1]?.Item).toEqual({
+        id: { S: 'item2' },
+        version: { N: '7' },
+      })
+
+      // Neither update was applied
+      const first = await client.send(
+        new GetItemCommand({
+          TableName: tableName,
+          Key: { id: { S: 'item1' } },
+        })
+      )
+      expect(first.Item?.version!.N).toBe('1')
+    })
   })
 
   describe('Update Expression Variants', () => {
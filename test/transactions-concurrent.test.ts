@@ -798,4 +798,113 @@ describe('Concurrent Transaction Tests', () => {
       }
     }
   }, 30000)
+
+  test('condition check vs concurrent write - no torn reads', async () => {
+    const tableName = getTableName()
+    const NUM_WORKERS = 20
+    const OPS_PER_WORKER = 15
+
+    await createTable(client, tableName)
+
+    // Writers keep x.a, x.b and y.a equal; x and y usually land on
+    // different shards
+    for (const id of ['x', 'y']) {
+      await client.send(
+        new PutItemCommand({
+          TableName: tableName,
+          Item: { id: { S: id }, a: { N: '0' }, b: { N: '0' } },
+        })
+      )
+    }
+
+    let successfulWrites = 0
+    let successfulChecks = 0
+    const checkFailureCodes: string[] = []
+
+    async function writer() {
+      const increment = (id: string) => ({
+        Update: {
+          TableName: tableName,
+          Key: { id: { S: id } },
+          UpdateExpression: 'SET a = a + :one, b = b + :one',
+          ExpressionAttributeValues: { ':one': { N: '1' } },
+        },
+      })
+      try {
+        await client.send(
+          new TransactWriteItemsCommand({
+            TransactItems: [increment('x'), increment('y')],
+          })
+        )
+        successfulWrites++
+      } catch (error) {
+        if (!(error instanceof TransactionCanceledException)) throw error
+      }
+    }
+
+    async function checker(workerId: number, op: number) {
+      try {
+        await client.send(
+          new TransactWriteItemsCommand({
+            TransactItems: [
+              {
+                ConditionCheck: {
+                  TableName: tableName,
+                  Key: { id: { S: 'x' } },
+                  ConditionExpression: 'a = b',
+                },
+              },
+              {
+                Put: {
+                  TableName: tableName,
+                  Item: { id: { S: `audit-${workerId}-${op}` } },
+                },
+              },
+            ],
+          })
+        )
+        successfulChecks++
+      } catch (error) {
+        if (!(error instanceof TransactionCanceledException)) throw error
+        for (const reason of error.CancellationReasons ?? []) {
+          if (reason.Code && reason.Code !== 'None') {
+            checkFailureCodes.push(reason.Code)
+          }
+        }
+      }
+    }
+
+    await Promise.all(
+      Array.from({ length: NUM_WORKERS }, async (_, workerId) => {
+        for (let op = 0; op < OPS_PER_WORKER; op++) {
+          if (workerId % 2 === 0) {
+            await writer()
+          } else {
+            await checker(workerId, op)
+          }
+        }
+      })
+    )
+
+    if (VERBOSE) {
+      console.log(`Successful writes: ${successfulWrites}`)
+      console.log(`Successful checks: ${successfulChecks}`)
+      console.log(`Check cancellations: ${checkFailureCodes.length}`)
+    }
+
+    // A check may lose a race, but never observes a half-applied update
+    expect(checkFailureCodes).not.toContain('ConditionalCheckFailed')
+    expect(successfulChecks).toBeGreaterThan(0)
+
+    const [x, y] = await Promise.all(
+      ['x', 'y'].map((id) =>
+        client.send(
+          new GetItemCommand({ TableName: tableName, Key: { id: { S: id } } })
+        )
+      )
+    )
+    expect(x!.Item!.a!.N).toBe(String(successfulWrites))
+    expect(x!.Item!.b!.N).toBe(String(successfulWrites))
+    expect(y!.Item!.a!.N).toBe(String(successfulWrites))
+  }, 30000)
 })
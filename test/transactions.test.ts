@@ -471,6 +471,50 @@ describe('Transaction Operations', () => {
     expect(item3.Item).toBeUndefined()
   })
 
+  test('ConditionCheck on a missing item leaves no trace', async () => {
+    const tableName = getTableName()
+
+    await client.send(
+      new TransactWriteItemsCommand({
+        TransactItems: [
+          {
+            ConditionCheck: {
+              TableName: tableName,
+              Key: { id: { S: 'ghost' } },
+              ConditionExpression: 'attribute_not_exists(id)',
+            },
+          },
+          {
+            Put: {
+              TableName: tableName,
+              Item: { id: { S: 'other' } },
+            },
+          },
+        ],
+      })
+    )
+
+    // The item is still absent as far as later conditions are concerned
+    await client.send(
+      new TransactWriteItemsCommand({
+        TransactItems: [
+          {
+            Put: {
+              TableName: tableName,
+              Item: { id: { S: 'ghost' }, value: { S: 'created' } },
+              ConditionExpression: 'attribute_not_exists(id)',
+            },
+          },
+        ],
+      })
+    )
+
+    const ghost = await client.send(
+      new GetItemCommand({ TableName: tableName, Key: { id: { S: 'ghost' } } })
+    )
+    expect(ghost.Item?.value!.S).toBe('created')
+  })
+
   test('should get multiple items atomically', async () => {
     const tableName = getTableName()
 
@@ -0,0 +1,170 @@
+// Tests for Time to Live
+// Starts dedicated servers and runs the sweeper directly
+
+import { test, expect, describe } from 'bun:test'
+import {
+  DescribeTimeToLiveCommand,
+  GetItemCommand,
+  PutItemCommand,
+  ScanCommand,
+  UpdateTimeToLiveCommand,
+} from '@aws-sdk/client-dynamodb'
+import { createTable, startDynado, uniqueTableName } from './helpers.ts'
+
+describe('Time to Live', () => {
+  // Sweeps on demand; DynamoDB Local has no equivalent
+  if (process.env.TEST_DYNAMODB_LOCAL === 'true') {
+    return
+  }
+
+  test('UpdateTimeToLive enables and disables TTL', async () => {
+    const { client, cleanup } = await startDynado({ ttlSweepIntervalMs: 0 })
+    try {
+      const tableName = await createTable(client, uniqueTableName('Ttl'))
+      const describeTtl = async () =>
+        (
+          await client.send(
+            new DescribeTimeToLiveCommand({ TableName: tableName })
+          )
+        ).TimeToLiveDescription
+      const update = (Enabled: boolean) =>
+        client.send(
+          new UpdateTimeToLiveCommand({
+            TableName: tableName,
+            TimeToLiveSpecification: { Enabled, AttributeName: 'expiresAt' },
+          })
+        )
+
+      expect(await describeTtl()).toEqual({ TimeToLiveStatus: 'DISABLED' })
+
+      const enabled = await update(true)
+      expect(enabled.TimeToLiveSpecification).toEqual({
+        Enabled: true,
+        AttributeName: 'expiresAt',
+      })
+      expect(await describeTtl()).toEqual({
+        TimeToLiveStatus: 'ENABLED',
+        AttributeName: 'expiresAt',
+      })
+      await expect(update(true)).rejects.toHaveProperty(
+        'name',
+        'ValidationException'
+      )
+
+      await update(false)
+      expect(await describeTtl()).toEqual({ TimeToLiveStatus: 'DISABLED' })
+    } finally {
+      await cleanup()
+    }
+  })
+
+  test('the sweeper deletes only items whose TTL has passed', async () => {
+    const { db, client, cleanup } = await startDynado({
+      ttlSweepIntervalMs: 0,
+    })
+    try {
+      const tableName = await createTable(client, uniqueTableName('Sweep'))
+      await client.send(
+        new UpdateTimeToLiveCommand({
+          TableName: tableName,
+          TimeToLiveSpecification: { Enabled: true, AttributeName: 'ttl' },
+        })
+      )
+      const now = Math.floor(Date.now() / 1000)
+      const items = {
+        expired: { N: String(now - 60) },
+        future: { N: String(now + 3600) },
+        // Only numbers count as an expiry time
+        string: { S: String(now - 60) },
+      }
+      for (const [id, ttl] of Object.entries(items)) {
+        await client.send(
+          new PutItemCommand({
+            TableName: tableName,
+            Item: { id: { S: id }, ttl },
+          })
+        )
+      }
+      await client.send(
+        new PutItemCommand({
+          TableName: tableName,
+          Item: { id: { S: 'none' } },
+        })
+      )
+
+      expect(await db.sweepExpiredItems()).toBe(1)
+
+      const expired = await client.send(
+        new GetItemCommand({
+          TableName: tableName,
+          Key: { id: { S: 'expired' } },
+        })
+      )
+      expect(expired.Item).toBeUndefined()
+      const { Items } = await client.send(
+        new ScanCommand({ TableName: tableName })
+      )
+      expect(Items!.map((item) => item.id!.S).sort()).toEqual([
+        'future',
+        'none',
+        'string',
+      ])
+    } finally {
+      await cleanup()
+    }
+  })
+
+  test('a sweep interval deletes expired items in the background', async () => {
+    const { client, cleanup } = await startDynado({ ttlSweepIntervalMs: 20 })
+    try {
+      const tableName = await createTable(client, uniqueTableName('Interval'))
+      await client.send(
+        new UpdateTimeToLiveCommand({
+          TableName: tableName,
+          TimeToLiveSpecification: { Enabled: true, AttributeName: 'ttl' },
+        })
+      )
+      await client.send(
+        new PutItemCommand({
+          TableName: tableName,
+          Item: { id: { S: 'item-1' }, ttl: { N: '1' } },
+        })
+      )
+
+      const getItem = async () =>
+        (
+          await client.send(
+            new GetItemCommand({
+              TableName: tableName,
+              Key: { id: { S: 'item-1' } },
+            })
+          )
+        ).Item
+      let item = await getItem()
+      for (let attempt = 0; item && attempt < 50; attempt++) {
+        await Bun.sleep(20)
+        item = await getItem()
+      }
+      expect(item).toBeUndefined()
+    } finally {
+      await cleanup()
+    }
+  })
+
+  test('stopping the server stops the sweeps', async () => {
+    const { db, cleanup } = await startDynado({ ttlSweepIntervalMs: 20 })
+    let sweeps = 0
+    const sweep = db.sweepExpiredItems.bind(db)
+    db.sweepExpiredItems = (nowMs?: number) => {
+      sweeps++
+      return sweep(nowMs)
+    }
+    await Bun.sleep(100)
+    expect(sweeps).toBeGreaterThan(0)
+
+    await cleanup()
+    const stoppedAt = sweeps
+    await Bun.sleep(100)
+    expect(sweeps).toBe(stoppedAt)
+  })
+})
@@ -0,0 +1,739 @@
+// Tests for UpdateExpression semantics
+// Uses HTTP API via AWS SDK
+
+import { test, expect, beforeAll, afterEach, describe } from 'bun:test'
+import {
+  DeleteItemCommand,
+  DynamoDBClient,
+  PutItemCommand,
+  UpdateItemCommand,
+  GetItemCommand,
+} from '@aws-sdk/client-dynamodb'
+import {
+  getGlobalTestDB,
+  createTable,
+  cleanupTables,
+  uniqueTableName,
+  trackTable,
+} from './helpers.ts'
+
+describe('UpdateExpression', () => {
+  let client: DynamoDBClient
+  const createdTables: string[] = []
+
+  beforeAll(async () => {
+    const testDB = await getGlobalTestDB()
+    client = testDB.client
+  })
+
+  afterEach(async () => {
+    await cleanupTables(client, createdTables)
+  })
+
+  async function createListItem(): Promise<string> {
+    const tableName = trackTable(createdTables, uniqueTableName('Paths'))
+    await createTable(client, tableName)
+    await client.send(
+      new PutItemCommand({
+        TableName: tableName,
+        Item: {
+          id: { S: 'item-1' },
+          tags: { L: [{ S: 'a' }, { S: 'b' }, { S: 'c' }] },
+        },
+      })
+    )
+    return tableName
+  }
+
+  async function getTags(tableName: string) {
+    const response = await client.send(
+      new GetItemCommand({ TableName: tableName, Key: { id: { S: 'item-1' } } })
+    )
+    return response.Item!.tags
+  }
+
+  test('SET at an existing list index replaces the element', async () => {
+    const tableName = await createListItem()
+
+    await client.send(
+      new UpdateItemCommand({
+        TableName: tableName,
+        Key: { id: { S: 'item-1' } },
+        UpdateExpression: 'SET tags[1] = :v',
+        ExpressionAttributeValues: { ':v': { S: 'B' } },
+      })
+    )
+
+    expect(await getTags(tableName)).toEqual({
+      L: [{ S: 'a' }, { S: 'B' }, { S: 'c' }],
+    })
+  })
+
+  test('SET at the list length appends', async () => {
+    const tableName = await createListItem()
+
+    await client.send(
+      new UpdateItemCommand({
+        TableName: tableName,
+        Key: { id: { S: 'item-1' } },
+        UpdateExpression: 'SET tags[3] = :v',
+        ExpressionAttributeValues: { ':v': { S: 'd' } },
+      })
+    )
+
+    expect(await getTags(tableName)).toEqual({
+      L: [{ S: 'a' }, { S: 'b' }, { S: 'c' }, { S: 'd' }],
+    })
+  })
+
+  test('SET past the list length fails with ValidationException', async () => {
+    // DynamoDB appends instead of rejecting gapped indexes
+    if (process.env.TEST_DYNAMODB_LOCAL === 'true') {
+      return
+    }
+
+    const tableName = await createListItem()
+
+    await expect(
+      client.send(
+        new UpdateItemCommand({
+          TableName: tableName,
+          Key: { id: { S: 'item-1' } },
+          UpdateExpression: 'SET tags[5] = :v',
+          ExpressionAttributeValues: { ':v': { S: 'f' } },
+        })
+      )
+    ).rejects.toHaveProperty('name', 'ValidationException')
+
+    expect(await getTags(tableName)).toEqual({
+      L: [{ S: 'a' }, { S: 'b' }, { S: 'c' }],
+    })
+  })
+
+  test('REMOVE of an absent attribute is a no-op', async () => {
+    const tableName = await createListItem()
+
+    const response = await client.send(
+      new UpdateItemCommand({
+        TableName: tableName,
+        Key: { id: { S: 'item-1' } },
+        UpdateExpression: 'SET title = :t REMOVE nonexistent, tags[10]',
+        ExpressionAttributeValues: { ':t': { S: 'Updated' } },
+        ReturnValues: 'ALL_NEW',
+      })
+    )
+
+    expect(response.Attributes).toEqual({
+      id: { S: 'item-1' },
+      tags: { L: [{ S: 'a' }, { S: 'b' }, { S: 'c' }] },
+      title: { S: 'Updated' },
+    })
+  })
+
+  test('REMOVE of every non-key attribute keeps the item', async () => {
+    const tableName = await createListItem()
+
+    await client.send(
+      new UpdateItemCommand({
+        TableName: tableName,
+        Key: { id: { S: 'item-1' } },
+        UpdateExpression: 'REMOVE tags',
+      })
+    )
+
+    const response = await client.send(
+      new GetItemCommand({ TableName: tableName, Key: { id: { S: 'item-1' } } })
+    )
+    expect(response.Item).toEqual({ id: { S: 'item-1' } })
+  })
+
+  test('writing a key attribute fails with ValidationException', async () => {
+    const tableName = await createListItem()
+
+    const error = await client
+      .send(
+        new UpdateItemCommand({
+          TableName: tableName,
+          Key: { id: { S: 'item-1' } },
+          UpdateExpression: 'REMOVE id',
+        })
+      )
+      .catch((e) => e)
+    expect(error.name).toBe('ValidationException')
+    expect(error.message).toContain('part of the key')
+
+    // Setting a key attribute to its current value is rejected too
+    const same = await client
+      .send(
+        new UpdateItemCommand({
+          TableName: tableName,
+          Key: { id: { S: 'item-1' } },
+          UpdateExpression: 'SET #id = :id',
+          ExpressionAttributeNames: { '#id': 'id' },
+          ExpressionAttributeValues: { ':id': { S: 'item-1' } },
+        })
+      )
+      .catch((e) => e)
+    expect(same.name).toBe('ValidationException')
+    expect(same.message).toBe(
+      'One or more parameter values were invalid: Cannot update attribute id. This attribute is part of the key'
+    )
+
+    expect(await getTags(tableName)).toEqual({
+      L: [{ S: 'a' }, { S: 'b' }, { S: 'c' }],
+    })
+  })
+
+  test('a ConditionExpression without an update action is rejected', async () => {
+    // DynamoDB Local accepts this and writes only the key attributes
+    if (process.env.TEST_DYNAMODB_LOCAL === 'true') {
+      return
+    }
+    const tableName = await createListItem()
+
+    const error = await client
+      .send(
+        new UpdateItemCommand({
+          TableName: tableName,
+          Key: { id: { S: 'item-1' } },
+          ConditionExpression: 'attribute_exists(id)',
+        })
+      )
+      .catch((e) => e)
+    expect(error.name).toBe('ValidationException')
+    expect(error.message).toContain('requires an UpdateExpression')
+  })
+
+  test('aliases apply at every segment of a nested path', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('Aliases'))
+    await createTable(client, tableName)
+    await client.send(
+      new PutItemCommand({
+        TableName: tableName,
+        Item: {
+          id: { S: 'item-1' },
+          config: { M: { status: { S: 'draft' } } },
+        },
+      })
+    )
+    const names = { '#status': 'status' }
+
+    await client.send(
+      new UpdateItemCommand({
+        TableName: tableName,
+        Key: { id: { S: 'item-1' } },
+        UpdateExpression: 'SET config.#status = :published',
+        ConditionExpression: 'config.#status = :draft',
+        ExpressionAttributeNames: names,
+        ExpressionAttributeValues: {
+          ':draft': { S: 'draft' },
+          ':published': { S: 'published' },
+        },
+      })
+    )
+
+    const response = await client.send(
+      new GetItemCommand({
+        TableName: tableName,
+        Key: { id: { S: 'item-1' } },
+        ProjectionExpression: 'config.#status',
+        ExpressionAttributeNames: names,
+      })
+    )
+    expect(response.Item).toEqual({
+      config: { M: { status: { S: 'published' } } },
+    })
+
+    // The guard now fails because the nested value changed
+    await expect(
+      client.send(
+        new UpdateItemCommand({
+          TableName: tableName,
+          Key: { id: { S: 'item-1' } },
+          UpdateExpression: 'SET config.#status = :published',
+          ConditionExpression: 'config.#status = :draft',
+          ExpressionAttributeNames: names,
+          ExpressionAttributeValues: {
+            ':draft': { S: 'draft' },
+            ':published': { S: 'published' },
+          },
+        })
+      )
+    ).rejects.toHaveProperty('name', 'ConditionalCheckFailedException')
+  })
+
+  test('a path through a missing element is invalid for update', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('DocPaths'))
+    await createTable(client, tableName)
+    const Key = { id: { S: 'item-1' } }
+    await client.send(
+      new PutItemCommand({
+        TableName: tableName,
+        Item: {
+          ...Key,
+          a: { M: { b: { L: [{ S: 'x' }, { M: { c: { N: '1' } } }] } } },
+        },
+      })
+    )
+    const update = (UpdateExpression: string, ConditionExpression?: string) =>
+      client.send(
+        new UpdateItemCommand({
+          TableName: tableName,
+          Key,
+          UpdateExpression,
+          ConditionExpression,
+          ExpressionAttributeValues: { ':v': { N: '2' } },
+          ReturnValues: 'UPDATED_NEW',
+        })
+      )
+
+    const updated = await update('SET a.b[1].c = :v', 'a.b[1].c < :v')
+    expect(updated.Attributes).toEqual({
+      a: { M: { b: { L: [{ M: { c: { N: '2' } } }] } } },
+    })
+
+    // A condition reads a missing intermediate as a missing attribute
+    const guarded = await update(
+      'SET a.b[1].d = :v',
+      'attribute_not_exists(a.z.c)'
+    )
+    expect(guarded.Attributes).toEqual({
+      a: { M: { b: { L: [{ M: { d: { N: '2' } } }] } } },
+    })
+
+    // Missing map keys and list elements, and elements of the wrong type
+    for (const path of ['a.z.c', 'a.b[5].c', 'a.b[0].c', 'missing[0]']) {
+      const error = await update(`SET ${path} = :v`).catch((e) => e)
+      expect(error.name).toBe('ValidationException')
+      expect(error.message).toBe(
+        'The document path provided in the update expression is invalid for update'
+      )
+    }
+  })
+
+  test('update actions may not write overlapping paths', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('Overlap'))
+    await createTable(client, tableName)
+    const update = (UpdateExpression: string) =>
+      client.send(
+        new UpdateItemCommand({
+          TableName: tableName,
+          Key: { id: { S: 'item-1' } },
+          UpdateExpression,
+          ExpressionAttributeNames: { '#a': 'a' },
+          ExpressionAttributeValues: { ':v': { N: '1' } },
+        })
+      )
+
+    const overlap = await update('SET a.b = :v REMOVE #a').catch((e) => e)
+    expect(overlap.name).toBe('ValidationException')
+    expect(overlap.message).toBe(
+      'Invalid UpdateExpression: Two document paths overlap with each other; must remove or rewrite one of these paths; path one: [a, b], path two: [a]'
+    )
+
+    const conflict = await update('SET a.b = :v, #a[0] = :v').catch((e) => e)
+    expect(conflict.name).toBe('ValidationException')
+    expect(conflict.message).toContain('Two document paths conflict')
+  })
+
+  test('SET values read the item as it was before the update', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('SetValues'))
+    await createTable(client, tableName)
+    const Key = { id: { S: 'item-1' } }
+    await client.send(
+      new PutItemCommand({
+        TableName: tableName,
+        Item: { ...Key, a: { N: '1' }, b: { N: '2' }, price: { N: '0.1' } },
+      })
+    )
+
+    const response = await client.send(
+      new UpdateItemCommand({
+        TableName: tableName,
+        Key,
+        UpdateExpression:
+          'SET a = b, b = a, price = price + :cents, ' +
+          'history = list_append(if_not_exists(history, :empty), :entry), ' +
+          'remaining = :ten - if_not_exists(spent, :zero)',
+        ExpressionAttributeValues: {
+          ':cents': { N: '0.2' },
+          ':empty': { L: [] },
+          ':entry': { L: [{ S: 'swapped' }] },
+          ':ten': { N: '10' },
+          ':zero': { N: '0' },
+        },
+        ReturnValues: 'ALL_NEW',
+      })
+    )
+    // Arithmetic is decimal, so 0.1 + 0.2 is exactly 0.3
+    expect(response.Attributes).toEqual({
+      ...Key,
+      a: { N: '2' },
+      b: { N: '1' },
+      price: { N: '0.3' },
+      history: { L: [{ S: 'swapped' }] },
+      remaining: { N: '10' },
+    })
+  })
+
+  test('operands of the wrong type or missing are rejected', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('Operands'))
+    await createTable(client, tableName)
+    const Key = { id: { S: 'item-1' } }
+    await client.send(
+      new PutItemCommand({
+        TableName: tableName,
+        Item: { ...Key, name: { S: 'x' } },
+      })
+    )
+    const update = (UpdateExpression: string) =>
+      client
+        .send(
+          new UpdateItemCommand({
+            TableName: tableName,
+            Key,
+            UpdateExpression,
+            // DynamoDB rejects names an expression does not use
+            ...(UpdateExpression.includes('#name') && {
+              ExpressionAttributeNames: { '#name': 'name' },
+            }),
+            ExpressionAttributeValues: { ':v': { N: '1' } },
+          })
+        )
+        .catch((e) => e)
+
+    const missing = await update('SET n = n + :v')
+    expect(missing.name).toBe('ValidationException')
+    expect(missing.message).toBe(
+      'The provided expression refers to an attribute that does not exist in the item'
+    )
+
+    for (const expression of [
+      'SET n = #name + :v',
+      'ADD #name :v',
+      'SET l = list_append(#name, :v)',
+    ]) {
+      const error = await update(expression)
+      expect(error.name).toBe('ValidationException')
+      expect(error.message).toMatch(/incorrect data type|operand type: S/)
+    }
+
+    const twice = await update('SET a = :v REMOVE b SET c = :v')
+    expect(twice.name).toBe('ValidationException')
+    expect(twice.message).toBe(
+      'Invalid UpdateExpression: The "SET" section can only be used once in an update expression;'
+    )
+  })
+
+  test('concurrent ADD to a string set keeps every element', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('SetAdd'))
+    await createTable(client, tableName)
+    const tags = Array.from({ length: 50 }, (_, i) => `tag-${i}`)
+
+    await Promise.all(
+      tags.map((tag) =>
+        client.send(
+          new UpdateItemCommand({
+            TableName: tableName,
+            Key: { id: { S: 'item-1' } },
+            UpdateExpression: 'ADD tags :tag',
+            ExpressionAttributeValues: { ':tag': { SS: [tag] } },
+          })
+        )
+      )
+    )
+
+    const response = await client.send(
+      new GetItemCommand({ TableName: tableName, Key: { id: { S: 'item-1' } } })
+    )
+    expect(response.Item!.tags!.SS!.sort()).toEqual([...tags].sort())
+  })
+
+  test('ADD to a missing key creates the item with the number', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('Upsert'))
+    await createTable(client, tableName)
+
+    // COUNT is a reserved word, so it needs an alias
+    const response = await client.send(
+      new UpdateItemCommand({
+        TableName: tableName,
+        Key: { id: { S: 'counter-1' } },
+        UpdateExpression: 'ADD #count :n',
+        ExpressionAttributeNames: { '#count': 'count' },
+        ExpressionAttributeValues: { ':n': { N: '5' } },
+        ReturnValues: 'ALL_NEW',
+      })
+    )
+    expect(response.Attributes).toEqual({
+      id: { S: 'counter-1' },
+      count: { N: '5' },
+    })
+
+    const { Item } = await client.send(
+      new GetItemCommand({
+        TableName: tableName,
+        Key: { id: { S: 'counter-1' } },
+      })
+    )
+    expect(Item).toEqual({ id: { S: 'counter-1' }, count: { N: '5' } })
+  })
+
+  test('DELETE of the last set elements removes the attribute', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('SetDelete'))
+    await createTable(client, tableName)
+    await client.send(
+      new PutItemCommand({
+        TableName: tableName,
+        Item: { id: { S: 'item-1' }, tags: { SS: ['a', 'b', 'c'] } },
+      })
+    )
+    const deleteTags = (tags: string[]) =>
+      client.send(
+        new UpdateItemCommand({
+          TableName: tableName,
+          Key: { id: { S: 'item-1' } },
+          UpdateExpression: 'DELETE tags :t',
+          ExpressionAttributeValues: { ':t': { SS: tags } },
+        })
+      )
+
+    await deleteTags(['b', 'z'])
+    expect((await getTags(tableName))!.SS!.sort()).toEqual(['a', 'c'])
+
+    await deleteTags(['a', 'c'])
+    expect(await getTags(tableName)).toBeUndefined()
+  })
+
+  test('empty sets are rejected on write', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('EmptySet'))
+    await createTable(client, tableName)
+
+    const put = await client
+      .send(
+        new PutItemCommand({
+          TableName: tableName,
+          Item: { id: { S: 'item-1' }, tags: { SS: [] } },
+        })
+      )
+      .catch((e) => e)
+    expect(put.name).toBe('ValidationException')
+    expect(put.message).toContain('empty')
+
+    const update = await client
+      .send(
+        new UpdateItemCommand({
+          TableName: tableName,
+          Key: { id: { S: 'item-1' } },
+          UpdateExpression: 'SET tags = :t',
+          ExpressionAttributeValues: { ':t': { NS: [] } },
+        })
+      )
+      .catch((e) => e)
+    expect(update.name).toBe('ValidationException')
+    expect(update.message).toContain('empty')
+  })
+
+  test('sets with repeated elements are rejected on write', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('DupSet'))
+    await createTable(client, tableName)
+
+    const put = await client
+      .send(
+        new PutItemCommand({
+          TableName: tableName,
+          Item: { id: { S: 'item-1' }, tags: { SS: ['a', 'b', 'a'] } },
+        })
+      )
+      .catch((e) => e)
+    expect(put.name).toBe('ValidationException')
+    expect(put.message).toBe(
+      'One or more parameter values were invalid: Input collection [a, b, a] contains duplicates.'
+    )
+
+    // Numbers repeat when their values are equal, however they are written
+    const update = await client
+      .send(
+        new UpdateItemCommand({
+          TableName: tableName,
+          Key: { id: { S: 'item-1' } },
+          UpdateExpression: 'ADD scores :s',
+          ExpressionAttributeValues: { ':s': { NS: ['1', '1.0'] } },
+        })
+      )
+      .catch((e) => e)
+    expect(update.name).toBe('ValidationException')
+    expect(update.message).toContain('contains duplicates')
+  })
+
+  test('ADD and DELETE match number set elements by value', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('NumberSet'))
+    await createTable(client, tableName)
+    const Key = { id: { S: 'item-1' } }
+    const update = async (UpdateExpression: string, scores: string[]) =>
+      (
+        await client.send(
+          new UpdateItemCommand({
+            TableName: tableName,
+            Key,
+            UpdateExpression,
+            ExpressionAttributeValues: { ':s': { NS: scores } },
+            ReturnValues: 'ALL_NEW',
+          })
+        )
+      ).Attributes?.scores?.NS?.map(Number).sort((a, b) => a - b)
+
+    expect(await update('ADD scores :s', ['1', '2'])).toEqual([1, 2])
+    expect(await update('ADD scores :s', ['2.0', '3'])).toEqual([1, 2, 3])
+    expect(await update('DELETE scores :s', ['1.00', '30e-1'])).toEqual([2])
+  })
+
+  test('list_append past 400KB fails on the resulting item size', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('ItemSize'))
+    await createTable(client, tableName)
+    const chunk = 'x'.repeat(150 * 1024)
+
+    // Two chunks stay under the limit
+    await client.send(
+      new PutItemCommand({
+        TableName: tableName,
+        Item: {
+          id: { S: 'item-1' },
+          chunks: { L: [{ S: chunk }, { S: chunk }] },
+        },
+      })
+    )
+
+    // The request itself is small next to the limit; the third chunk is not
+    const error = await client
+      .send(
+        new UpdateItemCommand({
+          TableName: tableName,
+          Key: { id: { S: 'item-1' } },
+          UpdateExpression: 'SET chunks = list_append(chunks, :more)',
+          ExpressionAttributeValues: { ':more': { L: [{ S: chunk }] } },
+        })
+      )
+      .catch((e) => e)
+    expect(error.name).toBe('ValidationException')
+    expect(error.message).toContain('exceeded the maximum allowed size')
+
+    const response = await client.send(
+      new GetItemCommand({ TableName: tableName, Key: { id: { S: 'item-1' } } })
+    )
+    expect(response.Item!.chunks!.L).toHaveLength(2)
+  })
+
+  test('UPDATED_OLD and UPDATED_NEW return only the written paths', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('Updated'))
+    await createTable(client, tableName)
+    const Key = { id: { S: 'item-1' } }
+    await client.send(
+      new PutItemCommand({
+        TableName: tableName,
+        Item: {
+          ...Key,
+          count: { N: '1' },
+          stale: { S: 'x' },
+          other: { S: 'kept' },
+          profile: { M: { name: { S: 'ann' }, age: { N: '30' } } },
+        },
+      })
+    )
+    const update = (ReturnValues: 'UPDATED_OLD' | 'UPDATED_NEW') =>
+      client.send(
+        new UpdateItemCommand({
+          TableName: tableName,
+          Key,
+          UpdateExpression:
+            'SET #p.age = :age, added = :added REMOVE stale ADD #c :one',
+          ExpressionAttributeNames: { '#p': 'profile', '#c': 'count' },
+          ExpressionAttributeValues: {
+            ':age': { N: '31' },
+            ':added': { S: 'new' },
+            ':one': { N: '1' },
+          },
+          ReturnValues,
+        })
+      )
+
+    // Attributes the update adds are missing from the old side, and the
+    // ones it removes from the new side
+    const old = await update('UPDATED_OLD')
+    expect(old.Attributes).toEqual({
+      count: { N: '1' },
+      stale: { S: 'x' },
+      profile: { M: { age: { N: '30' } } },
+    })
+    const updated = await update('UPDATED_NEW')
+    expect(updated.Attributes).toEqual({
+      count: { N: '3' },
+      added: { S: 'new' },
+      profile: { M: { age: { N: '31' } } },
+    })
+
+    // Nothing written before the update means nothing to return
+    const created = await client.send(
+      new UpdateItemCommand({
+        TableName: tableName,
+        Key: { id: { S: 'item-2' } },
+        UpdateExpression: 'SET v = :v',
+        ExpressionAttributeValues: { ':v': { N: '1' } },
+        ReturnValues: 'UPDATED_OLD',
+      })
+    )
+    expect(created.Attributes).toBeUndefined()
+  })
+
+  test('ReturnValues must suit the operation', async () => {
+    const tableName = trackTable(createdTables, uniqueTableName('Returns'))
+    await createTable(client, tableName)
+    const Key = { id: { S: 'item-1' } }
+
+    // PutItem and DeleteItem only return the item they replace
+    const put = await client
+      .send(
+        new PutItemCommand({
+          TableName: tableName,
+          Item: Key,
+          ReturnValues: 'ALL_NEW',
+        })
+      )
+      .catch((e) => e)
+    expect(put.name).toBe('ValidationException')
+    expect(put.message).toBe('Return values set to invalid value')
+    const deleted = await client
+      .send(
+        new DeleteItemCommand({
+          TableName: tableName,
+          Key,
+          ReturnValues: 'UPDATED_OLD',
+        })
+      )
+      .catch((e) => e)
+    expect(deleted.name).toBe('ValidationException')
+
+    const update = await client
+      .send(
+        new UpdateItemCommand({
+          TableName: tableName,
+          Key,
+          UpdateExpression: 'SET v = :v',
+          ExpressionAttributeValues: { ':v': { N: '1' } },
+          ReturnValues: 'EVERYTHING' as any,
+        })
+      )
+      .catch((e) => e)
+    expect(update.name).toBe('ValidationException')
+    expect(update.message).toContain('Member must satisfy enum value set')
+
+    // ALL_OLD without an old item returns nothing
+    const created = await client.send(
+      new PutItemCommand({
+        TableName: tableName,
+        Item: Key,
+        ReturnValues: 'ALL_OLD',
+      })
+    )
+    expect(created.Attributes).toBeUndefined()
+  })
+})
@@ -0,0 +1,732 @@
+// Tests for request validation errors
+// Uses HTTP API via AWS SDK
+
+import { test, expect, beforeAll, afterEach, describe } from 'bun:test'
+import {
+  type AttributeValue,
+  DynamoDBClient,
+  BatchGetItemCommand,
+  BatchWriteItemCommand,
+  GetItemCommand,
+  PutItemCommand,
+  UpdateItemCommand,
+  QueryCommand,
+  ScanCommand,
+  TransactGetItemsCommand,
+  TransactWriteItemsCommand,
+} from '@aws-sdk/client-dynamodb'
+import {
+  getGlobalTestDB,
+  createTable,
+  createTableWithItems,
+  cleanupTables,
+  startDynado,
+  uniqueTableName,
+  trackTable,
+} from './helpers.ts'
+
+describe('Request validation', () => {
+  let client: DynamoDBClient
+  const createdTables: string[] = []
+
+  beforeAll(async () => {
+    const testDB = await getGlobalTestDB()
+    client = testDB.client
+  })
+
+  afterEach(async () => {
+    await cleanupTables(client, createdTables)
+  })
+
+  async function expectValidationError(promise: Promise<unknown>) {
+    const error = await promise.catch((e) => e)
+    expect(error.name).toBe('ValidationException')
+    expect(error.message).toContain(
+      'must have length greater than or equal to 1'
+    )
+  }
+
+  describe('empty inputs', () => {
+    test('TransactWriteItems with no items', async () => {
+      await expectValidationError(
+        client.send(new TransactWriteItemsCommand({ TransactItems: [] }))
+      )
+    })
+
+    test('TransactGetItems with no items', async () => {
+      await expectValidationError(
+        client.send(new TransactGetItemsCommand({ TransactItems: [] }))
+      )
+    })
+
+    test('BatchWriteItem with no tables', async () => {
+      await expectValidationError(
+        client.send(new BatchWriteItemCommand({ RequestItems: {} }))
+      )
+    })
+
+    test('BatchWriteItem with no requests for a table', async () => {
+      const tableName = trackTable(createdTables, uniqueTableName('Empty'))
+      await createTable(client, tableName)
+
+      await expectValidationError(
+        client.send(
+          new BatchWriteItemCommand({ RequestItems: { [tableName]: [] } })
+        )
+      )
+    })
+
+    test('BatchGetItem with no tables', async () => {
+      await expectValidationError(
+        client.send(new BatchGetItemCommand({ RequestItems: {} }))
+      )
+    })
+
+    test('BatchGetItem with no keys for a table', async () => {
+      const tableName = trackTable(createdTables, uniqueTableName('Empty'))
+      await createTable(client, tableName)
+
+      await expectValidationError(
+        client.send(
+          new BatchGetItemCommand({
+            RequestItems: { [tableName]: { Keys: [] } },
+          })
+        )
+      )
+    })
+  })
+
+  describe('key schema', () => {
+    async function createCompositeTable(): Promise<string> {
+      const tableName = trackTable(createdTables, uniqueTableName('KeyShape'))
+      return await createTable(client, tableName, {
+        keySchema: [
+          { AttributeName: 'pk', KeyType: 'HASH' },
+          { AttributeName: 'sk', KeyType: 'RANGE' },
+        ],
+        attributeDefinitions: [
+          { AttributeName: 'pk', AttributeType: 'S' },
+          { AttributeName: 'sk', AttributeType: 'S' },
+        ],
+      })
+    }
+
+    test('GetItem rejects a Key with extra attributes', async () => {
+      const tableName = await createCompositeTable()
+
+      const error = await client
+        .send(
+          new GetItemCommand({
+            TableName: tableName,
+            Key: { pk: { S: 'a' }, sk: { S: 'b' }, extra: { S: 'c' } },
+          })
+        )
+        .catch((e) => e)
+      expect(error.name).toBe('ValidationException')
+      expect(error.message).toBe(
+        'The provided key element does not match the schema'
+      )
+    })
+
+    test('GetItem rejects a Key missing the sort key', async () => {
+      const tableName = await createCompositeTable()
+
+      const error = await client
+        .send(
+          new GetItemCommand({ TableName: tableName, Key: { pk: { S: 'a' } } })
+        )
+        .catch((e) => e)
+      expect(error.name).toBe('ValidationException')
+      expect(error.message).toBe(
+        'The provided key element does not match the schema'
+      )
+    })
+
+    test('Query rejects a partition key value of the wrong type', async () => {
+      const tableName = trackTable(createdTables, uniqueTableName('KeyType'))
+      await createTable(client, tableName)
+
+      const error = await client
+        .send(
+          new QueryCommand({
+            TableName: tableName,
+            KeyConditionExpression: 'id = :id',
+            ExpressionAttributeValues: { ':id': { N: '1' } },
+          })
+        )
+        .catch((e) => e)
+      expect(error.name).toBe('ValidationException')
+      expect(error.message).toContain(
+        'Condition parameter type does not match schema type'
+      )
+    })
+
+    test('PutItem rejects a key attribute of the wrong type', async () => {
+      const tableName = await createCompositeTable()
+
+      const error = await client
+        .send(
+          new PutItemCommand({
+            TableName: tableName,
+            Item: { pk: { S: 'a' }, sk: { B: new Uint8Array([1]) } },
+          })
+        )
+        .catch((e) => e)
+      expect(error.name).toBe('ValidationException')
+      expect(error.message).toBe(
+        'One or more parameter values were invalid: Type mismatch for key sk expected: S actual: B'
+      )
+    })
+
+    test('PutItem rejects an empty binary key', async () => {
+      const tableName = trackTable(createdTables, uniqueTableName('EmptyKey'))
+      await createTable(client, tableName, {
+        attributeDefinitions: [{ AttributeName: 'id', AttributeType: 'B' }],
+      })
+
+      const error = await client
+        .send(
+          new PutItemCommand({
+            TableName: tableName,
+            Item: { id: { B: new Uint8Array() } },
+          })
+        )
+        .catch((e) => e)
+      expect(error.name).toBe('ValidationException')
+      expect(error.message).toBe(
+        'One or more parameter values are not valid. The AttributeValue for a key attribute cannot contain an empty binary value. Key: id'
+      )
+    })
+  })
+
+  describe('BETWEEN bounds', () => {
+    test('Query rejects a key condition with lower > upper', async () => {
+      const tableName = trackTable(createdTables, uniqueTableName('Between'))
+      await createTable(client, tableName, {
+        keySchema: [
+          { AttributeName: 'pk', KeyType: 'HASH' },
+          { AttributeName: 'n', KeyType: 'RANGE' },
+        ],
+        attributeDefinitions: [
+          { AttributeName: 'pk', AttributeType: 'S' },
+          { AttributeName: 'n', AttributeType: 'N' },
+        ],
+      })
+
+      await expect(
+        client.send(
+          new QueryCommand({
+            TableName: tableName,
+            KeyConditionExpression: 'pk = :pk AND n BETWEEN :a AND :b',
+            ExpressionAttributeValues: {
+              ':pk': { S: 'p' },
+              ':a': { N: '10' },
+              ':b': { N: '2' },
+            },
+          })
+        )
+      ).rejects.toHaveProperty('name', 'ValidationException')
+    })
+
+    test('Scan rejects a filter with lower > upper', async () => {
+      const tableName = trackTable(createdTables, uniqueTableName('Between'))
+      await createTable(client, tableName)
+
+      await expect(
+        client.send(
+          new ScanCommand({
+            TableName: tableName,
+            FilterExpression: 'title BETWEEN :a AND :b',
+            ExpressionAttributeValues: {
+              ':a': { S: 'zebra' },
+              ':b': { S: 'apple' },
+            },
+          })
+        )
+      ).rejects.toHaveProperty('name', 'ValidationException')
+    })
+
+    test('number bounds are compared digit by digit', async () => {
+      const tableName = trackTable(createdTables, uniqueTableName('Between'))
+      await createTable(client, tableName)
+      // 38 digits, equal as floats, differing only in the last digit
+      const smaller = '12345678901234567890123456789012345678'
+      const larger = '12345678901234567890123456789012345679'
+      const scan = (lower: string, upper: string) =>
+        client.send(
+          new ScanCommand({
+            TableName: tableName,
+            FilterExpression: 'n BETWEEN :a AND :b',
+            ExpressionAttributeValues: {
+              ':a': { N: lower },
+              ':b': { N: upper },
+            },
+          })
+        )
+
+      await expect(scan(larger, smaller)).rejects.toHaveProperty(
+        'name',
+        'ValidationException'
+      )
+      await expect(scan(smaller, larger)).resolves.toBeDefined()
+      await expect(scan('-0.5', '-0.25')).resolves.toBeDefined()
+      await expect(scan('1e2', '99')).rejects.toHaveProperty(
+        'name',
+        'ValidationException'
+      )
+    })
+  })
+
+  describe('ExpressionAttributeNames', () => {
+    test('two aliases may name distinct attributes', async () => {
+      const tableName = trackTable(createdTables, uniqueTableName('Aliases'))
+      await createTable(client, tableName)
+      await client.send(
+        new PutItemCommand({
+          TableName: tableName,
+          Item: { id: { S: 'item-1' } },
+        })
+      )
+
+      await client.send(
+        new UpdateItemCommand({
+          TableName: tableName,
+          Key: { id: { S: 'item-1' } },
+          UpdateExpression: 'SET #a = :a, #b = :b',
+          ExpressionAttributeNames: { '#a': 'first', '#b': 'second' },
+          ExpressionAttributeValues: { ':a': { S: 'A' }, ':b': { S: 'B' } },
+        })
+      )
+
+      const response = await client.send(
+        new GetItemCommand({
+          TableName: tableName,
+          Key: { id: { S: 'item-1' } },
+        })
+      )
+      expect(response.Item).toEqual({
+        id: { S: 'item-1' },
+        first: { S: 'A' },
+        second: { S: 'B' },
+      })
+    })
+
+    test('a self-referential alias is rejected', async () => {
+      // DynamoDB accepts any string as an attribute name
+      if (process.env.TEST_DYNAMODB_LOCAL === 'true') {
+        return
+      }
+
+      const tableName = trackTable(createdTables, uniqueTableName('Aliases'))
+      await createTable(client, tableName)
+
+      await expect(
+        client.send(
+          new UpdateItemCommand({
+            TableName: tableName,
+            Key: { id: { S: 'item-1' } },
+            UpdateExpression: 'SET #a = :a',
+            ExpressionAttributeNames: { '#a': '#a' },
+            ExpressionAttributeValues: { ':a': { S: 'A' } },
+          })
+        )
+      ).rejects.toHaveProperty('name', 'ValidationException')
+    })
+
+    test('an undeclared alias is rejected', async () => {
+      const tableName = trackTable(createdTables, uniqueTableName('Aliases'))
+      await createTable(client, tableName)
+
+      await expect(
+        client.send(
+          new UpdateItemCommand({
+            TableName: tableName,
+            Key: { id: { S: 'item-1' } },
+            UpdateExpression: 'SET #missing = :a',
+            ExpressionAttributeValues: { ':a': { S: 'A' } },
+          })
+        )
+      ).rejects.toHaveProperty('name', 'ValidationException')
+    })
+  })
+
+  describe('expression errors', () => {
+    // Sends SET <expression> with :a declared
+    async function update(updateExpression: string) {
+      const tableName = trackTable(createdTables, uniqueTableName('Exprs'))
+      await createTable(client, tableName)
+      return client
+        .send(
+          new UpdateItemCommand({
+            TableName: tableName,
+            Key: { id: { S: 'item-1' } },
+            UpdateExpression: updateExpression,
+            ExpressionAttributeValues: { ':a': { S: 'A' } },
+          })
+        )
+        .catch((e) => e)
+    }
+
+    test('a malformed expression is a syntax error', async () => {
+      const error = await update('SET a =')
+      expect(error.name).toBe('ValidationException')
+      expect(error.message).toContain('Invalid UpdateExpression: Syntax error')
+    })
+
+    test('an undefined placeholder is a semantic error', async () => {
+      const error = await update('SET a = :a, b = :missing')
+      expect(error.name).toBe('ValidationException')
+      expect(error.message).toBe(
+        'Invalid UpdateExpression: An expression attribute value used in expression is not defined; attribute value: :missing'
+      )
+    })
+
+    test('a syntax error is reported before an undefined placeholder', async () => {
+      const error = await update('SET a = :missing,')
+      expect(error.message).toContain('Invalid UpdateExpression: Syntax error')
+    })
+  })
+
+  describe('BatchWriteItem limits', () => {
+    async function createTwoTables(): Promise<[string, string]> {
+      const first = trackTable(createdTables, uniqueTableName('BatchA'))
+      const second = trackTable(createdTables, uniqueTableName('BatchB'))
+      await createTable(client, first)
+      await createTable(client, second)
+      return [first, second]
+    }
+
+    function puts(count: number, prefix: string) {
+      return Array.from({ length: count }, (_, i) => ({
+        PutRequest: { Item: { id: { S: `${prefix}-${i}` } } },
+      }))
+    }
+
+    test('26 writes across two tables exceed the combined limit', async () => {
+      const [first, second] = await createTwoTables()
+
+      const error = await client
+        .send(
+          new BatchWriteItemCommand({
+            RequestItems: { [first]: puts(13, 'a'), [second]: puts(13, 'b') },
+          })
+        )
+        .catch((e) => e)
+      expect(error.name).toBe('ValidationException')
+      expect(error.message).toContain('Too many items requested')
+    })
+
+    test('25 writes across two tables succeed', async () => {
+      const [first, second] = await createTwoTables()
+
+      await client.send(
+        new BatchWriteItemCommand({
+          RequestItems: { [first]: puts(13, 'a'), [second]: puts(12, 'b') },
+        })
+      )
+    })
+  })
+
+  describe('Scan segments', () => {
+    async function createSegmentTable(): Promise<string> {
+      const tableName = trackTable(createdTables, uniqueTableName('Segments'))
+      return await createTableWithItems(
+        client,
+        tableName,
+        Array.from({ length: 20 }, (_, i) => ({ id: `item-${i}` }))
+      )
+    }
+
+    test('Segment without TotalSegments is rejected', async () => {
+      const tableName = await createSegmentTable()
+
+      const error = await client
+        .send(new ScanCommand({ TableName: tableName, Segment: 0 }))
+        .catch((e) => e)
+      expect(error.name).toBe('ValidationException')
+      expect(error.message).toContain('TotalSegments')
+    })
+
+    test('Segment must be less than TotalSegments', async () => {
+      const tableName = await createSegmentTable()
+
+      await expect(
+        client.send(
+          new ScanCommand({
+            TableName: tableName,
+            Segment: 2,
+            TotalSegments: 2,
+          })
+        )
+      ).rejects.toHaveProperty('name', 'ValidationException')
+    })
+
+    test('a single segment scans the whole table', async () => {
+      const tableName = await createSegmentTable()
+
+      const response = await client.send(
+        new ScanCommand({ TableName: tableName, Segment: 0, TotalSegments: 1 })
+      )
+      expect(response.Count).toBe(20)
+    })
+
+    test('segments partition the table', async () => {
+      const tableName = await createSegmentTable()
+
+      const ids: string[] = []
+      for (let segment = 0; segment < 4; segment++) {
+        const response = await client.send(
+          new ScanCommand({
+            TableName: tableName,
+            Segment: segment,
+            TotalSegments: 4,
+          })
+        )
+        ids.push(...response.Items!.map((item) => item.id!.S!))
+      }
+      expect(ids.sort()).toEqual(
+        Array.from({ length: 20 }, (_, i) => `item-${i}`).sort()
+      )
+    })
+
+    test('segments read in order match a full scan', async () => {
+      // DynamoDB Local hands out segments in its own order
+      if (process.env.TEST_DYNAMODB_LOCAL === 'true') {
+        return
+      }
+      const tableName = await createSegmentTable()
+      const full = await client.send(new ScanCommand({ TableName: tableName }))
+
+      // Each segment pages on its own, resuming inside that segment
+      const items: Record<string, AttributeValue>[] = []
+      for (let segment = 0; segment < 3; segment++) {
+        let startKey: Record<string, AttributeValue> | undefined
+        do {
+          const page = await client.send(
+            new ScanCommand({
+              TableName: tableName,
+              Segment: segment,
+              TotalSegments: 3,
+              Limit: 2,
+              ExclusiveStartKey: startKey,
+            })
+          )
+          items.push(...page.Items!)
+          startKey = page.LastEvaluatedKey
+        } while (startKey)
+      }
+      expect(items).toEqual(full.Items!)
+    })
+  })
+
+  describe('document nesting', () => {
+    // Alternates maps and lists so both container types count
+    function nested(levels: number): AttributeValue {
+      let value: AttributeValue = { S: 'leaf' }
+      for (let level = 0; level < levels; level++) {
+        value = level % 2 === 0 ? { M: { child: value } } : { L: [value] }
+      }
+      return value
+    }
+
+    test('32 levels round-trip', async () => {
+      const tableName = trackTable(createdTables, uniqueTableName('Nesting'))
+      await createTable(client, tableName)
+      const item = { id: { S: 'deep' }, doc: nested(32) }
+
+      await client.send(
+        new PutItemCommand({ TableName: tableName, Item: item })
+      )
+
+      const response = await client.send(
+        new GetItemCommand({ TableName: tableName, Key: { id: { S: 'deep' } } })
+      )
+      expect(response.Item).toEqual(item)
+    })
+
+    test('33 levels are rejected on PutItem', async () => {
+      const tableName = trackTable(createdTables, uniqueTableName('Nesting'))
+      await createTable(client, tableName)
+
+      await expect(
+        client.send(
+          new PutItemCommand({
+            TableName: tableName,
+            Item: { id: { S: 'too-deep' }, doc: nested(33) },
+          })
+        )
+      ).rejects.toHaveProperty('name', 'ValidationException')
+    })
+  })
+
+  describe('error codes', () => {
+    // DynadoErrorCode is a dynado extension to the error payload
+    if (process.env.TEST_DYNAMODB_LOCAL === 'true') {
+      return
+    }
+
+    // 33 levels of maps, one more than DynamoDB allows
+    let tooDeep: AttributeValue = { S: 'leaf' }
+    for (let level = 0; level < 33; level++) {
+      tooDeep = { M: { child: tooDeep } }
+    }
+
+    const cases: Array<{
+      name: string
+      code: string
+      send: (tableName: string) => Promise<unknown>
+    }> = [
+      {
+        name: 'a Key naming the wrong attribute',
+        code: 'SCHEMA_MISMATCH',
+        send: (tableName) =>
+          client.send(
+            new GetItemCommand({
+              TableName: tableName,
+              Key: { other: { S: 'item-1' } },
+            })
+          ),
+      },
+      {
+        name: 'a reserved word used as an attribute name',
+        code: 'RESERVED_WORD',
+        send: (tableName) =>
+          client.send(
+            new UpdateItemCommand({
+              TableName: tableName,
+              Key: { id: { S: 'item-1' } },
+              UpdateExpression: 'SET status = :s',
+              ExpressionAttributeValues: { ':s': { S: 'active' } },
+            })
+          ),
+      },
+      {
+        name: 'an unterminated condition expression',
+        code: 'EXPRESSION_SYNTAX',
+        send: (tableName) =>
+          client.send(
+            new PutItemCommand({
+              TableName: tableName,
+              Item: { id: { S: 'item-2' } },
+              ConditionExpression: 'attribute_not_exists(id',
+            })
+          ),
+      },
+      {
+        name: 'AttributesToGet with a ProjectionExpression',
+        code: 'EXPRESSION_SYNTAX',
+        send: (tableName) =>
+          client.send(
+            new GetItemCommand({
+              TableName: tableName,
+              Key: { id: { S: 'item-1' } },
+              AttributesToGet: ['id'],
+              ProjectionExpression: 'id',
+            })
+          ),
+      },
+      {
+        name: 'two conditions on the sort key',
+        code: 'EXPRESSION_SYNTAX',
+        send: (tableName) =>
+          client.send(
+            new QueryCommand({
+              TableName: tableName,
+              KeyConditionExpression: 'id = :id AND n > :lo AND n < :hi',
+              ExpressionAttributeValues: {
+                ':id': { S: 'item-1' },
+                ':lo': { N: '1' },
+                ':hi': { N: '5' },
+              },
+            })
+          ),
+      },
+      {
+        name: 'an item nested past the depth limit',
+        code: 'SIZE_LIMIT',
+        send: (tableName) =>
+          client.send(
+            new PutItemCommand({
+              TableName: tableName,
+              Item: { id: { S: 'item-3' }, doc: tooDeep },
+            })
+          ),
+      },
+      {
+        name: 'ADD of a number set to a string set',
+        code: 'TYPE_MISMATCH',
+        send: (tableName) =>
+          client.send(
+            new UpdateItemCommand({
+              TableName: tableName,
+              Key: { id: { S: 'item-1' } },
+              UpdateExpression: 'ADD tags :n',
+              ExpressionAttributeValues: { ':n': { NS: ['1'] } },
+            })
+          ),
+      },
+    ]
+
+    for (const { name, code, send } of cases) {
+      test(`${name} reports ${code}`, async () => {
+        const tableName = trackTable(createdTables, uniqueTableName('Codes'))
+        await createTable(client, tableName)
+        await client.send(
+          new PutItemCommand({
+            TableName: tableName,
+            Item: { id: { S: 'item-1' }, tags: { SS: ['a'] } },
+          })
+        )
+
+        const error = await send(tableName).catch((e) => e)
+        expect(error.name).toBe('ValidationException')
+        expect(error.DynadoErrorCode).toBe(code)
+      })
+    }
+  })
+})
+
+describe('Request body size', () => {
+  // DynamoDB Local's body limit cannot be lowered to MAX_REQUEST_BODY_BYTES
+  if (process.env.TEST_DYNAMODB_LOCAL === 'true') {
+    return
+  }
+
+  test('oversized bodies are rejected without affecting the server', async () => {
+    const { db, client, cleanup } = await startDynado({
+      maxRequestBodyBytes: 1024,
+    })
+    try {
+      const tableName = await createTable(client, uniqueTableName('BodySize'))
+
+      const response = await fetch(`http://localhost:${db.server.port}/`, {
+        method: 'POST',
+        headers: {
+          'x-amz-target': 'DynamoDB_20120810.PutItem',
+          'Content-Type': 'application/x-amz-json-1.0',
+        },
+        body: JSON.stringify({
+          TableName: tableName,
+          Item: { id: { S: 'big' }, payload: { S: 'x'.repeat(4096) } },
+        }),
+      })
+      expect(response.status).toBe(400)
+      const error = (await response.json()) as {
+        __type: string
+        DynadoErrorCode: string
+      }
+      expect(error.__type).toContain('ValidationException')
+      expect(error.DynadoErrorCode).toBe('SIZE_LIMIT')
+
+      // The server keeps serving normal requests
+      await client.send(
+        new PutItemCommand({
+          TableName: tableName,
+          Item: { id: { S: 'small' } },
+        })
+      )
+    } finally {
+      await cleanup()
+    }
+  })
+})